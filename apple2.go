@@ -16,6 +16,7 @@ type Apple2 struct {
 	mmu     *memoryManager
 	io      *ioC0Page
 	video   screen.VideoSource
+	scanner *videoScanner
 	cg      *CharacterGenerator
 	cards       [8]Card
 	tracers     []executionTracer
@@ -43,6 +44,9 @@ type Apple2 struct {
 	cpuTrace             bool
 	forceCaps            bool
 	removableMediaDrives []drive
+	rewind               *rewindBuffer
+	debugger             *Debugger
+	movie                *movie
 
 	currentFreqMHz float64
 }
@@ -75,17 +79,29 @@ func (a *Apple2) requestIRQ(slot int, asserted bool) {
 
 // SetKeyboardProvider attaches an external keyboard provider
 func (a *Apple2) SetKeyboardProvider(kb KeyboardProvider) {
+	if a.movie != nil {
+		a.movie.keyboard = kb
+		return
+	}
 	a.io.setKeyboardProvider(kb)
 }
 
 
 // SetJoysticksProvider attaches an external joysticks provider
 func (a *Apple2) SetJoysticksProvider(j JoysticksProvider) {
+	if a.movie != nil {
+		a.movie.joysticks = j
+		return
+	}
 	a.io.setJoysticksProvider(j)
 }
 
 // SetMouseProvider attaches an external mouse provider
 func (a *Apple2) SetMouseProvider(m MouseProvider) {
+	if a.movie != nil {
+		a.movie.mouse = m
+		return
+	}
 	a.io.setMouseProvider(m)
 }
 
@@ -44,12 +44,10 @@ func (a *Apple2) Start(paused bool) {
 					// a.cpu.SetTrace(pc >= 0xc700 && pc < 0xc800)
 
 					// Execution
-					startCycles := a.cpu.GetCycles()
-					a.cpu.ExecuteInstruction()
-					a.cycles += a.cpu.GetCycles() - startCycles
-
-					a.tickCards()
-					a.executionTrace()
+					if !a.executeInstruction() {
+						a.paused.Store(true)
+						break
+					}
 				}
 			} else {
 				// a card, like the Z80 Softcard, is running
@@ -58,6 +56,7 @@ func (a *Apple2) Start(paused bool) {
 					card.runDMACycle()
 					a.cycles++
 
+					a.scanner.tick()
 					a.tickCards()
 					a.executionTrace()
 				}
@@ -68,10 +67,16 @@ func (a *Apple2) Start(paused bool) {
 				a.cycleBreakpoint.Store(0)
 				a.paused.Store(true)
 			}
+
+			a.rewindTick()
 		} else {
 			time.Sleep(200 * time.Millisecond)
 		}
 
+		if a.movie != nil {
+			a.movie.tick()
+		}
+
 		// Execute meta commands
 		commandsPending := true
 		for commandsPending {
@@ -79,6 +84,17 @@ func (a *Apple2) Start(paused bool) {
 			case command := <-a.commandChannel:
 				switch command.getId() {
 				case CommandKill:
+					if a.movie != nil {
+						a.movie.close()
+					}
+					if a.io.cassetteOutput != nil {
+						a.io.cassetteOutput.close()
+					}
+					for _, card := range a.cards {
+						if closer, ok := card.(cardCloser); ok {
+							closer.close()
+						}
+					}
 					return
 				case CommandPause:
 					if !a.paused.Load() {
@@ -97,6 +113,11 @@ func (a *Apple2) Start(paused bool) {
 				default:
 					// Execute the other commands
 					a.executeCommand(command)
+					if a.cycles < speedReferenceCycles {
+						// The cycles went back with a rewind or a state load
+						speedReferenceTime = time.Now()
+						speedReferenceCycles = a.cycles
+					}
 				}
 			default:
 				commandsPending = false
@@ -129,6 +150,25 @@ func (a *Apple2) Start(paused bool) {
 	}
 }
 
+// executeInstruction runs a 6502 instruction. Returns false if the debugger
+// stopped the execution.
+func (a *Apple2) executeInstruction() bool {
+	debugging := a.debugger.active.Load()
+	if debugging && a.debugger.beforeInstruction() {
+		return false
+	}
+
+	startCycles := a.cpu.GetCycles()
+	a.cpu.ExecuteInstruction()
+	a.cycles += a.cpu.GetCycles() - startCycles
+
+	a.scanner.tick()
+	a.tickCards()
+	a.executionTrace()
+
+	return !(debugging && a.debugger.afterInstruction())
+}
+
 func (a *Apple2) reset() {
 	a.cpu.Reset()
 	a.mmu.reset()
@@ -3,7 +3,7 @@ Package audio synthesizes the sound of the Apple II.
 
 The emulation core reports the sound activity as events with the CPU
 cycle when they happen: speaker clicks and output level changes of the
-sound cards. This package reconstructs a mixed 48 kHz float32 mono
+sound cards. This package reconstructs a mixed 48 kHz float32 stereo
 stream from those events. It is shared by the frontends, that only need
 to send the samples to their audio device.
 
@@ -21,11 +21,17 @@ The synthesis works as follows:
     building a cushion against jitter between the emulation and audio
     clocks. If the events get too far ahead (fast forward) or fall
     behind (pause, hiccup) the render clock resynchronizes.
-  - The sources are summed and a DC-blocking high-pass filter models the
+  - Each source has a gain and a position on the stereo field. They are
+    summed on each channel and a DC-blocking high-pass filter models the
     AC coupling of a real speaker: constant levels decay to silence.
 */
 package audio
 
+import (
+	"math"
+	"sync/atomic"
+)
+
 const (
 	// SampleRate is the sample rate of the generated audio stream
 	SampleRate = 48000
@@ -48,47 +54,116 @@ type levelEvent struct {
 	level float32
 }
 
-// Source receives the output level changes of one sound generator. It
-// implements the izapple2.AudioSink interface.
-type Source struct {
-	events   chan levelEvent
+// levelTrack holds the level changes of a generator waiting to be
+// rendered
+type levelTrack struct {
 	pending  []levelEvent
 	consumed int
 	level    float64 // Current output level of the generator
 }
 
-// PushLevel reports that the generator output changed to level at the
-// given CPU cycle. It can be called from any goroutine.
-func (s *Source) PushLevel(cycle uint64, level float32) {
-	select {
-	case s.events <- levelEvent{cycle, level}:
-	default:
-		// The channel is full, the event is lost
-	}
-}
-
 // renderWindow returns the average level over the sample window,
 // applying the pending events that fall inside it
-func (s *Source) renderWindow(start, end float64) float64 {
+func (t *levelTrack) renderWindow(start, end float64) float64 {
 	acc := 0.0
 	pos := start
-	for s.consumed < len(s.pending) {
-		event := s.pending[s.consumed]
+	for t.consumed < len(t.pending) {
+		event := t.pending[t.consumed]
 		cycle := float64(event.cycle)
 		if cycle >= end {
 			break
 		}
 		if cycle > pos {
-			acc += s.level * (cycle - pos)
+			acc += t.level * (cycle - pos)
 			pos = cycle
 		}
-		s.level = float64(event.level)
-		s.consumed++
+		t.level = float64(event.level)
+		t.consumed++
 	}
-	acc += s.level * (end - pos)
+	acc += t.level * (end - pos)
 	return acc / (end - start)
 }
 
+// compact drops the events already rendered
+func (t *levelTrack) compact() {
+	t.pending = t.pending[:copy(t.pending, t.pending[t.consumed:])]
+	t.consumed = 0
+}
+
+// panGains returns the gains for the left and right channels of a source
+// at the pan position. A centered source plays at full level on both
+// channels.
+func panGains(pan float64) (float64, float64) {
+	return min(1, 1-pan), min(1, 1+pan)
+}
+
+// Source receives the output level changes of one sound generator. It
+// implements the izapple2.AudioSink interface.
+type Source struct {
+	levelTrack
+	events chan levelEvent
+
+	// Controls of the source, float32 bits to be set from any goroutine
+	gain  atomic.Uint32
+	pan   atomic.Uint32
+	muted atomic.Bool
+}
+
+// SetGain sets the volume of the source, 1.0 is the nominal level. It can
+// be called from any goroutine.
+func (s *Source) SetGain(gain float32) {
+	s.gain.Store(math.Float32bits(gain))
+}
+
+// Gain returns the volume of the source
+func (s *Source) Gain() float32 {
+	return math.Float32frombits(s.gain.Load())
+}
+
+// SetPan sets the position of the source on the stereo field, from -1.0
+// for left only to 1.0 for right only, 0 is centered. It can be called
+// from any goroutine.
+func (s *Source) SetPan(pan float32) {
+	pan = min(max(pan, -1), 1)
+	s.pan.Store(math.Float32bits(pan))
+}
+
+// Pan returns the position of the source on the stereo field
+func (s *Source) Pan() float32 {
+	return math.Float32frombits(s.pan.Load())
+}
+
+// SetMuted silences the source without changing its gain. It can be
+// called from any goroutine.
+func (s *Source) SetMuted(muted bool) {
+	s.muted.Store(muted)
+}
+
+// IsMuted returns true if the source is muted
+func (s *Source) IsMuted() bool {
+	return s.muted.Load()
+}
+
+// channelGains returns the gains for the left and right channels
+func (s *Source) channelGains() (float64, float64) {
+	if s.IsMuted() {
+		return 0, 0
+	}
+	gain := float64(s.Gain())
+	left, right := panGains(float64(s.Pan()))
+	return gain * left, gain * right
+}
+
+// PushLevel reports that the generator output changed to level at the
+// given CPU cycle. It can be called from any goroutine.
+func (s *Source) PushLevel(cycle uint64, level float32) {
+	select {
+	case s.events <- levelEvent{cycle, level}:
+	default:
+		// The channel is full, the event is lost
+	}
+}
+
 // Mixer generates the audio stream of the machine, summing the streams
 // of its sources.
 type Mixer struct {
@@ -102,9 +177,9 @@ type Mixer struct {
 	synced      bool    // False until the first event arrives
 	renderCycle float64 // Render clock, the CPU cycle of the next sample
 
-	// DC-blocking filter state
-	dcPrevIn  float64
-	dcPrevOut float64
+	// DC-blocking filter state for each channel
+	dcPrevIn  [2]float64
+	dcPrevOut [2]float64
 }
 
 // NewMixer creates a Mixer for a CPU running at clockMhz
@@ -116,20 +191,23 @@ func NewMixer(clockMhz float64) *Mixer {
 	return &m
 }
 
-// NewSource adds a sound source to the mix. All the sources must be
-// created before the audio device starts calling ReadSamples.
+// NewSource adds a sound source to the mix, centered and with the
+// nominal gain. All the sources must be created before the audio device
+// starts calling ReadSamples.
 func (m *Mixer) NewSource() *Source {
 	s := &Source{
-		events:  make(chan levelEvent, eventChannelSize),
-		pending: make([]levelEvent, 0, eventChannelSize),
+		events: make(chan levelEvent, eventChannelSize),
 	}
+	s.pending = make([]levelEvent, 0, eventChannelSize)
+	s.SetGain(1)
 	m.sources = append(m.sources, s)
 	return s
 }
 
-// ReadSamples fills buf with the next samples of the audio stream. Mono,
-// values in [-1.0, 1.0]. It must always be called from the same goroutine
-// or audio callback thread.
+// ReadSamples fills buf with the next samples of the audio stream.
+// Stereo, with the left and right samples interleaved, values in
+// [-1.0, 1.0]. It must always be called from the same goroutine or audio
+// callback thread.
 func (m *Mixer) ReadSamples(buf []float32) {
 	// Take the queued events of each source
 	someEvents := false
@@ -172,25 +250,32 @@ func (m *Mixer) ReadSamples(buf []float32) {
 		return
 	}
 
-	for i := range buf {
+	gains := make([][2]float64, len(m.sources))
+	for i, s := range m.sources {
+		gains[i][0], gains[i][1] = s.channelGains()
+	}
+
+	for i := 0; i+1 < len(buf); i += 2 {
 		windowEnd := m.renderCycle + m.cyclesPerSample
-		sample := 0.0
-		for _, s := range m.sources {
-			sample += s.renderWindow(m.renderCycle, windowEnd)
+		var sample [2]float64
+		for j, s := range m.sources {
+			level := s.renderWindow(m.renderCycle, windowEnd)
+			sample[0] += level * gains[j][0]
+			sample[1] += level * gains[j][1]
 		}
 
-		// DC-blocking filter
-		out := sample - m.dcPrevIn + dcFilterPole*m.dcPrevOut
-		m.dcPrevIn = sample
-		m.dcPrevOut = out
-
-		buf[i] = float32(out)
+		for ch := range 2 {
+			// DC-blocking filter
+			out := sample[ch] - m.dcPrevIn[ch] + dcFilterPole*m.dcPrevOut[ch]
+			m.dcPrevIn[ch] = sample[ch]
+			m.dcPrevOut[ch] = out
+			buf[i+ch] = float32(out)
+		}
 		m.renderCycle = windowEnd
 	}
 
 	// Keep the events not rendered yet for the next call
 	for _, s := range m.sources {
-		s.pending = s.pending[:copy(s.pending, s.pending[s.consumed:])]
-		s.consumed = 0
+		s.compact()
 	}
 }
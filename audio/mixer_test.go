@@ -47,7 +47,7 @@ func TestMixerSourceHoldsLevel(t *testing.T) {
 	s := m.NewSource()
 
 	s.PushLevel(1_000_000, 0.5)
-	buf := make([]float32, SampleRate) // One second
+	buf := make([]float32, 2*SampleRate) // One second of interleaved left and right samples
 	m.ReadSamples(buf)
 
 	if waveAmplitude(buf) < 0.4 {
@@ -60,3 +60,43 @@ func TestMixerSourceHoldsLevel(t *testing.T) {
 		}
 	}
 }
+
+func TestMixerStereoPanAndGain(t *testing.T) {
+	d := newWaveDriver(1_000_000, 2)
+	d.togglers[0].source.SetPan(-1)
+	d.togglers[1].source.SetPan(1)
+	d.togglers[1].source.SetGain(0.5)
+
+	d.run(512, 10)
+	buf := d.stepStereo(512)
+
+	leftPeak := waveAmplitude(leftChannel(buf))
+	rightPeak := waveAmplitude(leftChannel(buf[1:]))
+	ratio := rightPeak / leftPeak
+	if ratio < 0.45 || ratio > 0.55 {
+		t.Errorf("expected the right source at half the gain, got a ratio of %v", ratio)
+	}
+}
+
+func TestMixerPannedSourceIsSilentOnTheOtherChannel(t *testing.T) {
+	d := newWaveDriver(1_000_000, 1)
+	d.togglers[0].source.SetPan(1)
+
+	left := d.run(512, 20)
+	if waveAmplitude(left) != 0 {
+		t.Error("expected silence on the left channel for a source on the right")
+	}
+}
+
+func TestMixerMutedSource(t *testing.T) {
+	d := newWaveDriver(1_000_000, 1)
+	d.togglers[0].source.SetMuted(true)
+	if waveAmplitude(d.run(512, 20)) != 0 {
+		t.Error("expected a muted source to be silent")
+	}
+
+	d.togglers[0].source.SetMuted(false)
+	if waveAmplitude(d.run(512, 20)) < 0.1 {
+		t.Error("expected the source to play again after unmuting")
+	}
+}
@@ -0,0 +1,239 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"math"
+	"os"
+	"sync"
+)
+
+/*
+Recorder writes the audio of the machine to WAV files, 16 bits at 48 kHz.
+
+Unlike the Mixer, the samples are not tied to the audio device clock.
+They are rendered from the cycles of the events, the sample n covers the
+CPU cycles from startCycle + n * ~21.31. The duration of the recording is
+exactly the emulated time, it does not depend on the emulation speed.
+
+The events of the different sources can arrive slightly out of order, the
+rendering waits recorderMarginCycles behind the newest event. The levels
+are written as reported, without the DC-blocking filter of the Mixer.
+
+The mix is written as stereo with the pan of each source. Each source can
+also be written to its own mono file.
+*/
+
+// The rendering waits this many cycles behind the newest event
+const recorderMarginCycles = 50_000
+
+// LevelSink receives the output level changes of a sound generator. It is
+// the izapple2.AudioSink interface.
+type LevelSink interface {
+	PushLevel(cycle uint64, level float32)
+}
+
+// Recorder renders the level changes of its sources to WAV files
+type Recorder struct {
+	mutex           sync.Mutex
+	cyclesPerSample float64
+	startCycle      float64
+	renderCycle     float64 // CPU cycle of the next sample
+	newestCycle     uint64
+	sources         []*RecorderSource
+	mix             *wavWriter // nil if the mix is not recorded
+}
+
+// RecorderSource receives the level changes of one sound generator for a
+// Recorder. It implements the izapple2.AudioSink interface.
+type RecorderSource struct {
+	levelTrack
+	recorder *Recorder
+	pan      float64
+	next     LevelSink  // Optional sink also receiving the events
+	file     *wavWriter // nil if the source is not recorded separately
+}
+
+// NewRecorder creates a Recorder for a CPU running at clockMhz. The
+// recording starts on startCycle. The mix is written to filename, if not
+// empty.
+func NewRecorder(clockMhz float64, startCycle uint64, filename string) (*Recorder, error) {
+	var r Recorder
+	r.cyclesPerSample = 1000 * clockMhz * 1000 / SampleRate
+	r.startCycle = float64(startCycle)
+	r.renderCycle = r.startCycle
+	r.newestCycle = startCycle
+	if filename != "" {
+		var err error
+		r.mix, err = newWavWriter(filename, 2)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &r, nil
+}
+
+// NewSource adds a sound source to the recording, with the position on the
+// stereo field for the mix. The source is also written alone to filename,
+// if not empty. The events are forwarded to next, if not nil, to keep
+// playing them.
+func (r *Recorder) NewSource(pan float32, filename string, next LevelSink) (*RecorderSource, error) {
+	s := &RecorderSource{
+		recorder: r,
+		pan:      min(max(float64(pan), -1), 1),
+		next:     next,
+	}
+	if filename != "" {
+		var err error
+		s.file, err = newWavWriter(filename, 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sources = append(r.sources, s)
+	return s, nil
+}
+
+// PushLevel reports that the generator output changed to level at the
+// given CPU cycle
+func (s *RecorderSource) PushLevel(cycle uint64, level float32) {
+	r := s.recorder
+	r.mutex.Lock()
+	s.pending = append(s.pending, levelEvent{cycle, level})
+	if cycle > r.newestCycle {
+		r.newestCycle = cycle
+		if cycle > recorderMarginCycles {
+			r.render(float64(cycle - recorderMarginCycles))
+		}
+	}
+	r.mutex.Unlock()
+
+	if s.next != nil {
+		s.next.PushLevel(cycle, level)
+	}
+}
+
+// render writes the samples up to the CPU cycle
+func (r *Recorder) render(toCycle float64) {
+	for r.renderCycle+r.cyclesPerSample <= toCycle {
+		windowEnd := r.renderCycle + r.cyclesPerSample
+		var left, right float64
+		for _, s := range r.sources {
+			level := s.renderWindow(r.renderCycle, windowEnd)
+			if s.file != nil {
+				s.file.write(level)
+			}
+			leftGain, rightGain := panGains(s.pan)
+			left += level * leftGain
+			right += level * rightGain
+		}
+		if r.mix != nil {
+			r.mix.write(left, right)
+		}
+		r.renderCycle = windowEnd
+	}
+
+	for _, s := range r.sources {
+		s.compact()
+	}
+}
+
+// Close renders the samples up to endCycle and completes the files
+func (r *Recorder) Close(endCycle uint64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.render(float64(endCycle))
+
+	var err error
+	if r.mix != nil {
+		err = r.mix.close()
+	}
+	for _, s := range r.sources {
+		if s.file != nil {
+			errSource := s.file.close()
+			if err == nil {
+				err = errSource
+			}
+		}
+	}
+	return err
+}
+
+// Samples returns the number of samples per channel written
+func (r *Recorder) Samples() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return int(math.Round((r.renderCycle - r.startCycle) / r.cyclesPerSample))
+}
+
+type wavWriter struct {
+	file     *os.File
+	writer   *bufio.Writer
+	channels int
+	samples  uint32 // Samples per channel written
+}
+
+const wavHeaderSize = 44
+
+func newWavWriter(filename string, channels int) (*wavWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	w := &wavWriter{
+		file:     f,
+		writer:   bufio.NewWriter(f),
+		channels: channels,
+	}
+	// The sizes are written on close
+	w.writer.Write(w.header())
+	return w, nil
+}
+
+func (w *wavWriter) header() []uint8 {
+	const bitsPerSample = 16
+	blockAlign := w.channels * bitsPerSample / 8
+	dataSize := w.samples * uint32(blockAlign)
+
+	header := make([]uint8, 0, wavHeaderSize)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, wavHeaderSize-8+dataSize)
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16) // Format chunk size
+	header = binary.LittleEndian.AppendUint16(header, 1)  // PCM
+	header = binary.LittleEndian.AppendUint16(header, uint16(w.channels))
+	header = binary.LittleEndian.AppendUint32(header, SampleRate)
+	header = binary.LittleEndian.AppendUint32(header, uint32(SampleRate*blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, uint16(blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, bitsPerSample)
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, dataSize)
+	return header
+}
+
+// write adds a sample for each channel, values in [-1.0, 1.0]
+func (w *wavWriter) write(values ...float64) {
+	for _, v := range values {
+		v = min(max(v, -1), 1)
+		var data [2]uint8
+		binary.LittleEndian.PutUint16(data[:], uint16(int16(math.Round(v*math.MaxInt16))))
+		w.writer.Write(data[:])
+	}
+	w.samples++
+}
+
+func (w *wavWriter) close() error {
+	err := w.writer.Flush()
+	if err == nil {
+		_, err = w.file.WriteAt(w.header(), 0)
+	}
+	errClose := w.file.Close()
+	if err == nil {
+		err = errClose
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readWav(t *testing.T, filename string) (int, []int16) {
+	t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < wavHeaderSize || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		t.Fatalf("%v is not a WAV file", filename)
+	}
+	channels := int(binary.LittleEndian.Uint16(data[22:]))
+	dataSize := int(binary.LittleEndian.Uint32(data[40:]))
+	if dataSize != len(data)-wavHeaderSize {
+		t.Fatalf("The data size of %v should be %v, got %v", filename, len(data)-wavHeaderSize, dataSize)
+	}
+	samples := make([]int16, dataSize/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[wavHeaderSize+2*i:]))
+	}
+	return channels, samples
+}
+
+func TestRecorderDurationAndLevels(t *testing.T) {
+	dir := t.TempDir()
+	mixFile := filepath.Join(dir, "mix.wav")
+	leftFile := filepath.Join(dir, "left.wav")
+
+	start := uint64(1_000_000)
+	r, err := NewRecorder(testClockMhz, start, mixFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	left, err := r.NewSource(-1, leftFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	center, err := r.NewSource(0, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One second of emulated time
+	second := uint64(math.Ceil(SampleRate * r.cyclesPerSample))
+	left.PushLevel(start, 0.5)
+	center.PushLevel(start+second/2, 0.25)
+	err = r.Close(start + second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Samples() != SampleRate {
+		t.Errorf("A second should be recorded, got %v samples", r.Samples())
+	}
+
+	channels, mix := readWav(t, mixFile)
+	if channels != 2 || len(mix) != 2*SampleRate {
+		t.Fatalf("The mix should be stereo, got %v channels and %v samples", channels, len(mix))
+	}
+	if mix[100] != 16384 || mix[101] != 0 {
+		t.Errorf("The left source should be only on the left channel, got %v and %v", mix[100], mix[101])
+	}
+	last := len(mix) - 2
+	if mix[last] != 24575 || mix[last+1] != 8192 {
+		t.Errorf("The centered source should be on both channels, got %v and %v", mix[last], mix[last+1])
+	}
+
+	channels, alone := readWav(t, leftFile)
+	if channels != 1 || len(alone) != SampleRate || alone[last/2] != 16384 {
+		t.Errorf("The source should be recorded alone in mono")
+	}
+}
+
+type countingSink struct {
+	events int
+}
+
+func (s *countingSink) PushLevel(cycle uint64, level float32) {
+	s.events++
+}
+
+func TestRecorderForwardsEvents(t *testing.T) {
+	r, err := NewRecorder(testClockMhz, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var next countingSink
+	s, err := r.NewSource(0, "", &next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cycle := uint64(0); cycle < 100_000; cycle += 512 {
+		s.PushLevel(cycle, 0.25)
+	}
+	r.Close(100_000)
+	if next.events != 196 {
+		t.Errorf("The events should be forwarded, got %v", next.events)
+	}
+}
@@ -62,8 +62,14 @@ func newWaveDriver(startCycle uint64, togglers int) *waveDriver {
 	return d
 }
 
-// step advances 10 ms, toggling every halfPeriodCycles, 0 for silence
+// step advances 10 ms, toggling every halfPeriodCycles, 0 for silence.
+// It returns the left channel.
 func (d *waveDriver) step(halfPeriodCycles uint64) []float32 {
+	return leftChannel(d.stepStereo(halfPeriodCycles))
+}
+
+// stepStereo is like step returning both channels interleaved
+func (d *waveDriver) stepStereo(halfPeriodCycles uint64) []float32 {
 	chunkCycles := float64(driverChunkSamples) * d.m.cyclesPerSample
 	d.cycle += uint64(chunkCycles)
 	if halfPeriodCycles != 0 {
@@ -76,11 +82,20 @@ func (d *waveDriver) step(halfPeriodCycles uint64) []float32 {
 	} else {
 		d.nextClick = d.cycle
 	}
-	buf := make([]float32, driverChunkSamples)
+	buf := make([]float32, 2*driverChunkSamples)
 	d.m.ReadSamples(buf)
 	return buf
 }
 
+// leftChannel extracts the left samples of a stereo buffer
+func leftChannel(buf []float32) []float32 {
+	left := make([]float32, len(buf)/2)
+	for i := range left {
+		left[i] = buf[2*i]
+	}
+	return left
+}
+
 func (d *waveDriver) run(halfPeriodCycles uint64, steps int) []float32 {
 	out := make([]float32, 0, steps*driverChunkSamples)
 	for range steps {
@@ -6,7 +6,9 @@ Audio interface between the sound generators and the frontends.
 The built-in speaker and the cards that generate sound implement
 AudioSource. The frontend attaches an AudioSink to each source and
 renders the reported level changes, typically with the audio package
-Mixer.
+Mixer. The sources are identified by name to let the frontends control
+the volume of each one and they report their position on the stereo
+field, as the Mockingboard has its PSGs on the left and right channels.
 */
 
 // AudioSink receives the output level changes of a sound source with the
@@ -18,9 +20,18 @@ type AudioSink interface {
 // AudioSource is implemented by the cards that generate sound.
 type AudioSource interface {
 	GetAudioSourceName() string
+	// GetAudioSourcePan returns the position on the stereo field, from
+	// -1.0 for left to 1.0 for right, 0 is centered
+	GetAudioSourcePan() float32
 	SetAudioSink(sink AudioSink)
 }
 
+// audioSourcesProvider is implemented by the cards with more than one
+// sound generator mixed separately
+type audioSourcesProvider interface {
+	audioSources() []AudioSource
+}
+
 // GetAudioSources returns the sound generators of the machine: the
 // built-in speaker and the sound cards
 func (a *Apple2) GetAudioSources() []AudioSource {
@@ -29,6 +40,9 @@ func (a *Apple2) GetAudioSources() []AudioSource {
 		if source, ok := card.(AudioSource); ok {
 			sources = append(sources, source)
 		}
+		if provider, ok := card.(audioSourcesProvider); ok {
+			sources = append(sources, provider.audioSources()...)
+		}
 	}
 	return sources
 }
@@ -47,6 +61,10 @@ func (s *speakerAudioSource) GetAudioSourceName() string {
 	return "speaker"
 }
 
+func (s *speakerAudioSource) GetAudioSourcePan() float32 {
+	return 0
+}
+
 func (s *speakerAudioSource) SetAudioSink(sink AudioSink) {
 	s.sink = sink
 }
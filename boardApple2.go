@@ -31,7 +31,7 @@ func addApple2SoftSwitches(io *ioC0Page) {
 
 	io.addSoftSwitchRW(0x00, buildKeySoftSwitch(io), "KEYBOARD")           // Keyboard
 	io.addSoftSwitchRW(0x10, buildStrobeKeyboardSoftSwitch(io), "AKD")     // Keyboard Strobe
-	io.addSoftSwitchR(0x20, buildNotImplementedSoftSwitchR(io), "TAPEOUT") // Cassette Output
+	io.addSoftSwitchRW(0x20, buildCassetteOutputSoftSwitch(io), "TAPEOUT") // Cassette Output
 	speaker := buildSpeakerSoftSwitch(io)
 	for i := uint8(0x30); i < 0x40; i++ {
 		io.addSoftSwitchRW(i, speaker, "SPEAKER") // Speaker, any access to $C030-$C03F toggles it
@@ -95,6 +95,16 @@ func buildCassetteSoftSwitch(io *ioC0Page) softSwitchR {
 	}
 }
 
+func buildCassetteOutputSoftSwitch(io *ioC0Page) softSwitchR {
+	notImplemented := buildNotImplementedSoftSwitchR(io)
+	return func() uint8 {
+		if io.cassetteOutput != nil {
+			io.cassetteOutput.toggle(io.apple2.GetCycles())
+		}
+		return notImplemented()
+	}
+}
+
 func buildNotImplementedSoftSwitchR(io *ioC0Page) softSwitchR {
 	return func() uint8 {
 		// Return random info. Some games (Serpentine) used CASSETTE and get stuck if not changing.
@@ -10,11 +10,6 @@ const (
 	ioFlag80Col   uint8 = 0x1F
 )
 
-const (
-	screenDrawCycles         = uint64(12480 + 4550)
-	screenVertBlankingCycles = uint64(4550)
-)
-
 func addApple2ESoftSwitches(io *ioC0Page) {
 	// New MMU read softswithes
 	mmu := io.apple2.mmu
@@ -47,14 +42,13 @@ func addApple2ESoftSwitches(io *ioC0Page) {
 		// See "Inside Apple IIe", page 268
 		// See http://rich12345.tripod.com/aiivideo/vbl.html
 		// For each screen draw:
-		//      12480 cycles drawing lines, VERTBLANK = $00
-		//       4550 cycles doing the return to position (0,0), VERTBLANK = $80
-		// Vert blank takes 12480 cycles every page redraw
-		cycles := io.apple2.GetCycles() % screenDrawCycles
-		if cycles <= screenVertBlankingCycles {
-			return ssOn
+		//      12480 cycles drawing lines, RDVBLBAR = $80
+		//       4550 cycles doing the return to position (0,0), RDVBLBAR = $00
+		// The beam position is tracked by the video scanner
+		if io.apple2.scanner.isVerticalBlank() {
+			return ssOff
 		}
-		return ssOff
+		return ssOn
 	}, "VERTBLANK")
 
 	// io.softSwitchesData[ioFlagAltChar] = ssOn // Not sure about this.
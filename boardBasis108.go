@@ -1,6 +1,10 @@
 package izapple2
 
-import "github.com/ivanizag/izapple2/screen"
+import (
+	"io"
+
+	"github.com/ivanizag/izapple2/screen"
+)
 
 /*
 	Basis 108 clone
@@ -49,6 +53,14 @@ func newVideoBasis108(a *Apple2, ram *memoryRangeBasis108) *videoBasis108 {
 	return &v
 }
 
+func (v *videoBasis108) saveState(w io.Writer) error {
+	return saveValues(w, &v.col80)
+}
+
+func (v *videoBasis108) loadState(r io.Reader) error {
+	return loadValues(r, &v.col80)
+}
+
 // GetCurrentVideoMode returns the active video mode
 func (v *videoBasis108) GetCurrentVideoMode() uint32 {
 	if v.col80 {
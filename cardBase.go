@@ -2,6 +2,7 @@ package izapple2
 
 import (
 	"fmt"
+	"io"
 )
 
 // Card represents an Apple II card to be inserted in a slot
@@ -11,11 +12,18 @@ type Card interface {
 	assign(a *Apple2, slot int)
 	reset()
 	runDMACycle()
+	persistent
 
 	GetName() string
 	GetInfo() map[string]string
 }
 
+// cardCloser is implemented by the cards with files or connections to
+// release when the emulation ends
+type cardCloser interface {
+	close()
+}
+
 type cardBase struct {
 	a           *Apple2
 	name        string
@@ -166,6 +174,43 @@ func (c *cardBase) assign(a *Apple2, slot int) {
 	}
 }
 
+// saveState stores the active pages of the card ROM. The cards with more
+// state extend it.
+func (c *cardBase) saveState(w io.Writer) error {
+	for _, p := range c.persistentRoms() {
+		err := p.saveState(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cardBase) loadState(r io.Reader) error {
+	for _, p := range c.persistentRoms() {
+		err := p.loadState(r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// persistentRoms returns the ROMs of the card that can have pages. Some
+// cards are their own memory handler and are not included.
+func (c *cardBase) persistentRoms() []persistent {
+	var result []persistent
+	if c.romCsxx != nil {
+		result = append(result, c.romCsxx)
+	}
+	for _, mh := range []memoryHandler{c.romC8xx, c.romCxxx} {
+		if rom, ok := mh.(*memoryRangeROM); ok {
+			result = append(result, rom)
+		}
+	}
+	return result
+}
+
 func (c *cardBase) runDMACycle() {
 	// No DMA
 }
@@ -1,6 +1,9 @@
 package izapple2
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+)
 
 /*
 	Brain board card for Apple II
@@ -157,3 +160,19 @@ func (c *CardBrainBoard) peek(address uint16) uint8 {
 func (c *CardBrainBoard) poke(address uint16, value uint8) {
 	// Nothing
 }
+
+func (c *CardBrainBoard) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	return saveValues(w, &c.isBankB, &c.isMotherboardRomEnabled)
+}
+
+func (c *CardBrainBoard) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	return loadValues(r, &c.isBankB, &c.isMotherboardRomEnabled)
+}
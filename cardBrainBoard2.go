@@ -1,5 +1,7 @@
 package izapple2
 
+import "io"
+
 /*
 	Brain board II card for Apple II
 
@@ -120,3 +122,19 @@ func (c *CardBrainBoardII) peek(address uint16) uint8 {
 func (c *CardBrainBoardII) poke(address uint16, value uint8) {
 	// Nothing
 }
+
+func (c *CardBrainBoardII) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	return saveValues(w, &c.highBank)
+}
+
+func (c *CardBrainBoardII) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	return loadValues(r, &c.highBank)
+}
@@ -47,6 +47,7 @@ func getCardFactory() map[string]*cardBuilder {
 	cardFactory["diskiiseq"] = newCardDisk2SequencerBuilder()
 	cardFactory["fastchip"] = newCardFastChipBuilder()
 	cardFactory["fujinet"] = newCardSmartPortFujinetBuilder()
+	cardFactory["grappler"] = newCardGrapplerBuilder()
 	cardFactory["inout"] = newCardInOutBuilder()
 	cardFactory["language"] = newCardLanguageBuilder()
 	cardFactory["softswitchlogger"] = newCardLoggerBuilder()
@@ -55,6 +56,7 @@ func getCardFactory() map[string]*cardBuilder {
 	cardFactory["mouse"] = newCardMouseBuilder()
 	cardFactory["multirom"] = newMultiRomCardBuilder()
 	cardFactory["parallel"] = newCardParallelPrinterBuilder()
+	cardFactory["phasor"] = newCardPhasorBuilder()
 	cardFactory["prodosblock"] = newCardProDOSBlockStorageBuilder()
 	cardFactory["prodosromdrive"] = newCardProDOSRomDriveBuilder()
 	cardFactory["prodosromcard3"] = newCardProDOSRomCard3Builder()
@@ -62,6 +64,7 @@ func getCardFactory() map[string]*cardBuilder {
 	cardFactory["profile"] = newCardProfileBuilder()
 	cardFactory["saturn"] = newCardSaturnBuilder()
 	cardFactory["smartport"] = newCardSmartPortStorageBuilder()
+	cardFactory["ssc"] = newCardSuperSerialBuilder()
 	cardFactory["swyftcard"] = newCardSwyftBuilder()
 	cardFactory["thunderclock"] = newCardThunderClockPlusBuilder()
 	cardFactory["videx"] = newCardVidexVideotermBuilder()
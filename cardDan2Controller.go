@@ -2,6 +2,7 @@ package izapple2
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 )
@@ -601,3 +602,19 @@ var PROGMEM_v7 = [3 * 512]uint8{
 	0x68, 0x4c, 0xe3, 0xfd, 0xa2, 0x00, 0xc5, 0xf9, 0x90, 0x06, 0xe8, 0x38,
 	0xe5, 0xf9, 0xb0, 0xf6, 0x60,
 }
+
+func (c *CardDan2Controller) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	return saveValues(w, &c.portB, &c.portC)
+}
+
+func (c *CardDan2Controller) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	return loadValues(r, &c.portB, &c.portC)
+}
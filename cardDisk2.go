@@ -2,7 +2,11 @@ package izapple2
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/ivanizag/izapple2/storage"
 )
@@ -45,6 +49,7 @@ type drive interface {
 
 type cardDisk2Drive struct {
 	name      string
+	wozSave   string
 	diskette  storage.Diskette
 	phases    uint8 // q3, q2, q1 and q0 with q0 on the LSB. Magnets that are active on the stepper motor
 	trackStep int   // Stepmotor for tracks position. 4 steps per track
@@ -60,11 +65,20 @@ func newCardDisk2Builder() *cardBuilder {
 			{"tracktracer", "Trace how the disk head moves between tracks", "false"},
 			{"fast", "Enable CPU burst when accessing the disk", "true"},
 			{"sectors13", "Use 13 sectors per track ROM", "false"},
+			{"wozsave", "Save the changes to WOZ images: none, overwrite or sidecar", "none"},
 		},
 		buildFunc: func(params map[string]string) (Card, error) {
 			var c CardDisk2
 			c.sectors13 = paramsGetBool(params, "sectors13")
 
+			wozSave := paramsGetString(params, "wozsave")
+			err := checkWozSave(wozSave)
+			if err != nil {
+				return nil, err
+			}
+			c.drive[0].wozSave = wozSave
+			c.drive[1].wozSave = wozSave
+
 			disk1 := paramsGetPath(params, "disk1")
 			if disk1 != "" {
 				err := c.drive[0].insertDiskette(disk1)
@@ -89,7 +103,7 @@ func newCardDisk2Builder() *cardBuilder {
 				P5RomFile = "<internal>/Apple Disk II 13 Sector Interface Card ROM P5 - 341-0009.bin"
 			}
 
-			err := c.loadRomFromResource(P5RomFile, cardRomSimple)
+			err = c.loadRomFromResource(P5RomFile, cardRomSimple)
 			if err != nil {
 				return nil, err
 			}
@@ -292,12 +306,143 @@ func (c *CardDisk2) processQ6Q7(in uint8) {
 }
 
 func (d *cardDisk2Drive) insertDiskette(name string) error {
-	diskette, err := LoadDiskette(name)
+	diskette, err := LoadDiskette(wozLoadFile(d.wozSave, name))
 	if err != nil {
 		return err
 	}
+	if saveable, ok := diskette.(storage.SaveableDiskette); ok {
+		saveable.SetSaveFile(wozSaveFile(d.wozSave, name))
+	}
 
 	d.name = name
 	d.diskette = diskette
 	return nil
 }
+
+/*
+The changes to WOZ and A2R images are kept in memory unless wozsave is set:
+
+	none: the changes are lost when the emulator is closed
+	overwrite: the changes are saved to the original file, not for A2R
+	sidecar: the changes are saved to a new file with the ".save.woz"
+		extension. If that file exists it is loaded instead of the original.
+
+The image is saved when the drive motor is turned off. Only local
+uncompressed files are saved.
+*/
+const (
+	wozSaveNone      = "none"
+	wozSaveOverwrite = "overwrite"
+	wozSaveSidecar   = "sidecar"
+)
+
+func checkWozSave(mode string) error {
+	switch mode {
+	case "", wozSaveNone, wozSaveOverwrite, wozSaveSidecar:
+		return nil
+	}
+	return fmt.Errorf("invalid wozsave value '%s', use none, overwrite or sidecar", mode)
+}
+
+func wozSidecarFile(filename string) string {
+	filename = normalizeFilename(filename)
+	ext := filepath.Ext(filename)
+	if !strings.EqualFold(ext, ".woz") && !strings.EqualFold(ext, ".a2r") {
+		return ""
+	}
+	return strings.TrimSuffix(filename, ext) + ".save.woz"
+}
+
+// wozSaveFile returns where to save the changes of a WOZ image, empty if not saved
+func wozSaveFile(mode string, filename string) string {
+	switch mode {
+	case wozSaveOverwrite:
+		filename = normalizeFilename(filename)
+		if !strings.EqualFold(filepath.Ext(filename), ".woz") {
+			return "" // A2R images are not overwritten
+		}
+		return filename
+	case wozSaveSidecar:
+		return wozSidecarFile(filename)
+	}
+	return ""
+}
+
+// wozLoadFile returns the sidecar file if it has to be loaded instead of the original
+func wozLoadFile(mode string, filename string) string {
+	if mode == wozSaveSidecar {
+		sidecar := wozSidecarFile(filename)
+		if sidecar != "" {
+			if _, err := os.Stat(sidecar); err == nil {
+				return sidecar
+			}
+		}
+	}
+	return filename
+}
+
+func (c *CardDisk2) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	err = saveValues(w, &c.selected, &c.power, &c.dataLatch, &c.q6, &c.q7)
+	if err != nil {
+		return err
+	}
+	for i := range c.drive {
+		d := &c.drive[i]
+		err = saveValues(w, &d.name, &d.phases, &d.trackStep)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CardDisk2) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+
+	// The cycles count has been restored, the diskettes have to follow it.
+	// Power off to restore the drives, it will be turned on again if needed
+	c.resetDisketteTime()
+	c.softSwitchQ4(false)
+	var power bool
+	err = loadValues(r, &c.selected, &power, &c.dataLatch, &c.q6, &c.q7)
+	if err != nil {
+		return err
+	}
+	for i := range c.drive {
+		d := &c.drive[i]
+		var name string
+		err = loadValues(r, &name, &d.phases, &d.trackStep)
+		if err != nil {
+			return err
+		}
+		if name != d.name {
+			if name == "" {
+				d.name = ""
+				d.diskette = nil
+			} else {
+				err = d.insertDiskette(name)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	c.resetDisketteTime()
+	c.softSwitchQ4(power)
+	return nil
+}
+
+func (c *CardDisk2) resetDisketteTime() {
+	for i := range c.drive {
+		if d, ok := c.drive[i].diskette.(storage.TimedDiskette); ok {
+			d.ResetTime(c.a.GetCycles())
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package izapple2
 
 import (
+	"io"
+
 	"github.com/ivanizag/izapple2/component"
 )
 
@@ -31,8 +33,7 @@ type CardDisk2Sequencer struct {
 	motorDelay uint64  // NE556 timer, used to delay motor off
 	drive      [2]cardDisk2SequencerDrive
 
-	lastWriteValue  bool  // We write transitions to the WOZ file. We store the last value to send a pulse on change.
-	lastPulseCycles uint8 // There is a new pulse every 4ms, that's 8 cycles of 2Mhz
+	lastWriteValue bool // We write transitions to the WOZ file. We store the last value to send a pulse on change.
 
 	lastCycle uint64 // 2 Mhz cycles
 
@@ -46,7 +47,6 @@ type cardDisk2Shared interface {
 
 const (
 	disk2MotorOffDelay = uint64(2 * 1000 * 1000) // 2 Mhz cycles. Total 1 second.
-	disk2PulseCycles    = uint8(8)                // 8 cycles = 4ms * 2Mhz
 
 	/*
 	   We skip register calculations for long periods with the motor
@@ -64,10 +64,19 @@ func newCardDisk2SequencerBuilder() *cardBuilder {
 			{"disk1", "Diskette image for drive 1", ""},
 			{"disk2", "Diskette image for drive 2", ""},
 			{"tracktracer", "Trace how the disk head moves between tracks", "false"},
+			{"wozsave", "Save the changes to WOZ images: none, overwrite or sidecar", "none"},
 		},
 		buildFunc: func(params map[string]string) (Card, error) {
 			var c CardDisk2Sequencer
 
+			wozSave := paramsGetString(params, "wozsave")
+			err := checkWozSave(wozSave)
+			if err != nil {
+				return nil, err
+			}
+			c.drive[0].wozSave = wozSave
+			c.drive[1].wozSave = wozSave
+
 			disk1 := paramsGetString(params, "disk1")
 			if disk1 != "" {
 				err := c.drive[0].insertDiskette(disk1)
@@ -93,7 +102,7 @@ func newCardDisk2SequencerBuilder() *cardBuilder {
 				// P6RomFile = "<internal>/Apple Disk II 13 Sector Interface Card ROM P6 - 341-0010.bin"
 			}
 
-			err := c.loadRomFromResource(P5RomFile, cardRomSimple)
+			err = c.loadRomFromResource(P5RomFile, cardRomSimple)
 			if err != nil {
 				return nil, err
 			}
@@ -244,14 +253,8 @@ func (c *CardDisk2Sequencer) step(data uint8, firstStep bool) bool {
 		The woz format provides the pulse directly and we won't emulate
 		this detection.
 	*/
-	pulse := false
-	c.lastPulseCycles++
-	if c.lastPulseCycles == disk2PulseCycles {
-		// Read
-		pulse = c.drive[0].readPulse() ||
-			c.drive[1].readPulse()
-		c.lastPulseCycles = 0
-	}
+	pulse := c.drive[0].step()
+	pulse = c.drive[1].step() || pulse
 
 	/*
 		The write protected signal comes directly from any of the
@@ -332,3 +335,47 @@ func (c *CardDisk2Sequencer) step(data uint8, firstStep bool) bool {
 	c.sequence = next
 	return true
 }
+
+func (c *CardDisk2Sequencer) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	err = saveValues(w, &c.q, &c.register, &c.sequence, &c.motorDelay,
+		&c.lastWriteValue, &c.lastCycle)
+	if err != nil {
+		return err
+	}
+	for i := range c.drive {
+		d := &c.drive[i]
+		err = saveValues(w, &d.enabled, &d.currentQuarterTrack,
+			&d.position, &d.positionMax, &d.mc3470Buffer, &d.ticks, &d.fluxTicks,
+			&d.writing, &d.writeFlux)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CardDisk2Sequencer) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	err = loadValues(r, &c.q, &c.register, &c.sequence, &c.motorDelay,
+		&c.lastWriteValue, &c.lastCycle)
+	if err != nil {
+		return err
+	}
+	for i := range c.drive {
+		d := &c.drive[i]
+		err = loadValues(r, &d.enabled, &d.currentQuarterTrack,
+			&d.position, &d.positionMax, &d.mc3470Buffer, &d.ticks, &d.fluxTicks,
+			&d.writing, &d.writeFlux)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
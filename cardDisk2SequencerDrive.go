@@ -2,6 +2,7 @@ package izapple2
 
 import (
 	"errors"
+	"fmt"
 	"math/rand"
 
 	"github.com/ivanizag/izapple2/component"
@@ -18,14 +19,25 @@ type cardDisk2SequencerDrive struct {
 	positionMax uint32 // As tracks may have different lengths position is related of positionMax of the las track
 
 	mc3470Buffer uint8 // Four bit buffer to detect weak bits and to add latency
+
+	ticks     uint32 // Time since the last bit in units of 125 nanoseconds
+	fluxTicks uint32 // Time to the next flux transition in units of 125 nanoseconds
+
+	writing   bool // The sequencer has been writing on the current bit cell
+	writeFlux bool // A flux transition has been written on the current bit cell
+
+	// Needed to write back
+	wozSave   string
+	saveFile  string
+	writeable bool
 }
 
 func (d *cardDisk2SequencerDrive) insertDiskette(filename string) error {
-	data, writeable, err := LoadResource(filename)
+	data, writeable, err := LoadResource(wozLoadFile(d.wozSave, filename))
 	if err != nil {
 		return err
 	}
-	f, err := storage.NewFileWoz(data)
+	f, err := storage.MakeFileWoz(data)
 	if err != nil {
 		return err
 	}
@@ -36,15 +48,31 @@ func (d *cardDisk2SequencerDrive) insertDiskette(filename string) error {
 	}
 
 	d.data = f
-	d.writeProtected = !writeable
+	d.writeProtected = f.Info.WriteProtected == 1
+	d.writeable = writeable
+	d.saveFile = wozSaveFile(d.wozSave, filename)
 
 	return nil
 }
 
 func (d *cardDisk2SequencerDrive) enable(enabled bool) {
+	if d.enabled && !enabled {
+		d.commit()
+	}
 	d.enabled = enabled
 }
 
+func (d *cardDisk2SequencerDrive) commit() {
+	if d.data == nil || d.saveFile == "" || !d.writeable || !d.data.IsModified() {
+		return
+	}
+	err := d.data.Save(d.saveFile)
+	if err != nil {
+		fmt.Printf("Data can't be written to %v: %v\n", d.saveFile, err)
+		d.saveFile = ""
+	}
+}
+
 func (d *cardDisk2SequencerDrive) moveHead(q0, q1, q2, q3 bool, trackTracer trackTracer, slot int, driveNumber int) {
 	if !d.enabled {
 		return
@@ -61,11 +89,61 @@ func (d *cardDisk2SequencerDrive) moveHead(q0, q1, q2, q3 bool, trackTracer trac
 	}
 }
 
-func (d *cardDisk2SequencerDrive) readPulse() bool {
+/*
+The sequencer runs at 2Mhz, every step is 500 nanoseconds or 4 ticks of
+the 125 nanoseconds used by the WOZ timings. On tracks with bits, a new
+bit is read every OptimalBitTiming ticks, usually 32. On tracks with flux
+transition timings, the pulse is sent on the step the transition happens.
+*/
+const disk2TicksPerStep = 4
+
+func (d *cardDisk2SequencerDrive) step() bool {
 	if !d.enabled || d.data == nil {
 		return false
 	}
 
+	if d.data.HasFlux(d.currentQuarterTrack) && !d.writing {
+		return d.fluxPulse()
+	}
+
+	d.ticks += disk2TicksPerStep
+	if d.ticks < d.data.BitTiming() {
+		return false
+	}
+	d.ticks -= d.data.BitTiming()
+	return d.readPulse()
+}
+
+func (d *cardDisk2SequencerDrive) fluxPulse() bool {
+	if d.fluxTicks > disk2TicksPerStep {
+		d.fluxTicks -= disk2TicksPerStep
+		return false
+	}
+
+	var ticks uint32
+	ticks, d.position, d.positionMax = d.data.GetNextFluxAndPosition(
+		d.position,
+		d.positionMax,
+		d.currentQuarterTrack)
+	// The next transition time is relative to the next step
+	d.fluxTicks += ticks
+	if d.fluxTicks > disk2TicksPerStep {
+		d.fluxTicks -= disk2TicksPerStep
+	} else {
+		d.fluxTicks = 0
+	}
+	return true
+}
+
+func (d *cardDisk2SequencerDrive) readPulse() bool {
+
+	// Store what has been written on the bit cell before moving to the next
+	if d.writing {
+		d.data.SetBit(d.writeFlux, d.position, d.positionMax, d.currentQuarterTrack)
+		d.writing = false
+		d.writeFlux = false
+	}
+
 	// Get next bit taking into account the MC3470 latency and weak bits
 	var fluxBit bool
 	fluxBit, d.position, d.positionMax = d.data.GetNextBitAndPosition(
@@ -91,9 +169,7 @@ func (d *cardDisk2SequencerDrive) writePulse(value bool) {
 		return
 	}
 
-	d.data.SetBit(
-		value,
-		d.position,
-		d.positionMax,
-		d.currentQuarterTrack)
+	// The bit is stored when the head moves to the next bit cell
+	d.writing = true
+	d.writeFlux = d.writeFlux || value
 }
@@ -1,5 +1,7 @@
 package izapple2
 
+import "io"
+
 /*
 Simulates just what is needed to make Total Replay use fast mode. Can change
 from controlled speed to max speed the emulator can do.
@@ -98,3 +100,31 @@ func (c *CardFastChip) setSpeed(a *Apple2, value uint8) {
 	}
 	c.accelerated = newAccelerated
 }
+
+func (c *CardFastChip) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	return saveValues(w, &c.unlocked, &c.unlockCounter, &c.enabled, &c.accelerated, &c.configRegister)
+}
+
+func (c *CardFastChip) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	var accelerated bool
+	err = loadValues(r, &c.unlocked, &c.unlockCounter, &c.enabled, &accelerated, &c.configRegister)
+	if err != nil {
+		return err
+	}
+
+	// Go through setSpeed to keep the fast mode requests balanced
+	speed := fastChipNormalSpeed
+	if accelerated {
+		speed++
+	}
+	c.setSpeed(c.a, speed)
+	return nil
+}
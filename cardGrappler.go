@@ -0,0 +1,290 @@
+package izapple2
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ivanizag/izapple2/screen"
+)
+
+/*
+Orange Micro Grappler+ printer interface card.
+
+See:
+	"Grappler+ Printer Interface Operators Manual", Orange Micro
+
+Softswitches:
+
+	$C0n0: write the data to the printer and send the strobe
+	$C0n1: status, bit 0 BUSY, bit 1 PAPER OUT, bit 2 SELECT, bit 3 ACK of
+		the last byte, cleared on the next strobe
+
+The ROM of the card can be loaded with the rom param as a 2KB dump. The
+firmware commands are then interpreted by the Grappler firmware.
+
+Without it, a simplified firmware prints with PR#n and echoes the output
+on the screen. The card interprets the commands received from the
+simplified firmware, sending ESC/P graphics to the printer as for an
+Epson printer:
+
+	Ctrl-I G: hi-res screen dump, preceded by 2 for page 2, and followed
+		by D for double size, I for inverse and R for rotated
+	Ctrl-I T: text screen dump
+	Ctrl-I nN: line length of n characters, disables the screen echo
+
+The commands end with a carriage return. The simplified firmware uses
+$C0n2 and $C0n4 that are not present on the real card.
+*/
+
+// CardGrappler represents a Grappler+ printer interface card
+type CardGrappler struct {
+	cardBase
+	printer    *printerOutput
+	builtinRom bool
+	busyUntil  uint64
+	strobed    bool
+	echo       bool
+	inCommand  bool
+	command    []uint8 // Ctrl-I command being received
+	lineLength int
+	column     int
+}
+
+const (
+	grapplerBusyCycles = 100
+
+	grapplerStatusBusy   uint8 = 1 << 0
+	grapplerStatusSelect uint8 = 1 << 2
+	grapplerStatusAck    uint8 = 1 << 3
+
+	grapplerCommandChar = 0x09 // Ctrl-I
+)
+
+func newCardGrapplerBuilder() *cardBuilder {
+	params := append([]paramSpec{
+		{"rom", "ROM file of the card, 2KB. Empty to use a simplified firmware", ""},
+	}, printerOutputParams...)
+
+	return &cardBuilder{
+		name:          "Grappler+",
+		description:   "Orange Micro Grappler+ printer interface card with screen dumps",
+		defaultParams: &params,
+		buildFunc: func(params map[string]string) (Card, error) {
+			var c CardGrappler
+			var err error
+			c.printer, err = newPrinterOutput(params)
+			if err != nil {
+				return nil, err
+			}
+
+			romFile := paramsGetPath(params, "rom")
+			if romFile != "" {
+				err = c.loadRomFromResource(romFile, cardRomUpperEnd)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				c.builtinRom = true
+			}
+			c.echo = true
+			return &c, nil
+		},
+	}
+}
+
+func (c *CardGrappler) assign(a *Apple2, slot int) {
+	if c.builtinRom {
+		c.loadRom(buildGrapplerRom(slot), cardRomSimple)
+	}
+
+	c.addCardSoftSwitchW(0, func(value uint8) {
+		c.strobe(value)
+	}, "GRAPPLERDATA")
+
+	c.addCardSoftSwitchR(1, func() uint8 {
+		return c.status()
+	}, "GRAPPLERSTATUS")
+
+	if c.builtinRom {
+		c.addCardSoftSwitchR(2, func() uint8 {
+			if c.echo {
+				return 0x80
+			}
+			return 0
+		}, "GRAPPLERECHO")
+
+		c.addCardSoftSwitchW(4, func(value uint8) {
+			c.firmwareOutput(value)
+		}, "GRAPPLERFIRMWARE")
+	}
+
+	c.cardBase.assign(a, slot)
+}
+
+func (c *CardGrappler) reset() {
+	c.inCommand = false
+	c.command = nil
+}
+
+func (c *CardGrappler) close() {
+	c.printer.close()
+}
+
+// strobe sends a byte to the printer, it is busy for a while
+func (c *CardGrappler) strobe(value uint8) {
+	c.printer.write(value)
+	c.busyUntil = c.a.GetCycles() + grapplerBusyCycles
+	c.strobed = true
+}
+
+func (c *CardGrappler) status() uint8 {
+	status := grapplerStatusSelect
+	if c.a.GetCycles() < c.busyUntil {
+		status |= grapplerStatusBusy
+	} else if c.strobed {
+		status |= grapplerStatusAck
+	}
+	return status
+}
+
+// firmwareOutput processes the characters printed with the simplified
+// firmware
+func (c *CardGrappler) firmwareOutput(value uint8) {
+	char := value & 0x7f
+	if c.inCommand {
+		if char == '\r' {
+			c.inCommand = false
+			c.execute(strings.ToUpper(string(c.command)))
+			return
+		}
+		c.command = append(c.command, char)
+		return
+	}
+
+	switch {
+	case char == grapplerCommandChar:
+		c.inCommand = true
+		c.command = nil
+	case char == '\r':
+		c.column = 0
+		c.strobe(value)
+	case c.lineLength > 0 && c.column >= c.lineLength && char >= ' ':
+		c.strobe('\r' | value&0x80)
+		c.column = 1
+		c.strobe(value)
+	default:
+		if char >= ' ' {
+			c.column++
+		}
+		c.strobe(value)
+	}
+}
+
+func (c *CardGrappler) execute(command string) {
+	// A number can precede the command letter
+	i := 0
+	for i < len(command) && command[i] >= '0' && command[i] <= '9' {
+		i++
+	}
+	if i == len(command) {
+		return
+	}
+	number, _ := strconv.Atoi(command[:i])
+	options := command[i+1:]
+
+	switch command[i] {
+	case 'G':
+		c.dumpHiRes(number == 2,
+			strings.Contains(options, "D"),
+			strings.Contains(options, "I"),
+			strings.Contains(options, "R"))
+	case 'T':
+		c.dumpText()
+	case 'N':
+		c.lineLength = number
+		c.echo = false
+	}
+	// Other commands are ignored
+}
+
+func (c *CardGrappler) sendBytes(data []uint8) {
+	for _, value := range data {
+		c.strobe(value)
+	}
+}
+
+// dumpHiRes prints the hi-res screen as ESC/P bit image graphics
+func (c *CardGrappler) dumpHiRes(secondPage bool, double bool, inverse bool, rotate bool) {
+	data := c.a.video.GetVideoMemory(secondPage, false)
+	pixel := func(x int, y int) bool {
+		if rotate {
+			x, y = y, hiResHeight-1-x
+		}
+		line := (y>>6)*40 + ((y>>3)&7)*0x80 + (y&7)*0x400 // See getHiResLineOffset
+		on := data[line+x/7]>>(x%7)&1 == 1
+		return on != inverse
+	}
+
+	width, height := hiResWidth, hiResHeight
+	if rotate {
+		width, height = height, width
+	}
+	scale := 1
+	if double {
+		scale = 2
+	}
+	columns := width * scale
+
+	c.sendBytes([]uint8{'\r', 0x1b, 'A', 8}) // Line spacing of 8 pins
+	for band := 0; band < height*scale; band += 8 {
+		// CRT graphics, 80 dots per inch
+		c.sendBytes([]uint8{0x1b, '*', 4, uint8(columns), uint8(columns >> 8)})
+		for x := 0; x < columns; x++ {
+			var dots uint8
+			for pin := 0; pin < 8; pin++ {
+				y := band + pin
+				if y < height*scale && pixel(x/scale, y/scale) {
+					dots |= 0x80 >> pin
+				}
+			}
+			c.strobe(dots)
+		}
+		c.sendBytes([]uint8{'\r', '\n'})
+	}
+	c.sendBytes([]uint8{0x1b, '2'}) // Line spacing of 1/6 inch
+}
+
+// dumpText prints the 40 columns text screen
+func (c *CardGrappler) dumpText() {
+	text := screen.RenderTextModeString(c.a.video, false, false, false, c.a.video.SupportsLowercase(), false)
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		c.sendBytes([]uint8(line))
+		c.sendBytes([]uint8{'\r', '\n'})
+	}
+}
+
+const (
+	hiResWidth  = 280
+	hiResHeight = 192
+)
+
+func buildGrapplerRom(slot int) []uint8 {
+	data := make([]uint8, 256)
+	ssBase := 0x80 + uint8(slot<<4)
+
+	copy(data, []uint8{
+		0x48,                   // PHA
+		0x2c, ssBase + 2, 0xc0, // BIT $C0n2 ; N set to echo on the screen
+		0x10, 0x03, // BPL wait
+		0x20, 0xf0, 0xfd, // JSR COUT1
+		// wait
+		0xad, ssBase + 1, 0xc0, // LDA $C0n1
+		0x29, 0x01, // AND #$01 ; Busy?
+		0xd0, 0xf9, // BNE wait
+		0x68,                   // PLA
+		0x8d, ssBase + 4, 0xc0, // STA $C0n4
+		0x60, // RTS
+	})
+
+	return data
+}
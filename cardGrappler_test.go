@@ -0,0 +1,123 @@
+package izapple2
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makeGrapplerTester(t *testing.T) (*Apple2, *CardGrappler, string) {
+	file := filepath.Join(t.TempDir(), "printer.out")
+	overrides := newConfiguration()
+	overrides.set(confS1, "grappler,printer=raw,file="+file)
+	at, err := makeApple2Tester("2plus", overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := at.a
+	card, ok := a.cards[1].(*CardGrappler)
+	if !ok {
+		t.Fatal("The Grappler+ should be in slot 1")
+	}
+	return a, card, file
+}
+
+// grapplerPrint sends the text as printed with PR#1
+func grapplerPrint(a *Apple2, text string) {
+	for _, value := range []uint8(text) {
+		a.mmu.Poke(0xc094, value|0x80)
+	}
+}
+
+func grapplerPrinted(t *testing.T, card *CardGrappler, file string) []uint8 {
+	card.close()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestCardGrapplerHandshake(t *testing.T) {
+	a, card, file := makeGrapplerTester(t)
+
+	a.mmu.Poke(0xc090, 'A')
+	if a.mmu.Peek(0xc091)&grapplerStatusBusy == 0 {
+		t.Error("The printer should be busy after the strobe")
+	}
+	a.cycles += grapplerBusyCycles
+	status := a.mmu.Peek(0xc091)
+	if status&grapplerStatusBusy != 0 || status&grapplerStatusAck == 0 {
+		t.Errorf("The printer should acknowledge the byte, got status $%02x", status)
+	}
+
+	if data := grapplerPrinted(t, card, file); string(data) != "A" {
+		t.Errorf("The byte should be printed, got %q", data)
+	}
+}
+
+func TestCardGrapplerHiResDump(t *testing.T) {
+	a, card, file := makeGrapplerTester(t)
+	for address := uint16(0x2000); address < 0x4000; address++ {
+		a.mmu.Poke(address, 0)
+	}
+	a.mmu.Poke(0x2000, 0x01) // Pixel 0,0
+	a.mmu.Poke(0x2401, 0x02) // Pixel 8,1
+
+	grapplerPrint(a, "\tG\r")
+	data := grapplerPrinted(t, card, file)
+
+	header := []uint8{'\r', 0x1b, 'A', 8, 0x1b, '*', 4, 280 & 0xff, 280 >> 8}
+	if !bytes.HasPrefix(data, header) {
+		t.Fatalf("The dump should start with a bit image command, got %v", data[:len(header)])
+	}
+	columns := data[len(header):]
+	if columns[0] != 0x80 || columns[8] != 0x40 || columns[1] != 0 {
+		t.Errorf("The dots should match the pixels, got %v", columns[:9])
+	}
+	bands := bytes.Count(data, []uint8{0x1b, '*', 4})
+	if bands != 192/8 {
+		t.Errorf("The dump should have 24 bands, got %v", bands)
+	}
+}
+
+func TestCardGrapplerTextDump(t *testing.T) {
+	a, card, file := makeGrapplerTester(t)
+	for address := uint16(0x400); address < 0x800; address++ {
+		a.mmu.Poke(address, 0xa0)
+	}
+	a.mmu.Poke(0x400, 'H'|0x80)
+	a.mmu.Poke(0x401, 'I'|0x80)
+
+	grapplerPrint(a, "\tT\r")
+	data := grapplerPrinted(t, card, file)
+	if !bytes.HasPrefix(data, []uint8("HI\r\n\r\n")) || bytes.Count(data, []uint8("\r\n")) != 24 {
+		t.Errorf("The text screen should be printed, got %q", data)
+	}
+}
+
+func TestCardGrapplerLineLength(t *testing.T) {
+	a, card, file := makeGrapplerTester(t)
+	if a.mmu.Peek(0xc092)&0x80 == 0 {
+		t.Error("The output should be echoed on the screen by default")
+	}
+
+	grapplerPrint(a, "\t3N\rABCDE\r")
+	if a.mmu.Peek(0xc092)&0x80 != 0 {
+		t.Error("Setting the line length should disable the echo")
+	}
+	data := grapplerPrinted(t, card, file)
+	if string(data) != "\xc1\xc2\xc3\x8d\xc4\xc5\x8d" {
+		t.Errorf("The lines should be split at 3 characters, got %q", data)
+	}
+}
+
+func TestCardGrapplerMissingRom(t *testing.T) {
+	overrides := newConfiguration()
+	overrides.set(confS1, "grappler,rom=\""+filepath.Join(t.TempDir(), "missing.rom")+"\"")
+	_, err := makeApple2Tester("2plus", overrides)
+	if err == nil {
+		t.Error("A missing ROM should be an error")
+	}
+}
@@ -1,5 +1,7 @@
 package izapple2
 
+import "io"
+
 /*
 Language card with 16 extra kb for the Apple ][ and  ][+
 Manual: http://www.applelogic.org/files/LANGCARDMAN.pdf
@@ -126,3 +128,24 @@ func (c *CardLanguage) ssAction(ss uint8, write bool) {
 func (c *CardLanguage) applyState() {
 	c.a.mmu.setLanguageRAM(c.readState, c.writeState == lcWriteEnabled, c.altBank)
 }
+
+func (c *CardLanguage) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	return saveValues(w, &c.readState, &c.writeState, &c.altBank)
+}
+
+func (c *CardLanguage) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	err = loadValues(r, &c.readState, &c.writeState, &c.altBank)
+	if err != nil {
+		return err
+	}
+	c.applyState()
+	return nil
+}
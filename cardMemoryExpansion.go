@@ -1,6 +1,9 @@
 package izapple2
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+)
 
 /*
 Apple II Memory Expansion Card
@@ -142,3 +145,19 @@ func (c *CardMemoryExpansion) assign(a *Apple2, slot int) {
 
 	c.cardBase.assign(a, slot)
 }
+
+func (c *CardMemoryExpansion) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	return saveValues(w, c.ram, &c.index)
+}
+
+func (c *CardMemoryExpansion) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	return loadValues(r, c.ram, &c.index)
+}
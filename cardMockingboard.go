@@ -1,6 +1,10 @@
 package izapple2
 
 import (
+	"errors"
+	"fmt"
+	"io"
+
 	"github.com/ivanizag/izapple2/component"
 )
 
@@ -28,19 +32,61 @@ The IRQ outputs of both VIAs are wired to the 6502 IRQ line. The VIA
 timers are caught up on every access and on every instruction, so the
 timer reads used by the Mockingboard detection routines are cycle exact.
 
-The mixed output level of both PSGs is reported to the frontend as an
-AudioSource, stepping the chips every 8 CPU cycles.
+The output levels of the PSGs are reported to the frontend as two
+AudioSources, the VIA 1 PSG on the left channel and the VIA 2 PSG on the
+right, stepping the chips every 8 CPU cycles.
+
+Optionally a speech chip is present, selected with the speech param:
+
+	ssi263: SSI-263 as on the Mockingboard C, its registers replace the
+		VIA 1 mirror on $Cn40-$Cn7F. A/R is wired to the VIA 1 CA1.
+	sc01: Votrax SC-01 as on the Sound/Speech I, written on the VIA 1
+		port B when DDRB is $FF and PCR is $B0. A/R is wired to the VIA 1
+		CB1.
+
+The speech is synthesized even without a sink, the software waits for
+the interrupts at the end of the phonemes. It is reported as a third
+AudioSource, centered.
+
+The Applied Engineering Phasor is built as the phasor card. It has two
+more AY-3-8913, a second one on each VIA. The mode is selected accessing
+the $C0n0-$C0nF softswitches, the address bits 0 and 2 set the mode:
+
+	$C0n0: Mockingboard compatible mode, as described above
+	$C0n5: Phasor native mode
+
+The other combinations behave as the Mockingboard compatible mode.
+
+On the native mode the address bit 4 selects the VIA 1 and bit 7 the VIA
+2. Both can be selected at once, the writes go to both and the reads are
+combined. The port B bits 3 and 4 are the chip selects, active low, of
+the two AY-3-8913 of each VIA. The PSGs are clocked at 2 MHz.
+
+The register writes to the PSGs can be logged to VGM or YM files with the
+vgm and ym tracers, see psgLog.go.
 */
 type CardMockingboard struct {
 	cardBase
 	via       [2]component.MOS6522
-	psg       [2]component.AY38913
-	lastBusOp [2]uint8
+	psg       [4]component.AY38913 // The VIA n drives the PSGs n and n+2
+	lastBusOp [4]uint8
+
+	phasor     bool
+	phasorMode uint8
+
+	sink      [2]AudioSink // Left and right channels
+	lastCycle uint64       // The chips are caught up to this cycle
+	psgCycle  uint64       // Start of the next PSG synthesis step
+	lastLevel [2]float32
 
-	sink      AudioSink
-	lastCycle uint64 // The chips are caught up to this cycle
-	psgCycle  uint64 // Start of the next PSG synthesis step
-	lastLevel float32
+	speech      string
+	ssi263      component.SSI263
+	sc01        component.VotraxSC01
+	speechSink  AudioSink
+	speechCycle uint64 // Start of the next speech synthesis step
+	speechLevel float32
+
+	psgLog psgLogger // Optional log of the PSG register writes
 }
 
 const (
@@ -49,20 +95,65 @@ const (
 	mockingboardBusLatch uint8 = 3
 
 	mockingboardPsgStepCycles = 8
+
+	mockingboardSpeechStepCycles = 102 // About component.SpeechSampleRate
+
+	mockingboardSpeechNone   = "none"
+	mockingboardSpeechSSI263 = "ssi263"
+	mockingboardSpeechSC01   = "sc01"
+
+	mockingboardSSI263Base = 0x40 // SSI-263 on $Cn40-$Cn7F
+
+	phasorModeMockingboard uint8 = 0
+	phasorModeNative       uint8 = 5
 )
 
+var mockingboardParams = []paramSpec{
+	{"speech", "Speech chip: none, ssi263 or sc01", mockingboardSpeechNone},
+}
+
 func newCardMockingboardBuilder() *cardBuilder {
 	return &cardBuilder{
-		name:        "Mockingboard",
-		description: "Mockingboard sound card with two AY-3-8913 sound generators",
+		name:          "Mockingboard",
+		description:   "Mockingboard sound card with two AY-3-8913 sound generators",
+		defaultParams: &mockingboardParams,
 		buildFunc: func(params map[string]string) (Card, error) {
-			var c CardMockingboard
-			return &c, nil
+			return buildMockingboard(params, false)
 		},
 	}
 }
 
+func newCardPhasorBuilder() *cardBuilder {
+	return &cardBuilder{
+		name:          "Phasor",
+		description:   "Applied Engineering Phasor sound card with four AY-3-8913 sound generators",
+		defaultParams: &mockingboardParams,
+		buildFunc: func(params map[string]string) (Card, error) {
+			return buildMockingboard(params, true)
+		},
+	}
+}
+
+func buildMockingboard(params map[string]string, phasor bool) (Card, error) {
+	var c CardMockingboard
+	c.phasor = phasor
+	c.speech = paramsGetString(params, "speech")
+	switch c.speech {
+	case mockingboardSpeechNone, mockingboardSpeechSSI263, mockingboardSpeechSC01:
+	default:
+		return nil, fmt.Errorf("invalid speech chip '%v'", c.speech)
+	}
+	return &c, nil
+}
+
 func (c *CardMockingboard) assign(a *Apple2, slot int) {
+	if c.phasor {
+		c.addCardSoftSwitches(func(address uint8, _ uint8, _ bool) uint8 {
+			c.catchUp()
+			c.phasorMode = address & 0x05
+			return 0
+		}, "PHASORMODE")
+	}
 	c.cardBase.assign(a, slot)
 	if slot != 0 {
 		a.mmu.setCardROM(slot, traceMemory(c, c.name, c.traceMemory))
@@ -70,16 +161,27 @@ func (c *CardMockingboard) assign(a *Apple2, slot int) {
 	a.registerTickerCard(c)
 	c.lastCycle = a.GetCycles()
 	c.psgCycle = c.lastCycle
-	c.psg[0].Reset()
-	c.psg[1].Reset()
+	c.speechCycle = c.lastCycle
+	for i := range c.psg {
+		c.psg[i].Reset()
+	}
+	c.ssi263.Reset()
+	c.sc01.Reset()
+	c.updateSpeechLines()
 }
 
 func (c *CardMockingboard) reset() {
-	for i := range 2 {
+	for i := range c.via {
 		c.via[i].Reset()
+	}
+	for i := range c.psg {
 		c.psg[i].Reset()
 		c.lastBusOp[i] = 0
 	}
+	c.phasorMode = phasorModeMockingboard
+	c.ssi263.Reset()
+	c.sc01.Reset()
+	c.updateSpeechLines()
 	if c.a != nil {
 		c.a.requestIRQ(c.slot, false)
 	}
@@ -88,46 +190,115 @@ func (c *CardMockingboard) reset() {
 // peek and poke serve the $Cn00-$CnFF page, implementing memoryHandler
 func (c *CardMockingboard) peek(address uint16) uint8 {
 	c.catchUp()
-	n := int(address>>7) & 1
-	value := c.via[n].Read(uint8(address & 0x0f))
+	if c.isSSI263Address(address) {
+		return c.ssi263.Read()
+	}
+	var value uint8
+	selected := c.selectedVias(address)
+	for n := range c.via {
+		if selected&(1<<n) != 0 {
+			value |= c.via[n].Read(uint8(address & 0x0f))
+		}
+	}
 	c.updateIRQ() // Some register reads clear interrupt flags
 	return value
 }
 
 func (c *CardMockingboard) poke(address uint16, value uint8) {
 	c.catchUp()
-	n := int(address>>7) & 1
+	if c.isSSI263Address(address) {
+		c.ssi263.Write(uint8(address&0x07), value)
+		c.updateSpeechLines()
+		c.updateIRQ()
+		return
+	}
 	reg := uint8(address & 0x0f)
-	c.via[n].Write(reg, value)
-	if reg == 0 || reg == 2 {
-		// ORB or DDRB writes can change the PSG bus control lines
-		c.updatePsgBus(n)
+	selected := c.selectedVias(address)
+	for n := range c.via {
+		if selected&(1<<n) == 0 {
+			continue
+		}
+		c.via[n].Write(reg, value)
+		if n == 0 && reg == 0 && c.isSC01Selected() {
+			c.sc01.Write(value)
+			c.updateSpeechLines()
+		} else if reg == 0 || reg == 2 {
+			// ORB or DDRB writes can change the PSG bus control lines
+			c.updatePsgBus(n)
+		}
 	}
 	c.updateIRQ()
 }
 
+// selectedVias returns the VIAs addressed, bit 0 for VIA 1 and bit 1 for
+// VIA 2
+func (c *CardMockingboard) selectedVias(address uint16) uint8 {
+	if c.phasorMode == phasorModeNative {
+		return uint8(address>>6)&0x02 | uint8(address>>4)&0x01
+	}
+	return 1 << ((address >> 7) & 1)
+}
+
 // updatePsgBus runs the AY-3-8913 bus protocol wired to the VIA port B
 func (c *CardMockingboard) updatePsgBus(n int) {
 	portB := c.via[n].GetPortB()
-	if portB&0x04 == 0 {
-		// /RESET is active low
-		c.psg[n].Reset()
-		c.lastBusOp[n] = 0
-		return
+
+	// On the Phasor native mode the bits 3 and 4 select the PSGs
+	chips := []int{n}
+	if c.phasorMode == phasorModeNative {
+		chips = nil
+		if portB&0x08 == 0 {
+			chips = append(chips, n)
+		}
+		if portB&0x10 == 0 {
+			chips = append(chips, n+2)
+		}
 	}
 
-	// The operations execute when BDIR-BC1 change
-	busOp := portB & 0x03
-	if busOp != c.lastBusOp[n] {
-		switch busOp {
-		case mockingboardBusRead:
-			c.via[n].SetInputA(c.psg[n].ReadData())
-		case mockingboardBusWrite:
-			c.psg[n].WriteData(c.via[n].GetPortA())
-		case mockingboardBusLatch:
-			c.psg[n].LatchAddress(c.via[n].GetPortA())
+	for _, i := range chips {
+		if portB&0x04 == 0 {
+			// /RESET is active low
+			c.psg[i].Reset()
+			c.lastBusOp[i] = 0
+			continue
 		}
-		c.lastBusOp[n] = busOp
+
+		// The operations execute when BDIR-BC1 change
+		busOp := portB & 0x03
+		if busOp != c.lastBusOp[i] {
+			switch busOp {
+			case mockingboardBusRead:
+				c.via[n].SetInputA(c.psg[i].ReadData())
+			case mockingboardBusWrite:
+				c.psg[i].WriteData(c.via[n].GetPortA())
+				if c.psgLog != nil {
+					c.psgLog.write(c.a.GetCycles(), i, c.psg[i].Address(), c.psg[i].ReadData())
+				}
+			case mockingboardBusLatch:
+				c.psg[i].LatchAddress(c.via[n].GetPortA())
+			}
+			c.lastBusOp[i] = busOp
+		}
+	}
+}
+
+func (c *CardMockingboard) isSSI263Address(address uint16) bool {
+	return c.speech == mockingboardSpeechSSI263 && address&0xc0 == mockingboardSSI263Base
+}
+
+// isSC01Selected checks if the VIA 1 port B is configured to drive the
+// SC-01 instead of the PSG
+func (c *CardMockingboard) isSC01Selected() bool {
+	return c.speech == mockingboardSpeechSC01 && c.via[0].Read(2) == 0xff && c.via[0].Read(12) == 0xb0
+}
+
+// updateSpeechLines sets the VIA 1 control lines wired to the A/R outputs
+func (c *CardMockingboard) updateSpeechLines() {
+	switch c.speech {
+	case mockingboardSpeechSSI263:
+		c.via[0].SetCA1(!c.ssi263.Request())
+	case mockingboardSpeechSC01:
+		c.via[0].SetCB1(c.sc01.Request())
 	}
 }
 
@@ -147,6 +318,7 @@ func (c *CardMockingboard) catchUp() {
 
 	c.via[0].Tick(elapsed)
 	c.via[1].Tick(elapsed)
+	c.speak(current)
 	c.updateIRQ()
 	c.synthesize(current)
 }
@@ -155,31 +327,195 @@ func (c *CardMockingboard) updateIRQ() {
 	c.a.requestIRQ(c.slot, c.via[0].InterruptAsserted() || c.via[1].InterruptAsserted())
 }
 
-// synthesize advances both PSGs up to the given cycle in steps of 8 CPU
-// cycles, reporting the changes of the mixed level to the audio sink
+// synthesize advances the PSGs up to the given cycle in steps of 8 CPU
+// cycles, 4 on the Phasor native mode, reporting the changes of the mixed
+// level to the audio sink
 func (c *CardMockingboard) synthesize(toCycle uint64) {
-	if c.sink == nil {
+	if c.sink[0] == nil && c.sink[1] == nil {
 		c.psgCycle = toCycle
 		return
 	}
 
-	for ; c.psgCycle+mockingboardPsgStepCycles <= toCycle; c.psgCycle += mockingboardPsgStepCycles {
-		// Each PSG ranges from 0.0 to 3.0, scale the sum of both to a
-		// range comparable to the speaker
-		level := (c.psg[0].Step() + c.psg[1].Step()) * 0.25
-		if level != c.lastLevel {
-			c.sink.PushLevel(c.psgCycle, level)
-			c.lastLevel = level
+	// The second PSG of each VIA is only used on the Phasor native mode
+	chips := 2
+	stepCycles := uint64(mockingboardPsgStepCycles)
+	if c.phasorMode == phasorModeNative {
+		chips = 4
+		stepCycles /= 2
+	}
+
+	for ; c.psgCycle+stepCycles <= toCycle; c.psgCycle += stepCycles {
+		// Each PSG ranges from 0.0 to 3.0, scale them to a range comparable
+		// to the speaker. The PSGs n and n+2 are on the channel n.
+		var levels [2]float32
+		for i := range chips {
+			levels[i%2] += c.psg[i].Step()
+		}
+		for ch := range levels {
+			level := levels[ch] * 0.5 / float32(chips)
+			if level != c.lastLevel[ch] {
+				if c.sink[ch] != nil {
+					c.sink[ch].PushLevel(c.psgCycle, level)
+				}
+				c.lastLevel[ch] = level
+			}
+		}
+	}
+}
+
+// speak advances the speech chip up to the given cycle
+func (c *CardMockingboard) speak(toCycle uint64) {
+	if c.speech == mockingboardSpeechNone {
+		return
+	}
+
+	for ; c.speechCycle+mockingboardSpeechStepCycles <= toCycle; c.speechCycle += mockingboardSpeechStepCycles {
+		var level float32
+		if c.speech == mockingboardSpeechSSI263 {
+			level = c.ssi263.Step()
+		} else {
+			level = c.sc01.Step()
+		}
+		level *= 0.5
+		if c.speechSink != nil && level != c.speechLevel {
+			c.speechSink.PushLevel(c.speechCycle, level)
 		}
+		c.speechLevel = level
+		c.updateSpeechLines()
 	}
 }
 
-// GetAudioSourceName implements the AudioSource interface
-func (c *CardMockingboard) GetAudioSourceName() string {
-	return "mockingboard"
+// startPsgLog starts logging the PSG register writes to a VGM or YM file
+func (c *CardMockingboard) startPsgLog(filename string) error {
+	if c.psgLog != nil {
+		return errors.New("the PSG registers are already being logged")
+	}
+	logger, err := newPsgLogger(filename, c.a.GetClockMhz(), c.a.GetCycles())
+	if err != nil {
+		return err
+	}
+	for i := range c.psg {
+		for reg := uint8(0); reg < 14; reg++ {
+			logger.write(c.a.GetCycles(), i, reg, c.psg[i].Register(reg))
+		}
+	}
+	c.psgLog = logger
+	return nil
+}
+
+func (c *CardMockingboard) stopPsgLog() error {
+	if c.psgLog == nil {
+		return errors.New("the PSG registers are not being logged")
+	}
+	err := c.psgLog.close(c.a.GetCycles())
+	c.psgLog = nil
+	return err
+}
+
+func (c *CardMockingboard) close() {
+	if c.psgLog != nil {
+		err := c.stopPsgLog()
+		if err != nil {
+			fmt.Printf("Could not complete the PSG log: %v\n", err)
+		}
+	}
+}
+
+// audioSources returns the PSGs of each channel and the speech chip as
+// separate AudioSources
+func (c *CardMockingboard) audioSources() []AudioSource {
+	name := "mockingboard"
+	if c.phasor {
+		name = "phasor"
+	}
+	sources := []AudioSource{
+		&mockingboardAudioSource{name + " left", -1, &c.sink[0]},
+		&mockingboardAudioSource{name + " right", 1, &c.sink[1]},
+	}
+	if c.speech != mockingboardSpeechNone {
+		sources = append(sources, &mockingboardAudioSource{name + " speech", 0, &c.speechSink})
+	}
+	return sources
 }
 
-// SetAudioSink implements the AudioSource interface
-func (c *CardMockingboard) SetAudioSink(sink AudioSink) {
-	c.sink = sink
+type mockingboardAudioSource struct {
+	name string
+	pan  float32
+	sink *AudioSink
+}
+
+func (s *mockingboardAudioSource) GetAudioSourceName() string {
+	return s.name
+}
+
+func (s *mockingboardAudioSource) GetAudioSourcePan() float32 {
+	return s.pan
+}
+
+func (s *mockingboardAudioSource) SetAudioSink(sink AudioSink) {
+	*s.sink = sink
+}
+
+func (c *CardMockingboard) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		err = c.via[i].SaveState(w)
+		if err != nil {
+			return err
+		}
+		err = c.psg[i].SaveState(w)
+		if err != nil {
+			return err
+		}
+	}
+	for i := 2; i < 4; i++ {
+		err = c.psg[i].SaveState(w)
+		if err != nil {
+			return err
+		}
+	}
+	err = c.ssi263.SaveState(w)
+	if err != nil {
+		return err
+	}
+	err = c.sc01.SaveState(w)
+	if err != nil {
+		return err
+	}
+	return saveValues(w, &c.lastBusOp, &c.lastCycle, &c.psgCycle, &c.lastLevel, &c.speechCycle, &c.speechLevel, &c.phasorMode)
+}
+
+func (c *CardMockingboard) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		err = c.via[i].LoadState(r)
+		if err != nil {
+			return err
+		}
+		err = c.psg[i].LoadState(r)
+		if err != nil {
+			return err
+		}
+	}
+	for i := 2; i < 4; i++ {
+		err = c.psg[i].LoadState(r)
+		if err != nil {
+			return err
+		}
+	}
+	err = c.ssi263.LoadState(r)
+	if err != nil {
+		return err
+	}
+	err = c.sc01.LoadState(r)
+	if err != nil {
+		return err
+	}
+	return loadValues(r, &c.lastBusOp, &c.lastCycle, &c.psgCycle, &c.lastLevel, &c.speechCycle, &c.speechLevel, &c.phasorMode)
 }
@@ -2,11 +2,17 @@ package izapple2
 
 import (
 	"testing"
+
+	"github.com/ivanizag/izapple2/component"
 )
 
 func makeMockingboardTester(t *testing.T) (*Apple2, *CardMockingboard) {
+	return makeMockingboardTesterWithConf(t, "mockingboard")
+}
+
+func makeMockingboardTesterWithConf(t *testing.T, conf string) (*Apple2, *CardMockingboard) {
 	overrides := newConfiguration()
-	overrides.set(confS4, "mockingboard")
+	overrides.set(confS4, conf)
 	at, err := makeApple2Tester("2plus", overrides)
 	if err != nil {
 		t.Fatal(err)
@@ -83,12 +89,18 @@ func TestCardMockingboardSecondVIA(t *testing.T) {
 
 // writePsg drives the AY bus protocol like the Mockingboard drivers do
 func writePsg(a *Apple2, base uint16, reg uint8, value uint8) {
-	a.mmu.Poke(base+1, reg)  // ORA: register number
-	a.mmu.Poke(base, 4|3)    // Latch address
-	a.mmu.Poke(base, 4)      // Inactive
+	writePsgLines(a, base, 4, reg, value)
+}
+
+// writePsgLines drives the AY bus protocol with the other port B lines
+// set as in lines
+func writePsgLines(a *Apple2, base uint16, lines uint8, reg uint8, value uint8) {
+	a.mmu.Poke(base+1, reg)   // ORA: register number
+	a.mmu.Poke(base, lines|3) // Latch address
+	a.mmu.Poke(base, lines)   // Inactive
 	a.mmu.Poke(base+1, value)
-	a.mmu.Poke(base, 4|2) // Write data
-	a.mmu.Poke(base, 4)   // Inactive
+	a.mmu.Poke(base, lines|2) // Write data
+	a.mmu.Poke(base, lines)   // Inactive
 }
 
 func TestCardMockingboardPsgBus(t *testing.T) {
@@ -112,28 +124,37 @@ func TestCardMockingboardPsgBus(t *testing.T) {
 }
 
 type testAudioSink struct {
-	events int
+	events   int
+	maxLevel float32
 }
 
 func (s *testAudioSink) PushLevel(cycle uint64, level float32) {
 	s.events++
+	s.maxLevel = max(s.maxLevel, level)
 }
 
 func TestCardMockingboardGeneratesSound(t *testing.T) {
 	a, card := makeMockingboardTester(t)
 
-	var card2 AudioSource
+	var left, right AudioSource
 	for _, source := range a.GetAudioSources() {
-		if source.GetAudioSourceName() == "mockingboard" {
-			card2 = source
+		switch source.GetAudioSourceName() {
+		case "mockingboard left":
+			left = source
+		case "mockingboard right":
+			right = source
 		}
 	}
-	if card2 == nil {
-		t.Fatal("The card should be published as an audio source")
+	if left == nil || right == nil {
+		t.Fatal("The card should be published as two audio sources")
+	}
+	if left.GetAudioSourcePan() != -1 || right.GetAudioSourcePan() != 1 {
+		t.Error("The PSGs should be on the left and right channels")
 	}
 
-	var sink testAudioSink
-	card2.SetAudioSink(&sink)
+	var sink, rightSink testAudioSink
+	left.SetAudioSink(&sink)
+	right.SetAudioSink(&rightSink)
 
 	a.mmu.Poke(0xc403, 0xff)
 	a.mmu.Poke(0xc402, 0x07)
@@ -147,4 +168,145 @@ func TestCardMockingboardGeneratesSound(t *testing.T) {
 	if sink.events < 10 {
 		t.Errorf("The sink should receive the tone level changes, got %v", sink.events)
 	}
+	if rightSink.events != 0 {
+		t.Errorf("The VIA 2 PSG is silent, the right sink should not change, got %v", rightSink.events)
+	}
+}
+
+// runMockingboard advances the emulation until the IRQ is requested
+func runMockingboard(a *Apple2, card *CardMockingboard, maxCycles uint64) uint64 {
+	var elapsed uint64
+	for elapsed = 0; elapsed < maxCycles && a.irqRequests == 0; elapsed += 100 {
+		a.cycles += 100
+		card.tick()
+	}
+	return elapsed
+}
+
+func TestCardMockingboardSSI263(t *testing.T) {
+	a, card := makeMockingboardTesterWithConf(t, "mockingboard,speech=ssi263")
+
+	a.mmu.Poke(0xc40e, 0x82) // IER: enable CA1
+	a.mmu.Poke(0xc443, 0x80) // CTL set
+	a.mmu.Poke(0xc440, 0xc0) // Mode 3
+	a.mmu.Poke(0xc443, 0x7f) // CTL clear, full amplitude
+	a.mmu.Poke(0xc442, 0xf8) // Fastest rate
+	a.mmu.Poke(0xc440, 0xce) // AH
+
+	if a.mmu.Peek(0xc440)&0x80 != 0 {
+		t.Error("The SSI-263 should be speaking")
+	}
+	elapsed := runMockingboard(a, card, 100_000)
+	if a.irqRequests == 0 {
+		t.Fatal("The IRQ should be requested when the phoneme ends")
+	}
+	if elapsed < 3_000 || elapsed > 6_000 {
+		t.Errorf("The phoneme should last about 4ms, got %v cycles", elapsed)
+	}
+	if a.mmu.Peek(0xc440)&0x80 == 0 {
+		t.Error("The SSI-263 should request a phoneme")
+	}
+
+	// Writing a phoneme and clearing the flag releases the IRQ
+	a.mmu.Poke(0xc440, 0xce)
+	a.mmu.Peek(0xc401)
+	if a.irqRequests != 0 {
+		t.Error("The IRQ should be released")
+	}
+
+	// The VIA 1 is not mirrored on the SSI-263 addresses
+	a.mmu.Poke(0xc443, 0x80)
+	if a.mmu.Peek(0xc403) != 0 {
+		t.Error("The VIA 1 DDRA should not be modified")
+	}
+}
+
+func TestCardMockingboardSC01(t *testing.T) {
+	a, card := makeMockingboardTesterWithConf(t, "mockingboard,speech=sc01")
+
+	a.mmu.Poke(0xc402, 0xff) // DDRB all outputs
+	a.mmu.Poke(0xc40c, 0xb0) // PCR: CB1 positive edge
+	a.mmu.Poke(0xc40e, 0x90) // IER: enable CB1
+	a.mmu.Poke(0xc400, 0x03) // PA0, 47ms
+
+	if card.sc01.Phoneme() != "PA0" {
+		t.Errorf("The phoneme should be written to the SC-01, got %v", card.sc01.Phoneme())
+	}
+	elapsed := runMockingboard(a, card, 1_000_000)
+	if a.irqRequests == 0 {
+		t.Fatal("The IRQ should be requested when the phoneme ends")
+	}
+	if elapsed < 45_000 || elapsed > 50_000 {
+		t.Errorf("The phoneme should last 47ms, got %v cycles", elapsed)
+	}
+
+	// Writing port B clears the flag
+	a.mmu.Poke(0xc400, 0x24)
+	if a.irqRequests != 0 {
+		t.Error("The IRQ should be released")
+	}
+}
+
+func readPsgRegister(psg *component.AY38913, reg uint8) uint8 {
+	psg.LatchAddress(reg)
+	return psg.ReadData()
+}
+
+func TestCardPhasorNativeMode(t *testing.T) {
+	a, card := makeMockingboardTesterWithConf(t, "phasor")
+
+	a.mmu.Peek(0xc0c5) // Native mode
+	if card.selectedVias(0xc400) != 0 {
+		t.Error("No VIA should be selected without A4 and A7")
+	}
+
+	// Setup the ports of both VIAs at once
+	a.mmu.Poke(0xc493, 0xff)
+	a.mmu.Poke(0xc492, 0x1f)
+	if card.via[0].Read(3) != 0xff || card.via[1].Read(3) != 0xff {
+		t.Fatal("Both VIAs should be written")
+	}
+
+	// Write the amplitude A of each of the four PSGs
+	writePsgLines(a, 0xc410, 0x04|0x10, 8, 1) // VIA 1, first PSG
+	writePsgLines(a, 0xc410, 0x04|0x08, 8, 2) // VIA 1, second PSG
+	writePsgLines(a, 0xc480, 0x04|0x10, 8, 3) // VIA 2, first PSG
+	writePsgLines(a, 0xc480, 0x04|0x08, 8, 4) // VIA 2, second PSG
+	for i, expected := range []uint8{1, 3, 2, 4} {
+		if v := readPsgRegister(&card.psg[i], 8); v != expected {
+			t.Errorf("The PSG %v should have the amplitude %v, got %v", i, expected, v)
+		}
+	}
+
+	// Back to the Mockingboard mode, only the first PSG of each VIA is used
+	a.mmu.Peek(0xc0c0)
+	writePsg(a, 0xc400, 8, 5)
+	if readPsgRegister(&card.psg[0], 8) != 5 || readPsgRegister(&card.psg[2], 8) != 2 {
+		t.Error("The Mockingboard mode should address the first PSG of the VIA 1")
+	}
+}
+
+// maxToneLevel plays a full volume tone on the first PSG and returns the
+// highest level on the left channel
+func maxToneLevel(t *testing.T, conf string) float32 {
+	a, card := makeMockingboardTesterWithConf(t, conf)
+	var sink testAudioSink
+	card.audioSources()[0].SetAudioSink(&sink)
+
+	a.mmu.Poke(0xc403, 0xff)
+	a.mmu.Poke(0xc402, 0x07)
+	writePsg(a, 0xc400, 0, 100)  // Tone A period
+	writePsg(a, 0xc400, 7, 0x3e) // Mixer: only tone A
+	writePsg(a, 0xc400, 8, 15)   // Full volume
+	a.cycles += 10_000
+	card.tick()
+	return sink.maxLevel
+}
+
+func TestCardPhasorMockingboardModeVolume(t *testing.T) {
+	mockingboard := maxToneLevel(t, "mockingboard")
+	phasor := maxToneLevel(t, "phasor")
+	if mockingboard == 0 || phasor != mockingboard {
+		t.Errorf("The Phasor should play Mockingboard software at the same volume, got %v and %v", phasor, mockingboard)
+	}
 }
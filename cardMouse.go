@@ -2,6 +2,7 @@ package izapple2
 
 import (
 	"fmt"
+	"io"
 )
 
 /*
@@ -269,3 +270,23 @@ func (c *CardMouse) assign(a *Apple2, slot int) {
 
 	c.cardBase.assign(a, slot)
 }
+
+func (c *CardMouse) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	return saveValues(w, &c.lastX, &c.lastY, &c.lastPressed,
+		&c.minX, &c.minY, &c.maxX, &c.maxY, &c.mode,
+		&c.response, &c.iOut, &c.iIn)
+}
+
+func (c *CardMouse) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	return loadValues(r, &c.lastX, &c.lastY, &c.lastPressed,
+		&c.minX, &c.minY, &c.maxX, &c.maxY, &c.mode,
+		&c.response, &c.iOut, &c.iIn)
+}
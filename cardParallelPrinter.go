@@ -1,9 +1,5 @@
 package izapple2
 
-import (
-	"os"
-)
-
 /*
 Apple II Parallel Printer Interface card.
 
@@ -15,27 +11,21 @@ See:
 // CardParallelPrinter represents a Parallel Printer Interface card
 type CardParallelPrinter struct {
 	cardBase
-	file  *os.File
-	ascii bool
+	printer *printerOutput
 }
 
 func newCardParallelPrinterBuilder() *cardBuilder {
 	return &cardBuilder{
-		name:        "Parallel Printer Interface",
-		description: "Card to dump to a file what would be printed to a parallel printer",
-		defaultParams: &[]paramSpec{
-			{"file", "File to store the printed code", "printer.out"},
-			{"ascii", "Remove the 7 bit. Useful for normal text printing, but breaks graphics printing ", "false"},
-		},
+		name:          "Parallel Printer Interface",
+		description:   "Parallel printer card, dumps the output to a file or prints on an Epson FX-80",
+		defaultParams: &printerOutputParams,
 		buildFunc: func(params map[string]string) (Card, error) {
 			var c CardParallelPrinter
-			c.ascii = paramsGetBool(params, "ascii")
-			filepath := paramsGetPath(params, "file")
-			f, err := os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			var err error
+			c.printer, err = newPrinterOutput(params)
 			if err != nil {
 				return nil, err
 			}
-			c.file = f
 			err = c.loadRomFromResource("<internal>/Apple II Parallel Printer Interface Card ROM fixed.bin", cardRomSimple)
 			if err != nil {
 				return nil, err
@@ -47,7 +37,7 @@ func newCardParallelPrinterBuilder() *cardBuilder {
 
 func (c *CardParallelPrinter) assign(a *Apple2, slot int) {
 	c.addCardSoftSwitchW(0, func(value uint8) {
-		c.printByte(value)
+		c.printer.write(value)
 	}, "PARALLELDEVW")
 
 	c.addCardSoftSwitchR(4, func() uint8 {
@@ -57,10 +47,6 @@ func (c *CardParallelPrinter) assign(a *Apple2, slot int) {
 	c.cardBase.assign(a, slot)
 }
 
-func (c *CardParallelPrinter) printByte(value uint8) {
-	if c.ascii {
-		// As text the MSB has to be removed, but if done, graphics modes won't work
-		value &= 0x7f // Remove the MSB bit
-	}
-	c.file.Write([]byte{value})
+func (c *CardParallelPrinter) close() {
+	c.printer.close()
 }
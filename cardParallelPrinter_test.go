@@ -0,0 +1,36 @@
+package izapple2
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCardParallelPrinterEpson(t *testing.T) {
+	dir := t.TempDir()
+	overrides := newConfiguration()
+	overrides.set(confS1, "parallel,printer=epson,format=png,dir="+dir)
+	at, err := makeApple2Tester("2plus", overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := at.a
+	card, ok := a.cards[1].(*CardParallelPrinter)
+	if !ok {
+		t.Fatal("The parallel printer card should be in slot 1")
+	}
+
+	for _, value := range []uint8("HELLO\r\n\f") {
+		a.mmu.Poke(0xc090, value)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.png"))
+	if len(files) != 1 {
+		t.Errorf("The form feed should save the page, got %v", files)
+	}
+
+	a.mmu.Poke(0xc090, 'X')
+	card.close()
+	files, _ = filepath.Glob(filepath.Join(dir, "*.png"))
+	if len(files) != 2 {
+		t.Errorf("Closing the printer should save the page, got %v", files)
+	}
+}
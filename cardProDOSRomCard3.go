@@ -1,6 +1,9 @@
 package izapple2
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+)
 
 /*
 Ralle Palaveev's ProDOS-Romcard3
@@ -132,3 +135,27 @@ func (c *CardProDOSRomCard3) poke(address uint16, value uint8) {
 		c.data[c.translateAddress(address)] = value
 	}
 }
+
+func (c *CardProDOSRomCard3) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	err = saveValues(w, &c.bank, &c.secondROMPage)
+	if err != nil || !c.nvram {
+		return err
+	}
+	return saveValues(w, c.data)
+}
+
+func (c *CardProDOSRomCard3) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	err = loadValues(r, &c.bank, &c.secondROMPage)
+	if err != nil || !c.nvram {
+		return err
+	}
+	return loadValues(r, c.data)
+}
@@ -1,6 +1,9 @@
 package izapple2
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+)
 
 /*
 Terence Boldt's ProDOS-ROM-Drive: A bootable 1 MB solid state disk for Apple ][ computers
@@ -71,3 +74,19 @@ func (c *CardProDOSRomDrive) assign(a *Apple2, slot int) {
 
 	c.cardBase.assign(a, slot)
 }
+
+func (c *CardProDOSRomDrive) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	return saveValues(w, &c.address)
+}
+
+func (c *CardProDOSRomDrive) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	return loadValues(r, &c.address)
+}
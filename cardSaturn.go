@@ -1,5 +1,7 @@
 package izapple2
 
+import "io"
+
 /*
 RAM card with 128Kb. It's like 8 language cards.
 
@@ -116,3 +118,24 @@ func (c *CardSaturn) applyState() {
 	c.a.mmu.setLanguageRAMActiveBlock(c.activeBlock)
 	c.a.mmu.setLanguageRAM(c.readState, c.writeState == lcWriteEnabled, c.altBank)
 }
+
+func (c *CardSaturn) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	return saveValues(w, &c.readState, &c.writeState, &c.altBank, &c.activeBlock)
+}
+
+func (c *CardSaturn) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	err = loadValues(r, &c.readState, &c.writeState, &c.altBank, &c.activeBlock)
+	if err != nil {
+		return err
+	}
+	c.applyState()
+	return nil
+}
@@ -2,6 +2,7 @@ package izapple2
 
 import (
 	"fmt"
+	"io"
 	"strconv"
 )
 
@@ -124,6 +125,16 @@ func (c *CardSmartPort) GetInfo() map[string]string {
 
 // LoadImage loads a disk image
 func (c *CardSmartPort) LoadImage(filename string, trace bool) error {
+	if IsHostDirectory(filename) {
+		device, err := NewSmartPortHostDirectory(c, filename)
+		if err == nil {
+			device.trace = trace
+			c.devices = append(c.devices, device)
+			c.hardDiskBlocks = hostDirectoryBlocks // Needed for the PRODOS status
+		}
+		return err
+	}
+
 	device, err := NewSmartPortHardDisk(c, filename)
 	if err == nil {
 		device.trace = trace
@@ -325,3 +336,19 @@ func buildHardDiskRom(slot int, proDOSBlockDeviceType uint8) []uint8 {
 
 	return data
 }
+
+func (c *CardSmartPort) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	return saveValues(w, &c.mliParams)
+}
+
+func (c *CardSmartPort) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	return loadValues(r, &c.mliParams)
+}
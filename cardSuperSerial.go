@@ -0,0 +1,387 @@
+package izapple2
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/ivanizag/izapple2/component"
+)
+
+/*
+Apple Super Serial Card. A MOS 6551 ACIA with the DIP switches read by
+the firmware.
+
+See:
+	"Apple II Super Serial Card Installation and Operating Manual"
+	https://github.com/AppleWin/AppleWin/blob/master/source/SerialComms.cpp
+
+Softswitches:
+
+	$C0n1: DIP switches SW1
+	$C0n2: DIP switches SW2
+	$C0n8-$C0nB: ACIA registers, mirrored in $C0nC-$C0nF
+
+The DIP switches read as 0 when ON:
+
+	SW1 bits 7-4: SW1-1 to SW1-4, baud rate as on the ACIA control register
+	SW1 bits 1-0: SW1-5 and SW1-6, mode: ON ON for printer, OFF ON for communications
+	SW2 bit 7: SW2-1, ON for 1 stop bit, OFF for 2
+	SW2 bit 5: SW2-2, ON for 8 data bits, OFF for 7
+	SW2 bit 3: SW2-3, ON for odd parity, OFF for even
+	SW2 bit 2: SW2-4, ON for no parity
+	SW2 bit 1: SW2-5, ON to add a line feed after carriage return
+	SW2 bit 0: CTS, 0 when active
+	SW2-6 connects the ACIA interrupts to the IRQ line, it is not readable.
+
+The ROM of the card, 341-0065-A, can be loaded with the rom param as a 2KB
+dump. Without it, a simplified firmware is used. It supports PR#n and IN#n
+from BASIC, adding the line feeds if configured, and the Pascal 1.1
+firmware protocol. The programs with their own serial drivers, like ADTPro
+or the terminal programs, use the ACIA directly and work with both.
+
+The simplified firmware tells the input calls from the output calls with
+the standard hooks, CSW and KSW. The calls to $Cn00 are for output when
+CSW points there, for input when KSW points there and CSW doesn't. When
+DOS 3.3 or ProDOS have the hooks, the calls are for output.
+*/
+
+// CardSuperSerial represents a Super Serial Card
+type CardSuperSerial struct {
+	cardBase
+	acia       *component.MOS6551
+	line       serialLine
+	sw1        uint8
+	sw2        uint8
+	interrupts bool
+	lastCycle  uint64
+}
+
+func newCardSuperSerialBuilder() *cardBuilder {
+	return &cardBuilder{
+		name:        "Super Serial Card",
+		description: "Serial interface card with a 6551 ACIA",
+		defaultParams: &[]paramSpec{
+			{"device", "Serial line connection: none, tcp:host:port, listen:host:port, pty, modem[:[host:]port] or file:path", "none"},
+			{"rom", "ROM file of the card, 2KB. Empty to use a simplified firmware", ""},
+			{"baud", "Baud rate, SW1-1 to SW1-4", "9600"},
+			{"mode", "Firmware mode, SW1-5 and SW1-6: printer or communications", "communications"},
+			{"stopbits", "Stop bits, 1 or 2, SW2-1", "1"},
+			{"databits", "Data bits, 7 or 8, SW2-2", "8"},
+			{"parity", "Parity, none, odd or even, SW2-3 and SW2-4", "none"},
+			{"linefeed", "Add a line feed after carriage return, SW2-5", "false"},
+			{"interrupts", "Connect the interrupts, SW2-6", "true"},
+		},
+		buildFunc: func(params map[string]string) (Card, error) {
+			var c CardSuperSerial
+			err := c.setDipSwitches(params)
+			if err != nil {
+				return nil, err
+			}
+			c.interrupts = paramsGetBool(params, "interrupts")
+
+			romFile := paramsGetPath(params, "rom")
+			if romFile != "" {
+				err = c.loadRomFromResource(romFile, cardRomUpperEnd)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			c.line, err = newSerialLine(paramsGetString(params, "device"),
+				func() uint64 { return c.a.GetCycles() })
+			if err != nil {
+				return nil, err
+			}
+			c.acia = component.NewMOS6551(CPUClockMhz * 1_000_000)
+			return &c, nil
+		},
+	}
+}
+
+// Baud rates as selected on the ACIA control register
+var superSerialBauds = map[string]uint8{
+	"50": 1, "75": 2, "110": 3, "135": 4, "150": 5, "300": 6, "600": 7, "1200": 8,
+	"1800": 9, "2400": 10, "3600": 11, "4800": 12, "7200": 13, "9600": 14, "19200": 15,
+}
+
+func (c *CardSuperSerial) setDipSwitches(params map[string]string) error {
+	baud, ok := superSerialBauds[paramsGetString(params, "baud")]
+	if !ok {
+		return fmt.Errorf("invalid baud rate '%v'", paramsGetString(params, "baud"))
+	}
+	c.sw1 = baud << 4
+	switch paramsGetString(params, "mode") {
+	case "printer":
+		// SW1-5 and SW1-6 ON
+	case "communications":
+		c.sw1 |= 0x02 // SW1-5 OFF
+	default:
+		return fmt.Errorf("invalid mode '%v', it must be printer or communications", paramsGetString(params, "mode"))
+	}
+
+	switch paramsGetString(params, "stopbits") {
+	case "1":
+	case "2":
+		c.sw2 |= 0x80
+	default:
+		return fmt.Errorf("invalid stop bits '%v'", paramsGetString(params, "stopbits"))
+	}
+	switch paramsGetString(params, "databits") {
+	case "8":
+	case "7":
+		c.sw2 |= 0x20
+	default:
+		return fmt.Errorf("invalid data bits '%v'", paramsGetString(params, "databits"))
+	}
+	switch paramsGetString(params, "parity") {
+	case "none":
+	case "odd":
+		c.sw2 |= 0x04
+	case "even":
+		c.sw2 |= 0x0c
+	default:
+		return fmt.Errorf("invalid parity '%v', it must be none, odd or even", paramsGetString(params, "parity"))
+	}
+	if !paramsGetBool(params, "linefeed") {
+		c.sw2 |= 0x02
+	}
+	return nil
+}
+
+// GetInfo returns the card info
+func (c *CardSuperSerial) GetInfo() map[string]string {
+	info := make(map[string]string)
+	info["connected"] = strconv.FormatBool(c.line.isConnected())
+	return info
+}
+
+func (c *CardSuperSerial) assign(a *Apple2, slot int) {
+	if c.romCsxx == nil {
+		c.loadRom(buildSuperSerialRom(slot), cardRomSimple)
+	}
+
+	c.addCardSoftSwitches(func(address uint8, data uint8, write bool) uint8 {
+		switch {
+		case address >= 8:
+			c.catchUp()
+			var value uint8
+			if write {
+				c.acia.Write(address&3, data)
+			} else {
+				value = c.acia.Read(address & 3)
+			}
+			c.updateIRQ()
+			return value
+		case address == 1 && !write:
+			return c.sw1
+		case address == 2 && !write:
+			return c.sw2
+		}
+		return 0
+	}, "SSC")
+
+	c.cardBase.assign(a, slot)
+	a.registerTickerCard(c)
+	c.lastCycle = a.GetCycles()
+}
+
+func (c *CardSuperSerial) reset() {
+	c.acia.Reset()
+	if c.a != nil {
+		c.a.requestIRQ(c.slot, false)
+	}
+}
+
+// tick moves the bytes between the ACIA and the serial line
+func (c *CardSuperSerial) tick() {
+	c.catchUp()
+}
+
+func (c *CardSuperSerial) catchUp() {
+	current := c.a.GetCycles()
+	if current <= c.lastCycle {
+		return
+	}
+	c.acia.Tick(current - c.lastCycle)
+	c.lastCycle = current
+
+	if sent := c.acia.Transmitted(); len(sent) > 0 {
+		c.line.write(sent)
+	}
+	if c.acia.ReadyToReceive() {
+		if value, ok := c.line.read(); ok {
+			c.acia.Receive(value)
+		}
+	}
+	connected := c.line.isConnected()
+	c.acia.SetDSR(connected)
+	c.acia.SetDCD(connected)
+	c.updateIRQ()
+}
+
+func (c *CardSuperSerial) updateIRQ() {
+	c.a.requestIRQ(c.slot, c.interrupts && c.acia.InterruptAsserted())
+}
+
+func (c *CardSuperSerial) close() {
+	c.line.close()
+}
+
+func (c *CardSuperSerial) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	return c.acia.SaveState(w)
+}
+
+func (c *CardSuperSerial) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	err = c.acia.LoadState(r)
+	if err != nil {
+		return err
+	}
+	c.lastCycle = c.a.GetCycles()
+	return nil
+}
+
+func buildSuperSerialRom(slot int) []uint8 {
+	data := make([]uint8, 256)
+	ssBase := 0x80 + uint8(slot<<4)
+	page := 0xc0 + uint8(slot)
+
+	copy(data, []uint8{
+		// BASIC entry point, $Cn05 and $Cn07 as expected by the Pascal 1.1
+		// firmware protocol. They are the input and output entry points.
+		0x2c, 0x58, 0xff, // BIT $FF58 ; Set V
+		0x70, 0x0c, // BVS init
+		0x38,       // SEC ; $Cn05, input
+		0x90, 0x18, // BCC ; Not taken. $Cn07 is CLC, output
+		0xb8,       // CLV
+		0x50, 0x09, // BVC common
+
+		0x01,                   // Generic signature of the Pascal 1.1 protocol
+		0x31,                   // Device signature, serial card
+		0x6a, 0x70, 0x7d, 0x83, // Offsets of the Pascal init, read, write and status
+
+		// init, $Cn11
+		0x4c, 0x96, page, // JMP detect
+
+		// common, $Cn14
+		0xb0, 0x18, // BCS input
+		0x48,       // PHA ; Output
+		0x29, 0x7f, // AND #$7F
+		0x20, 0x49, page, // JSR send
+		0xc9, 0x0d, // CMP #$0D
+		0xd0, 0x0c, // BNE odone
+		0xad, ssBase + 2, 0xc0, // LDA $C0n2 ; SW2-5 ON to add a line feed
+		0x29, 0x02, // AND #$02
+		0xd0, 0x05, // BNE odone
+		0xa9, 0x0a, // LDA #$0A
+		0x20, 0x49, page, // JSR send
+		// odone
+		0x68, // PLA
+		0x60, // RTS
+
+		// input, $Cn2E
+		0x91, 0x28, // STA ($28),Y ; Remove the cursor
+		// iloop
+		0x2c, 0x00, 0xc0, // BIT $C000 ; Key pressed?
+		0x30, 0x0d, // BMI key
+		0xad, ssBase + 9, 0xc0, // LDA $C0n9 ; Byte received?
+		0x29, 0x08, // AND #$08
+		0xf0, 0xf4, // BEQ iloop
+		0xad, ssBase + 8, 0xc0, // LDA $C0n8
+		0x09, 0x80, // ORA #$80
+		0x60, // RTS
+		// key
+		0xad, 0x00, 0xc0, // LDA $C000
+		0x2c, 0x10, 0xc0, // BIT $C010
+		0x60, // RTS
+
+		// send, $Cn49
+		0x48, // PHA
+		// swait
+		0xad, ssBase + 9, 0xc0, // LDA $C0n9 ; Transmit register empty?
+		0x29, 0x10, // AND #$10
+		0xf0, 0xf9, // BEQ swait
+		0x68,                   // PLA
+		0x8d, ssBase + 8, 0xc0, // STA $C0n8
+		0x60, // RTS
+
+		// setup, $Cn56. Programs the ACIA with the baud rate of SW1
+		0x48,                   // PHA
+		0xad, ssBase + 1, 0xc0, // LDA $C0n1
+		0x4a, 0x4a, 0x4a, 0x4a, // LSR LSR LSR LSR
+		0x09, 0x10, // ORA #$10 ; Internal clock, 8 bits, 1 stop bit
+		0x8d, ssBase + 11, 0xc0, // STA $C0nB
+		0xa9, 0x0b, // LDA #$0B ; No parity, no interrupts, DTR
+		0x8d, ssBase + 10, 0xc0, // STA $C0nA
+		0x68, // PLA
+		0x60, // RTS
+
+		// Pascal init, $Cn6A
+		0x20, 0x56, page, // JSR setup
+		0xa2, 0x00, // LDX #$00
+		0x60, // RTS
+
+		// Pascal read, $Cn70
+		0xad, ssBase + 9, 0xc0, // LDA $C0n9
+		0x29, 0x08, // AND #$08
+		0xf0, 0xf9, // BEQ read
+		0xad, ssBase + 8, 0xc0, // LDA $C0n8
+		0xa2, 0x00, // LDX #$00
+		0x60, // RTS
+
+		// Pascal write, $Cn7D
+		0x20, 0x49, page, // JSR send
+		0xa2, 0x00, // LDX #$00
+		0x60, // RTS
+
+		// Pascal status, $Cn83. Carry set if ready for output (A=0)
+		// or with input available (A=1)
+		0xa2, 0x10, // LDX #$10 ; TDRE
+		0xc9, 0x00, // CMP #$00
+		0xf0, 0x02, // BEQ ps1
+		0xa2, 0x08, // LDX #$08 ; RDRF
+		// ps1
+		0x8a,                   // TXA
+		0x2d, ssBase + 9, 0xc0, // AND $C0n9
+		0x18,       // CLC
+		0xf0, 0x01, // BEQ ps2
+		0x38, // SEC
+		// ps2
+		0xa2, 0x00, // LDX #$00
+		0x60, // RTS
+
+		// detect, $Cn96. Output if CSW points to $Cn00, input if KSW
+		// points to $Cn00 and CSW doesn't, output otherwise
+		0x48,             // PHA ; The character to output
+		0x20, 0x56, page, // JSR setup
+		0xa5, 0x37, // LDA $37 ; CSWH
+		0xc9, page, // CMP #$Cn
+		0xd0, 0x04, // BNE ksw
+		0xa5, 0x36, // LDA $36 ; CSWL
+		0xf0, 0x0a, // BEQ output
+		// ksw
+		0xa5, 0x39, // LDA $39 ; KSWH
+		0xc9, page, // CMP #$Cn
+		0xd0, 0x04, // BNE output
+		0xa5, 0x38, // LDA $38 ; KSWL
+		0xf0, 0x05, // BEQ input
+		// output, $CnAE
+		0x18,             // CLC
+		0x68,             // PLA
+		0x4c, 0x14, page, // JMP common
+		// input, $CnB3
+		0x38,             // SEC
+		0x68,             // PLA
+		0x4c, 0x14, page, // JMP common
+	})
+
+	return data
+}
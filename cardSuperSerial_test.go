@@ -0,0 +1,145 @@
+package izapple2
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func makeSuperSerialTester(t *testing.T, params string) (*Apple2, *CardSuperSerial) {
+	overrides := newConfiguration()
+	overrides.set(confS2, "ssc,"+params)
+	at, err := makeApple2Tester("2plus", overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := at.a
+	card, ok := a.cards[2].(*CardSuperSerial)
+	if !ok {
+		t.Fatal("The Super Serial Card should be in slot 2")
+	}
+	t.Cleanup(card.line.close)
+	return a, card
+}
+
+// waitSerial advances the emulation until the condition is met, giving
+// time to the goroutines reading the socket
+func waitSerial(a *Apple2, card *CardSuperSerial, condition func() bool) bool {
+	for i := 0; i < 1000; i++ {
+		a.cycles += 1000
+		card.tick()
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
+func TestCardSuperSerialDipSwitches(t *testing.T) {
+	a, _ := makeSuperSerialTester(t, "baud=300,mode=printer,databits=7,parity=even,linefeed=true")
+
+	if sw1 := a.mmu.Peek(0xc0a1); sw1 != 0x60 {
+		t.Errorf("SW1 should select 300 bauds in printer mode, got $%02x", sw1)
+	}
+	if sw2 := a.mmu.Peek(0xc0a2); sw2 != 0x2c {
+		t.Errorf("SW2 should select 7 bits, even parity and line feeds, got $%02x", sw2)
+	}
+}
+
+func TestCardSuperSerialLoopback(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	a, card := makeSuperSerialTester(t, "device=tcp:"+listener.Addr().String())
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	a.mmu.Poke(0xc0ab, 0x1f) // Control: 19200 bauds, 8 bits, 1 stop bit
+	a.mmu.Poke(0xc0aa, 0x0b) // Command: no parity, no interrupts, DTR
+
+	// Transmit, the second byte waits for the first one to be sent
+	a.mmu.Poke(0xc0a8, 'H')
+	a.mmu.Poke(0xc0a8, 'i')
+	if a.mmu.Peek(0xc0a9)&0x10 != 0 {
+		t.Error("The transmit register should not be empty while sending")
+	}
+	if !waitSerial(a, card, func() bool { return a.mmu.Peek(0xc0a9)&0x10 != 0 }) {
+		t.Fatal("The byte should be sent")
+	}
+	a.cycles += 1000
+	card.tick()
+	buffer := make([]uint8, 2)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = io.ReadFull(conn, buffer)
+	if err != nil || string(buffer) != "Hi" {
+		t.Errorf("The bytes should be received on the socket, got %q, %v", buffer, err)
+	}
+
+	// Receive
+	_, err = conn.Write([]uint8{'i'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !waitSerial(a, card, func() bool { return a.mmu.Peek(0xc0a9)&0x08 != 0 }) {
+		t.Fatal("The byte should be received")
+	}
+	if value := a.mmu.Peek(0xc0a8); value != 'i' {
+		t.Errorf("The byte received should be 'i', got $%02x", value)
+	}
+	if a.mmu.Peek(0xc0a9)&0x08 != 0 {
+		t.Error("Reading the data register should clear the receive flag")
+	}
+}
+
+func TestCardSuperSerialIRQ(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	a, card := makeSuperSerialTester(t, "device=tcp:"+listener.Addr().String())
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	a.mmu.Poke(0xc0ab, 0x1f) // Control: 19200 bauds, 8 bits, 1 stop bit
+	a.mmu.Poke(0xc0aa, 0x09) // Command: receiver interrupts, DTR
+	a.mmu.Peek(0xc0a9)       // Clear the pending DCD interrupt
+	card.tick()
+	a.mmu.Peek(0xc0a9)
+	if a.irqRequests != 0 {
+		t.Fatal("The IRQ should not be requested without data")
+	}
+
+	conn.Write([]uint8{0x55})
+	if !waitSerial(a, card, func() bool { return a.irqRequests != 0 }) {
+		t.Fatal("The IRQ should be requested when a byte is received")
+	}
+	if a.mmu.Peek(0xc0a9)&0x88 != 0x88 {
+		t.Error("The status should show the interrupt and the byte received")
+	}
+	if a.irqRequests != 0 {
+		t.Error("Reading the status should release the IRQ")
+	}
+}
+
+func TestCardSuperSerialMissingRom(t *testing.T) {
+	overrides := newConfiguration()
+	overrides.set(confS2, "ssc,rom=\""+filepath.Join(t.TempDir(), "missing.rom")+"\"")
+	_, err := makeApple2Tester("2plus", overrides)
+	if err == nil {
+		t.Error("A missing ROM should be an error")
+	}
+}
@@ -1,5 +1,7 @@
 package izapple2
 
+import "io"
+
 /*
 	Swyft card for Apple IIe
 
@@ -135,3 +137,19 @@ func (c *CardSwyft) peek(address uint16) uint8 {
 func (c *CardSwyft) poke(address uint16, value uint8) {
 	// Nothing
 }
+
+func (c *CardSwyft) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	return saveValues(w, &c.bank2)
+}
+
+func (c *CardSwyft) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	return loadValues(r, &c.bank2)
+}
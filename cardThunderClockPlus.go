@@ -1,6 +1,10 @@
 package izapple2
 
-import "github.com/ivanizag/izapple2/component"
+import (
+	"io"
+
+	"github.com/ivanizag/izapple2/component"
+)
 
 /*
 ThunderClock`, real time clock card.
@@ -65,3 +69,19 @@ func (c *CardThunderClockPlus) assign(a *Apple2, slot int) {
 
 	c.cardBase.assign(a, slot)
 }
+
+func (c *CardThunderClockPlus) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	return c.upd1990.SaveState(w)
+}
+
+func (c *CardThunderClockPlus) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	return c.upd1990.LoadState(r)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"io"
 	"strings"
 	"time"
 
@@ -381,3 +382,27 @@ func (c *CardVidexUltraterm) dumpState() {
 		data.Columns, data.Lines, width, height, is512mode, c.sramPage512, sramPage256, mhz,
 		data.AdjustLines, flags)
 }
+
+func (c *CardVidexUltraterm) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	err = c.mc6845.SaveState(w)
+	if err != nil {
+		return err
+	}
+	return saveValues(w, &c.modeControl, &c.videoAttribute, &c.sramPage512, &c.sram)
+}
+
+func (c *CardVidexUltraterm) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	err = c.mc6845.LoadState(r)
+	if err != nil {
+		return err
+	}
+	return loadValues(r, &c.modeControl, &c.videoAttribute, &c.sramPage512, &c.sram)
+}
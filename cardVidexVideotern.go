@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"io"
 	"strings"
 	"time"
 
@@ -219,3 +220,27 @@ func (c *CardVidexVideoterm) getText() string {
 	}
 	return text
 }
+
+func (c *CardVidexVideoterm) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	err = c.mc6845.SaveState(w)
+	if err != nil {
+		return err
+	}
+	return saveValues(w, &c.sramPage, &c.sram)
+}
+
+func (c *CardVidexVideoterm) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	err = c.mc6845.LoadState(r)
+	if err != nil {
+		return err
+	}
+	return loadValues(r, &c.sramPage, &c.sram)
+}
@@ -2,6 +2,7 @@ package izapple2
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/koron-go/z80"
 )
@@ -121,3 +122,23 @@ func z80AddressTranslation(addr uint16) uint16 {
 		return addr - 0xf000
 	}
 }
+
+func (c *CardZ80SoftCard) saveState(w io.Writer) error {
+	err := c.cardBase.saveState(w)
+	if err != nil {
+		return err
+	}
+	s := &c.cpu.States
+	return saveValues(w, &c.z80Active, &s.GPR, &s.SPR, &s.Alternate,
+		&s.IFF1, &s.IFF2, &s.IM, &c.cpu.HALT)
+}
+
+func (c *CardZ80SoftCard) loadState(r io.Reader) error {
+	err := c.cardBase.loadState(r)
+	if err != nil {
+		return err
+	}
+	s := &c.cpu.States
+	return loadValues(r, &c.z80Active, &s.GPR, &s.SPR, &s.Alternate,
+		&s.IFF1, &s.IFF2, &s.IM, &c.cpu.HALT)
+}
@@ -1,6 +1,8 @@
 package izapple2
 
 import (
+	"io"
+
 	"github.com/ivanizag/izapple2/storage"
 )
 
@@ -19,6 +21,12 @@ The tape starts playing on the first read of $C060 and pauses when
 the program stops polling, so no play or rewind controls are needed.
 Fast mode is requested while the tape is playing.
 
+On turbo mode the recordings are decoded on load. When the Monitor ROM
+READ routine is called, the next recording on the tape is copied directly
+to memory and the routine exits as the ROM does, beeping if the checksum
+is correct or printing ERR if not. Tapes not using the ROM routines, or
+with recordings that can't be decoded, are played as usual.
+
 See:
   - "Apple II Reference Manual", cassette interface
   - https://retrocomputing.stackexchange.com/questions/143/what-format-is-used-for-apple-ii-cassette-tapes
@@ -30,6 +38,18 @@ See:
 // skipping the start of the tape and any noise before the header tone.
 const cassetteAutoPauseCycles = 5_000_000
 
+// Monitor ROM tape read routine entry point and exits, and variables. See
+// "Apple II Reference Manual", Monitor ROM listing.
+const (
+	monitorRead      = uint16(0xfefd)
+	monitorReadBell  = uint16(0xff3a) // Checksum correct
+	monitorReadError = uint16(0xff2d) // Checksum error
+	monitorRead2Bit  = uint16(0xfcfa) // Called by READ
+	monitorA1        = uint16(0x3c)
+	monitorA2        = uint16(0x3e)
+	monitorChecksum  = uint16(0x2e)
+)
+
 type cassette struct {
 	a           *Apple2
 	transitions []uint64 // Cycles from the tape start with a zero crossing
@@ -38,11 +58,13 @@ type cassette struct {
 	position    uint64 // Tape position in cycles while paused
 	startCycle  uint64 // Cycle of the tape start position while playing
 	lastRead    uint64
+	turbo       bool
+	blocks      []storage.TapeBlock // Recordings decoded for turbo mode
 }
 
 // newCassette loads a WAV recording of a tape and prepares it to be
 // read on the cassette input softswitch
-func newCassette(a *Apple2, data []uint8) (*cassette, error) {
+func newCassette(a *Apple2, data []uint8, turbo bool) (*cassette, error) {
 	transitions, err := storage.MakeTape(data, CPUClockMhz*1_000_000)
 	if err != nil {
 		return nil, err
@@ -51,6 +73,10 @@ func newCassette(a *Apple2, data []uint8) (*cassette, error) {
 	var c cassette
 	c.a = a
 	c.transitions = transitions
+	c.turbo = turbo
+	if turbo {
+		c.blocks = storage.DecodeTape(transitions, CPUClockMhz*1_000_000)
+	}
 
 	a.registerTickerCard(&c)
 	return &c, nil
@@ -83,6 +109,13 @@ func (c *cassette) read(cycle uint64) uint8 {
 // tick pauses the tape when the program stops polling the cassette
 // input, keeping the position and releasing fast mode
 func (c *cassette) tick() {
+	if c.turbo {
+		pc, _ := c.a.cpu.GetPCAndSP()
+		if pc == monitorRead && c.isMonitorRead() {
+			c.fastRead()
+		}
+	}
+
 	if c.playing {
 		cycle := c.a.GetCycles()
 		if cycle-c.lastRead > cassetteAutoPauseCycles {
@@ -91,6 +124,60 @@ func (c *cassette) tick() {
 	}
 }
 
+// isMonitorRead checks that the Monitor ROM READ routine is mapped
+func (c *cassette) isMonitorRead() bool {
+	mmu := c.a.mmu
+	return !mmu.lcActiveRead &&
+		mmu.Peek(monitorRead) == opcodeJSR &&
+		mmu.Peek(monitorRead+1) == uint8(monitorRead2Bit&0xff) &&
+		mmu.Peek(monitorRead+2) == uint8(monitorRead2Bit>>8)
+}
+
+// fastRead copies the next recording on the tape to the memory range
+// from A1 to A2 and exits the READ routine
+func (c *cassette) fastRead() {
+	var block *storage.TapeBlock
+	for i := range c.blocks {
+		if c.blocks[i].End > c.cursor {
+			block = &c.blocks[i]
+			break
+		}
+	}
+
+	mmu := c.a.mmu
+	a1 := uint16(mmu.Peek(monitorA1)) | uint16(mmu.Peek(monitorA1+1))<<8
+	a2 := uint16(mmu.Peek(monitorA2)) | uint16(mmu.Peek(monitorA2+1))<<8
+	count := max(int(a2)-int(a1)+1, 1)
+	if block == nil || len(block.Data) < count+1 {
+		// Not enough data, let the ROM read the tape
+		return
+	}
+
+	checksum := uint8(0xff)
+	for i := 0; i < count; i++ {
+		mmu.Poke(a1, block.Data[i])
+		checksum ^= block.Data[i]
+		a1++
+	}
+	mmu.Poke(monitorA1, uint8(a1))
+	mmu.Poke(monitorA1+1, uint8(a1>>8))
+	mmu.Poke(monitorChecksum, checksum)
+
+	if checksum == block.Data[count] {
+		c.a.cpu.SetPC(monitorReadBell)
+	} else {
+		c.a.cpu.SetPC(monitorReadError)
+	}
+
+	// Move the tape after the recording
+	c.cursor = block.End
+	if c.playing {
+		c.pause(c.a.GetCycles())
+	} else {
+		c.position = c.transitions[c.cursor-1]
+	}
+}
+
 func (c *cassette) pause(cycle uint64) {
 	// Rewind to the last transition delivered so that on resume the
 	// next transition arrives a full half-cycle later. Resuming at an
@@ -103,3 +190,30 @@ func (c *cassette) pause(cycle uint64) {
 	c.playing = false
 	c.a.ReleaseFastMode()
 }
+
+// The tape is stored paused, it will resume playing on the next read
+func (c *cassette) saveState(w io.Writer) error {
+	position := c.position
+	if c.playing {
+		position = 0
+		if c.cursor > 0 {
+			position = c.transitions[c.cursor-1]
+		}
+	}
+	return saveValues(w, &c.cursor, &position)
+}
+
+func (c *cassette) loadState(r io.Reader) error {
+	if c.playing {
+		c.pause(c.a.GetCycles())
+	}
+	err := loadValues(r, &c.cursor, &c.position)
+	if err != nil {
+		return err
+	}
+	if c.cursor < 0 || c.cursor > len(c.transitions) {
+		c.cursor = 0
+		c.position = 0
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package izapple2
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ivanizag/izapple2/storage"
+)
+
+/*
+Emulation of the cassette tape output.
+
+Any access to $C020 toggles the cassette output. The Monitor ROM WRITE
+routine, used by the Monitor W command and by SAVE in BASIC, generates
+the same signal decoded by the cassette input: a 770 Hz header tone, a
+short sync cycle, then 2 kHz cycles for "0" bits and 1 kHz cycles for
+"1" bits.
+
+The cycles of the toggles are recorded and saved as a WAV file that can
+be loaded back with -tape or played to a real Apple II. The tape is
+saved when the program stops toggling the output and when the emulator
+exits. Several recordings are kept on the same tape, the silence between
+them is shortened to one second. Fast mode is requested while recording.
+*/
+
+// Cycles without toggles before the recording is paused and saved. It
+// must be longer than the pauses between the header tone and the data
+// of the Monitor ROM WRITE routine.
+const cassetteOutputPauseCycles = 1_000_000
+
+// Silence between recordings, about one second
+const cassetteOutputSilenceCycles = 1_000_000
+
+type cassetteOutput struct {
+	a           *Apple2
+	filename    string
+	transitions []uint64 // Cycles from the tape start with a toggle
+	recording   bool
+	offset      uint64 // Cycle of the tape start position
+	lastToggle  uint64
+	saved       int // Transitions already saved
+}
+
+func newCassetteOutput(a *Apple2, filename string) *cassetteOutput {
+	var c cassetteOutput
+	c.a = a
+	c.filename = filename
+
+	a.registerTickerCard(&c)
+	return &c
+}
+
+// toggle records an access to $C020
+func (c *cassetteOutput) toggle(cycle uint64) {
+	if !c.recording {
+		c.recording = true
+		if len(c.transitions) == 0 {
+			c.offset = cycle
+		} else {
+			// Continue one second after the previous recording
+			last := c.transitions[len(c.transitions)-1]
+			c.offset = cycle - last - cassetteOutputSilenceCycles
+		}
+		c.a.RequestFastMode()
+	}
+	c.lastToggle = cycle
+	c.transitions = append(c.transitions, cycle-c.offset)
+}
+
+// tick pauses the recording and saves the tape when the program stops
+// toggling the cassette output
+func (c *cassetteOutput) tick() {
+	if c.recording && c.a.GetCycles()-c.lastToggle > cassetteOutputPauseCycles {
+		c.recording = false
+		c.a.ReleaseFastMode()
+		c.save()
+	}
+}
+
+func (c *cassetteOutput) close() {
+	c.save()
+}
+
+func (c *cassetteOutput) save() {
+	if c.saved == len(c.transitions) {
+		return // Nothing new recorded
+	}
+
+	data := storage.EncodeTape(c.transitions, CPUClockMhz*1_000_000)
+	err := os.WriteFile(c.filename, data, 0644)
+	if err != nil {
+		fmt.Printf("Error saving the tape %v: %v\n", c.filename, err)
+		return
+	}
+	c.saved = len(c.transitions)
+}
@@ -2,6 +2,8 @@ package izapple2
 
 import (
 	"encoding/binary"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -118,7 +120,7 @@ func wavBytes16BitStereo(samples []float64, channel int) []uint8 {
 
 func testTapeTransitions(t *testing.T, wav []uint8, expected int) {
 	var a Apple2
-	c, err := newCassette(&a, wav)
+	c, err := newCassette(&a, wav, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -145,8 +147,85 @@ func TestCassetteTransitions16BitStereo(t *testing.T) {
 
 func TestCassetteInvalidFile(t *testing.T) {
 	var a Apple2
-	_, err := newCassette(&a, []uint8{0x01, 0x02, 0x03, 0x04})
+	_, err := newCassette(&a, []uint8{0x01, 0x02, 0x03, 0x04}, false)
 	if err == nil {
 		t.Error("Expected an error loading a file that is not a WAV")
 	}
 }
+
+func TestCassetteOutputRecording(t *testing.T) {
+	var a Apple2
+	path := filepath.Join(t.TempDir(), "out.wav")
+	c := newCassetteOutput(&a, path)
+
+	// Two recordings, a 770 Hz tone and a 1 kHz tone, ten seconds apart
+	cycle := uint64(5000)
+	for range 1000 {
+		c.toggle(cycle)
+		cycle += 663
+	}
+	a.cycles = cycle + cassetteOutputPauseCycles + 1
+	c.tick()
+	if c.recording {
+		t.Error("the recording should be paused")
+	}
+
+	cycle += 10 * 1_020_484
+	for range 500 {
+		c.toggle(cycle)
+		cycle += 510
+	}
+	c.close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seconds := float64(len(data)-44) / 2 / 44100
+	if seconds > 2.5 {
+		t.Errorf("the silence between recordings should be shortened, the tape has %.1f seconds", seconds)
+	}
+	testTapeTransitions(t, data, 1500)
+}
+
+func TestCassetteTurboRead(t *testing.T) {
+	data := []uint8{0x10, 0x20, 0x30, 0x40}
+	var recorder tapeRecorder
+	recorder.record(data)
+
+	path := filepath.Join(t.TempDir(), "test.wav")
+	err := os.WriteFile(path, wavBytes8BitMono(recorder.samples), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overrides := newConfiguration()
+	overrides.set(confS6, "empty")
+	overrides.set(confTape, path)
+	overrides.set(confTapeTurbo, "true")
+	at, err := makeApple2Tester("2plus", overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := at.a
+
+	// As if READ was called to load $0900-$0903
+	a.mmu.pokeRange(monitorA1, []uint8{0x00, 0x09, 0x03, 0x09})
+	a.cpu.SetPC(monitorRead)
+	a.io.cassette.tick()
+
+	for i, value := range data {
+		if a.mmu.Peek(0x900+uint16(i)) != value {
+			t.Errorf("byte %v not loaded, expected $%02x", i, value)
+		}
+	}
+	if pc, _ := a.cpu.GetPCAndSP(); pc != monitorReadBell {
+		t.Errorf("READ should exit on BELL, PC is $%04x", pc)
+	}
+
+	// There are no more recordings, the ROM would read the tape
+	a.cpu.SetPC(monitorRead)
+	a.io.cassette.tick()
+	if pc, _ := a.cpu.GetPCAndSP(); pc != monitorRead {
+		t.Errorf("READ should not be skipped at the end of the tape, PC is $%04x", pc)
+	}
+}
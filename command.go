@@ -25,6 +25,12 @@ const (
 	CommandStart
 	// CommandComplex for commands that use a struct with parameters
 	CommandComplex
+	// CommandSaveState saves the state of the machine to DefaultStateFile
+	CommandSaveState
+	// CommandLoadState restores the state of the machine from DefaultStateFile
+	CommandLoadState
+	// CommandRewind pauses the emulator and goes back to the previous rewind snapshot
+	CommandRewind
 )
 
 type command interface {
@@ -40,6 +46,14 @@ type commandLoadDisk struct {
 	path  string
 }
 
+type commandSaveState struct {
+	path string
+}
+
+type commandLoadState struct {
+	path string
+}
+
 func (c *commandSimple) getId() int {
 	return c.id
 }
@@ -48,6 +62,14 @@ func (c *commandLoadDisk) getId() int {
 	return CommandComplex
 }
 
+func (c *commandSaveState) getId() int {
+	return CommandComplex
+}
+
+func (c *commandLoadState) getId() int {
+	return CommandComplex
+}
+
 func (a *Apple2) queueCommand(c command) {
 	a.commandChannel <- c
 }
@@ -66,6 +88,20 @@ func (a *Apple2) SendLoadDisk(drive int, path string) {
 	a.queueCommand(&c)
 }
 
+// SendSaveState enqueues a request to save the state of the machine to a file
+func (a *Apple2) SendSaveState(path string) {
+	var c commandSaveState
+	c.path = path
+	a.queueCommand(&c)
+}
+
+// SendLoadState enqueues a request to restore the state of the machine from a file
+func (a *Apple2) SendLoadState(path string) {
+	var c commandLoadState
+	c.path = path
+	a.queueCommand(&c)
+}
+
 func (a *Apple2) executeCommand(command command) {
 	switch command.getId() {
 	case CommandToggleSpeed:
@@ -88,12 +124,38 @@ func (a *Apple2) executeCommand(command command) {
 		a.cpu.SetTrace(a.cpuTrace)
 	case CommandReset:
 		a.reset()
+	case CommandSaveState:
+		a.executeCommand(&commandSaveState{DefaultStateFile})
+	case CommandLoadState:
+		a.executeCommand(&commandLoadState{DefaultStateFile})
+	case CommandRewind:
+		a.paused.Store(true)
+		err := a.rewindStep()
+		if err != nil {
+			fmt.Printf("Could not rewind: %v\n", err)
+		}
 	case CommandComplex:
 		switch t := command.(type) {
 		case *commandLoadDisk:
 			err := a.changeDisk(t.drive, t.path)
 			if err != nil {
 				fmt.Printf("Could no load file %v\n%v\n", t.path, err)
+			} else if a.movie != nil {
+				a.movie.recordDisk(t.drive, t.path)
+			}
+		case *commandSaveState:
+			err := a.saveStateToFile(t.path)
+			if err != nil {
+				fmt.Printf("Could not save state to %v\n%v\n", t.path, err)
+			} else {
+				fmt.Printf("State saved to %v\n", t.path)
+			}
+		case *commandLoadState:
+			err := a.loadStateFromFile(t.path)
+			if err != nil {
+				fmt.Printf("Could not load state from %v\n%v\n", t.path, err)
+			} else {
+				fmt.Printf("State loaded from %v\n", t.path)
 			}
 		}
 	}
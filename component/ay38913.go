@@ -1,5 +1,7 @@
 package component
 
+import "io"
+
 /*
 General Instrument AY-3-8913 Programmable Sound Generator
 See:
@@ -86,6 +88,16 @@ func (ay *AY38913) ReadData() uint8 {
 	return ay.regs[ay.address]
 }
 
+// Address returns the register selected with LatchAddress
+func (ay *AY38913) Address() uint8 {
+	return ay.address
+}
+
+// Register returns the value of a register without changing the address
+func (ay *AY38913) Register(reg uint8) uint8 {
+	return ay.regs[reg&0x0f]
+}
+
 // Reset clears the registers and the generators
 func (ay *AY38913) Reset() {
 	for i := range ay.regs {
@@ -212,3 +224,19 @@ func (ay *AY38913) endOfEnvelopeRamp() {
 		}
 	}
 }
+
+// SaveState writes the internal state of the PSG
+func (ay *AY38913) SaveState(w io.Writer) error {
+	return saveValues(w,
+		&ay.regs, &ay.address, &ay.toneCounter, &ay.toneOut,
+		&ay.noiseCounter, &ay.noiseShift,
+		&ay.envCounter, &ay.envPosition, &ay.envAttack, &ay.envHolding, &ay.envHeldLevel)
+}
+
+// LoadState restores the state written by SaveState
+func (ay *AY38913) LoadState(r io.Reader) error {
+	return loadValues(r,
+		&ay.regs, &ay.address, &ay.toneCounter, &ay.toneOut,
+		&ay.noiseCounter, &ay.noiseShift,
+		&ay.envCounter, &ay.envPosition, &ay.envAttack, &ay.envHolding, &ay.envHeldLevel)
+}
@@ -1,5 +1,7 @@
 package component
 
+import "io"
+
 /*
 	MC6845 CRT Controller
 	See:
@@ -124,3 +126,15 @@ func (data *MC6845ImageData) IterateScreen(callBack MC6845RasterCallBack) {
 		y++
 	}
 }
+
+// SaveState writes the internal state of the CRTC
+func (m *MC6845) SaveState(w io.Writer) error {
+	return saveValues(w,
+		&m.reg, &m.sel)
+}
+
+// LoadState restores the state written by SaveState
+func (m *MC6845) LoadState(r io.Reader) error {
+	return loadValues(r,
+		&m.reg, &m.sel)
+}
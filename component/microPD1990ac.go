@@ -1,6 +1,7 @@
 package component
 
 import (
+	"io"
 	"time"
 )
 
@@ -119,3 +120,15 @@ func (m *MicroPD1990ac) loadTime() {
 
 	m.register = register
 }
+
+// SaveState writes the internal state of the clock chip
+func (m *MicroPD1990ac) SaveState(w io.Writer) error {
+	return saveValues(w,
+		&m.clock, &m.strobe, &m.command, &m.register)
+}
+
+// LoadState restores the state written by SaveState
+func (m *MicroPD1990ac) LoadState(r io.Reader) error {
+	return loadValues(r,
+		&m.clock, &m.strobe, &m.command, &m.register)
+}
@@ -1,5 +1,7 @@
 package component
 
+import "io"
+
 /*
 MOS 6522 Versatile Interface Adapter (VIA)
 See:
@@ -8,11 +10,11 @@ See:
 	http://archive.6502.org/datasheets/rockwell_r6522_via.pdf
 
 Used by the Mockingboard card to drive the AY-3-8913 sound generators
-and to raise interrupts with the timers.
+and to raise interrupts with the timers and the speech chips.
 
-Implemented: ports A and B, timers T1 and T2, the IFR/IER interrupt logic.
-Not implemented: the shift register, the CA/CB control lines, handshaking
-and the T2 pulse counting mode.
+Implemented: ports A and B, timers T1 and T2, the IFR/IER interrupt logic
+and the interrupts of the CA1 and CB1 inputs. Not implemented: the shift
+register, the CA2/CB2 lines, handshaking and the T2 pulse counting mode.
 
 Registers:
 
@@ -39,11 +41,17 @@ type MOS6522 struct {
 
 	sr, acr, pcr uint8
 	ifr, ier     uint8
+	ca1, cb1     bool // Levels of the control line inputs
 }
 
 const (
-	mos6522IntT1 uint8 = 1 << 6
-	mos6522IntT2 uint8 = 1 << 5
+	mos6522IntT1  uint8 = 1 << 6
+	mos6522IntT2  uint8 = 1 << 5
+	mos6522IntCB1 uint8 = 1 << 4
+	mos6522IntCA1 uint8 = 1 << 1
+
+	mos6522PcrCA1Positive uint8 = 1 << 0
+	mos6522PcrCB1Positive uint8 = 1 << 4
 
 	mos6522AcrT1FreeRunning uint8 = 1 << 6
 )
@@ -52,8 +60,12 @@ const (
 func (v *MOS6522) Read(reg uint8) uint8 {
 	switch reg & 0x0f {
 	case 0:
+		v.ifr &^= mos6522IntCB1
 		return (v.irb &^ v.ddrb) | (v.orb & v.ddrb)
-	case 1, 15:
+	case 1:
+		v.ifr &^= mos6522IntCA1
+		return (v.ira &^ v.ddra) | (v.ora & v.ddra)
+	case 15:
 		return (v.ira &^ v.ddra) | (v.ora & v.ddra)
 	case 2:
 		return v.ddrb
@@ -95,8 +107,12 @@ func (v *MOS6522) Read(reg uint8) uint8 {
 func (v *MOS6522) Write(reg uint8, value uint8) {
 	switch reg & 0x0f {
 	case 0:
+		v.ifr &^= mos6522IntCB1
 		v.orb = value
-	case 1, 15:
+	case 1:
+		v.ifr &^= mos6522IntCA1
+		v.ora = value
+	case 15:
 		v.ora = value
 	case 2:
 		v.ddrb = value
@@ -200,3 +216,37 @@ func (v *MOS6522) SetInputA(value uint8) {
 func (v *MOS6522) SetInputB(value uint8) {
 	v.irb = value
 }
+
+// SetCA1 sets the level of the CA1 input, the active edge selected on
+// the PCR sets the interrupt flag
+func (v *MOS6522) SetCA1(level bool) {
+	if level != v.ca1 && level == (v.pcr&mos6522PcrCA1Positive != 0) {
+		v.ifr |= mos6522IntCA1
+	}
+	v.ca1 = level
+}
+
+// SetCB1 sets the level of the CB1 input, the active edge selected on
+// the PCR sets the interrupt flag
+func (v *MOS6522) SetCB1(level bool) {
+	if level != v.cb1 && level == (v.pcr&mos6522PcrCB1Positive != 0) {
+		v.ifr |= mos6522IntCB1
+	}
+	v.cb1 = level
+}
+
+// SaveState writes the internal state of the VIA
+func (v *MOS6522) SaveState(w io.Writer) error {
+	return saveValues(w,
+		&v.ora, &v.orb, &v.ira, &v.irb, &v.ddra, &v.ddrb,
+		&v.t1counter, &v.t1latch, &v.t1fired, &v.t2counter, &v.t2latchL, &v.t2fired,
+		&v.sr, &v.acr, &v.pcr, &v.ifr, &v.ier, &v.ca1, &v.cb1)
+}
+
+// LoadState restores the state written by SaveState
+func (v *MOS6522) LoadState(r io.Reader) error {
+	return loadValues(r,
+		&v.ora, &v.orb, &v.ira, &v.irb, &v.ddra, &v.ddrb,
+		&v.t1counter, &v.t1latch, &v.t1fired, &v.t2counter, &v.t2latchL, &v.t2fired,
+		&v.sr, &v.acr, &v.pcr, &v.ifr, &v.ier, &v.ca1, &v.cb1)
+}
@@ -1,6 +1,7 @@
 package component
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -150,6 +151,32 @@ func TestMOS6522Ports(t *testing.T) {
 	}
 }
 
+func TestMOS6522ControlLines(t *testing.T) {
+	var v MOS6522
+	v.Write(14, 0x80|0x02|0x10) // Enable the CA1 and CB1 interrupts
+	v.Write(12, 0x10)           // CA1 negative edge, CB1 positive edge
+
+	v.SetCA1(true)
+	v.SetCB1(true)
+	if v.Read(13) != 0x10|0x80 {
+		t.Errorf("Only the CB1 positive edge should set the flag, got 0x%02x", v.Read(13))
+	}
+	v.Read(0)
+	if v.InterruptAsserted() {
+		t.Error("Reading port B should clear the CB1 flag")
+	}
+
+	v.SetCA1(false)
+	v.SetCB1(false)
+	if v.Read(13) != 0x02|0x80 {
+		t.Errorf("Only the CA1 negative edge should set the flag, got 0x%02x", v.Read(13))
+	}
+	v.Write(1, 0)
+	if v.InterruptAsserted() {
+		t.Error("Writing port A should clear the CA1 flag")
+	}
+}
+
 func TestMOS6522Reset(t *testing.T) {
 	var v MOS6522
 	v.Write(14, 0x80|0x40)
@@ -165,3 +192,33 @@ func TestMOS6522Reset(t *testing.T) {
 		t.Error("Reset should clear the data direction registers")
 	}
 }
+
+func TestMOS6522SaveState(t *testing.T) {
+	var v MOS6522
+	v.Write(3, 0xff)       // DDRA all outputs
+	v.Write(1, 0x5a)       // ORA
+	v.Write(14, 0x80|0x40) // Enable the T1 interrupt
+	v.Write(4, 100)
+	v.Write(5, 0)
+	v.Tick(50)
+
+	var buf bytes.Buffer
+	err := v.SaveState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var restored MOS6522
+	err = restored.LoadState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != v {
+		t.Error("The restored VIA should be equal to the saved one")
+	}
+
+	restored.Tick(52)
+	if !restored.InterruptAsserted() {
+		t.Error("The restored timer should continue counting")
+	}
+}
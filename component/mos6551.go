@@ -0,0 +1,244 @@
+package component
+
+import "io"
+
+/*
+MOS 6551 Asynchronous Communication Interface Adapter (ACIA)
+See:
+
+	http://archive.6502.org/datasheets/mos_6551_acia.pdf
+	http://archive.6502.org/datasheets/rockwell_r6551_acia.pdf
+
+Used by the Super Serial Card.
+
+Implemented: the transmitter and receiver with the timing of the
+programmed baud rate and word format, the interrupts, the echo mode and
+the DSR and DCD inputs. Not implemented: parity checks, framing errors
+and breaks. The baud rate 0, using an external clock, is emulated as
+115200 bauds.
+
+Registers:
+
+	0: Transmit / receive data
+	1: Status, writing it does a programmed reset
+	2: Command
+	3: Control
+
+The bytes sent are collected with Transmitted() and the bytes to be
+received are offered with Receive() when ReadyToReceive() returns true.
+The timing advances with Tick(elapsedCycles).
+*/
+type MOS6551 struct {
+	cyclesPerSecond float64
+
+	tdr, rdr        uint8
+	shift           uint8 // Byte being sent
+	status          uint8
+	command         uint8
+	control         uint8
+	txPending       bool  // The TDR has a byte waiting for the shift register
+	txShifting      bool  // The shift register is sending a byte
+	txCycles        int64 // Remaining cycles to send the byte
+	rxCycles        int64 // Remaining cycles to receive the next byte
+	dsrOff, dcdOff  bool
+	transmittedData []uint8
+}
+
+const (
+	mos6551StatusIRQ     uint8 = 1 << 7
+	mos6551StatusDSR     uint8 = 1 << 6 // Active low
+	mos6551StatusDCD     uint8 = 1 << 5 // Active low
+	mos6551StatusTDRE    uint8 = 1 << 4
+	mos6551StatusRDRF    uint8 = 1 << 3
+	mos6551StatusOverrun uint8 = 1 << 2
+
+	mos6551CommandDTR     uint8 = 1 << 0 // Enables the receiver and the interrupts
+	mos6551CommandIRD     uint8 = 1 << 1 // Disables the receiver interrupts
+	mos6551CommandTIC     uint8 = 3 << 2 // Transmitter control
+	mos6551CommandTICIRQ  uint8 = 1 << 2 // Transmitter interrupts enabled
+	mos6551CommandEcho    uint8 = 1 << 4
+	mos6551CommandParity  uint8 = 1 << 5 // Parity enabled
+	mos6551ControlStop    uint8 = 1 << 7
+	mos6551ControlWordLen uint8 = 3 << 5
+	mos6551ControlBaud    uint8 = 0x0f
+
+	mos6551ExternalBauds = 115200
+)
+
+// Baud rates selected on the control register, 0 uses the external clock
+var mos6551Bauds = [16]float64{
+	mos6551ExternalBauds, 50, 75, 109.92, 134.58, 150, 300, 600,
+	1200, 1800, 2400, 3600, 4800, 7200, 9600, 19200,
+}
+
+// NewMOS6551 creates an ACIA timed with the CPU clock
+func NewMOS6551(cyclesPerSecond float64) *MOS6551 {
+	var a MOS6551
+	a.cyclesPerSecond = cyclesPerSecond
+	a.Reset()
+	return &a
+}
+
+// Read returns the value of a register
+func (a *MOS6551) Read(reg uint8) uint8 {
+	switch reg & 0x03 {
+	case 0:
+		a.status &^= mos6551StatusRDRF | mos6551StatusOverrun
+		return a.rdr
+	case 1:
+		status := a.status
+		if a.dsrOff {
+			status |= mos6551StatusDSR
+		}
+		if a.dcdOff {
+			status |= mos6551StatusDCD
+		}
+		a.status &^= mos6551StatusIRQ
+		return status
+	case 2:
+		return a.command
+	default:
+		return a.control
+	}
+}
+
+// Write sets the value of a register
+func (a *MOS6551) Write(reg uint8, value uint8) {
+	switch reg & 0x03 {
+	case 0:
+		a.tdr = value
+		a.txPending = true
+		a.status &^= mos6551StatusTDRE
+		if !a.txShifting {
+			a.startShift()
+		}
+	case 1:
+		// Programmed reset
+		a.command &= 0xe0
+		a.status &^= mos6551StatusOverrun
+	case 2:
+		a.command = value
+	default:
+		a.control = value
+	}
+}
+
+// Tick advances the transmitter and the receiver by the elapsed CPU cycles
+func (a *MOS6551) Tick(elapsedCycles uint64) {
+	if a.rxCycles > 0 {
+		a.rxCycles -= int64(elapsedCycles)
+	}
+	if a.txShifting {
+		a.txCycles -= int64(elapsedCycles)
+		for a.txShifting && a.txCycles <= 0 {
+			a.transmittedData = append(a.transmittedData, a.shift)
+			a.txShifting = false
+			if a.txPending {
+				// The next byte starts when the previous ends
+				late := a.txCycles
+				a.startShift()
+				a.txCycles += late
+			}
+		}
+	}
+}
+
+// startShift moves the TDR to the shift register to be sent
+func (a *MOS6551) startShift() {
+	a.shift = a.tdr
+	a.txPending = false
+	a.txShifting = true
+	a.txCycles = a.byteCycles()
+	a.status |= mos6551StatusTDRE
+	if a.command&mos6551CommandTIC == mos6551CommandTICIRQ {
+		a.interrupt()
+	}
+}
+
+// ReadyToReceive returns true when the receiver can take a new byte
+func (a *MOS6551) ReadyToReceive() bool {
+	return a.command&mos6551CommandDTR != 0 && a.rxCycles <= 0 &&
+		a.status&mos6551StatusRDRF == 0
+}
+
+// Receive puts a byte on the receive data register
+func (a *MOS6551) Receive(value uint8) {
+	a.rdr = value
+	a.status |= mos6551StatusRDRF
+	a.rxCycles = a.byteCycles()
+	if a.command&mos6551CommandIRD == 0 {
+		a.interrupt()
+	}
+	if a.command&(mos6551CommandEcho|mos6551CommandTIC) == mos6551CommandEcho {
+		a.transmittedData = append(a.transmittedData, value)
+	}
+}
+
+// Transmitted returns the bytes sent since the previous call
+func (a *MOS6551) Transmitted() []uint8 {
+	data := a.transmittedData
+	a.transmittedData = nil
+	return data
+}
+
+// SetDSR sets the state of the Data Set Ready input
+func (a *MOS6551) SetDSR(active bool) {
+	a.dsrOff = !active
+}
+
+// SetDCD sets the state of the Data Carrier Detect input
+func (a *MOS6551) SetDCD(active bool) {
+	if a.dcdOff == active {
+		a.dcdOff = !active
+		a.interrupt()
+	}
+}
+
+// InterruptAsserted returns the state of the IRQ output line
+func (a *MOS6551) InterruptAsserted() bool {
+	return a.status&mos6551StatusIRQ != 0
+}
+
+// Reset sets the registers as the RES pin
+func (a *MOS6551) Reset() {
+	a.status = mos6551StatusTDRE
+	a.command = mos6551CommandIRD
+	a.control = 0
+	a.txPending = false
+	a.txShifting = false
+	a.rxCycles = 0
+}
+
+func (a *MOS6551) interrupt() {
+	if a.command&mos6551CommandDTR != 0 {
+		a.status |= mos6551StatusIRQ
+	}
+}
+
+// byteCycles returns the duration of a character on the line
+func (a *MOS6551) byteCycles() int64 {
+	dataBits := 8 - int((a.control&mos6551ControlWordLen)>>5)
+	bits := 1 + dataBits + 1 // Start, data and stop bits
+	if a.command&mos6551CommandParity != 0 {
+		bits++ // Parity
+	}
+	if a.control&mos6551ControlStop != 0 && !(dataBits == 8 && a.command&mos6551CommandParity != 0) {
+		bits++
+	}
+	baud := mos6551Bauds[a.control&mos6551ControlBaud]
+	return int64(a.cyclesPerSecond * float64(bits) / baud)
+}
+
+// SaveState writes the internal state of the ACIA
+func (a *MOS6551) SaveState(w io.Writer) error {
+	return saveValues(w,
+		&a.tdr, &a.rdr, &a.shift, &a.status, &a.command, &a.control,
+		&a.txPending, &a.txShifting, &a.txCycles, &a.rxCycles)
+}
+
+// LoadState restores the state written by SaveState
+func (a *MOS6551) LoadState(r io.Reader) error {
+	return loadValues(r,
+		&a.tdr, &a.rdr, &a.shift, &a.status, &a.command, &a.control,
+		&a.txPending, &a.txShifting, &a.txCycles, &a.rxCycles)
+}
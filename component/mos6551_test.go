@@ -0,0 +1,65 @@
+package component
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMOS6551Transmit(t *testing.T) {
+	a := NewMOS6551(1_000_000)
+	a.Write(3, 0x1e) // 9600 bauds, 8 bits, 1 stop bit
+	a.Write(2, 0x0b) // DTR, no interrupts
+
+	a.Write(0, 'A')
+	if a.Read(1)&mos6551StatusTDRE == 0 {
+		t.Error("The TDR should be empty when the byte goes to the shift register")
+	}
+	a.Write(0, 'B')
+	if a.Read(1)&mos6551StatusTDRE != 0 {
+		t.Error("The TDR should be full while the shift register is busy")
+	}
+
+	// 10 bits at 9600 bauds are 1041 cycles
+	a.Tick(1000)
+	if len(a.Transmitted()) != 0 {
+		t.Error("The byte should not be sent before the time of 10 bits")
+	}
+	a.Tick(1100)
+	if sent := a.Transmitted(); !bytes.Equal(sent, []uint8("AB")) {
+		t.Errorf("Expected AB to be sent, got %q", sent)
+	}
+}
+
+func TestMOS6551ReceiveInterrupt(t *testing.T) {
+	a := NewMOS6551(1_000_000)
+	a.Write(3, 0x1f) // 19200 bauds
+	if a.ReadyToReceive() {
+		t.Error("The receiver should be disabled until DTR is set")
+	}
+	a.Write(2, 0x09) // DTR, receiver interrupts enabled
+
+	a.Receive(0x55)
+	if !a.InterruptAsserted() {
+		t.Error("The interrupt should be asserted when a byte is received")
+	}
+	if a.ReadyToReceive() {
+		t.Error("The receiver should not take a byte with the RDR full")
+	}
+	status := a.Read(1)
+	if status&(mos6551StatusIRQ|mos6551StatusRDRF) != mos6551StatusIRQ|mos6551StatusRDRF {
+		t.Errorf("The status should have IRQ and RDRF, got $%02x", status)
+	}
+	if a.InterruptAsserted() {
+		t.Error("Reading the status should release the interrupt")
+	}
+	if a.Read(0) != 0x55 {
+		t.Error("The received byte should be on the data register")
+	}
+	if a.ReadyToReceive() {
+		t.Error("The receiver should wait the time of a byte")
+	}
+	a.Tick(600)
+	if !a.ReadyToReceive() {
+		t.Error("The receiver should take the next byte")
+	}
+}
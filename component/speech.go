@@ -0,0 +1,162 @@
+package component
+
+import (
+	"io"
+	"math"
+)
+
+/*
+Formant synthesizer for the phoneme speech chips.
+
+See:
+
+	"Software for a cascade/parallel formant synthesizer", D. H. Klatt, 1980
+
+The SSI-263 and the Votrax SC-01 build the speech with analog filters
+driven by a glottal pulse and a noise source. Here they are approximated
+with three cascaded second order resonators for the first three formants,
+excited by a sawtooth at the pitch frequency for the voiced sounds and by
+a LFSR for the fricatives. The formants glide from one phoneme to the next
+to make the transitions smooth.
+
+The chips have different phoneme sets, both are mapped to the base sounds
+of speechSounds.
+*/
+
+// SpeechSampleRate is the frequency of the Step() calls of the speech chips
+const SpeechSampleRate = 10000
+
+type speechSound struct {
+	f1, f2, f3 float64 // Formant frequencies in Hz
+	voice      float64 // Amplitude of the glottal source
+	noise      float64 // Amplitude of the noise source
+}
+
+// Formants from Peterson and Barney and the Klatt paper
+var speechSounds = map[string]speechSound{
+	"":   {500, 1500, 2500, 0, 0}, // Silence
+	"iy": {270, 2290, 3010, 1, 0},
+	"ih": {390, 1990, 2550, 1, 0},
+	"ey": {480, 2100, 2700, 1, 0},
+	"eh": {530, 1840, 2480, 1, 0},
+	"ae": {660, 1720, 2410, 1, 0},
+	"aa": {730, 1090, 2440, 1, 0},
+	"ao": {570, 840, 2410, 1, 0},
+	"ow": {500, 900, 2400, 1, 0},
+	"ah": {520, 1190, 2390, 1, 0},
+	"uh": {440, 1020, 2240, 1, 0},
+	"uw": {300, 870, 2240, 1, 0},
+	"er": {490, 1350, 1690, 1, 0},
+	"r":  {420, 1300, 1600, 0.8, 0},
+	"l":  {360, 1050, 2800, 0.7, 0},
+	"w":  {290, 610, 2150, 0.7, 0},
+	"y":  {260, 2070, 3020, 0.7, 0},
+	"m":  {480, 1270, 2130, 0.5, 0},
+	"n":  {480, 1340, 2470, 0.5, 0},
+	"ng": {480, 2000, 2900, 0.5, 0},
+	"b":  {200, 1100, 2150, 0.4, 0.1},
+	"d":  {200, 1600, 2600, 0.4, 0.1},
+	"g":  {200, 1990, 2850, 0.4, 0.1},
+	"p":  {400, 1100, 2150, 0, 0.6},
+	"t":  {400, 1600, 2600, 0, 0.6},
+	"k":  {300, 1990, 2850, 0, 0.6},
+	"h":  {500, 1500, 2500, 0, 0.5},
+	"f":  {340, 1100, 2080, 0, 0.3},
+	"th": {320, 1290, 2540, 0, 0.3},
+	"s":  {320, 1390, 2530, 0, 0.6},
+	"sh": {300, 1840, 2750, 0, 0.6},
+	"v":  {220, 1100, 2080, 0.5, 0.2},
+	"dh": {270, 1290, 2540, 0.5, 0.2},
+	"z":  {240, 1390, 2530, 0.5, 0.3},
+	"zh": {300, 1840, 2750, 0.5, 0.3},
+	"ch": {300, 1840, 2750, 0.2, 0.5},
+	"j":  {300, 1840, 2750, 0.5, 0.3},
+}
+
+var speechBandwidths = [3]float64{60, 90, 150}
+
+// The resonators amplify the formants, the open vowels peak at about 5.5
+const speechGain = 0.15
+
+type speechSynth struct {
+	target    speechSound
+	current   speechSound
+	glide     float64 // Fraction of the distance to the target moved per sample
+	pitch     float64 // Frequency of the glottal source in Hz
+	amplitude float64
+
+	phase float64    // Position in the glottal period, 0.0 to 1.0
+	noise uint32     // 23 bit LFSR
+	y1    [3]float64 // Resonators outputs for the previous sample
+	y2    [3]float64 // Resonators outputs two samples ago
+}
+
+func (s *speechSynth) reset() {
+	*s = speechSynth{}
+	s.current = speechSounds[""]
+	s.target = s.current
+	s.glide = 0.01
+	s.pitch = 100
+	s.noise = 1
+}
+
+func (s *speechSynth) setSound(name string) {
+	s.target = speechSounds[name]
+}
+
+// resonate applies the formant resonator n to the sample
+func (s *speechSynth) resonate(n int, frequency float64, x float64) float64 {
+	const t = 1.0 / SpeechSampleRate
+	c := -math.Exp(-2 * math.Pi * speechBandwidths[n] * t)
+	b := 2 * math.Exp(-math.Pi*speechBandwidths[n]*t) * math.Cos(2*math.Pi*frequency*t)
+	a := 1 - b - c
+
+	y := a*x + b*s.y1[n] + c*s.y2[n]
+	s.y2[n] = s.y1[n]
+	s.y1[n] = y
+	return y
+}
+
+// step returns the next sample, from -1.0 to 1.0
+func (s *speechSynth) step() float32 {
+	glide := func(current *float64, target float64) {
+		*current += (target - *current) * s.glide
+	}
+	glide(&s.current.f1, s.target.f1)
+	glide(&s.current.f2, s.target.f2)
+	glide(&s.current.f3, s.target.f3)
+	glide(&s.current.voice, s.target.voice)
+	glide(&s.current.noise, s.target.noise)
+
+	s.phase += s.pitch / SpeechSampleRate
+	if s.phase >= 1 {
+		s.phase -= 1
+	}
+	glottal := 1 - 2*s.phase
+
+	// Taps 23 and 18
+	bit := (s.noise ^ (s.noise >> 5)) & 1
+	s.noise = (s.noise >> 1) | (bit << 22)
+	noise := float64(s.noise&1)*2 - 1
+
+	x := glottal*s.current.voice + noise*s.current.noise
+	x = s.resonate(0, s.current.f1, x)
+	x = s.resonate(1, s.current.f2, x)
+	x = s.resonate(2, s.current.f3, x)
+
+	level := x * s.amplitude * speechGain
+	level = math.Max(-1, math.Min(1, level))
+	return float32(level)
+}
+
+func (s *speechSynth) saveState(w io.Writer) error {
+	return saveValues(w, &s.target.f1, &s.target.f2, &s.target.f3, &s.target.voice, &s.target.noise,
+		&s.current.f1, &s.current.f2, &s.current.f3, &s.current.voice, &s.current.noise,
+		&s.glide, &s.pitch, &s.amplitude, &s.phase, &s.noise, &s.y1, &s.y2)
+}
+
+func (s *speechSynth) loadState(r io.Reader) error {
+	return loadValues(r, &s.target.f1, &s.target.f2, &s.target.f3, &s.target.voice, &s.target.noise,
+		&s.current.f1, &s.current.f2, &s.current.f3, &s.current.voice, &s.current.noise,
+		&s.glide, &s.pitch, &s.amplitude, &s.phase, &s.noise, &s.y1, &s.y2)
+}
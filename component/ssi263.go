@@ -0,0 +1,175 @@
+package component
+
+import "io"
+
+/*
+Silicon Systems SSI-263 phoneme speech synthesizer.
+
+See:
+
+	"SSI 263A Phoneme Speech Synthesizer" datasheet, Silicon Systems
+	https://github.com/AppleWin/AppleWin/blob/master/source/SSI263.cpp
+
+Used by the Mockingboard C and the Phasor.
+
+Registers:
+
+	R0: bits 7-6 duration, bits 5-0 phoneme
+	R1: inflection, bits 10-3
+	R2: bits 7-4 rate, bits 3-0 inflection bits 11 and 2-0
+	R3: bit 7 CTL, bits 6-4 articulation, bits 3-0 amplitude
+	R4: filter frequency
+
+When CTL goes from 1 to 0 the duration bits of R0 select the operating
+mode, mode 0 disables the A/R output. A write to R0 starts a new phoneme
+and releases A/R. When the phoneme ends the chip requests the next one
+with A/R, the last phoneme is held until it arrives. With CTL set the
+chip is in standby and silent.
+
+The duration of the phonemes is approximated to (16-rate)*(4-duration)
+units of 4096 microseconds. The filter frequency is not emulated.
+*/
+type SSI263 struct {
+	regs      [5]uint8
+	mode      uint8
+	remaining uint32 // Samples until the end of the phoneme
+	request   bool   // A/R is active, the chip waits for a phoneme
+	synth     speechSynth
+}
+
+const (
+	ssi263RegDurationPhoneme = 0
+	ssi263RegInflection      = 1
+	ssi263RegRateInflection  = 2
+	ssi263RegControl         = 3
+	ssi263RegFilter          = 4
+
+	ssi263Control uint8 = 0x80
+
+	ssi263UnitMicroseconds = 4096
+)
+
+// Names of the phonemes as in the datasheet with the base sound used
+var ssi263Phonemes = [64][2]string{
+	{"PA", ""}, {"E", "iy"}, {"E1", "iy"}, {"Y", "y"},
+	{"YI", "ih"}, {"AY", "ey"}, {"IE", "ih"}, {"I", "ih"},
+	{"A", "ey"}, {"AI", "eh"}, {"EH", "eh"}, {"EH1", "eh"},
+	{"AE", "ae"}, {"AE1", "ae"}, {"AH", "aa"}, {"AH1", "aa"},
+	{"W", "w"}, {"O", "ow"}, {"OU", "ow"}, {"OO", "uw"},
+	{"IU", "uh"}, {"IU1", "uh"}, {"U", "uw"}, {"U1", "uw"},
+	{"UH", "ah"}, {"UH1", "ah"}, {"UH2", "ah"}, {"UH3", "ah"},
+	{"ER", "er"}, {"R", "r"}, {"R1", "r"}, {"R2", "r"},
+	{"L", "l"}, {"L1", "l"}, {"LF", "l"}, {"W", "w"},
+	{"B", "b"}, {"D", "d"}, {"KV", "g"}, {"P", "p"},
+	{"T", "t"}, {"K", "k"}, {"HV", "h"}, {"HVC", "h"},
+	{"HF", "h"}, {"HFC", "h"}, {"HN", "h"}, {"Z", "z"},
+	{"S", "s"}, {"J", "j"}, {"SCH", "sh"}, {"V", "v"},
+	{"F", "f"}, {"THV", "dh"}, {"TH", "th"}, {"M", "m"},
+	{"N", "n"}, {"NG", "ng"}, {":A", "ae"}, {":OH", "ao"},
+	{":U", "uw"}, {":UH", "ah"}, {"E2", "iy"}, {"LB", "l"},
+}
+
+// Reset sets the chip in standby
+func (s *SSI263) Reset() {
+	s.regs = [5]uint8{}
+	s.regs[ssi263RegControl] = ssi263Control
+	s.mode = 0
+	s.remaining = 0
+	s.request = false
+	s.synth.reset()
+}
+
+// Write sets one of the registers, reg is the register number from 0 to 7
+func (s *SSI263) Write(reg uint8, value uint8) {
+	reg &= 0x07
+	if reg > ssi263RegFilter {
+		reg = ssi263RegFilter // R5 to R7 are mirrors of the filter register
+	}
+	previous := s.regs[reg]
+	s.regs[reg] = value
+
+	switch reg {
+	case ssi263RegDurationPhoneme:
+		s.startPhoneme()
+	case ssi263RegControl:
+		if previous&ssi263Control != 0 && value&ssi263Control == 0 {
+			s.mode = s.regs[ssi263RegDurationPhoneme] >> 6
+		}
+	}
+	s.updateVoice()
+}
+
+// Read returns the A/R status on bit 7, set when a new phoneme is requested
+func (s *SSI263) Read() uint8 {
+	if s.Request() {
+		return 0x80
+	}
+	return 0
+}
+
+// Request returns true when the A/R output is active, the phoneme has
+// ended and the chip waits for the next one
+func (s *SSI263) Request() bool {
+	return s.request && s.mode != 0
+}
+
+// Phoneme returns the name of the current phoneme
+func (s *SSI263) Phoneme() string {
+	return ssi263Phonemes[s.regs[ssi263RegDurationPhoneme]&0x3f][0]
+}
+
+func (s *SSI263) startPhoneme() {
+	phoneme := s.regs[ssi263RegDurationPhoneme]
+	duration := uint32(phoneme >> 6)
+	rate := uint32(s.regs[ssi263RegRateInflection] >> 4)
+	s.remaining = (16 - rate) * (4 - duration) * ssi263UnitMicroseconds * SpeechSampleRate / 1_000_000
+	s.request = false
+	s.synth.setSound(ssi263Phonemes[phoneme&0x3f][1])
+}
+
+func (s *SSI263) updateVoice() {
+	inflection := uint16(s.regs[ssi263RegInflection])<<3 |
+		uint16(s.regs[ssi263RegRateInflection]&0x07) |
+		uint16(s.regs[ssi263RegRateInflection]&0x08)<<8
+	s.synth.pitch = 60 + float64(inflection)*200/4096
+
+	control := s.regs[ssi263RegControl]
+	if control&ssi263Control != 0 {
+		s.synth.amplitude = 0
+	} else {
+		s.synth.amplitude = float64(control&0x0f) / 15
+	}
+	// Faster transitions with higher articulation
+	articulation := (control >> 4) & 0x07
+	s.synth.glide = 0.002 * float64(articulation+1)
+}
+
+// Step advances the synthesis by 1/SpeechSampleRate seconds and returns
+// the output level, from -1.0 to 1.0
+func (s *SSI263) Step() float32 {
+	if s.remaining > 0 {
+		s.remaining--
+		if s.remaining == 0 {
+			s.request = true
+		}
+	}
+	return s.synth.step()
+}
+
+// SaveState writes the internal state of the chip
+func (s *SSI263) SaveState(w io.Writer) error {
+	err := saveValues(w, &s.regs, &s.mode, &s.remaining, &s.request)
+	if err != nil {
+		return err
+	}
+	return s.synth.saveState(w)
+}
+
+// LoadState restores the state written by SaveState
+func (s *SSI263) LoadState(r io.Reader) error {
+	err := loadValues(r, &s.regs, &s.mode, &s.remaining, &s.request)
+	if err != nil {
+		return err
+	}
+	return s.synth.loadState(r)
+}
@@ -0,0 +1,100 @@
+package component
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSSI263Phoneme(t *testing.T) {
+	var s SSI263
+	s.Reset()
+	s.Write(ssi263RegDurationPhoneme, 0xc0) // Mode 3 with PA
+	s.Write(ssi263RegControl, 0x0f)         // CTL from 1 to 0, full amplitude
+	s.Write(ssi263RegRateInflection, 0xf8)  // Fastest rate
+	s.Write(ssi263RegDurationPhoneme, 0xce) // Shortest AH
+
+	if s.Phoneme() != "AH" {
+		t.Errorf("The phoneme should be AH, got %v", s.Phoneme())
+	}
+	if s.Request() || s.Read() != 0 {
+		t.Error("A/R should be released while the phoneme is spoken")
+	}
+
+	// One unit of 4096 microseconds
+	steps := 0
+	var peak float32
+	for !s.Request() && steps < 1000 {
+		level := s.Step()
+		if level > peak {
+			peak = level
+		}
+		steps++
+	}
+	if steps != 40 {
+		t.Errorf("The phoneme should last 40 samples, got %v", steps)
+	}
+	if peak == 0 {
+		t.Error("The vowel should be audible")
+	}
+	if s.Read() != 0x80 {
+		t.Error("The next phoneme should be requested")
+	}
+
+	s.Write(ssi263RegDurationPhoneme, 0xce)
+	if s.Request() {
+		t.Error("A new phoneme should release A/R")
+	}
+}
+
+func TestSSI263ModeDisablesRequest(t *testing.T) {
+	var s SSI263
+	s.Reset()
+	s.Write(ssi263RegDurationPhoneme, 0x00) // Mode 0
+	s.Write(ssi263RegControl, 0x0f)
+	s.Write(ssi263RegRateInflection, 0xf0)
+	s.Write(ssi263RegDurationPhoneme, 0xc1)
+	for range 100 {
+		s.Step()
+	}
+	if s.Request() {
+		t.Error("A/R should not be active on mode 0")
+	}
+}
+
+func TestSSI263Standby(t *testing.T) {
+	var s SSI263
+	s.Reset()
+	s.Write(ssi263RegDurationPhoneme, 0x0e)
+	for range 500 {
+		if s.Step() != 0 {
+			t.Fatal("The chip should be silent on standby")
+		}
+	}
+}
+
+func TestSSI263SaveState(t *testing.T) {
+	var s SSI263
+	s.Reset()
+	s.Write(ssi263RegControl, 0x0f)
+	s.Write(ssi263RegDurationPhoneme, 0x0e)
+	for range 50 {
+		s.Step()
+	}
+
+	var buf bytes.Buffer
+	err := s.SaveState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored SSI263
+	err = restored.LoadState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != s {
+		t.Error("The restored chip should be equal to the saved one")
+	}
+	if restored.Step() != s.Step() {
+		t.Error("The restored chip should continue the synthesis")
+	}
+}
@@ -0,0 +1,29 @@
+package component
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// saveValues writes a list of pointers to fixed size fields for the save
+// states
+func saveValues(w io.Writer, values ...any) error {
+	for _, value := range values {
+		err := binary.Write(w, binary.BigEndian, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadValues reads the fields written by saveValues
+func loadValues(r io.Reader, values ...any) error {
+	for _, value := range values {
+		err := binary.Read(r, binary.BigEndian, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package component
+
+import "io"
+
+/*
+Votrax SC-01 phoneme speech synthesizer.
+
+See:
+
+	"SC-01 Speech Synthesizer Phoneme Chart", Votrax
+	https://github.com/mamedev/mame/blob/master/src/devices/sound/votrax.cpp
+
+Used by the Sound/Speech I card, the Mockingboard with speech.
+
+A write of a byte latches the phoneme on bits 5-0 and the inflection on
+bits 7-6 and releases the A/R output. A/R is active again when the
+phoneme ends, the last phoneme is held until a new one arrives. PA0, PA1
+and STOP are silent.
+*/
+type VotraxSC01 struct {
+	phoneme    uint8
+	inflection uint8
+	remaining  uint32 // Samples until the end of the phoneme
+	request    bool   // A/R is active, the chip waits for a phoneme
+	synth      speechSynth
+}
+
+type votraxPhoneme struct {
+	name     string
+	sound    string // Base sound used
+	duration uint32 // Milliseconds
+}
+
+var votraxSC01Phonemes = [64]votraxPhoneme{
+	{"EH3", "eh", 59}, {"EH2", "eh", 71}, {"EH1", "eh", 121}, {"PA0", "", 47},
+	{"DT", "d", 47}, {"A1", "ey", 71}, {"A2", "ey", 103}, {"ZH", "zh", 90},
+	{"AH2", "aa", 71}, {"I3", "ih", 55}, {"I2", "ih", 80}, {"I1", "ih", 121},
+	{"M", "m", 103}, {"N", "n", 80}, {"B", "b", 71}, {"V", "v", 71},
+	{"CH", "ch", 71}, {"SH", "sh", 121}, {"Z", "z", 71}, {"AW1", "ao", 146},
+	{"NG", "ng", 121}, {"AH1", "aa", 146}, {"OO1", "uh", 103}, {"OO", "uh", 185},
+	{"L", "l", 103}, {"K", "k", 80}, {"J", "j", 47}, {"H", "h", 71},
+	{"G", "g", 71}, {"F", "f", 103}, {"D", "d", 55}, {"S", "s", 90},
+	{"A", "ey", 185}, {"AY", "ey", 103}, {"Y1", "y", 55}, {"UH3", "ah", 90},
+	{"AH", "aa", 250}, {"P", "p", 103}, {"O", "ow", 185}, {"I", "ih", 185},
+	{"U", "uw", 185}, {"Y", "y", 103}, {"T", "t", 71}, {"R", "r", 90},
+	{"E", "iy", 185}, {"W", "w", 80}, {"AE", "ae", 185}, {"AE1", "ae", 103},
+	{"AW2", "ao", 90}, {"UH2", "ah", 71}, {"UH1", "ah", 103}, {"UH", "ah", 185},
+	{"O2", "ow", 80}, {"O1", "ow", 121}, {"IU", "uw", 59}, {"U1", "uw", 90},
+	{"THV", "dh", 80}, {"TH", "th", 71}, {"ER", "er", 146}, {"EH", "eh", 185},
+	{"E1", "iy", 121}, {"AW", "ao", 250}, {"PA1", "", 185}, {"STOP", "", 47},
+}
+
+// Pitch in Hz for each of the inflection levels
+var votraxSC01Pitches = [4]float64{90, 100, 110, 120}
+
+// Reset stops the speech. The chip is ready for a phoneme.
+func (v *VotraxSC01) Reset() {
+	v.phoneme = 0x3f // STOP
+	v.inflection = 0
+	v.remaining = 0
+	v.request = true
+	v.synth.reset()
+	v.synth.amplitude = 1
+}
+
+// Write latches a new phoneme and inflection
+func (v *VotraxSC01) Write(value uint8) {
+	v.phoneme = value & 0x3f
+	v.inflection = value >> 6
+	phoneme := &votraxSC01Phonemes[v.phoneme]
+	v.remaining = phoneme.duration * SpeechSampleRate / 1000
+	v.request = false
+	v.synth.setSound(phoneme.sound)
+	v.synth.pitch = votraxSC01Pitches[v.inflection]
+}
+
+// Request returns true when the A/R output is active, the phoneme has
+// ended and the chip waits for the next one
+func (v *VotraxSC01) Request() bool {
+	return v.request
+}
+
+// Phoneme returns the name of the current phoneme
+func (v *VotraxSC01) Phoneme() string {
+	return votraxSC01Phonemes[v.phoneme].name
+}
+
+// Step advances the synthesis by 1/SpeechSampleRate seconds and returns
+// the output level, from -1.0 to 1.0
+func (v *VotraxSC01) Step() float32 {
+	if v.remaining > 0 {
+		v.remaining--
+		if v.remaining == 0 {
+			v.request = true
+		}
+	}
+	return v.synth.step()
+}
+
+// SaveState writes the internal state of the chip
+func (v *VotraxSC01) SaveState(w io.Writer) error {
+	err := saveValues(w, &v.phoneme, &v.inflection, &v.remaining, &v.request)
+	if err != nil {
+		return err
+	}
+	return v.synth.saveState(w)
+}
+
+// LoadState restores the state written by SaveState
+func (v *VotraxSC01) LoadState(r io.Reader) error {
+	err := loadValues(r, &v.phoneme, &v.inflection, &v.remaining, &v.request)
+	if err != nil {
+		return err
+	}
+	return v.synth.loadState(r)
+}
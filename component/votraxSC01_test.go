@@ -0,0 +1,46 @@
+package component
+
+import "testing"
+
+func TestVotraxSC01Phoneme(t *testing.T) {
+	var v VotraxSC01
+	v.Reset()
+	if !v.Request() {
+		t.Error("The chip should be ready after a reset")
+	}
+
+	v.Write(0x40 | 0x24) // AH with inflection 1
+	if v.Phoneme() != "AH" {
+		t.Errorf("The phoneme should be AH, got %v", v.Phoneme())
+	}
+	if v.Request() {
+		t.Error("A/R should be released while the phoneme is spoken")
+	}
+
+	steps := 0
+	var peak float32
+	for !v.Request() && steps < 10000 {
+		level := v.Step()
+		if level > peak {
+			peak = level
+		}
+		steps++
+	}
+	if steps != 250*SpeechSampleRate/1000 {
+		t.Errorf("AH should last 250ms, got %v samples", steps)
+	}
+	if peak == 0 {
+		t.Error("The vowel should be audible")
+	}
+}
+
+func TestVotraxSC01Pause(t *testing.T) {
+	var v VotraxSC01
+	v.Reset()
+	v.Write(0x3e) // PA1
+	for range 1000 {
+		if v.Step() != 0 {
+			t.Fatal("A pause should be silent")
+		}
+	}
+}
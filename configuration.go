@@ -36,6 +36,12 @@ const (
 	confRomx       = "romx"
 	confMods       = "mods"
 	confTape       = "tape"
+	confTapeOut    = "tapeout"
+	confTapeTurbo  = "tapeturbo"
+	confRewind     = "rewind"
+	confViceMon    = "vicemon"
+	confRecord     = "record"
+	confPlay       = "play"
 
 	confS0 = "s0"
 	confS1 = "s1"
@@ -232,6 +238,12 @@ func setupFlags(models *configurationModels, configuration *configuration) error
 		confRgb:        "emulate the RGB modes of the 80col RGB card for DHGR",
 		confRomx:       "emulate a RomX",
 		confTape:       "WAV file with a tape recording for the cassette input",
+		confTapeOut:    "WAV file to record the cassette output",
+		confTapeTurbo:  "load the tape recordings directly to memory when read with the Monitor ROM routines",
+		confRewind:     "seconds of emulation kept to be able to rewind, 0 to disable",
+		confViceMon:    "TCP address to listen for VICE binary monitor clients, like ':6502'",
+		confRecord:     "movie file to record the inputs from power on",
+		confPlay:       "movie file to play back the inputs from power on",
 		confS0:         "slot 0 configuration.",
 		confS1:         "slot 1 configuration.",
 		confS2:         "slot 2 configuration.",
@@ -242,7 +254,7 @@ func setupFlags(models *configurationModels, configuration *configuration) error
 		confS7:         "slot 7 configuration.",
 	}
 
-	boolParams := []string{confProfile, confShowConfig, confForceCaps, confRgb, confRomx}
+	boolParams := []string{confProfile, confShowConfig, confForceCaps, confRgb, confRomx, confTapeTurbo}
 
 	for name, description := range paramDescription {
 		defaultValue, ok := configuration.getHas(name)
@@ -25,6 +25,7 @@ func TestConfigurationModel(t *testing.T) {
 		requiredFields := []string{
 			confRom, confCharRom, confCpu, confSpeed, confRamworks, confNsc,
 			confTrace, confProfile, confShowConfig, confForceCaps, confRgb, confRomx,
+			confTapeOut, confTapeTurbo, confRewind, confViceMon, confRecord, confPlay,
 			confS0, confS1, confS2, confS3, confS4, confS5, confS6, confS7,
 		}
 		availabledModels := models.availableModels()
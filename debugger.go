@@ -0,0 +1,489 @@
+package izapple2
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ivanizag/iz6502"
+)
+
+/*
+Debugger for the 6502 code running on the emulated machine.
+
+It supports:
+  - Breakpoints on the PC, optionally with conditions on the registers
+    like "A==$20 && X<10". The registers are A, X, Y, P and S.
+  - Watchpoints on memory ranges for reads, writes or both. They are
+    checked on the memory manager accessRead and accessWrite. Opcode
+    fetches are reads too.
+  - Stepping: step into, step over a JSR and step out of a subroutine.
+
+When the execution stops the emulator is paused, the stop reason is
+available with LastStop(). The stepping and Continue() resume the emulator.
+
+The methods can be called from any goroutine.
+*/
+
+// Breakpoint stops the execution before running an instruction from
+// Address to End, both included
+type Breakpoint struct {
+	ID        int
+	Address   uint16
+	End       uint16
+	Condition string
+
+	conditions []breakpointCondition
+}
+
+// Watchpoint stops the execution after an instruction accesses the memory
+// range from Start to End, both included
+type Watchpoint struct {
+	ID    int
+	Start uint16
+	End   uint16
+	Read  bool
+	Write bool
+}
+
+type breakpointCondition struct {
+	register byte
+	operator string
+	value    uint16
+}
+
+const (
+	debuggerStepNone = iota
+	debuggerStepInto
+	debuggerStepOver
+	debuggerStepOut
+)
+
+const (
+	opcodeJSR = uint8(0x20)
+	opcodeRTS = uint8(0x60)
+	opcodeRTI = uint8(0x40)
+)
+
+// Debugger controls the 6502 execution
+type Debugger struct {
+	a        *Apple2
+	active   atomic.Bool   // There are breakpoints, watchpoints or a step in progress
+	watching atomic.Bool   // There are watchpoints
+	disasm   *iz6502.State // Disassembles from memory without triggering the watchpoints
+
+	mutex          sync.Mutex
+	lastID         int
+	breakpoints    []Breakpoint
+	watchpoints    []Watchpoint
+	step           int
+	stepPC         uint16
+	stepSP         uint8
+	opcode         uint8 // Opcode of the instruction being run
+	skipBreakpoint bool  // To continue from a breakpoint without stopping again
+	watchHit       string
+	watchHitID     int
+	lastStop       string
+	stopHandler    func(id int, reason string)
+}
+
+func newDebugger(a *Apple2) *Debugger {
+	var d Debugger
+	d.a = a
+	return &d
+}
+
+// debuggerMemory is the view of the memory for the debugger disassembler,
+// the accesses don't trigger the watchpoints
+type debuggerMemory struct {
+	mmu *memoryManager
+}
+
+func (m *debuggerMemory) Peek(address uint16) uint8 {
+	return m.mmu.peekUnwatched(address)
+}
+
+func (m *debuggerMemory) PeekCode(address uint16) uint8 {
+	return m.mmu.peekUnwatched(address)
+}
+
+func (m *debuggerMemory) Poke(address uint16, value uint8) {
+	m.mmu.pokeUnwatched(address, value)
+}
+
+// Debugger returns the debugger of the emulated machine
+func (a *Apple2) Debugger() *Debugger {
+	return a.debugger
+}
+
+// AddBreakpoint adds a breakpoint on an address with an optional condition.
+// Returns the breakpoint id.
+func (d *Debugger) AddBreakpoint(address uint16, condition string) (int, error) {
+	return d.AddBreakpointRange(address, address, condition)
+}
+
+// AddBreakpointRange adds a breakpoint on a range of addresses with an
+// optional condition. Returns the breakpoint id.
+func (d *Debugger) AddBreakpointRange(address uint16, end uint16, condition string) (int, error) {
+	if end < address {
+		return 0, errors.New("the end of the breakpoint range is before the start")
+	}
+	conditions, err := parseBreakpointConditions(condition)
+	if err != nil {
+		return 0, err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.lastID++
+	d.breakpoints = append(d.breakpoints, Breakpoint{
+		ID:         d.lastID,
+		Address:    address,
+		End:        end,
+		Condition:  strings.TrimSpace(condition),
+		conditions: conditions,
+	})
+	d.updateActive()
+	return d.lastID, nil
+}
+
+// AddWatchpoint adds a watchpoint on a memory range. Returns the watchpoint id.
+func (d *Debugger) AddWatchpoint(start uint16, end uint16, read bool, write bool) (int, error) {
+	if end < start {
+		return 0, errors.New("the end of the watchpoint range is before the start")
+	}
+	if !read && !write {
+		return 0, errors.New("the watchpoint must be for reads, writes or both")
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.lastID++
+	d.watchpoints = append(d.watchpoints, Watchpoint{
+		ID:    d.lastID,
+		Start: start,
+		End:   end,
+		Read:  read,
+		Write: write,
+	})
+	d.updateActive()
+	return d.lastID, nil
+}
+
+// Remove deletes a breakpoint or a watchpoint
+func (d *Debugger) Remove(id int) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for i, bp := range d.breakpoints {
+		if bp.ID == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			d.updateActive()
+			return nil
+		}
+	}
+	for i, wp := range d.watchpoints {
+		if wp.ID == id {
+			d.watchpoints = append(d.watchpoints[:i], d.watchpoints[i+1:]...)
+			d.updateActive()
+			return nil
+		}
+	}
+	return fmt.Errorf("breakpoint or watchpoint %v not found", id)
+}
+
+// GetBreakpoints returns a copy of the breakpoints
+func (d *Debugger) GetBreakpoints() []Breakpoint {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]Breakpoint(nil), d.breakpoints...)
+}
+
+// GetWatchpoints returns a copy of the watchpoints
+func (d *Debugger) GetWatchpoints() []Watchpoint {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]Watchpoint(nil), d.watchpoints...)
+}
+
+// LastStop describes why the debugger stopped the execution the last time
+func (d *Debugger) LastStop() string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.lastStop
+}
+
+// SetStopHandler sets a function to be called when the debugger stops the
+// execution. The id is the breakpoint or watchpoint hit, 0 for steps. It
+// is called from the emulation goroutine and must not block nor call the
+// debugger.
+func (d *Debugger) SetStopHandler(handler func(id int, reason string)) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.stopHandler = handler
+}
+
+// Step runs one instruction. The emulator must be paused.
+func (d *Debugger) Step() error {
+	return d.resume(debuggerStepInto)
+}
+
+// StepOver runs one instruction, a JSR is run until the subroutine returns.
+// The emulator must be paused.
+func (d *Debugger) StepOver() error {
+	return d.resume(debuggerStepOver)
+}
+
+// StepOut runs until the current subroutine returns. The emulator must be paused.
+func (d *Debugger) StepOut() error {
+	return d.resume(debuggerStepOut)
+}
+
+// Continue resumes the emulation without stopping on a breakpoint on the
+// current PC
+func (d *Debugger) Continue() error {
+	return d.resume(debuggerStepNone)
+}
+
+// Registers returns the state of the CPU registers and the next instruction.
+// The emulator must be paused.
+func (d *Debugger) Registers() string {
+	pc, sp := d.a.cpu.GetPCAndSP()
+	regA, regX, regY, regP := d.a.cpu.GetAXYP()
+	line := ""
+	if pc&0xff00 != 0xc000 { // Avoid the side effects of the softswitches
+		line, _ = d.disasm.DisasmInstruction(pc)
+	}
+
+	return fmt.Sprintf("PC:$%04X A:$%02X X:$%02X Y:$%02X P:$%02X S:$%02X %s",
+		pc, regA, regX, regY, regP, sp, strings.TrimSpace(line))
+}
+
+func (d *Debugger) resume(step int) error {
+	if !d.a.IsPaused() {
+		return errors.New("the emulator must be paused")
+	}
+
+	d.mutex.Lock()
+	pc, sp := d.a.cpu.GetPCAndSP()
+	d.step = step
+	d.stepSP = sp
+	d.skipBreakpoint = true
+	d.lastStop = ""
+	if step == debuggerStepOver {
+		if d.peekCode(pc) == opcodeJSR {
+			d.stepPC = pc + 3
+		} else {
+			d.step = debuggerStepInto
+		}
+	}
+	d.updateActive()
+	d.mutex.Unlock()
+
+	d.a.breakPoint.Store(false)
+	d.a.paused.Store(false)
+	return nil
+}
+
+// updateActive is called with the mutex locked
+func (d *Debugger) updateActive() {
+	d.watching.Store(len(d.watchpoints) != 0)
+	d.active.Store(len(d.breakpoints) != 0 || len(d.watchpoints) != 0 ||
+		d.step != debuggerStepNone || d.skipBreakpoint)
+}
+
+// peekCode is called with the mutex locked
+func (d *Debugger) peekCode(address uint16) uint8 {
+	if address&0xff00 == 0xc000 {
+		return 0 // Avoid the side effects of the softswitches
+	}
+	return d.a.mmu.peekUnwatched(address)
+}
+
+// stop is called with the mutex locked
+func (d *Debugger) stop(id int, reason string) bool {
+	d.step = debuggerStepNone
+	d.skipBreakpoint = false
+	d.watchHit = ""
+	d.lastStop = reason
+	d.updateActive()
+	d.a.breakPoint.Store(true)
+	if d.stopHandler != nil {
+		d.stopHandler(id, reason)
+	}
+	return true
+}
+
+// beforeInstruction returns true if the execution has to stop before running
+// the instruction on the PC. To be called from the emulation goroutine.
+func (d *Debugger) beforeInstruction() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	pc, _ := d.a.cpu.GetPCAndSP()
+	d.opcode = d.peekCode(pc)
+
+	if d.skipBreakpoint {
+		d.skipBreakpoint = false
+		d.updateActive()
+		return false
+	}
+
+	for _, bp := range d.breakpoints {
+		if pc >= bp.Address && pc <= bp.End && d.evalConditions(bp.conditions) {
+			return d.stop(bp.ID, fmt.Sprintf("breakpoint %v at $%04X", bp.ID, pc))
+		}
+	}
+	return false
+}
+
+// afterInstruction returns true if the execution has to stop after the
+// instruction just run. To be called from the emulation goroutine.
+func (d *Debugger) afterInstruction() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.watchHit != "" {
+		return d.stop(d.watchHitID, d.watchHit)
+	}
+
+	pc, sp := d.a.cpu.GetPCAndSP()
+	switch d.step {
+	case debuggerStepInto:
+		return d.stop(0, fmt.Sprintf("step at $%04X", pc))
+	case debuggerStepOver:
+		if pc == d.stepPC && sp >= d.stepSP {
+			return d.stop(0, fmt.Sprintf("step over at $%04X", pc))
+		}
+	case debuggerStepOut:
+		if (d.opcode == opcodeRTS || d.opcode == opcodeRTI) && sp > d.stepSP {
+			return d.stop(0, fmt.Sprintf("step out at $%04X", pc))
+		}
+	}
+	return false
+}
+
+// checkWatchpoints is called by the memory manager on every access while
+// there are watchpoints. To be called from the emulation goroutine.
+func (d *Debugger) checkWatchpoints(address uint16, write bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.watchHit != "" {
+		return
+	}
+	for _, wp := range d.watchpoints {
+		if address >= wp.Start && address <= wp.End &&
+			((write && wp.Write) || (!write && wp.Read)) {
+			access := "read"
+			if write {
+				access = "write"
+			}
+			d.watchHitID = wp.ID
+			d.watchHit = fmt.Sprintf("watchpoint %v, %s at $%04X", wp.ID, access, address)
+			return
+		}
+	}
+}
+
+func (d *Debugger) evalConditions(conditions []breakpointCondition) bool {
+	if len(conditions) == 0 {
+		return true
+	}
+	_, sp := d.a.cpu.GetPCAndSP()
+	regA, regX, regY, regP := d.a.cpu.GetAXYP()
+	for _, c := range conditions {
+		var value uint16
+		switch c.register {
+		case 'A':
+			value = uint16(regA)
+		case 'X':
+			value = uint16(regX)
+		case 'Y':
+			value = uint16(regY)
+		case 'P':
+			value = uint16(regP)
+		case 'S':
+			value = uint16(sp)
+		}
+
+		var result bool
+		switch c.operator {
+		case "==":
+			result = value == c.value
+		case "!=":
+			result = value != c.value
+		case "<":
+			result = value < c.value
+		case "<=":
+			result = value <= c.value
+		case ">":
+			result = value > c.value
+		case ">=":
+			result = value >= c.value
+		}
+		if !result {
+			return false
+		}
+	}
+	return true
+}
+
+// parseBreakpointConditions parses expressions like "A==$20 && X<10"
+func parseBreakpointConditions(condition string) ([]breakpointCondition, error) {
+	condition = strings.TrimSpace(condition)
+	if condition == "" {
+		return nil, nil
+	}
+
+	var conditions []breakpointCondition
+	for part := range strings.SplitSeq(condition, "&&") {
+		part = strings.ReplaceAll(part, " ", "")
+		if len(part) < 3 {
+			return nil, fmt.Errorf("invalid condition '%s'", part)
+		}
+
+		var c breakpointCondition
+		c.register = strings.ToUpper(part)[0]
+		if !strings.ContainsRune("AXYPS", rune(c.register)) {
+			return nil, fmt.Errorf("invalid register in condition '%s', it must be A, X, Y, P or S", part)
+		}
+
+		rest := part[1:]
+		for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+			if strings.HasPrefix(rest, op) {
+				c.operator = op
+				break
+			}
+		}
+		if c.operator == "" {
+			return nil, fmt.Errorf("invalid operator in condition '%s'", part)
+		}
+
+		value, err := ParseDebuggerValue(rest[len(c.operator):])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in condition '%s'", part)
+		}
+		c.value = value
+		conditions = append(conditions, c)
+	}
+	return conditions, nil
+}
+
+// ParseDebuggerValue parses decimal numbers and hexadecimal numbers prefixed
+// with '$' or '0x'
+func ParseDebuggerValue(s string) (uint16, error) {
+	s = strings.TrimSpace(s)
+	var value uint64
+	var err error
+	if after, ok := strings.CutPrefix(s, "$"); ok {
+		value, err = strconv.ParseUint(after, 16, 16)
+	} else if after, ok := strings.CutPrefix(strings.ToLower(s), "0x"); ok {
+		value, err = strconv.ParseUint(after, 16, 16)
+	} else {
+		value, err = strconv.ParseUint(s, 10, 16)
+	}
+	return uint16(value), err
+}
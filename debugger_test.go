@@ -0,0 +1,155 @@
+package izapple2
+
+import (
+	"testing"
+)
+
+func makeDebuggerTester(t *testing.T) *Apple2 {
+	at, err := makeApple2Tester("2plus", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at.terminateCondition = func(a *Apple2) bool { return false }
+	a := at.a
+
+	a.mmu.pokeRange(0x0300, []uint8{
+		0xa9, 0x20, //       LDA #$20
+		0x20, 0x10, 0x03, // JSR $0310
+		0x8d, 0x00, 0x20, // STA $2000
+		0xea, //             NOP
+	})
+	a.mmu.pokeRange(0x0310, []uint8{
+		0xa2, 0x05, // LDX #$05
+		0xe8, //       INX
+		0x60, //       RTS
+	})
+	a.cpu.SetPC(0x0300)
+	a.paused.Store(true)
+	return a
+}
+
+func runUntilDebuggerStop(t *testing.T, a *Apple2) {
+	for range 100 {
+		if !a.executeInstruction() {
+			a.paused.Store(true)
+			return
+		}
+	}
+	t.Fatal("The debugger should have stopped the execution")
+}
+
+func assertPC(t *testing.T, a *Apple2, expected uint16) {
+	t.Helper()
+	pc, _ := a.cpu.GetPCAndSP()
+	if pc != expected {
+		t.Errorf("PC should be $%04x, got $%04x", expected, pc)
+	}
+}
+
+func TestDebuggerBreakpoint(t *testing.T) {
+	a := makeDebuggerTester(t)
+	d := a.Debugger()
+	_, err := d.AddBreakpoint(0x0312, "X==6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.AddBreakpoint(0x0305, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.Continue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runUntilDebuggerStop(t, a)
+	assertPC(t, a, 0x0305)
+	if d.LastStop() == "" {
+		t.Error("The stop reason should be available")
+	}
+}
+
+func TestDebuggerConditionalBreakpoint(t *testing.T) {
+	a := makeDebuggerTester(t)
+	d := a.Debugger()
+	_, err := d.AddBreakpoint(0x0312, "A==$20 && X==5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Continue()
+	runUntilDebuggerStop(t, a)
+	assertPC(t, a, 0x0312)
+}
+
+func TestDebuggerWatchpoint(t *testing.T) {
+	a := makeDebuggerTester(t)
+	d := a.Debugger()
+	_, err := d.AddWatchpoint(0x2000, 0x20ff, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Continue()
+	runUntilDebuggerStop(t, a)
+	assertPC(t, a, 0x0308) // After the STA
+	if a.mmu.Peek(0x2000) != 0x20 {
+		t.Error("The instruction should complete before stopping")
+	}
+}
+
+func TestDebuggerReadsDoNotTriggerWatchpoints(t *testing.T) {
+	a := makeDebuggerTester(t)
+	d := a.Debugger()
+	_, err := d.AddWatchpoint(0x0300, 0x0302, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Registers()
+	if d.watchHit != "" {
+		t.Errorf("The disassembly of the debugger should not trigger the watchpoints")
+	}
+	a.mmu.Peek(0x0301)
+	if d.watchHit == "" {
+		t.Errorf("The reads of the emulation should trigger the watchpoints")
+	}
+}
+
+func TestDebuggerStepping(t *testing.T) {
+	a := makeDebuggerTester(t)
+	d := a.Debugger()
+
+	d.Step()
+	runUntilDebuggerStop(t, a)
+	assertPC(t, a, 0x0302)
+
+	d.StepOver()
+	runUntilDebuggerStop(t, a)
+	assertPC(t, a, 0x0305)
+
+	a.cpu.SetPC(0x0302)
+	d.Step()
+	runUntilDebuggerStop(t, a)
+	assertPC(t, a, 0x0310)
+
+	d.StepOut()
+	runUntilDebuggerStop(t, a)
+	assertPC(t, a, 0x0305)
+}
+
+func TestDebuggerConditionParsing(t *testing.T) {
+	valid := []string{"", "A==1", "x != $ff", "S>=0x80 && P<3"}
+	for _, condition := range valid {
+		if _, err := parseBreakpointConditions(condition); err != nil {
+			t.Errorf("'%s' should be valid: %v", condition, err)
+		}
+	}
+
+	invalid := []string{"Q==1", "A=1", "A==", "X<$10000"}
+	for _, condition := range invalid {
+		if _, err := parseBreakpointConditions(condition); err == nil {
+			t.Errorf("'%s' should be invalid", condition)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package dos33
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Applesoft BASIC programs are stored tokenized. Each line has:
+	Address of the next line (2 bytes), zero at the end of the program
+	Line number (2 bytes)
+	Tokens and characters, ended by a zero
+
+See:
+	Applesoft BASIC Programmer's Reference Manual, appendix F.
+*/
+
+var applesoftTokens = [...]string{
+	"END", "FOR", "NEXT", "DATA", "INPUT", "DEL", "DIM", "READ",
+	"GR", "TEXT", "PR#", "IN#", "CALL", "PLOT", "HLIN", "VLIN",
+	"HGR2", "HGR", "HCOLOR=", "HPLOT", "DRAW", "XDRAW", "HTAB", "HOME",
+	"ROT=", "SCALE=", "SHLOAD", "TRACE", "NOTRACE", "NORMAL", "INVERSE", "FLASH",
+	"COLOR=", "POP", "VTAB", "HIMEM:", "LOMEM:", "ONERR", "RESUME", "RECALL",
+	"STORE", "SPEED=", "LET", "GOTO", "RUN", "IF", "RESTORE", "&",
+	"GOSUB", "RETURN", "REM", "STOP", "ON", "WAIT", "LOAD", "SAVE",
+	"DEF", "POKE", "PRINT", "CONT", "LIST", "CLEAR", "GET", "NEW",
+	"TAB(", "TO", "FN", "SPC(", "THEN", "AT", "NOT", "STEP",
+	"+", "-", "*", "/", "^", "AND", "OR", ">",
+	"=", "<", "SGN", "INT", "ABS", "USR", "FRE", "SCRN(",
+	"PDL", "POS", "SQR", "RND", "LOG", "EXP", "COS", "SIN",
+	"TAN", "ATN", "PEEK", "LEN", "STR$", "VAL", "ASC", "CHR$",
+	"LEFT$", "RIGHT$", "MID$",
+}
+
+// DetokenizeApplesoft returns the listing of an Applesoft BASIC program
+func DetokenizeApplesoft(program []uint8) string {
+	var s strings.Builder
+	for pos := 0; pos+4 <= len(program); {
+		next := int(program[pos]) | int(program[pos+1])<<8
+		if next == 0 {
+			break
+		}
+		line := int(program[pos+2]) | int(program[pos+3])<<8
+		fmt.Fprintf(&s, "%v ", line)
+		pos += 4
+
+		for pos < len(program) && program[pos] != 0 {
+			c := program[pos]
+			if c >= 0x80 {
+				index := int(c - 0x80)
+				if index < len(applesoftTokens) {
+					fmt.Fprintf(&s, " %v ", applesoftTokens[index])
+				} else {
+					fmt.Fprintf(&s, "<$%02X>", c)
+				}
+			} else {
+				s.WriteByte(c)
+			}
+			pos++
+		}
+		s.WriteString("\n")
+		pos++ // The end of line zero
+	}
+	return s.String()
+}
@@ -0,0 +1,183 @@
+package dos33
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func loadTestVolume(t *testing.T) *Volume {
+	data, err := os.ReadFile("../resources/dos33.dsk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := Open(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestCatalog(t *testing.T) {
+	v := loadTestVolume(t)
+	entries, err := v.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Log(e.String())
+	}
+
+	f, err := v.ReadFile("HELLO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Entry.Type != FileTypeApplesoft {
+		t.Errorf("HELLO should be an Applesoft program, it is %v", f.Entry.Type)
+	}
+	listing := DetokenizeApplesoft(f.Data)
+	if !strings.Contains(listing, "PRINT") {
+		t.Errorf("unexpected listing:\n%v", listing)
+	}
+}
+
+func TestWriteAndDelete(t *testing.T) {
+	v := loadTestVolume(t)
+	free := v.FreeSectors()
+
+	data := make([]uint8, 40000) // Needs two track/sector lists
+	for i := range data {
+		data[i] = uint8(i * 7)
+	}
+	err := v.WriteFile("TEST.BIN", FileTypeBinary, data, 0x4000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.WriteFile("TEST.TXT", FileTypeText, TextFromHost("hello\nworld\n"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen to check the changes are on the image
+	v, err = Open(v.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := v.ReadFile("test.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Address != 0x4000 || !bytes.Equal(f.Data, data) {
+		t.Errorf("the binary file differs, address $%04x, %v bytes", f.Address, len(f.Data))
+	}
+	if f.Entry.Sectors != 2+(4+len(data)+255)/256 {
+		t.Errorf("unexpected sector count %v", f.Entry.Sectors)
+	}
+	f, err = v.ReadFile("TEST.TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if TextToHost(f.Data) != "hello\nworld\n" {
+		t.Errorf("unexpected text %q", TextToHost(f.Data))
+	}
+
+	err = v.Delete("TEST.BIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.Delete("TEST.TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.FreeSectors() != free {
+		t.Errorf("expected %v free sectors, got %v", free, v.FreeSectors())
+	}
+	_, err = v.Stat("TEST.BIN")
+	if err == nil {
+		t.Error("the file should be deleted")
+	}
+}
+
+func TestDos32(t *testing.T) {
+	data := make([]uint8, tracks*13*sectorSize)
+	v := Volume{data: data, sectorsPerTrack: 13}
+	vtoc := v.vtoc()
+	vtoc[0x01], vtoc[0x02] = vtocTrack, 12
+	vtoc[0x34], vtoc[0x35], vtoc[0x37] = tracks, 13, 1
+	for track := 1; track < tracks; track++ {
+		if track != vtocTrack {
+			vtoc[0x38+track*4] = 0xff
+			vtoc[0x39+track*4] = 0xf8
+		}
+	}
+
+	opened, err := Open(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.FreeSectors() != 33*13 {
+		t.Errorf("expected %v free sectors, got %v", 33*13, opened.FreeSectors())
+	}
+	err = opened.WriteFile("PROGRAM", FileTypeBinary, []uint8{1, 2, 3}, 0x300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := opened.ReadFile("PROGRAM")
+	if err != nil || !bytes.Equal(f.Data, []uint8{1, 2, 3}) {
+		t.Errorf("unexpected content %v %v", f, err)
+	}
+}
+
+func TestReplaceOnFullDisk(t *testing.T) {
+	v := loadTestVolume(t)
+	err := v.WriteRawFile("KEEP", FileTypeBinary, make([]uint8, 4*256)) // 4 data sectors and a list
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the disk leaving 2 free sectors
+	free := v.FreeSectors()
+	n := free
+	for n+(n+tsListPairs-1)/tsListPairs > free-2 {
+		n--
+	}
+	err = v.WriteRawFile("FILLER", FileTypeBinary, make([]uint8, n*256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.FreeSectors() != 2 {
+		t.Fatalf("expected 2 free sectors, got %v", v.FreeSectors())
+	}
+
+	// 7 data sectors and a list don't fit on the 2+5 sectors available
+	err = v.WriteRawFile("KEEP", FileTypeBinary, make([]uint8, 7*256))
+	if err == nil {
+		t.Fatal("the write should fail with the disk full")
+	}
+	data, _, err := v.ReadRawFile("KEEP")
+	if err != nil {
+		t.Fatalf("the replaced file should be kept: %v", err)
+	}
+	if len(data) != 4*256 {
+		t.Errorf("the replaced file changed, %v bytes", len(data))
+	}
+
+	// 6 data sectors and a list fit using the sectors of the old file
+	err = v.WriteRawFile("KEEP", FileTypeBinary, make([]uint8, 6*256))
+	if err != nil {
+		t.Errorf("the write should use the sectors of the old file: %v", err)
+	}
+}
+
+func TestWriteTextKeepsCallerData(t *testing.T) {
+	v := loadTestVolume(t)
+	backing := []uint8{'A' | 0x80, 'B' | 0x80, 'C' | 0x80, 0x55}
+	err := v.WriteFile("TEXT", FileTypeText, backing[:3], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backing[3] != 0x55 {
+		t.Error("the write should not change the caller data")
+	}
+}
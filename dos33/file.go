@@ -0,0 +1,154 @@
+package dos33
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FileType is the type of a DOS file
+type FileType uint8
+
+// DOS file types
+const (
+	FileTypeText        = FileType(0x00)
+	FileTypeInteger     = FileType(0x01)
+	FileTypeApplesoft   = FileType(0x02)
+	FileTypeBinary      = FileType(0x04)
+	FileTypeS           = FileType(0x08)
+	FileTypeRelocatable = FileType(0x10)
+	FileTypeA           = FileType(0x20)
+	FileTypeB           = FileType(0x40)
+)
+
+func (t FileType) String() string {
+	switch t {
+	case FileTypeText:
+		return "T"
+	case FileTypeInteger:
+		return "I"
+	case FileTypeApplesoft:
+		return "A"
+	case FileTypeBinary:
+		return "B"
+	case FileTypeS:
+		return "S"
+	case FileTypeRelocatable:
+		return "R"
+	case FileTypeA:
+		return "a"
+	case FileTypeB:
+		return "b"
+	}
+	return fmt.Sprintf("$%02x", uint8(t))
+}
+
+// ParseFileType accepts the letter of a DOS file type
+func ParseFileType(s string) (FileType, error) {
+	for _, t := range []FileType{FileTypeText, FileTypeInteger, FileTypeApplesoft, FileTypeBinary,
+		FileTypeS, FileTypeRelocatable, FileTypeA, FileTypeB} {
+		if t.String() == s {
+			return t, nil
+		}
+	}
+	switch strings.ToUpper(s) {
+	case "T", "TXT":
+		return FileTypeText, nil
+	case "I", "INT":
+		return FileTypeInteger, nil
+	case "A", "BAS":
+		return FileTypeApplesoft, nil
+	case "B", "BIN":
+		return FileTypeBinary, nil
+	}
+	return 0, fmt.Errorf("invalid DOS file type '%v'", s)
+}
+
+/*
+The files have a header depending on the type:
+	Applesoft and Integer BASIC: length (2 bytes)
+	Binary: address (2 bytes), length (2 bytes)
+	Text: no header, the file ends with a zero
+*/
+
+// File is the content of a file without the header
+type File struct {
+	Entry   *FileEntry
+	Address uint16 // Load address for binary files
+	Data    []uint8
+}
+
+// ReadFile returns the contents of a file, removing the header of the type
+func (v *Volume) ReadFile(name string) (*File, error) {
+	raw, e, err := v.ReadRawFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f := File{Entry: e}
+	switch e.Type {
+	case FileTypeApplesoft, FileTypeInteger:
+		if len(raw) < 2 {
+			return nil, errors.New("the file has no header")
+		}
+		length := int(raw[0]) | int(raw[1])<<8
+		f.Data = raw[2:min(2+length, len(raw))]
+	case FileTypeBinary:
+		if len(raw) < 4 {
+			return nil, errors.New("the file has no header")
+		}
+		f.Address = uint16(raw[0]) | uint16(raw[1])<<8
+		length := int(raw[2]) | int(raw[3])<<8
+		f.Data = raw[4:min(4+length, len(raw))]
+	case FileTypeText:
+		end := len(raw)
+		for i, c := range raw {
+			if c == 0 {
+				end = i
+				break
+			}
+		}
+		f.Data = raw[:end]
+	default:
+		f.Data = raw
+	}
+	return &f, nil
+}
+
+// WriteFile creates a file adding the header of the type. The address is
+// used only for binary files.
+func (v *Volume) WriteFile(name string, fileType FileType, data []uint8, address uint16) error {
+	length := []uint8{uint8(len(data)), uint8(len(data) >> 8)}
+	var raw []uint8
+	switch fileType {
+	case FileTypeApplesoft, FileTypeInteger:
+		if len(data) > 0xffff {
+			return errors.New("the file is too big")
+		}
+		raw = append(length, data...)
+	case FileTypeBinary:
+		if len(data) > 0xffff {
+			return errors.New("the file is too big")
+		}
+		raw = append([]uint8{uint8(address), uint8(address >> 8)}, length...)
+		raw = append(raw, data...)
+	case FileTypeText:
+		raw = append(append([]uint8{}, data...), 0) // Don't write on the caller backing array
+	default:
+		raw = data
+	}
+	return v.WriteRawFile(name, fileType, raw)
+}
+
+// TextToHost converts a text file to host text, removing the high bit and
+// changing the carriage returns to new lines
+func TextToHost(data []uint8) string {
+	return strings.ReplaceAll(fromAppleText(data), "\r", "\n")
+}
+
+// TextFromHost converts host text to a text file, changing the new lines
+// to carriage returns and setting the high bit
+func TextFromHost(s string) []uint8 {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return toAppleText(strings.ReplaceAll(s, "\n", "\r"))
+}
@@ -0,0 +1,449 @@
+package dos33
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+DOS 3.3 and DOS 3.2 filesystems on 140K and 113K disk images, to access the
+images from the host.
+
+See:
+	Beneath Apple DOS, chapter 4. https://fabiensanglard.net/fd_proxy/prince_of_persia/Beneath%20Apple%20DOS.pdf
+
+The images are in memory with the sectors in DOS order, 16 sectors per
+track for DOS 3.3 (.dsk, .do) and 13 for DOS 3.2 (.d13). The changes are
+done on the data slice, the caller is responsible of saving it.
+
+The VTOC is on track 17 sector 0. It points to the first sector of the
+catalog and has the bitmap of the free sectors. Each file has a chain of
+track/sector lists with the sectors of the file data.
+*/
+
+const (
+	sectorSize        = 256
+	tracks            = 35
+	vtocTrack         = 17
+	vtocSector        = 0
+	catalogEntries    = 7
+	catalogEntryStart = 0x0b
+	catalogEntrySize  = 0x23
+	tsListStart       = 0x0c
+	tsListPairs       = 122
+	maxNameLength     = 30
+	entryDeleted      = 0xff
+	entryUnused       = 0x00
+	maxChainLength    = tracks * 16 // To detect loops
+)
+
+// Volume is a DOS 3.3 or DOS 3.2 filesystem on an image in memory
+type Volume struct {
+	data            []uint8
+	sectorsPerTrack int
+}
+
+// FileEntry is a file on the catalog
+type FileEntry struct {
+	Name    string
+	Type    FileType
+	Locked  bool
+	Sectors int
+
+	tsTrack  uint8
+	tsSector uint8
+
+	// Location on the catalog
+	catalogTrack  uint8
+	catalogSector uint8
+	index         int
+}
+
+func (e *FileEntry) String() string {
+	lock := " "
+	if e.Locked {
+		lock = "*"
+	}
+	return fmt.Sprintf("%v%v %03d %v", lock, e.Type, e.Sectors%1000, e.Name)
+}
+
+// IsDos33 returns true if the image has a valid VTOC
+func IsDos33(data []uint8) bool {
+	_, err := Open(data)
+	return err == nil
+}
+
+// Open reads the DOS filesystem of an image with the sectors in DOS order
+func Open(data []uint8) (*Volume, error) {
+	var v Volume
+	v.data = data
+	switch len(data) {
+	case tracks * 16 * sectorSize:
+		v.sectorsPerTrack = 16
+	case tracks * 13 * sectorSize:
+		v.sectorsPerTrack = 13
+	default:
+		return nil, errors.New("only 140K and 113K images are supported")
+	}
+
+	vtoc := v.vtoc()
+	if int(vtoc[0x34]) != tracks || int(vtoc[0x35]) != v.sectorsPerTrack ||
+		vtoc[0x36] != 0 || vtoc[0x37] != 1 || !v.validSector(vtoc[0x01], vtoc[0x02]) {
+		return nil, errors.New("not a DOS 3.3 or 3.2 disk")
+	}
+	return &v, nil
+}
+
+// Bytes returns the image with the changes
+func (v *Volume) Bytes() []uint8 {
+	return v.data
+}
+
+// VolumeNumber returns the volume number of the disk
+func (v *Volume) VolumeNumber() int {
+	return int(v.vtoc()[0x06])
+}
+
+// SectorsPerTrack returns 16 for DOS 3.3 and 13 for DOS 3.2 disks
+func (v *Volume) SectorsPerTrack() int {
+	return v.sectorsPerTrack
+}
+
+func (v *Volume) sector(track uint8, sector uint8) []uint8 {
+	offset := (int(track)*v.sectorsPerTrack + int(sector)) * sectorSize
+	return v.data[offset : offset+sectorSize]
+}
+
+func (v *Volume) validSector(track uint8, sector uint8) bool {
+	return int(track) < tracks && int(sector) < v.sectorsPerTrack
+}
+
+func (v *Volume) vtoc() []uint8 {
+	return v.sector(vtocTrack, vtocSector)
+}
+
+/*
+The bitmap has 4 bytes per track, starting at $38 of the VTOC. The highest
+sector is on the bit 7 of the first byte, for DOS 3.3 the sector 0 is on
+the bit 0 of the second byte. A bit set is a free sector.
+*/
+
+func (v *Volume) bitmapPosition(track uint8, sector uint8) (int, uint8) {
+	bit := v.sectorsPerTrack - 1 - int(sector)
+	return 0x38 + int(track)*4 + bit/8, 0x80 >> (bit % 8)
+}
+
+func (v *Volume) isFree(track uint8, sector uint8) bool {
+	pos, mask := v.bitmapPosition(track, sector)
+	return v.vtoc()[pos]&mask != 0
+}
+
+func (v *Volume) setFree(track uint8, sector uint8, free bool) {
+	pos, mask := v.bitmapPosition(track, sector)
+	if free {
+		v.vtoc()[pos] |= mask
+	} else {
+		v.vtoc()[pos] &^= mask
+	}
+}
+
+// FreeSectors returns the number of sectors available
+func (v *Volume) FreeSectors() int {
+	free := 0
+	for track := range uint8(tracks) {
+		for sector := range uint8(v.sectorsPerTrack) {
+			if v.isFree(track, sector) {
+				free++
+			}
+		}
+	}
+	return free
+}
+
+// allocate returns a free sector, looking first on the tracks after the catalog
+func (v *Volume) allocate() (uint8, uint8, error) {
+	var order []uint8
+	for track := vtocTrack + 1; track < tracks; track++ {
+		order = append(order, uint8(track))
+	}
+	for track := vtocTrack - 1; track > 0; track-- {
+		order = append(order, uint8(track))
+	}
+
+	for _, track := range order {
+		for sector := v.sectorsPerTrack - 1; sector >= 0; sector-- {
+			if v.isFree(track, uint8(sector)) {
+				v.setFree(track, uint8(sector), false)
+				vtoc := v.vtoc()
+				vtoc[0x30] = track // Last track allocated
+				vtoc[0x31] = 1     // Direction
+				if track < vtocTrack {
+					vtoc[0x31] = 0xff
+				}
+				return track, uint8(sector), nil
+			}
+		}
+	}
+	return 0, 0, errors.New("disk full")
+}
+
+// forEachCatalogEntry calls f for every slot of the catalog, used or not
+func (v *Volume) forEachCatalogEntry(f func(track uint8, sector uint8, index int, entry []uint8) bool) error {
+	vtoc := v.vtoc()
+	track, sector := vtoc[0x01], vtoc[0x02]
+	for range maxChainLength {
+		if track == 0 {
+			return nil
+		}
+		if !v.validSector(track, sector) {
+			return errors.New("invalid catalog sector")
+		}
+		data := v.sector(track, sector)
+		for i := range catalogEntries {
+			offset := catalogEntryStart + i*catalogEntrySize
+			if f(track, sector, i, data[offset:offset+catalogEntrySize]) {
+				return nil
+			}
+		}
+		track, sector = data[0x01], data[0x02]
+	}
+	return errors.New("loop on the catalog")
+}
+
+func parseEntry(data []uint8) FileEntry {
+	var e FileEntry
+	e.tsTrack = data[0x00]
+	e.tsSector = data[0x01]
+	e.Type = FileType(data[0x02] & 0x7f)
+	e.Locked = data[0x02]&0x80 != 0
+	e.Name = fromAppleText(data[0x03 : 0x03+maxNameLength])
+	e.Name = strings.TrimRight(e.Name, " ")
+	e.Sectors = int(data[0x21]) | int(data[0x22])<<8
+	return e
+}
+
+// Catalog returns the files on the disk
+func (v *Volume) Catalog() ([]FileEntry, error) {
+	var entries []FileEntry
+	err := v.forEachCatalogEntry(func(track uint8, sector uint8, index int, data []uint8) bool {
+		if data[0] == entryUnused {
+			return true // The end of the catalog
+		}
+		if data[0] != entryDeleted {
+			e := parseEntry(data)
+			e.catalogTrack = track
+			e.catalogSector = sector
+			e.index = index
+			entries = append(entries, e)
+		}
+		return false
+	})
+	return entries, err
+}
+
+// Stat returns the catalog entry of a file
+func (v *Volume) Stat(name string) (*FileEntry, error) {
+	entries, err := v.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	name = strings.ToUpper(name)
+	for _, e := range entries {
+		if e.Name == name {
+			return &e, nil
+		}
+	}
+	return nil, fmt.Errorf("%v not found", name)
+}
+
+// dataSectors returns the data sectors of a file, with track 0 for the
+// sparse sectors, and the sectors of the track/sector lists
+func (v *Volume) dataSectors(e *FileEntry) ([][2]uint8, [][2]uint8, error) {
+	var data, lists [][2]uint8
+	track, sector := e.tsTrack, e.tsSector
+	for range maxChainLength {
+		if track == 0 {
+			// Remove the trailing sparse sectors
+			for len(data) > 0 && data[len(data)-1][0] == 0 {
+				data = data[:len(data)-1]
+			}
+			return data, lists, nil
+		}
+		if !v.validSector(track, sector) {
+			return nil, nil, errors.New("invalid track/sector list")
+		}
+		lists = append(lists, [2]uint8{track, sector})
+		list := v.sector(track, sector)
+		for i := range tsListPairs {
+			t, s := list[tsListStart+i*2], list[tsListStart+i*2+1]
+			if t != 0 && !v.validSector(t, s) {
+				return nil, nil, errors.New("invalid sector on the track/sector list")
+			}
+			data = append(data, [2]uint8{t, s})
+		}
+		track, sector = list[0x01], list[0x02]
+	}
+	return nil, nil, errors.New("loop on the track/sector list")
+}
+
+// ReadRawFile returns all the sectors of a file, without decoding the headers
+func (v *Volume) ReadRawFile(name string) ([]uint8, *FileEntry, error) {
+	e, err := v.Stat(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	sectors, _, err := v.dataSectors(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	data := make([]uint8, 0, len(sectors)*sectorSize)
+	for _, ts := range sectors {
+		if ts[0] == 0 {
+			data = append(data, make([]uint8, sectorSize)...)
+		} else {
+			data = append(data, v.sector(ts[0], ts[1])...)
+		}
+	}
+	return data, e, nil
+}
+
+// Delete removes a file from the catalog and frees its sectors
+func (v *Volume) Delete(name string) error {
+	e, err := v.Stat(name)
+	if err != nil {
+		return err
+	}
+	if e.Locked {
+		return fmt.Errorf("%v is locked", e.Name)
+	}
+	data, lists, err := v.dataSectors(e)
+	if err != nil {
+		return err
+	}
+	for _, ts := range append(data, lists...) {
+		if ts[0] != 0 {
+			v.setFree(ts[0], ts[1], true)
+		}
+	}
+
+	// The track of the list is kept on the last character of the name
+	entry := v.sector(e.catalogTrack, e.catalogSector)[catalogEntryStart+e.index*catalogEntrySize:]
+	entry[0x20] = entry[0x00]
+	entry[0x00] = entryDeleted
+	return nil
+}
+
+// WriteRawFile creates a file with the data as is, replacing the file if it exists
+func (v *Volume) WriteRawFile(name string, fileType FileType, data []uint8) error {
+	name = strings.ToUpper(name)
+	if len(name) == 0 || len(name) > maxNameLength || name[0] < 'A' || name[0] > 'Z' || strings.Contains(name, ",") {
+		return fmt.Errorf("invalid name '%v', it must start with a letter, have up to 30 characters and no commas", name)
+	}
+
+	// The space is checked before deleting the file replaced, counting the
+	// sectors it will free
+	dataCount := max(1, (len(data)+sectorSize-1)/sectorSize)
+	listCount := (dataCount + tsListPairs - 1) / tsListPairs
+	available := v.FreeSectors()
+	existing, err := v.Stat(name)
+	if err == nil {
+		if existing.Locked {
+			return fmt.Errorf("%v is locked", existing.Name)
+		}
+		dataSectors, listSectors, err := v.dataSectors(existing)
+		if err != nil {
+			return err
+		}
+		for _, ts := range append(dataSectors, listSectors...) {
+			if ts[0] != 0 {
+				available++
+			}
+		}
+	}
+	if available < dataCount+listCount {
+		return fmt.Errorf("disk full, %v sectors needed and %v available", dataCount+listCount, available)
+	}
+	if existing != nil {
+		err = v.Delete(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Find a slot on the catalog
+	var entry []uint8
+	err = v.forEachCatalogEntry(func(_ uint8, _ uint8, _ int, data []uint8) bool {
+		if data[0] == entryUnused || data[0] == entryDeleted {
+			entry = data
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return errors.New("the catalog is full")
+	}
+
+	// Track/sector lists and data
+	var previous []uint8
+	var firstTrack, firstSector uint8
+	for l := range listCount {
+		lt, ls, err := v.allocate()
+		if err != nil {
+			return err
+		}
+		list := v.sector(lt, ls)
+		clear(list)
+		offset := l * tsListPairs // First sector of the file on this list
+		list[0x05] = uint8(offset)
+		list[0x06] = uint8(offset >> 8)
+		if previous == nil {
+			firstTrack, firstSector = lt, ls
+		} else {
+			previous[0x01], previous[0x02] = lt, ls
+		}
+		previous = list
+
+		for i := 0; i < tsListPairs && l*tsListPairs+i < dataCount; i++ {
+			dt, ds, err := v.allocate()
+			if err != nil {
+				return err
+			}
+			sector := v.sector(dt, ds)
+			clear(sector)
+			start := min((l*tsListPairs+i)*sectorSize, len(data))
+			copy(sector, data[start:])
+			list[tsListStart+i*2] = dt
+			list[tsListStart+i*2+1] = ds
+		}
+	}
+
+	clear(entry)
+	entry[0x00] = firstTrack
+	entry[0x01] = firstSector
+	entry[0x02] = uint8(fileType)
+	copy(entry[0x03:0x03+maxNameLength], toAppleText(fmt.Sprintf("%-30s", name)))
+	sectors := dataCount + listCount
+	entry[0x21] = uint8(sectors)
+	entry[0x22] = uint8(sectors >> 8)
+	return nil
+}
+
+func fromAppleText(data []uint8) string {
+	var s strings.Builder
+	for _, c := range data {
+		s.WriteByte(c & 0x7f)
+	}
+	return s.String()
+}
+
+func toAppleText(s string) []uint8 {
+	data := []uint8(s)
+	for i := range data {
+		data[i] |= 0x80
+	}
+	return data
+}
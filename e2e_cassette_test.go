@@ -3,6 +3,7 @@ package izapple2
 import (
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -30,6 +31,16 @@ func (k *testKeyboard) putLine(text string) {
 // TestCassetteMonitorLoad reads a synthesized tape into memory using
 // the Monitor ROM tape read routine
 func TestCassetteMonitorLoad(t *testing.T) {
+	testCassetteMonitorLoad(t, false, 100_000_000)
+}
+
+// TestCassetteMonitorLoadTurbo reads the tape skipping the playback,
+// much faster than the 4 seconds of the header tone
+func TestCassetteMonitorLoadTurbo(t *testing.T) {
+	testCassetteMonitorLoad(t, true, 5_000_000)
+}
+
+func testCassetteMonitorLoad(t *testing.T, turbo bool, maxCycles uint64) {
 	data := make([]uint8, 16)
 	for i := range data {
 		data[i] = uint8(i*13 + 7)
@@ -46,6 +57,7 @@ func TestCassetteMonitorLoad(t *testing.T) {
 	overrides := newConfiguration()
 	overrides.set(confS6, "empty")
 	overrides.set(confTape, path)
+	overrides.set(confTapeTurbo, strconv.FormatBool(turbo))
 
 	at, err := makeApple2Tester("2plus", overrides)
 	if err != nil {
@@ -68,7 +80,7 @@ func TestCassetteMonitorLoad(t *testing.T) {
 	lastCheck := uint64(0)
 	at.terminateCondition = func(a *Apple2) bool {
 		cycles := a.GetCycles()
-		if cycles > 100_000_000 {
+		if cycles > maxCycles {
 			return true
 		}
 		if cycles-lastCheck < textCheckInterval {
@@ -27,9 +27,11 @@ func newEbitenAudio(clockMhz float64) *ebitenAudio {
 
 // Read is io.Reader's Read, it fills the buffer with audio samples
 func (s *ebitenAudio) Read(buf []byte) (n int, err error) {
-	const bytesPerSample = 8 // Two float32, one for each channel
-	samples := len(buf) / bytesPerSample
+	const bytesPerFrame = 8 // Two float32, one for each channel
+	frames := len(buf) / bytesPerFrame
 
+	// The mixer interleaves the left and right samples as expected
+	samples := frames * 2
 	if cap(s.samples) < samples {
 		s.samples = make([]float32, samples)
 	}
@@ -39,19 +41,15 @@ func (s *ebitenAudio) Read(buf []byte) (n int, err error) {
 	for i, v := range s.samples {
 		putFloat32InBuffer(buf, i, v)
 	}
-	return samples * bytesPerSample, nil
+	return frames * bytesPerFrame, nil
 }
 
 func putFloat32InBuffer(buf []byte, i int, f float32) {
 	v := math.Float32bits(f)
-	buf[i*8] = byte(v)
-	buf[i*8+1] = byte(v >> 8)
-	buf[i*8+2] = byte(v >> 16)
-	buf[i*8+3] = byte(v >> 24)
-	buf[i*8+4] = byte(v)
-	buf[i*8+5] = byte(v >> 8)
-	buf[i*8+6] = byte(v >> 16)
-	buf[i*8+7] = byte(v >> 24)
+	buf[i*4] = byte(v)
+	buf[i*4+1] = byte(v >> 8)
+	buf[i*4+2] = byte(v >> 16)
+	buf[i*4+3] = byte(v >> 24)
 }
 
 func (s *ebitenAudio) update() error {
@@ -133,6 +133,14 @@ func (k *ebitenKeyboard) putKey(key ebiten.Key) {
 		k.screenMode = screen.NextScreenMode(k.screenMode)
 	case ebiten.KeyF7:
 		k.showPages = !k.showPages
+	case ebiten.KeyF8:
+		if ctrl {
+			k.a.SendCommand(izapple2.CommandSaveState)
+		} else if shift {
+			k.a.SendCommand(izapple2.CommandRewind)
+		} else {
+			k.a.SendCommand(izapple2.CommandLoadState)
+		}
 	case ebiten.KeyF9:
 		k.a.SendCommand(izapple2.CommandDumpDebugInfo)
 	case ebiten.KeyF10:
@@ -135,7 +135,9 @@ func ebitenRun(a *izapple2.Apple2) {
 		speaker:  newEbitenAudio(a.GetClockMhz()),
 	}
 	for _, source := range a.GetAudioSources() {
-		source.SetAudioSink(game.speaker.mixer.NewSource())
+		sink := game.speaker.mixer.NewSource()
+		sink.SetPan(source.GetAudioSourcePan())
+		source.SetAudioSink(sink)
 	}
 
 	var err error
@@ -159,6 +161,9 @@ var helpMessage = `
      Ctrl-F5: Show speed
           F6: Next screen mode
           F7: Show/Hide pages
+          F8: Load state
+     Ctrl-F8: Save state
+    Shift-F8: Rewind, pauses and goes back in time
          F10: Next character set
     Ctrl-F10: Show/Hide character set
    Shift-F10: Show/Hide alternate text
@@ -51,7 +51,9 @@ func sdlRun(a *izapple2.Apple2) {
 
 	s := newSDLAudio(a.GetClockMhz())
 	for _, source := range a.GetAudioSources() {
-		source.SetAudioSink(s.mixer.NewSource())
+		sink := s.mixer.NewSource()
+		sink.SetPan(source.GetAudioSourcePan())
+		source.SetAudioSink(sink)
 	}
 	s.start()
 
@@ -162,6 +164,9 @@ var helpMessage = `
      Ctrl-F5: Show speed
           F6: Next screen mode
           F7: Show/Hide pages
+          F8: Load state
+     Ctrl-F8: Save state
+    Shift-F8: Rewind, pauses and goes back in time
          F10: Next character set
     Ctrl-F10: Show/Hide character set
    Shift-F10: Show/Hide alternate text
@@ -40,7 +40,8 @@ func newSDLAudio(clockMhz float64) *sdlAudio {
 //
 //export SpeakerCallback
 func SpeakerCallback(userdata unsafe.Pointer, stream *C.Uint8, length C.int) {
-	// Adapt the C buffer to a slice of float32 samples
+	// Adapt the C buffer to a slice of float32 samples, left and right
+	// interleaved
 	buf := unsafe.Slice((*float32)(unsafe.Pointer(stream)), int(length)/4)
 
 	s := theSDLAudio.Load()
@@ -65,7 +66,7 @@ func (s *sdlAudio) start() {
 	spec := &sdl.AudioSpec{
 		Freq:     audio.SampleRate,
 		Format:   sdl.AUDIO_F32SYS,
-		Channels: 1,
+		Channels: 2,
 		Samples:  bufferSamples,
 		Callback: sdl.AudioCallback(C.SpeakerCallback),
 	}
@@ -118,6 +118,14 @@ func (k *sdlKeyboard) putKey(keyEvent *sdl.KeyboardEvent) {
 		k.screenMode = screen.NextScreenMode(k.screenMode)
 	case sdl.K_F7:
 		k.showPages = !k.showPages
+	case sdl.K_F8:
+		if ctrl {
+			k.a.SendCommand(izapple2.CommandSaveState)
+		} else if shift {
+			k.a.SendCommand(izapple2.CommandRewind)
+		} else {
+			k.a.SendCommand(izapple2.CommandLoadState)
+		}
 	case sdl.K_F9:
 		k.a.SendCommand(izapple2.CommandDumpDebugInfo)
 	case sdl.K_F10:
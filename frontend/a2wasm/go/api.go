@@ -93,6 +93,35 @@ func setupAPI(a *izapple2.Apple2, game *Game) {
 		return nil
 	})
 
+	// Audio, the sources are the speaker and the sound cards
+	api["getAudioSources"] = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		names := []interface{}{}
+		for _, source := range a.GetAudioSources() {
+			names = append(names, source.GetAudioSourceName())
+		}
+		return names
+	})
+
+	api["setAudioVolume"] = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 2 {
+			return nil
+		}
+		if sink, ok := game.speaker.sources[args[0].String()]; ok {
+			sink.SetGain(float32(args[1].Float()))
+		}
+		return nil
+	})
+
+	api["setAudioMuted"] = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 2 {
+			return nil
+		}
+		if sink, ok := game.speaker.sources[args[0].String()]; ok {
+			sink.SetMuted(args[1].Bool())
+		}
+		return nil
+	})
+
 	// Screenshot
 	api["screenshot"] = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 		saveScreenshot(a, game.screenMode)
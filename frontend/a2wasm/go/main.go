@@ -114,7 +114,10 @@ func ebitenRun(a *izapple2.Apple2) {
 
 	// Set up providers
 	for _, source := range a.GetAudioSources() {
-		source.SetAudioSink(game.speaker.mixer.NewSource())
+		sink := game.speaker.mixer.NewSource()
+		sink.SetPan(source.GetAudioSourcePan())
+		source.SetAudioSink(sink)
+		game.speaker.sources[source.GetAudioSourceName()] = sink
 	}
 
 	// Setup API exports for React
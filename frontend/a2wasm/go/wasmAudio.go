@@ -14,7 +14,8 @@ import (
 // wasmAudio sends the mixed audio of the machine to the ebiten audio
 // player. The audio sources of the machine attach to the mixer.
 type wasmAudio struct {
-	mixer *a2audio.Mixer
+	mixer   *a2audio.Mixer
+	sources map[string]*a2audio.Source // By AudioSource name
 
 	audioContext *audio.Context
 	audioPlayer  *audio.Player
@@ -23,15 +24,18 @@ type wasmAudio struct {
 
 func newWasmAudio(clockMhz float64) *wasmAudio {
 	return &wasmAudio{
-		mixer: a2audio.NewMixer(clockMhz),
+		mixer:   a2audio.NewMixer(clockMhz),
+		sources: make(map[string]*a2audio.Source),
 	}
 }
 
 // Read is io.Reader's Read, it fills the buffer with audio samples
 func (s *wasmAudio) Read(buf []byte) (n int, err error) {
-	const bytesPerSample = 8 // Two float32, one for each channel
-	samples := len(buf) / bytesPerSample
+	const bytesPerFrame = 8 // Two float32, one for each channel
+	frames := len(buf) / bytesPerFrame
 
+	// The mixer interleaves the left and right samples as expected
+	samples := frames * 2
 	if cap(s.samples) < samples {
 		s.samples = make([]float32, samples)
 	}
@@ -41,19 +45,15 @@ func (s *wasmAudio) Read(buf []byte) (n int, err error) {
 	for i, v := range s.samples {
 		putFloat32InBuffer(buf, i, v)
 	}
-	return samples * bytesPerSample, nil
+	return frames * bytesPerFrame, nil
 }
 
 func putFloat32InBuffer(buf []byte, i int, f float32) {
 	v := math.Float32bits(f)
-	buf[i*8] = byte(v)
-	buf[i*8+1] = byte(v >> 8)
-	buf[i*8+2] = byte(v >> 16)
-	buf[i*8+3] = byte(v >> 24)
-	buf[i*8+4] = byte(v)
-	buf[i*8+5] = byte(v >> 8)
-	buf[i*8+6] = byte(v >> 16)
-	buf[i*8+7] = byte(v >> 24)
+	buf[i*4] = byte(v)
+	buf[i*4+1] = byte(v >> 8)
+	buf[i*4+2] = byte(v >> 16)
+	buf[i*4+3] = byte(v >> 24)
 }
 
 func (s *wasmAudio) update() error {
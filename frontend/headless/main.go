@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/ivanizag/izapple2"
+	"github.com/ivanizag/izapple2/audio"
 	"github.com/ivanizag/izapple2/screen"
 )
 
@@ -68,6 +69,62 @@ func main() {
 			fmt.Printf("%v\n", a.GetCycles())
 		case "reset":
 			a.SendCommand(izapple2.CommandReset)
+		case "rewind":
+			a.SendCommand(izapple2.CommandRewind)
+		case "savestate", "loadstate":
+			filename := izapple2.DefaultStateFile
+			if len(parts) > 1 {
+				filename = parts[1]
+			}
+			if command == "savestate" {
+				a.SendSaveState(filename)
+			} else {
+				a.SendLoadState(filename)
+			}
+
+		// Debugger commands
+		case "break":
+			if len(parts) < 2 {
+				fmt.Println("Usage: break <address> [<condition>]")
+			} else if address, err := parseAddress(parts[1]); err != nil {
+				fmt.Println("Usage: break <address> [<condition>]")
+			} else if id, err := a.Debugger().AddBreakpoint(address, strings.Join(parts[2:], " ")); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			} else {
+				fmt.Printf("Breakpoint %v at $%04X\n", id, address)
+			}
+		case "watch":
+			addWatchpoint(a, parts)
+		case "delete":
+			if len(parts) != 2 {
+				fmt.Println("Usage: delete <id>")
+			} else if id, err := strconv.Atoi(parts[1]); err != nil {
+				fmt.Println("Usage: delete <id>")
+			} else if err := a.Debugger().Remove(id); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		case "breakpoints":
+			for _, bp := range a.Debugger().GetBreakpoints() {
+				address := fmt.Sprintf("$%04X", bp.Address)
+				if bp.End != bp.Address {
+					address += fmt.Sprintf("-$%04X", bp.End)
+				}
+				fmt.Println(strings.TrimSpace(fmt.Sprintf("%v: break %s %s", bp.ID, address, bp.Condition)))
+			}
+			for _, wp := range a.Debugger().GetWatchpoints() {
+				mode := ""
+				if wp.Read {
+					mode += "r"
+				}
+				if wp.Write {
+					mode += "w"
+				}
+				fmt.Printf("%v: watch $%04X-$%04X %s\n", wp.ID, wp.Start, wp.End, mode)
+			}
+		case "step", "stepover", "stepout", "continue":
+			debuggerResume(a, command)
+		case "regs":
+			fmt.Println(a.Debugger().Registers())
 
 		// Keyboard related commands
 		case "key":
@@ -95,6 +152,16 @@ func main() {
 		case "text":
 			fmt.Print(izapple2.DumpTextModeAnsi(a))
 
+		// Audio related commands
+		case "wav":
+			startWav(a, fe, parts)
+		case "wavstop":
+			stopWav(a, fe)
+		case "psglog":
+			startPsgLog(a, parts)
+		case "psglogstop":
+			stopPsgLog(a)
+
 		// Old:
 		case "png":
 			err := screen.SaveSnapshot(a.GetVideoSource(), screen.ScreenModeNTSC, "snapshot.png")
@@ -139,6 +206,34 @@ Emulation control commands:
 		Prints the current cycle count
 	reset
 		Sends a reset to the emulator
+	rewind
+		Pauses the emulator and goes back to the previous rewind snapshot. Requires "-rewind"
+	savestate [<filename>]
+		Saves the state of the emulated machine to <filename>, "apple2.state" by default
+	loadstate [<filename>]
+		Restores the state of the emulated machine from <filename>, "apple2.state" by default
+
+Debugger commands:
+	break <address> [<condition>]
+		Stops before running the instruction at <address>. The optional <condition> is on the registers A, X,
+		Y, P and S, like "A==$20 && X<10". The addresses are hex, the values on conditions are decimal or hex
+		prefixed by "$" or "0x".
+	watch <address>[-<end>] [r|w|rw]
+		Stops after an instruction reads or writes the memory range. Writes by default.
+	delete <id>
+		Deletes a breakpoint or a watchpoint.
+	breakpoints
+		Lists the breakpoints and watchpoints.
+	step
+		Runs one instruction. The emulator must be paused.
+	stepover
+		Runs one instruction, a JSR is run until the subroutine returns.
+	stepout
+		Runs until the current subroutine returns.
+	continue
+		Runs until a breakpoint or watchpoint is hit. Returns to the prompt after two seconds without a stop.
+	regs
+		Prints the CPU registers and the next instruction.
 
 Keyboard related commands:
 	key <key>
@@ -164,6 +259,19 @@ Screen related commands:
 	* gifm <filename> <seconds> <delay>
 		Same as "gif" in monochrome.
 
+Audio related commands:
+	wav <filename> [separate]
+		Starts recording the audio to <filename> in WAV format, in sync with the emulated cycles. With
+		"separate", each audio source is also stored alone on <filename>_<source>.wav. The emulator must be
+		paused, use "run" to record a number of cycles.
+	wavstop
+		Stops the audio recording and completes the files. The emulator must be paused.
+	psglog <filename>
+		Starts logging the register writes to the sound generators of the Mockingboard or Phasor card to
+		<filename>, in VGM format for a .vgm extension or YM for .ym. The emulator must be paused.
+	psglogstop
+		Stops logging the sound generators and completes the file. The emulator must be paused.
+
 `
 
 /*
@@ -172,12 +280,182 @@ TODO:
 	joystick related commands: set paddle and button state, dump state
 */
 
+// parseAddress parses an hex address, with or without "$" or "0x"
+func parseAddress(s string) (uint16, error) {
+	s = strings.TrimPrefix(s, "$")
+	s = strings.TrimPrefix(strings.ToLower(s), "0x")
+	address, err := strconv.ParseUint(s, 16, 16)
+	return uint16(address), err
+}
+
+func addWatchpoint(a *izapple2.Apple2, parts []string) {
+	usage := "Usage: watch <address>[-<end>] [r|w|rw]"
+	if len(parts) < 2 || len(parts) > 3 {
+		fmt.Println(usage)
+		return
+	}
+
+	startText, endText, isRange := strings.Cut(parts[1], "-")
+	start, err := parseAddress(startText)
+	if err != nil {
+		fmt.Println(usage)
+		return
+	}
+	end := start
+	if isRange {
+		end, err = parseAddress(endText)
+		if err != nil {
+			fmt.Println(usage)
+			return
+		}
+	}
+
+	mode := "w"
+	if len(parts) == 3 {
+		mode = strings.ToLower(parts[2])
+	}
+	read := strings.Contains(mode, "r")
+	write := strings.Contains(mode, "w")
+	if strings.Trim(mode, "rw") != "" {
+		fmt.Println(usage)
+		return
+	}
+
+	id, err := a.Debugger().AddWatchpoint(start, end, read, write)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+	} else {
+		fmt.Printf("Watchpoint %v at $%04X-$%04X\n", id, start, end)
+	}
+}
+
+const debuggerResumeWait = 2 * time.Second
+
+func debuggerResume(a *izapple2.Apple2, command string) {
+	d := a.Debugger()
+	var err error
+	switch command {
+	case "step":
+		err = d.Step()
+	case "stepover":
+		err = d.StepOver()
+	case "stepout":
+		err = d.StepOut()
+	case "continue":
+		err = d.Continue()
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	// Don't block the prompt if there is no stop soon
+	deadline := time.Now().Add(debuggerResumeWait)
+	spinWait(func() bool { return a.IsPaused() || time.Now().After(deadline) })
+	if !a.IsPaused() {
+		fmt.Println("Still running, use \"pause\" to stop the emulation")
+		return
+	}
+	fmt.Printf("Stopped on %s\n", d.LastStop())
+	fmt.Println(d.Registers())
+}
+
 func spinWait(f func() bool) {
 	for !f() {
 		time.Sleep(time.Millisecond * 1)
 	}
 }
 
+func startWav(a *izapple2.Apple2, fe *headLessFrontend, parts []string) {
+	if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "separate") {
+		fmt.Println("Usage: wav <filename> [separate]")
+		return
+	}
+	if !a.IsPaused() {
+		fmt.Println("The emulator must be paused")
+		return
+	}
+	if fe.recorder != nil {
+		fmt.Println("Already recording")
+		return
+	}
+
+	filename := parts[1]
+	recorder, err := audio.NewRecorder(a.GetClockMhz(), a.GetCycles(), filename)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	sources := a.GetAudioSources()
+	for i, source := range sources {
+		sourceFilename := ""
+		if len(parts) == 3 {
+			name := strings.ReplaceAll(source.GetAudioSourceName(), " ", "_")
+			sourceFilename = strings.TrimSuffix(filename, ".wav") + "_" + name + ".wav"
+		}
+		sink, err := recorder.NewSource(source.GetAudioSourcePan(), sourceFilename, nil)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			// Detach the sources already recording and close their files
+			for _, attached := range sources[:i] {
+				attached.SetAudioSink(nil)
+			}
+			recorder.Close(a.GetCycles())
+			return
+		}
+		source.SetAudioSink(sink)
+	}
+	fe.recorder = recorder
+}
+
+func stopWav(a *izapple2.Apple2, fe *headLessFrontend) {
+	if !a.IsPaused() {
+		fmt.Println("The emulator must be paused")
+		return
+	}
+	if fe.recorder == nil {
+		fmt.Println("Not recording")
+		return
+	}
+
+	for _, source := range a.GetAudioSources() {
+		source.SetAudioSink(nil)
+	}
+	err := fe.recorder.Close(a.GetCycles())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+	} else {
+		fmt.Printf("Recorded %.2f seconds\n", float64(fe.recorder.Samples())/audio.SampleRate)
+	}
+	fe.recorder = nil
+}
+
+func startPsgLog(a *izapple2.Apple2, parts []string) {
+	if len(parts) != 2 {
+		fmt.Println("Usage: psglog <filename>")
+		return
+	}
+	if !a.IsPaused() {
+		fmt.Println("The emulator must be paused")
+		return
+	}
+	err := a.StartPsgLog(parts[1])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+}
+
+func stopPsgLog(a *izapple2.Apple2) {
+	if !a.IsPaused() {
+		fmt.Println("The emulator must be paused")
+		return
+	}
+	err := a.StopPsgLog()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+}
+
 func SaveGif(a *izapple2.Apple2, filename string) error {
 	animation := gif.GIF{}
 
@@ -217,6 +495,7 @@ Uses the console to send commands and queries to an emulated machine.
 */
 type headLessFrontend struct {
 	keyChannel chan uint8
+	recorder   *audio.Recorder
 }
 
 func (fe *headLessFrontend) GetKey(strobed bool) (key uint8, ok bool) {
@@ -2,6 +2,7 @@ package izapple2
 
 import (
 	"fmt"
+	"io"
 )
 
 type ioC0Page struct {
@@ -13,6 +14,7 @@ type ioC0Page struct {
 	keyboard           KeyboardProvider
 	speaker            speakerAudioSource
 	cassette           *cassette
+	cassetteOutput     *cassetteOutput
 	paddlesStrobeCycle uint64
 	joysticks          JoysticksProvider
 	mouse              MouseProvider
@@ -113,6 +115,10 @@ func (p *ioC0Page) setCassette(c *cassette) {
 	p.cassette = c
 }
 
+func (p *ioC0Page) setCassetteOutput(c *cassetteOutput) {
+	p.cassetteOutput = c
+}
+
 func (p *ioC0Page) setJoysticksProvider(j JoysticksProvider) {
 	p.joysticks = j
 }
@@ -172,6 +178,28 @@ func (p *ioC0Page) poke(address uint16, value uint8) {
 	ss(value)
 }
 
+func (p *ioC0Page) saveState(w io.Writer) error {
+	err := saveValues(w, &p.softSwitchesData, &p.paddlesStrobeCycle, &p.speaker.high)
+	if err != nil {
+		return err
+	}
+	if p.cassette != nil {
+		return p.cassette.saveState(w)
+	}
+	return nil
+}
+
+func (p *ioC0Page) loadState(r io.Reader) error {
+	err := loadValues(r, &p.softSwitchesData, &p.paddlesStrobeCycle, &p.speaker.high)
+	if err != nil {
+		return err
+	}
+	if p.cassette != nil {
+		return p.cassette.loadState(r)
+	}
+	return nil
+}
+
 func ssFromBool(value bool) uint8 {
 	if value {
 		return ssOn
@@ -1,6 +1,9 @@
 package izapple2
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+)
 
 // See https://fabiensanglard.net/fd_proxy/prince_of_persia/Inside%20the%20Apple%20IIe.pdf
 // See https://i.stack.imgur.com/yn21s.gif
@@ -164,6 +167,13 @@ func (mmu *memoryManager) inhibitROM(replacement memoryHandler) {
 }
 
 func (mmu *memoryManager) accessRead(address uint16) memoryHandler {
+	if mmu.apple2.debugger.watching.Load() {
+		mmu.apple2.debugger.checkWatchpoints(address, false)
+	}
+	return mmu.resolveRead(address)
+}
+
+func (mmu *memoryManager) resolveRead(address uint16) memoryHandler {
 	if address <= addressLimitZero {
 		return mmu.getPhysicalMainRAM(mmu.altZeroPage)
 	}
@@ -197,6 +207,13 @@ func (mmu *memoryManager) accessRead(address uint16) memoryHandler {
 }
 
 func (mmu *memoryManager) accessWrite(address uint16) memoryHandler {
+	if mmu.apple2.debugger.watching.Load() {
+		mmu.apple2.debugger.checkWatchpoints(address, true)
+	}
+	return mmu.resolveWrite(address)
+}
+
+func (mmu *memoryManager) resolveWrite(address uint16) memoryHandler {
 	if address <= addressLimitZero {
 		return mmu.getPhysicalMainRAM(mmu.altZeroPage)
 	}
@@ -252,7 +269,8 @@ func (mmu *memoryManager) Peek(address uint16) uint8 {
 func (mmu *memoryManager) PeekCode(address uint16) uint8 {
 	page := address & 0xff00
 	var mh memoryHandler
-	if page == mmu.lastAddressPage {
+	if page == mmu.lastAddressPage && !mmu.apple2.debugger.watching.Load() {
+		// With watchpoints the cache is skipped to check every access
 		mh = mmu.lastAddressHandler
 	} else {
 		mh = mmu.accessRead(address)
@@ -275,6 +293,25 @@ func (mmu *memoryManager) PeekCode(address uint16) uint8 {
 	return value
 }
 
+// peekUnwatched reads memory for the debugger, the watchpoints are not
+// checked
+func (mmu *memoryManager) peekUnwatched(address uint16) uint8 {
+	mh := mmu.resolveRead(address)
+	if mh == nil {
+		return uint8(address)
+	}
+	return mh.peek(address)
+}
+
+// pokeUnwatched writes memory for the debugger, the watchpoints are not
+// checked
+func (mmu *memoryManager) pokeUnwatched(address uint16, value uint8) {
+	mh := mmu.resolveWrite(address)
+	if mh != nil {
+		mh.poke(address, value)
+	}
+}
+
 func (mmu *memoryManager) pokeRange(address uint16, data []uint8) {
 	for i := range data {
 		mmu.Poke(address+uint16(i), data[i])
@@ -376,3 +413,87 @@ func (mmu *memoryManager) reset() {
 		// ioFlagText ?
 	}
 }
+
+func (mmu *memoryManager) saveState(w io.Writer) error {
+	err := saveValues(w,
+		&mmu.lcSelectedBlock, &mmu.lcActiveRead, &mmu.lcActiveWrite, &mmu.lcAltBank,
+		&mmu.altZeroPage, &mmu.altMainRAMActiveRead, &mmu.altMainRAMActiveWrite,
+		&mmu.store80Active, &mmu.slotC3ROMActive, &mmu.intCxROMActive, &mmu.intC8ROMActive,
+		&mmu.activeSlot, &mmu.extendedRAMBlock)
+	if err != nil {
+		return err
+	}
+
+	// The card inhibiting the main ROM is stored by slot, 0 for none
+	inhibitedBy := uint8(0)
+	for i, c := range mmu.apple2.cards {
+		if mh, ok := c.(memoryHandler); ok && mmu.mainROMinhibited != nil && mh == mmu.mainROMinhibited {
+			inhibitedBy = uint8(i + 1)
+		}
+	}
+	err = saveValues(w, &inhibitedBy)
+	if err != nil {
+		return err
+	}
+
+	for _, mh := range mmu.persistentMemory() {
+		err = mh.saveState(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mmu *memoryManager) loadState(r io.Reader) error {
+	err := loadValues(r,
+		&mmu.lcSelectedBlock, &mmu.lcActiveRead, &mmu.lcActiveWrite, &mmu.lcAltBank,
+		&mmu.altZeroPage, &mmu.altMainRAMActiveRead, &mmu.altMainRAMActiveWrite,
+		&mmu.store80Active, &mmu.slotC3ROMActive, &mmu.intCxROMActive, &mmu.intC8ROMActive,
+		&mmu.activeSlot, &mmu.extendedRAMBlock)
+	if err != nil {
+		return err
+	}
+
+	var inhibitedBy uint8
+	err = loadValues(r, &inhibitedBy)
+	if err != nil {
+		return err
+	}
+	if inhibitedBy == 0 {
+		mmu.inhibitROM(nil)
+	} else if mh, ok := mmu.apple2.cards[inhibitedBy-1].(memoryHandler); ok {
+		mmu.inhibitROM(mh)
+	} else {
+		return fmt.Errorf("the card on slot %v can't inhibit the main ROM", inhibitedBy-1)
+	}
+
+	for _, mh := range mmu.persistentMemory() {
+		err = mh.loadState(r)
+		if err != nil {
+			return err
+		}
+	}
+	mmu.lastAddressPage = invalidAddressPage // Invalidate cache
+	return nil
+}
+
+// persistentMemory returns the RAM banks and the paged ROM, in a stable order
+func (mmu *memoryManager) persistentMemory() []persistent {
+	var handlers []memoryHandler
+	handlers = append(handlers, mmu.physicalMainRAM, mmu.physicalROM)
+	handlers = append(handlers, mmu.physicalLangRAM...)
+	handlers = append(handlers, mmu.physicalLangAltRAM...)
+	for _, mh := range mmu.physicalExtRAM {
+		handlers = append(handlers, mh)
+	}
+	handlers = append(handlers, mmu.physicalExtAltRAM...)
+
+	var result []persistent
+	for _, mh := range handlers {
+		if p, ok := mh.(persistent); ok {
+			result = append(result, p)
+		}
+	}
+	return result
+}
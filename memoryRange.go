@@ -2,6 +2,7 @@ package izapple2
 
 import (
 	"fmt"
+	"io"
 )
 
 type memoryRange struct {
@@ -77,6 +78,23 @@ func (m *memoryRangeROM) poke(address uint16, value uint8) {
 	// Ignore
 }
 
+func (m *memoryRange) saveState(w io.Writer) error {
+	return saveValues(w, m.data)
+}
+
+func (m *memoryRange) loadState(r io.Reader) error {
+	return loadValues(r, m.data)
+}
+
+// The ROM contents are not stored, only the active page
+func (m *memoryRangeROM) saveState(w io.Writer) error {
+	return saveValues(w, &m.pageOffset)
+}
+
+func (m *memoryRangeROM) loadState(r io.Reader) error {
+	return loadValues(r, &m.pageOffset)
+}
+
 //lint:ignore U1000 this is used to write debug code
 func identifyMemory(m memoryHandler) string {
 	ram, ok := m.(*memoryRange)
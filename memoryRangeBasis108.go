@@ -1,5 +1,7 @@
 package izapple2
 
+import "io"
+
 /*
 	The Basis 108 clone has 128kb of RAM plus 2KB of static RAM at $0400 for 80 columns text.
 */
@@ -71,3 +73,11 @@ func (m *memoryRangeBasis108) getTextMemory(secondPage bool, ext bool) []uint8 {
 	}
 	return m.dataMain[addressStart : addressStart+textPageSize]
 }
+
+func (m *memoryRangeBasis108) saveState(w io.Writer) error {
+	return saveValues(w, m.dataMain, m.dataAux, m.dataStatic, &m.staticRam, &m.auxRam)
+}
+
+func (m *memoryRangeBasis108) loadState(r io.Reader) error {
+	return loadValues(r, m.dataMain, m.dataAux, m.dataStatic, &m.staticRam, &m.auxRam)
+}
@@ -0,0 +1,308 @@
+package izapple2
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+Movie files, recording and playback of the inputs.
+
+The recorder wraps the keyboard, joysticks and mouse providers and stores
+every value consumed by the emulated machine with the cycle it happened.
+The disk changes are stored too. The keys are stored when read, the other
+inputs only when they change.
+
+The recording starts on power on. The playback requires the same
+configuration and disk images to reproduce the session. Once all the
+events are replayed, the inputs come again from the frontend providers.
+
+It is a text file with a line per event:
+	izapple2 movie <version>
+	signature <configuration signature>
+	key <cycle> <code>
+	button <cycle> <number> <0|1>
+	paddle <cycle> <number> <value> <0|1 if there is data>
+	mouse <cycle> <x> <y> <0|1 pressed>
+	disk <cycle> <drive> <path>
+
+Not everything is deterministic: the real time clocks use the host time
+and the DiskII state machine uses random values for the weak bits.
+*/
+
+const movieVersion = 1
+
+type movieEvent struct {
+	kind   string
+	cycle  uint64
+	values [3]int
+	path   string
+}
+
+type movie struct {
+	a    *Apple2
+	file *os.File // Only when recording
+
+	// Events pending when playing back
+	events     []movieEvent
+	diskEvents []movieEvent
+
+	// Providers of the frontend
+	keyboard  KeyboardProvider
+	joysticks JoysticksProvider
+	mouse     MouseProvider
+
+	// Last values, to detect the changes when recording and to return when playing back
+	keys         []uint8
+	buttons      [3]bool
+	paddles      [4]uint8
+	paddlesData  [4]bool
+	mouseX       uint16
+	mouseY       uint16
+	mousePressed bool
+}
+
+func newMovie(a *Apple2) *movie {
+	var m movie
+	m.a = a
+	a.movie = &m
+	a.io.setKeyboardProvider(&m)
+	a.io.setJoysticksProvider(&m)
+	a.io.setMouseProvider(&m)
+	return &m
+}
+
+func (a *Apple2) startMovieRecording(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	m := newMovie(a)
+	m.file = file
+	return m.write(fmt.Sprintf("izapple2 movie %v\nsignature %s\n", movieVersion, a.stateSignature()))
+}
+
+func (a *Apple2) startMoviePlayback(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	events, diskEvents, err := parseMovie(file, a.stateSignature())
+	if err != nil {
+		return fmt.Errorf("invalid movie file %s: %w", filename, err)
+	}
+	m := newMovie(a)
+	m.events = events
+	m.diskEvents = diskEvents
+	return nil
+}
+
+func parseMovie(r io.Reader, signature string) ([]movieEvent, []movieEvent, error) {
+	var events []movieEvent
+	var diskEvents []movieEvent
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		switch line {
+		case 1:
+			if text != fmt.Sprintf("izapple2 movie %v", movieVersion) {
+				return nil, nil, errors.New("not a supported movie file")
+			}
+			continue
+		case 2:
+			if text != "signature "+signature {
+				return nil, nil, errors.New("the movie was recorded with a different configuration")
+			}
+			continue
+		}
+
+		parts := strings.SplitN(text, " ", 4)
+		if len(parts) < 3 {
+			return nil, nil, fmt.Errorf("invalid event on line %v", line)
+		}
+		var e movieEvent
+		e.kind = parts[0]
+		cycle, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid cycle on line %v", line)
+		}
+		e.cycle = cycle
+
+		if e.kind == "disk" {
+			if len(parts) < 4 {
+				return nil, nil, fmt.Errorf("invalid disk event on line %v", line)
+			}
+			e.values[0], err = strconv.Atoi(parts[2])
+			e.path = parts[3]
+			diskEvents = append(diskEvents, e)
+		} else {
+			fields := strings.Fields(strings.Join(parts[2:], " "))
+			expected := map[string]int{"key": 1, "button": 2, "paddle": 3, "mouse": 3}[e.kind]
+			if expected == 0 || len(fields) != expected {
+				return nil, nil, fmt.Errorf("invalid event on line %v", line)
+			}
+			for i, field := range fields {
+				e.values[i], err = strconv.Atoi(field)
+				if err != nil {
+					break
+				}
+			}
+			events = append(events, e)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid value on line %v", line)
+		}
+	}
+	return events, diskEvents, scanner.Err()
+}
+
+func (m *movie) isPlaying() bool {
+	return m.file == nil && (len(m.events) != 0 || len(m.diskEvents) != 0)
+}
+
+func (m *movie) write(line string) error {
+	_, err := m.file.WriteString(line)
+	if err != nil {
+		fmt.Printf("Movie recording stopped: %v\n", err)
+		m.file.Close()
+		m.file = nil
+	}
+	return err
+}
+
+func (m *movie) record(format string, args ...any) {
+	if m.file != nil {
+		m.write(fmt.Sprintf(format, args...))
+	}
+}
+
+// advance applies the events up to the current cycle
+func (m *movie) advance() {
+	cycles := m.a.GetCycles()
+	for len(m.events) != 0 && m.events[0].cycle <= cycles {
+		e := m.events[0]
+		m.events = m.events[1:]
+		switch e.kind {
+		case "key":
+			m.keys = append(m.keys, uint8(e.values[0]))
+		case "button":
+			m.buttons[e.values[0]%len(m.buttons)] = e.values[1] != 0
+		case "paddle":
+			i := e.values[0] % len(m.paddles)
+			m.paddles[i] = uint8(e.values[1])
+			m.paddlesData[i] = e.values[2] != 0
+		case "mouse":
+			m.mouseX = uint16(e.values[0])
+			m.mouseY = uint16(e.values[1])
+			m.mousePressed = e.values[2] != 0
+		}
+	}
+}
+
+// tick applies the disk changes. To be called from the emulation loop.
+func (m *movie) tick() {
+	for len(m.diskEvents) != 0 && m.diskEvents[0].cycle <= m.a.cycles {
+		e := m.diskEvents[0]
+		m.diskEvents = m.diskEvents[1:]
+		err := m.a.changeDisk(e.values[0], e.path)
+		if err != nil {
+			fmt.Printf("Movie playback could not load file %v\n%v\n", e.path, err)
+		}
+	}
+}
+
+func (m *movie) recordDisk(drive int, path string) {
+	m.record("disk %v %v %s\n", m.a.cycles, drive, path)
+}
+
+func (m *movie) close() {
+	if m.file != nil {
+		m.file.Close()
+		m.file = nil
+	}
+}
+
+// GetKey implements KeyboardProvider
+func (m *movie) GetKey(strobed bool) (uint8, bool) {
+	if m.isPlaying() || len(m.keys) != 0 {
+		m.advance()
+		if len(m.keys) == 0 {
+			return 0, false
+		}
+		key := m.keys[0]
+		m.keys = m.keys[1:]
+		return key, true
+	}
+
+	if m.keyboard == nil {
+		return 0, false
+	}
+	key, ok := m.keyboard.GetKey(strobed)
+	if ok {
+		m.record("key %v %v\n", m.a.cycles, key)
+	}
+	return key, ok
+}
+
+// ReadButton implements JoysticksProvider
+func (m *movie) ReadButton(i int) bool {
+	if m.isPlaying() {
+		m.advance()
+		return m.buttons[i]
+	}
+
+	pressed := m.joysticks != nil && m.joysticks.ReadButton(i)
+	if pressed != m.buttons[i] {
+		m.buttons[i] = pressed
+		m.record("button %v %v %v\n", m.a.cycles, i, boolToUint8(pressed))
+	}
+	return pressed
+}
+
+// ReadPaddle implements JoysticksProvider
+func (m *movie) ReadPaddle(i int) (uint8, bool) {
+	if m.isPlaying() {
+		m.advance()
+		return m.paddles[i], m.paddlesData[i]
+	}
+
+	var value uint8
+	var hasData bool
+	if m.joysticks != nil {
+		value, hasData = m.joysticks.ReadPaddle(i)
+	}
+	if value != m.paddles[i] || hasData != m.paddlesData[i] {
+		m.paddles[i] = value
+		m.paddlesData[i] = hasData
+		m.record("paddle %v %v %v %v\n", m.a.cycles, i, value, boolToUint8(hasData))
+	}
+	return value, hasData
+}
+
+// ReadMouse implements MouseProvider
+func (m *movie) ReadMouse() (uint16, uint16, bool) {
+	if m.isPlaying() {
+		m.advance()
+		return m.mouseX, m.mouseY, m.mousePressed
+	}
+
+	var x, y uint16
+	var pressed bool
+	if m.mouse != nil {
+		x, y, pressed = m.mouse.ReadMouse()
+	}
+	if x != m.mouseX || y != m.mouseY || pressed != m.mousePressed {
+		m.mouseX, m.mouseY, m.mousePressed = x, y, pressed
+		m.record("mouse %v %v %v %v\n", m.a.cycles, x, y, boolToUint8(pressed))
+	}
+	return x, y, pressed
+}
@@ -0,0 +1,102 @@
+package izapple2
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+type movieTestInput struct {
+	key     uint8
+	paddle0 uint8
+}
+
+func (i *movieTestInput) GetKey(_ bool) (uint8, bool) {
+	key := i.key
+	i.key = 0
+	return key, key != 0
+}
+
+func (i *movieTestInput) ReadButton(_ int) bool {
+	return false
+}
+
+func (i *movieTestInput) ReadPaddle(n int) (uint8, bool) {
+	if n == 0 {
+		return i.paddle0, true
+	}
+	return 0, false
+}
+
+func TestMovieRecordAndPlayback(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.movie")
+
+	at, err := makeApple2Tester("2plus", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := at.a
+	err = a.startMovieRecording(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := &movieTestInput{}
+	a.SetKeyboardProvider(input)
+	a.SetJoysticksProvider(input)
+
+	a.cycles = 100
+	input.key = 'A'
+	a.io.keyboard.GetKey(true)
+	a.cycles = 200
+	input.paddle0 = 50
+	a.io.joysticks.ReadPaddle(0)
+	a.movie.close()
+
+	at, err = makeApple2Tester("2plus", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a = at.a
+	err = a.startMoviePlayback(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetKeyboardProvider(&movieTestInput{key: 'B'}) // Ignored while playing back
+
+	a.cycles = 99
+	if _, ok := a.io.keyboard.GetKey(true); ok {
+		t.Error("The key should not be available before the cycle it was recorded")
+	}
+	a.cycles = 100
+	if key, ok := a.io.keyboard.GetKey(true); !ok || key != 'A' {
+		t.Errorf("The recorded key should be replayed, got %v", key)
+	}
+	if value, _ := a.io.joysticks.ReadPaddle(0); value != 0 {
+		t.Errorf("The paddle should not change before the recorded cycle, got %v", value)
+	}
+	a.cycles = 200
+	if value, _ := a.io.joysticks.ReadPaddle(0); value != 50 {
+		t.Errorf("The paddle should change on the recorded cycle, got %v", value)
+	}
+}
+
+func TestMovieConfigurationMismatch(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.movie")
+
+	at, err := makeApple2Tester("2plus", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = at.a.startMovieRecording(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at.a.movie.close()
+
+	at, err = makeApple2Tester("2e", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at.a.startMoviePlayback(filename) == nil {
+		t.Error("The movie should not play on a different configuration")
+	}
+}
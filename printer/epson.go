@@ -0,0 +1,515 @@
+package printer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+Epson FX-80 style dot matrix printer. It interprets the ESC/P commands and
+renders the printed pages as PNG files or as a PDF document.
+
+See:
+	"Epson FX Series Printer User's Manual", volume 2
+	https://files.support.epson.com/pdf/fx80__/fx80__u1.pdf
+
+Supported:
+	- Text with the pica, elite and condensed pitches, double width,
+	  emphasized, double strike, italic, underline, superscript and subscript
+	- Line spacing with ESC 0, 1, 2, 3 and A, and line feeds with ESC J and j
+	- Bit image graphics with ESC K, L, Y, Z, * and ^
+	- Margins, page length and form feed
+	- The characters with the MSB set are printed in italics if enabled,
+	  otherwise the MSB is ignored as the Apple II sends text with it set
+
+Ignored: international character sets, user defined characters, vertical
+tabs and proportional spacing.
+
+The characters are 7x8 dot bitmaps provided by the host. Each page is
+saved when ejected with a form feed or when the printer is closed.
+*/
+
+// Font returns the dots of a 7 columns by 8 rows character, row 7 is for
+// the descenders
+type Font func(char uint8, row int, column int) bool
+
+// Epson is an Epson FX-80 compatible printer
+type Epson struct {
+	font   Font
+	dir    string
+	format string
+	prefix string
+	pages  int
+	pdf    [][]uint8
+	page   *page
+
+	command []uint8 // ESC sequence being received
+
+	highBitItalic bool // The characters with the MSB set are printed in italics
+
+	// Position, x in 1/720 inch and y in 1/216 inch
+	x           int
+	y           int
+	lineSpacing int
+	pageLength  int
+	leftMargin  int
+	rightMargin int
+
+	elite        bool
+	condensed    bool
+	doubleWidth  bool
+	doubleLine   bool // Double width for the current line with SO
+	emphasized   bool
+	doubleStrike bool
+	italic       bool
+	underline    bool
+	script       int
+}
+
+const (
+	asciiNUL = 0x00
+	asciiBEL = 0x07
+	asciiBS  = 0x08
+	asciiHT  = 0x09
+	asciiLF  = 0x0a
+	asciiVT  = 0x0b
+	asciiFF  = 0x0c
+	asciiCR  = 0x0d
+	asciiSO  = 0x0e
+	asciiSI  = 0x0f
+	asciiDC2 = 0x12
+	asciiDC4 = 0x14
+	asciiCAN = 0x18
+	asciiESC = 0x1b
+	asciiDEL = 0x7f
+
+	scriptNone  = 0
+	scriptSuper = 1
+	scriptSub   = 2
+
+	// Horizontal units, 1/720 inch
+	picaWidth      = 72 // 10 characters per inch
+	eliteWidth     = 60 // 12 characters per inch
+	condensedWidth = 42 // 17.16 characters per inch
+	lineWidth      = 8 * unitsPerInchX
+
+	// Vertical units, 1/216 inch
+	pinSpacing         = 3
+	defaultLineSpacing = 36
+	defaultPageLength  = pageHeightInches * pageDPI
+	tabColumns         = 8
+)
+
+// NewEpson creates a printer saving the pages on the directory dir with
+// the format "png" or "pdf"
+func NewEpson(font Font, dir string, format string) (*Epson, error) {
+	if format != "png" && format != "pdf" {
+		return nil, fmt.Errorf("invalid printer format '%v', it must be png or pdf", format)
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	var e Epson
+	e.font = font
+	e.dir = dir
+	e.format = format
+	e.prefix = "printout-" + time.Now().Format("20060102-150405")
+	e.page = newPage()
+	e.reset()
+	return &e, nil
+}
+
+// SetHighBitItalic enables printing the characters with the MSB set in
+// italics. When disabled, the MSB is ignored on text.
+func (e *Epson) SetHighBitItalic(enabled bool) {
+	e.highBitItalic = enabled
+}
+
+// reset restores the default settings as ESC @, the paper is not moved
+func (e *Epson) reset() {
+	e.lineSpacing = defaultLineSpacing
+	e.pageLength = defaultPageLength
+	e.leftMargin = 0
+	e.rightMargin = lineWidth
+	e.elite = false
+	e.condensed = false
+	e.doubleWidth = false
+	e.doubleLine = false
+	e.emphasized = false
+	e.doubleStrike = false
+	e.italic = false
+	e.underline = false
+	e.script = scriptNone
+	e.x = e.leftMargin
+}
+
+// Write receives a byte from the computer
+func (e *Epson) Write(value uint8) {
+	if len(e.command) > 0 {
+		e.command = append(e.command, value)
+		length := e.commandLength()
+		if length != 0 && len(e.command) >= length {
+			e.escape(e.command)
+			e.command = nil
+		}
+		return
+	}
+
+	if value&0x7f < 0x20 || value == asciiDEL {
+		e.control(value & 0x7f)
+	} else {
+		e.printChar(value)
+	}
+}
+
+// Close ejects the page being printed
+func (e *Epson) Close() error {
+	return e.eject()
+}
+
+// Files returns the files with pages saved
+func (e *Epson) Files() []string {
+	var files []string
+	if e.format == "pdf" {
+		if e.pages > 0 {
+			files = append(files, e.pdfFilename())
+		}
+	} else {
+		for i := 1; i <= e.pages; i++ {
+			files = append(files, e.pngFilename(i))
+		}
+	}
+	return files
+}
+
+func (e *Epson) control(value uint8) {
+	switch value {
+	case asciiCR:
+		e.carriageReturn()
+	case asciiLF, asciiVT:
+		e.lineFeed(e.lineSpacing)
+	case asciiFF:
+		e.eject()
+		e.y = 0
+		e.carriageReturn()
+	case asciiBS:
+		e.x -= e.charWidth()
+		if e.x < e.leftMargin {
+			e.x = e.leftMargin
+		}
+	case asciiHT:
+		tab := tabColumns * e.charWidth()
+		e.x = e.leftMargin + ((e.x-e.leftMargin)/tab+1)*tab
+	case asciiSO:
+		e.doubleLine = true
+	case asciiDC4:
+		e.doubleLine = false
+	case asciiSI:
+		e.condensed = true
+	case asciiDC2:
+		e.condensed = false
+	case asciiCAN:
+		e.carriageReturn()
+	case asciiESC:
+		e.command = []uint8{asciiESC}
+	}
+	// NUL, BEL, DEL, DC1 and DC3 are ignored
+}
+
+// commandLength returns the length of the ESC sequence received or 0 if
+// more bytes are needed to know it
+func (e *Epson) commandLength() int {
+	c := e.command
+	if len(c) < 2 {
+		return 0
+	}
+	word := func(pos int) int {
+		return int(c[pos]) + int(c[pos+1])<<8
+	}
+
+	switch c[1] {
+	case 'K', 'L', 'Y', 'Z':
+		if len(c) < 4 {
+			return 0
+		}
+		return 4 + word(2)
+	case '*':
+		if len(c) < 5 {
+			return 0
+		}
+		return 5 + word(3)
+	case '^':
+		if len(c) < 5 {
+			return 0
+		}
+		return 5 + 2*word(3)
+	case 'D', 'B':
+		// Tab stops, ended with NUL
+		if len(c) > 2 && c[len(c)-1] == asciiNUL {
+			return len(c)
+		}
+		return 0
+	case '&':
+		// User defined characters, 12 bytes each
+		if len(c) < 5 {
+			return 0
+		}
+		if c[4] < c[3] {
+			return 5
+		}
+		return 5 + (int(c[4])-int(c[3])+1)*12
+	case 'C':
+		if len(c) < 3 {
+			return 0
+		}
+		if c[2] == 0 {
+			return 4 // Page length in inches
+		}
+		return 3
+	case ':':
+		return 5
+	case '%', '?', '$', '\\', 'e', 'f':
+		return 4
+	case '-', 'W', 'S', '3', 'A', 'J', 'j', 'l', 'Q', 'N', 'R', 'U',
+		's', 'x', 'k', 'p', '!', 'I', 'm', 'i', 'a', '/', 't':
+		return 3
+	}
+	return 2
+}
+
+func (e *Epson) escape(c []uint8) {
+	param := func() int {
+		return int(c[2])
+	}
+	flag := func() bool {
+		return c[2]&1 != 0 // Both 1 and '1' set the flag
+	}
+
+	switch c[1] {
+	case '@':
+		e.reset()
+	case 'E':
+		e.emphasized = true
+	case 'F':
+		e.emphasized = false
+	case 'G':
+		e.doubleStrike = true
+	case 'H':
+		e.doubleStrike = false
+	case '4':
+		e.italic = true
+	case '5':
+		e.italic = false
+	case '-':
+		e.underline = flag()
+	case 'W':
+		e.doubleWidth = flag()
+	case 'S':
+		if flag() {
+			e.script = scriptSub
+		} else {
+			e.script = scriptSuper
+		}
+	case 'T':
+		e.script = scriptNone
+	case 'M':
+		e.elite = true
+	case 'P':
+		e.elite = false
+	case asciiSO:
+		e.doubleLine = true
+	case asciiSI:
+		e.condensed = true
+	case '!':
+		mode := param()
+		e.elite = mode&0x01 != 0
+		e.condensed = mode&0x04 != 0
+		e.emphasized = mode&0x08 != 0
+		e.doubleStrike = mode&0x10 != 0
+		e.doubleWidth = mode&0x20 != 0
+		e.italic = mode&0x40 != 0
+		e.underline = mode&0x80 != 0
+	case '0':
+		e.lineSpacing = 27 // 1/8 inch
+	case '1':
+		e.lineSpacing = 21 // 7/72 inch
+	case '2':
+		e.lineSpacing = defaultLineSpacing
+	case '3':
+		e.lineSpacing = param()
+	case 'A':
+		e.lineSpacing = param() * pinSpacing
+	case 'J':
+		e.lineFeed(param())
+	case 'j':
+		e.y -= param()
+		if e.y < 0 {
+			e.y = 0
+		}
+	case 'C':
+		if c[2] == 0 {
+			e.pageLength = int(c[3]) * pageDPI
+		} else {
+			e.pageLength = param() * e.lineSpacing
+		}
+	case 'l':
+		e.leftMargin = param() * e.charWidth()
+		if e.x < e.leftMargin {
+			e.x = e.leftMargin
+		}
+	case 'Q':
+		e.rightMargin = param() * e.charWidth()
+		if e.rightMargin > lineWidth || e.rightMargin <= e.leftMargin {
+			e.rightMargin = lineWidth
+		}
+	case '$':
+		e.x = e.leftMargin + (int(c[2])+int(c[3])<<8)*unitsPerInchX/60
+	case 'K':
+		e.bitImage(c[4:], 1, 12) // 60 dpi
+	case 'L', 'Y':
+		e.bitImage(c[4:], 1, 6) // 120 dpi
+	case 'Z':
+		e.bitImage(c[4:], 1, 3) // 240 dpi
+	case '*':
+		e.bitImage(c[5:], 1, bitImageDensity(c[2]))
+	case '^':
+		e.bitImage(c[5:], 2, bitImageDensity(c[2]))
+	}
+}
+
+// Horizontal distance of the columns for the ESC * modes
+var bitImageDensities = [8]int{12, 6, 6, 3, 9, 10, 8, 5}
+
+func bitImageDensity(mode uint8) int {
+	return bitImageDensities[mode&7]
+}
+
+// bitImage prints columns of dots, with 8 or 9 pins
+func (e *Epson) bitImage(data []uint8, bytesPerColumn int, step int) {
+	for i := 0; i+bytesPerColumn <= len(data); i += bytesPerColumn {
+		if e.x >= e.rightMargin {
+			break // The data out of the margin is discarded
+		}
+		for pin := 0; pin < 8; pin++ {
+			if data[i]&(0x80>>pin) != 0 {
+				e.page.dot(e.x, float64(e.y+pin*pinSpacing))
+			}
+		}
+		if bytesPerColumn == 2 && data[i+1]&0x80 != 0 {
+			e.page.dot(e.x, float64(e.y+8*pinSpacing))
+		}
+		e.x += step
+	}
+}
+
+func (e *Epson) charWidth() int {
+	width := picaWidth
+	if e.condensed {
+		width = condensedWidth
+	} else if e.elite {
+		width = eliteWidth
+	}
+	if e.doubleWidth || e.doubleLine {
+		width *= 2
+	}
+	return width
+}
+
+func (e *Epson) printChar(value uint8) {
+	width := e.charWidth()
+	if e.x+width > e.rightMargin {
+		e.carriageReturn()
+		e.lineFeed(e.lineSpacing)
+	}
+
+	// The upper half of the characters can be printed in italics
+	italic := e.italic || (e.highBitItalic && value >= 0x80)
+	char := value & 0x7f
+
+	pitch := width / 6
+	rowHeight := float64(pinSpacing)
+	top := float64(e.y)
+	switch e.script {
+	case scriptSuper:
+		rowHeight = 2
+	case scriptSub:
+		rowHeight = 2
+		top += 9
+	}
+
+	for row := 0; row < 8; row++ {
+		slant := 0
+		if italic {
+			slant = (7 - row) * pitch / 4
+		}
+		y := top + float64(row)*rowHeight
+		for column := 0; column < 7; column++ {
+			if !e.font(char, row, column) {
+				continue
+			}
+			x := e.x + column*pitch + slant
+			e.strike(x, y)
+			if e.emphasized {
+				e.strike(x+pitch/2, y)
+			}
+		}
+	}
+
+	if e.underline {
+		y := float64(e.y + 8*pinSpacing)
+		for x := e.x; x < e.x+width; x += pitch / 2 {
+			e.strike(x, y)
+		}
+	}
+	e.x += width
+}
+
+// strike prints a dot, twice with double strike
+func (e *Epson) strike(x int, y float64) {
+	e.page.dot(x, y)
+	if e.doubleStrike {
+		e.page.dot(x, y+1)
+	}
+}
+
+func (e *Epson) carriageReturn() {
+	e.x = e.leftMargin
+	e.doubleLine = false
+}
+
+func (e *Epson) lineFeed(distance int) {
+	e.y += distance
+	e.doubleLine = false
+	if e.y >= e.pageLength {
+		e.eject()
+		e.y -= e.pageLength
+	}
+}
+
+// eject saves the page if something has been printed
+func (e *Epson) eject() error {
+	if !e.page.dirty {
+		return nil
+	}
+	current := e.page
+	e.page = newPage()
+	e.pages++
+
+	if e.format == "pdf" {
+		e.pdf = append(e.pdf, current.pdfImage())
+		return writePDF(e.pdfFilename(), e.pdf)
+	}
+	return current.savePNG(e.pngFilename(e.pages))
+}
+
+func (e *Epson) pngFilename(page int) string {
+	return filepath.Join(e.dir, fmt.Sprintf("%v-%03d.png", e.prefix, page))
+}
+
+func (e *Epson) pdfFilename() string {
+	return filepath.Join(e.dir, e.prefix+".pdf")
+}
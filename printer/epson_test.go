@@ -0,0 +1,167 @@
+package printer
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"testing"
+)
+
+// barFont prints every character as a vertical bar on column 3
+func barFont(char uint8, row int, column int) bool {
+	return column == 3
+}
+
+func newTestEpson(t *testing.T, format string) *Epson {
+	e, err := NewEpson(barFont, t.TempDir(), format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func (e *Epson) writeBytes(data []uint8) {
+	for _, value := range data {
+		e.Write(value)
+	}
+}
+
+// inkAt checks the dot at x in 1/720 inch and y in 1/216 inch
+func inkAt(e *Epson, x int, y int) bool {
+	return e.page.isInk(pageMarginX+x*pageDPI/unitsPerInchX, y)
+}
+
+func TestEpsonText(t *testing.T) {
+	e := newTestEpson(t, "png")
+	e.writeBytes([]uint8("AB\r\nC"))
+
+	if !inkAt(e, 3*12, 0) || !inkAt(e, 3*12, 7*pinSpacing) {
+		t.Error("The first character should be printed at the origin")
+	}
+	if !inkAt(e, picaWidth+3*12, 0) {
+		t.Error("The second character should be printed a pica width to the right")
+	}
+	if !inkAt(e, 3*12, defaultLineSpacing) {
+		t.Error("The third character should be printed on the second line")
+	}
+	if inkAt(e, 2*picaWidth+3*12, 0) {
+		t.Error("Nothing should be printed after the second character")
+	}
+}
+
+func TestEpsonTextModes(t *testing.T) {
+	e := newTestEpson(t, "png")
+	// Elite, then double width
+	e.writeBytes([]uint8{asciiESC, 'M', 'A', asciiESC, 'W', 1, 'A'})
+
+	if !inkAt(e, 3*10, 0) {
+		t.Error("The elite character should be narrower")
+	}
+	if !inkAt(e, eliteWidth+3*20, 0) {
+		t.Error("The double width character should be wider")
+	}
+	if e.x != eliteWidth*3 {
+		t.Errorf("The position should advance one elite and one double elite width, got %v", e.x)
+	}
+}
+
+func TestEpsonLineSpacing(t *testing.T) {
+	e := newTestEpson(t, "png")
+	e.writeBytes([]uint8{asciiESC, '3', 24, '\n', 'A', asciiESC, 'A', 12, '\n', 'A', asciiESC, 'J', 10, 'A'})
+
+	if !inkAt(e, 3*12, 24) {
+		t.Error("ESC 3 should set the line spacing in 1/216 inch")
+	}
+	if !inkAt(e, picaWidth+3*12, 24+36) {
+		t.Error("ESC A should set the line spacing in 1/72 inch")
+	}
+	if !inkAt(e, 2*picaWidth+3*12, 24+36+10) {
+		t.Error("ESC J should feed the paper without a carriage return")
+	}
+}
+
+func TestEpsonBitImage(t *testing.T) {
+	e := newTestEpson(t, "png")
+	// Single density with control codes as data, then a character
+	e.writeBytes([]uint8{asciiESC, 'K', 3, 0, 0x80, asciiCR, 0x01, 'A'})
+
+	if !inkAt(e, 0, 0) {
+		t.Error("The top pin of the first column should print")
+	}
+	if !inkAt(e, 12, 4*pinSpacing) || !inkAt(e, 12, 5*pinSpacing) || inkAt(e, 12, 6*pinSpacing) {
+		t.Error("The data bytes should not be interpreted as control codes")
+	}
+	if !inkAt(e, 24, 7*pinSpacing) {
+		t.Error("The bottom pin of the third column should print")
+	}
+	if !inkAt(e, 36+3*12, 0) {
+		t.Error("The text should continue after the graphics")
+	}
+
+	// ESC * with 240 dpi
+	e.writeBytes([]uint8{'\r', '\n', asciiESC, '*', 3, 2, 0, 0x80, 0x80})
+	if !inkAt(e, 0, 36) || !inkAt(e, 3, 36) || inkAt(e, 12, 36) {
+		t.Error("The quadruple density columns should be 1/240 inch apart")
+	}
+}
+
+func TestEpsonPNGPages(t *testing.T) {
+	e := newTestEpson(t, "png")
+	e.writeBytes([]uint8("PAGE 1\f\fPAGE 2"))
+	err := e.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := e.Files()
+	if len(files) != 2 {
+		t.Fatalf("Two pages should be printed, the blank page is not saved, got %v", files)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 1836 || img.Bounds().Dy() != 2376 {
+		t.Errorf("The page should be letter size at 216 dpi, got %v", img.Bounds())
+	}
+}
+
+func TestEpsonPDF(t *testing.T) {
+	e := newTestEpson(t, "pdf")
+	e.writeBytes([]uint8("PAGE 1\fPAGE 2\f"))
+	e.Close()
+
+	files := e.Files()
+	if len(files) != 1 {
+		t.Fatalf("A single PDF document should be created, got %v", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []uint8("%PDF-")) || !bytes.Contains(data, []uint8("/Count 2")) {
+		t.Error("The PDF document should have two pages")
+	}
+}
+
+func TestEpsonHighBitText(t *testing.T) {
+	e := newTestEpson(t, "png")
+	e.writeBytes([]uint8{'A' | 0x80})
+
+	if !inkAt(e, 3*12, 0) || !inkAt(e, 3*12, 7*pinSpacing) {
+		t.Error("The character with the MSB set should be printed upright")
+	}
+
+	e = newTestEpson(t, "png")
+	e.SetHighBitItalic(true)
+	e.writeBytes([]uint8{'A' | 0x80})
+
+	if inkAt(e, 3*12, 0) || !inkAt(e, 3*12, 7*pinSpacing) {
+		t.Error("The character with the MSB set should be printed in italics")
+	}
+}
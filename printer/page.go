@@ -0,0 +1,136 @@
+package printer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+)
+
+/*
+Bitmap of a printed page. The page is rendered at 216 dots per inch, the
+vertical resolution of the Epson printers. The horizontal positions are
+given in 1/720 inch to be exact for all the graphic densities.
+*/
+
+const (
+	pageDPI          = 216
+	pageWidthInches  = 8.5
+	pageHeightInches = 11
+	pageMarginX      = pageDPI / 4 // Printable area starts at 1/4 inch
+	unitsPerInchX    = 720
+	dotSize          = 3 // A pin makes dots of about 1/72 inch
+)
+
+type page struct {
+	img   *image.Gray
+	dirty bool
+}
+
+func newPage() *page {
+	var p page
+	p.img = image.NewGray(image.Rect(0, 0, pageWidthInches*pageDPI, pageHeightInches*pageDPI))
+	for i := range p.img.Pix {
+		p.img.Pix[i] = 0xff
+	}
+	return &p
+}
+
+// dot prints a dot centered on x, in 1/720 inch, and y, in 1/216 inch
+func (p *page) dot(x int, y float64) {
+	px := pageMarginX + x*pageDPI/unitsPerInchX - dotSize/2
+	py := int(y+0.5) - dotSize/2
+	for i := 0; i < dotSize; i++ {
+		for j := 0; j < dotSize; j++ {
+			p.img.SetGray(px+i, py+j, color.Gray{0})
+		}
+	}
+	p.dirty = true
+}
+
+func (p *page) isInk(px, py int) bool {
+	return p.img.GrayAt(px, py).Y == 0
+}
+
+func (p *page) savePNG(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, p.img)
+}
+
+// pdfImage returns the page as 1 bit per pixel compressed with zlib,
+// 0 is black as expected by the DeviceGray color space
+func (p *page) pdfImage() []uint8 {
+	bounds := p.img.Bounds()
+	rowBytes := (bounds.Dx() + 7) / 8
+	packed := make([]uint8, rowBytes*bounds.Dy())
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			if !p.isInk(x, y) {
+				packed[y*rowBytes+x/8] |= 0x80 >> (x % 8)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(packed)
+	w.Close()
+	return buf.Bytes()
+}
+
+// writePDF stores the pages images on a PDF document, one page each
+func writePDF(filename string, images [][]uint8) error {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(content string, stream []uint8) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%v 0 obj\n%v\n", len(offsets), content)
+		if stream != nil {
+			buf.WriteString("stream\n")
+			buf.Write(stream)
+			buf.WriteString("\nendstream\n")
+		}
+		buf.WriteString("endobj\n")
+	}
+
+	width := pageWidthInches * pageDPI
+	height := pageHeightInches * pageDPI
+	pointsWidth := pageWidthInches * 72
+	pointsHeight := pageHeightInches * 72
+
+	buf.WriteString("%PDF-1.4\n")
+	kids := ""
+	for i := range images {
+		// Each page uses 3 objects after the catalog and the pages tree
+		kids += fmt.Sprintf("%v 0 R ", 3+i*3)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%v] /Count %v >>", kids, len(images)), nil)
+	for i, data := range images {
+		pageObject := 3 + i*3
+		content := fmt.Sprintf("q %v 0 0 %v 0 0 cm /Im Do Q", pointsWidth, pointsHeight)
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %v %v] "+
+			"/Resources << /XObject << /Im %v 0 R >> >> /Contents %v 0 R >>",
+			pointsWidth, pointsHeight, pageObject+1, pageObject+2), nil)
+		object(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %v /Height %v "+
+			"/ColorSpace /DeviceGray /BitsPerComponent 1 /Filter /FlateDecode /Length %v >>",
+			width, height, len(data)), data)
+		object(fmt.Sprintf("<< /Length %v >>", len(content)), []uint8(content))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %v\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %v /Root 1 0 R >>\nstartxref\n%v\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return os.WriteFile(filename, buf.Bytes(), 0644)
+}
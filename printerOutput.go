@@ -0,0 +1,90 @@
+package izapple2
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ivanizag/izapple2/printer"
+)
+
+/*
+Printer connected to a printer interface card. It can be:
+	raw: the bytes received are appended to a file
+	epson: an Epson FX-80 rendering the pages as PNG files or as a PDF document
+*/
+
+type printerOutput struct {
+	file  *os.File
+	epson *printer.Epson
+	ascii bool
+}
+
+// printerOutputParams are the params of the cards to configure the printer
+var printerOutputParams = []paramSpec{
+	{"printer", "Printer connected: raw to store the bytes received, epson to render the pages", "raw"},
+	{"file", "File to store the printed code with the raw printer", "printer.out"},
+	{"dir", "Directory to store the pages printed with the epson printer", "printouts"},
+	{"format", "Format of the pages printed with the epson printer: png or pdf", "png"},
+	{"ascii", "Remove the 7 bit. Useful for normal text printing, but breaks graphics printing ", "false"},
+	{"italics", "Print the characters with the 7 bit set in italics with the epson printer", "false"},
+}
+
+func newPrinterOutput(params map[string]string) (*printerOutput, error) {
+	var p printerOutput
+	p.ascii = paramsGetBool(params, "ascii")
+	switch paramsGetString(params, "printer") {
+	case "raw":
+		filepath := paramsGetPath(params, "file")
+		f, err := os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		p.file = f
+	case "epson":
+		font, err := newPrinterFont()
+		if err != nil {
+			return nil, err
+		}
+		p.epson, err = printer.NewEpson(font, paramsGetPath(params, "dir"), paramsGetString(params, "format"))
+		if err != nil {
+			return nil, err
+		}
+		p.epson.SetHighBitItalic(paramsGetBool(params, "italics"))
+	default:
+		return nil, fmt.Errorf("invalid printer '%v', it must be raw or epson", paramsGetString(params, "printer"))
+	}
+	return &p, nil
+}
+
+// newPrinterFont uses the characters of the Apple IIe as the dot matrix
+// font of the printer
+func newPrinterFont() (printer.Font, error) {
+	cg, err := newCharacterGenerator("<internal>/Apple IIe Video Enhanced.bin", charGenColumnsMap2e, charGenPageSize2E)
+	if err != nil {
+		return nil, err
+	}
+	return func(char uint8, row int, column int) bool {
+		// The normal characters are inverted on $80 to $ff
+		return !cg.getPixel(0x80|char, row, column)
+	}, nil
+}
+
+func (p *printerOutput) write(value uint8) {
+	if p.ascii {
+		// As text the MSB has to be removed, but if done, graphics modes won't work
+		value &= 0x7f // Remove the MSB bit
+	}
+	if p.epson != nil {
+		p.epson.Write(value)
+	} else {
+		p.file.Write([]byte{value})
+	}
+}
+
+func (p *printerOutput) close() {
+	if p.epson != nil {
+		p.epson.Close()
+	} else {
+		p.file.Close()
+	}
+}
@@ -0,0 +1,483 @@
+package prodos
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+The directories are a linked list of blocks with 13 entries of 39 bytes.
+The first entry of the first block is the header of the directory.
+*/
+
+const (
+	directoryHeaderOffset = 4
+	entryLength           = 0x27
+	entriesPerBlock       = 0x0d
+	maxNameLength         = 15
+	accessDefault         = 0xc3 // Destroy, rename, write and read enabled
+	subdirectoryMagic     = 0x75 // Required by ProDOS on the subdirectory headers
+
+	storageDeleted         = 0x0
+	storageSeedling        = 0x1
+	storageSapling         = 0x2
+	storageTree            = 0x3
+	storageExtended        = 0x5
+	storageSubdirectory    = 0xd
+	storageSubdirHeader    = 0xe
+	storageVolumeHeader    = 0xf
+	maxDirectoryBlockChain = maxBlocks
+	maxDirectoryDepth      = 64 // Stops the loops on corrupt volumes, valid paths are never that deep
+)
+
+// FileEntry is a file or subdirectory on a directory
+type FileEntry struct {
+	Name        string
+	StorageType uint8
+	FileType    uint8
+	AuxType     uint16
+	KeyBlock    uint16
+	BlocksUsed  uint16
+	EOF         uint32
+	Access      uint8
+	Created     time.Time
+	Modified    time.Time
+
+	// Location of the entry
+	block  uint16
+	index  int
+	header uint16 // Key block of the directory
+}
+
+// IsDir returns true for subdirectories
+func (e *FileEntry) IsDir() bool {
+	return e.StorageType == storageSubdirectory
+}
+
+func (e *FileEntry) String() string {
+	return fmt.Sprintf("%-15s %-4s $%04x %6v %5v", e.Name, FileTypeName(e.FileType), e.AuxType, e.EOF, e.BlocksUsed)
+}
+
+func parseEntry(data []uint8) FileEntry {
+	var e FileEntry
+	e.StorageType = data[0] >> 4
+	e.Name = string(data[1 : 1+data[0]&0x0f])
+	e.FileType = data[0x10]
+	e.KeyBlock = getWord(data[0x11:])
+	e.BlocksUsed = getWord(data[0x13:])
+	e.EOF = uint32(data[0x15]) | uint32(data[0x16])<<8 | uint32(data[0x17])<<16
+	e.Created = getDateTime(data[0x18:])
+	e.Access = data[0x1e]
+	e.AuxType = getWord(data[0x1f:])
+	e.Modified = getDateTime(data[0x21:])
+	return e
+}
+
+func (e *FileEntry) encode(data []uint8) {
+	clear(data[:entryLength])
+	data[0] = e.StorageType<<4 | uint8(len(e.Name))
+	copy(data[1:], e.Name)
+	data[0x10] = e.FileType
+	putWord(data[0x11:], e.KeyBlock)
+	putWord(data[0x13:], e.BlocksUsed)
+	data[0x15] = uint8(e.EOF)
+	data[0x16] = uint8(e.EOF >> 8)
+	data[0x17] = uint8(e.EOF >> 16)
+	putDateTime(data[0x18:], e.Created)
+	data[0x1e] = e.Access
+	putWord(data[0x1f:], e.AuxType)
+	putDateTime(data[0x21:], e.Modified)
+	putWord(data[0x25:], e.header)
+}
+
+// directoryBlocks returns the chain of blocks of a directory
+func (v *Volume) directoryBlocks(key uint16) ([]uint16, error) {
+	var blocks []uint16
+	for next := key; next != 0; {
+		if len(blocks) > maxDirectoryBlockChain || next >= v.totalBlocks {
+			return nil, errors.New("invalid directory block chain")
+		}
+		blocks = append(blocks, next)
+		block, err := v.readBlock(next)
+		if err != nil {
+			return nil, err
+		}
+		next = getWord(block[2:])
+	}
+	return blocks, nil
+}
+
+// forEachEntry calls f for every slot of the directory, used or not
+func (v *Volume) forEachEntry(key uint16, f func(block uint16, index int, data []uint8) (bool, error)) error {
+	blocks, err := v.directoryBlocks(key)
+	if err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		block, err := v.readBlock(b)
+		if err != nil {
+			return err
+		}
+		for i := range entriesPerBlock {
+			if b == key && i == 0 {
+				continue // Header
+			}
+			offset := directoryHeaderOffset + i*entryLength
+			done, err := f(b, i, block[offset:offset+entryLength])
+			if err != nil || done {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *Volume) readDirectory(key uint16) ([]FileEntry, error) {
+	var entries []FileEntry
+	err := v.forEachEntry(key, func(block uint16, index int, data []uint8) (bool, error) {
+		if data[0]>>4 != storageDeleted {
+			e := parseEntry(data)
+			e.block = block
+			e.index = index
+			e.header = key
+			entries = append(entries, e)
+		}
+		return false, nil
+	})
+	return entries, err
+}
+
+func splitPath(path string) []string {
+	var parts []string
+	for _, p := range strings.Split(path, "/") {
+		if p != "" {
+			parts = append(parts, strings.ToUpper(p))
+		}
+	}
+	return parts
+}
+
+// findDirectory returns the key block of the directory of the path
+func (v *Volume) findDirectory(parts []string) (uint16, error) {
+	key := uint16(volumeDirectoryBlock)
+	for i, name := range parts {
+		e, err := v.findEntry(key, name)
+		if err != nil {
+			return 0, err
+		}
+		if e == nil {
+			return 0, fmt.Errorf("%v not found", strings.Join(parts[:i+1], "/"))
+		}
+		if !e.IsDir() {
+			return 0, fmt.Errorf("%v is not a directory", strings.Join(parts[:i+1], "/"))
+		}
+		key = e.KeyBlock
+	}
+	return key, nil
+}
+
+func (v *Volume) findEntry(key uint16, name string) (*FileEntry, error) {
+	entries, err := v.readDirectory(key)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Name == name {
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+// ReadDir returns the entries of a directory, the path "" or "/" is the volume directory
+func (v *Volume) ReadDir(path string) ([]FileEntry, error) {
+	key, err := v.findDirectory(splitPath(path))
+	if err != nil {
+		return nil, err
+	}
+	return v.readDirectory(key)
+}
+
+// Stat returns the entry for a path
+func (v *Volume) Stat(path string) (*FileEntry, error) {
+	parts := splitPath(path)
+	if len(parts) == 0 {
+		return nil, errors.New("the volume directory has no entry")
+	}
+	key, err := v.findDirectory(parts[:len(parts)-1])
+	if err != nil {
+		return nil, err
+	}
+	e, err := v.findEntry(key, parts[len(parts)-1])
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, fmt.Errorf("%v not found", path)
+	}
+	return e, nil
+}
+
+// newEntry adds an entry to a directory, growing it if needed
+func (v *Volume) newEntry(key uint16, e *FileEntry) error {
+	existing, err := v.findEntry(key, e.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("%v already exists", e.Name)
+	}
+
+	found := false
+	err = v.forEachEntry(key, func(block uint16, index int, data []uint8) (bool, error) {
+		if data[0]>>4 == storageDeleted {
+			e.block = block
+			e.index = index
+			found = true
+		}
+		return found, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		if key == volumeDirectoryBlock {
+			return errors.New("the volume directory is full")
+		}
+		err = v.growDirectory(key)
+		if err != nil {
+			return err
+		}
+		return v.newEntry(key, e)
+	}
+
+	e.header = key
+	err = v.writeEntry(e)
+	if err != nil {
+		return err
+	}
+	return v.updateFileCount(key, 1)
+}
+
+// newEntryBlocks returns the blocks needed to grow the directory for a new entry
+func (v *Volume) newEntryBlocks(key uint16) (int, error) {
+	if key == volumeDirectoryBlock {
+		return 0, nil
+	}
+	free := false
+	err := v.forEachEntry(key, func(block uint16, index int, data []uint8) (bool, error) {
+		free = data[0]>>4 == storageDeleted
+		return free, nil
+	})
+	if err != nil || free {
+		return 0, err
+	}
+	return 1, nil
+}
+
+func (v *Volume) writeEntry(e *FileEntry) error {
+	block, err := v.readBlock(e.block)
+	if err != nil {
+		return err
+	}
+	offset := directoryHeaderOffset + e.index*entryLength
+	e.encode(block[offset:])
+	return v.writeBlock(e.block, block)
+}
+
+func (v *Volume) updateFileCount(key uint16, delta int) error {
+	block, err := v.readBlock(key)
+	if err != nil {
+		return err
+	}
+	header := block[directoryHeaderOffset:]
+	putWord(header[0x21:], uint16(int(getWord(header[0x21:]))+delta))
+	return v.writeBlock(key, block)
+}
+
+// growDirectory adds a block to a subdirectory
+func (v *Volume) growDirectory(key uint16) error {
+	blocks, err := v.directoryBlocks(key)
+	if err != nil {
+		return err
+	}
+	last := blocks[len(blocks)-1]
+	allocated, err := v.allocate(1)
+	if err != nil {
+		return err
+	}
+
+	block := make([]uint8, blockSize)
+	putWord(block[0:], last)
+	err = v.writeBlock(allocated[0], block)
+	if err != nil {
+		return err
+	}
+
+	block, err = v.readBlock(last)
+	if err != nil {
+		return err
+	}
+	putWord(block[2:], allocated[0])
+	err = v.writeBlock(last, block)
+	if err != nil {
+		return err
+	}
+
+	// Update the size on the entry of the parent directory
+	header, err := v.readBlock(key)
+	if err != nil {
+		return err
+	}
+	parentBlock := getWord(header[directoryHeaderOffset+0x23:])
+	parentIndex := int(header[directoryHeaderOffset+0x25]) - 1 // The entry numbers start at 1
+	parent, err := v.readBlock(parentBlock)
+	if err != nil {
+		return err
+	}
+	entry := parent[directoryHeaderOffset+parentIndex*entryLength:]
+	putWord(entry[0x13:], uint16(len(blocks)+1))
+	eof := (len(blocks) + 1) * blockSize
+	entry[0x15] = uint8(eof)
+	entry[0x16] = uint8(eof >> 8)
+	entry[0x17] = uint8(eof >> 16)
+	return v.writeBlock(parentBlock, parent)
+}
+
+// Mkdir creates a subdirectory
+func (v *Volume) Mkdir(path string) error {
+	parts := splitPath(path)
+	if len(parts) == 0 {
+		return errors.New("the volume directory already exists")
+	}
+	name, err := normalizeName(parts[len(parts)-1])
+	if err != nil {
+		return err
+	}
+	key, err := v.findDirectory(parts[:len(parts)-1])
+	if err != nil {
+		return err
+	}
+
+	allocated, err := v.allocate(1)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	e := FileEntry{
+		Name:        name,
+		StorageType: storageSubdirectory,
+		FileType:    FileTypeDIR,
+		KeyBlock:    allocated[0],
+		BlocksUsed:  1,
+		EOF:         uint32(blockSize),
+		Access:      accessDefault,
+		Created:     now,
+		Modified:    now,
+	}
+	err = v.newEntry(key, &e)
+	if err != nil {
+		v.release(allocated)
+		return err
+	}
+
+	block := make([]uint8, blockSize)
+	header := block[directoryHeaderOffset:]
+	header[0] = storageSubdirHeader<<4 | uint8(len(name))
+	copy(header[1:], name)
+	header[0x10] = subdirectoryMagic
+	putDateTime(header[0x18:], now)
+	header[0x1e] = accessDefault
+	header[0x1f] = entryLength
+	header[0x20] = entriesPerBlock
+	putWord(header[0x23:], e.block)
+	header[0x25] = uint8(e.index + 1)
+	header[0x26] = entryLength
+	return v.writeBlock(e.KeyBlock, block)
+}
+
+// Delete removes a file or an empty subdirectory
+func (v *Volume) Delete(path string) error {
+	e, err := v.Stat(path)
+	if err != nil {
+		return err
+	}
+	if v.disk.IsReadOnly() {
+		return errors.New("the disk is read only")
+	}
+
+	var blocks []uint16
+	if e.IsDir() {
+		entries, err := v.readDirectory(e.KeyBlock)
+		if err != nil {
+			return err
+		}
+		if len(entries) != 0 {
+			return fmt.Errorf("the directory %v is not empty", path)
+		}
+		blocks, err = v.directoryBlocks(e.KeyBlock)
+		if err != nil {
+			return err
+		}
+	} else {
+		blocks, err = v.fileBlocks(e)
+		if err != nil {
+			return err
+		}
+	}
+
+	block, err := v.readBlock(e.block)
+	if err != nil {
+		return err
+	}
+	block[directoryHeaderOffset+e.index*entryLength] = storageDeleted
+	err = v.writeBlock(e.block, block)
+	if err != nil {
+		return err
+	}
+	err = v.updateFileCount(e.header, -1)
+	if err != nil {
+		return err
+	}
+	return v.release(blocks)
+}
+
+// MetadataBlocks returns the blocks of the directories and the bitmap
+func (v *Volume) MetadataBlocks() ([]uint16, error) {
+	var blocks []uint16
+	bitmapBlocks := (int(v.totalBlocks) + bitsPerBitmapBlock - 1) / bitsPerBitmapBlock
+	for i := range bitmapBlocks {
+		blocks = append(blocks, v.bitmapBlock+uint16(i))
+	}
+
+	var walk func(key uint16, depth int) error
+	walk = func(key uint16, depth int) error {
+		if depth > maxDirectoryDepth {
+			return errors.New("too many nested directories")
+		}
+		chain, err := v.directoryBlocks(key)
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, chain...)
+		entries, err := v.readDirectory(key)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				err = walk(e.KeyBlock, depth+1)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	err := walk(volumeDirectoryBlock, 0)
+	return blocks, err
+}
@@ -0,0 +1,289 @@
+package prodos
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+The data of the files is stored depending on the size:
+	Seedling: up to 512 bytes, the key block has the data.
+	Sapling: up to 128KB, the key block is an index with up to 256 blocks.
+	Tree: up to 16MB, the key block is a master index with up to 128 indexes.
+The index blocks have the low byte of the block numbers on the first half
+and the high byte on the second half. A zero block number is a sparse block
+full of zeros.
+*/
+
+const (
+	pointersPerIndex = blockSize / 2
+	maxTreeIndexes   = 128
+	maxFileSize      = 0xffffff // EOF has 3 bytes
+)
+
+func getIndex(index []uint8, i int) uint16 {
+	return uint16(index[i]) | uint16(index[pointersPerIndex+i])<<8
+}
+
+func putIndex(index []uint8, i int, block uint16) {
+	index[i] = uint8(block)
+	index[pointersPerIndex+i] = uint8(block >> 8)
+}
+
+// dataBlocks returns the data blocks of a file in order, with zero for the
+// sparse blocks, and the index blocks
+func (v *Volume) dataBlocks(e *FileEntry) ([]uint16, []uint16, error) {
+	count := max(1, (int(e.EOF)+blockSize-1)/blockSize)
+	var data []uint16
+	var indexes []uint16
+
+	readIndex := func(block uint16, limit int) error {
+		if block == 0 {
+			// Sparse index, all the data blocks are sparse
+			for i := 0; i < pointersPerIndex && len(data) < limit; i++ {
+				data = append(data, 0)
+			}
+			return nil
+		}
+		indexes = append(indexes, block)
+		index, err := v.readBlock(block)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < pointersPerIndex && len(data) < limit; i++ {
+			data = append(data, getIndex(index, i))
+		}
+		return nil
+	}
+
+	switch e.StorageType {
+	case storageSeedling:
+		data = append(data, e.KeyBlock)
+
+	case storageSapling:
+		err := readIndex(e.KeyBlock, count)
+		if err != nil {
+			return nil, nil, err
+		}
+
+	case storageTree:
+		indexes = append(indexes, e.KeyBlock)
+		master, err := v.readBlock(e.KeyBlock)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := 0; i < maxTreeIndexes && len(data) < count; i++ {
+			err = readIndex(getIndex(master, i), count)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+	case storageExtended:
+		return nil, nil, errors.New("files with resource forks are not supported")
+
+	default:
+		return nil, nil, fmt.Errorf("storage type %v not supported", e.StorageType)
+	}
+
+	for _, b := range data {
+		if b >= v.totalBlocks {
+			return nil, nil, errors.New("invalid block number on the file index")
+		}
+	}
+	return data, indexes, nil
+}
+
+// fileBlocks returns all the blocks used by a file
+func (v *Volume) fileBlocks(e *FileEntry) ([]uint16, error) {
+	data, indexes, err := v.dataBlocks(e)
+	if err != nil {
+		return nil, err
+	}
+	blocks := indexes
+	for _, b := range data {
+		if b != 0 {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks, nil
+}
+
+// DataBlocks returns the data blocks of a file in order, with zero for the
+// sparse blocks
+func (v *Volume) DataBlocks(path string) ([]uint16, error) {
+	e, err := v.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if e.IsDir() {
+		return nil, fmt.Errorf("%v is a directory", path)
+	}
+	blocks, _, err := v.dataBlocks(e)
+	return blocks, err
+}
+
+// ReadFile returns the contents of a file and its entry with the type and aux type
+func (v *Volume) ReadFile(path string) ([]uint8, *FileEntry, error) {
+	e, err := v.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if e.IsDir() {
+		return nil, nil, fmt.Errorf("%v is a directory", path)
+	}
+
+	blocks, _, err := v.dataBlocks(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	data := make([]uint8, 0, len(blocks)*blockSize)
+	for _, b := range blocks {
+		if b == 0 {
+			data = append(data, make([]uint8, blockSize)...)
+			continue
+		}
+		block, err := v.readBlock(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = append(data, block...)
+	}
+	if int(e.EOF) > len(data) {
+		return nil, nil, fmt.Errorf("the EOF of %v is beyond its blocks", path)
+	}
+	return data[:e.EOF], e, nil
+}
+
+// WriteFile creates a file with the data, replacing the file if it exists
+func (v *Volume) WriteFile(path string, data []uint8, fileType uint8, auxType uint16) error {
+	parts := splitPath(path)
+	if len(parts) == 0 {
+		return errors.New("a file name is needed")
+	}
+	name, err := normalizeName(parts[len(parts)-1])
+	if err != nil {
+		return err
+	}
+	if len(data) > maxFileSize {
+		return errors.New("the file is too big")
+	}
+	key, err := v.findDirectory(parts[:len(parts)-1])
+	if err != nil {
+		return err
+	}
+
+	count := max(1, (len(data)+blockSize-1)/blockSize)
+	storageType := uint8(storageSeedling)
+	indexCount := 0
+	switch {
+	case count > pointersPerIndex:
+		storageType = storageTree
+		indexCount = 1 + (count+pointersPerIndex-1)/pointersPerIndex
+	case count > 1:
+		storageType = storageSapling
+		indexCount = 1
+	}
+
+	// The space is checked before deleting the file replaced, counting the
+	// blocks it will free. A new file may need a block to grow the directory.
+	existing, err := v.findEntry(key, name)
+	if err != nil {
+		return err
+	}
+	available, err := v.FreeBlocks()
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.IsDir() {
+		return fmt.Errorf("%v is a directory", path)
+	}
+	needed := count + indexCount
+	if existing == nil {
+		entryBlocks, err := v.newEntryBlocks(key)
+		if err != nil {
+			return err
+		}
+		needed += entryBlocks
+	} else {
+		freed, err := v.fileBlocks(existing)
+		if err != nil {
+			return err
+		}
+		available += len(freed)
+	}
+	if available < needed {
+		return fmt.Errorf("disk full, %v blocks needed and %v available", needed, available)
+	}
+	if existing != nil {
+		err = v.Delete(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	blocks, err := v.allocate(count + indexCount)
+	if err != nil {
+		return err
+	}
+	indexes := blocks[:indexCount]
+	dataBlocks := blocks[indexCount:]
+
+	// Data
+	for i, b := range dataBlocks {
+		block := make([]uint8, blockSize)
+		copy(block, data[min(i*blockSize, len(data)):])
+		err = v.writeBlock(b, block)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Indexes
+	switch storageType {
+	case storageSapling:
+		index := make([]uint8, blockSize)
+		for i, b := range dataBlocks {
+			putIndex(index, i, b)
+		}
+		err = v.writeBlock(indexes[0], index)
+	case storageTree:
+		master := make([]uint8, blockSize)
+		for i, indexBlock := range indexes[1:] {
+			putIndex(master, i, indexBlock)
+			index := make([]uint8, blockSize)
+			for j, b := range dataBlocks[i*pointersPerIndex : min((i+1)*pointersPerIndex, count)] {
+				putIndex(index, j, b)
+			}
+			err = v.writeBlock(indexBlock, index)
+			if err != nil {
+				return err
+			}
+		}
+		err = v.writeBlock(indexes[0], master)
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	e := FileEntry{
+		Name:        name,
+		StorageType: storageType,
+		FileType:    fileType,
+		AuxType:     auxType,
+		KeyBlock:    blocks[0],
+		BlocksUsed:  uint16(len(blocks)),
+		EOF:         uint32(len(data)),
+		Access:      accessDefault,
+		Created:     now,
+		Modified:    now,
+	}
+	err = v.newEntry(key, &e)
+	if err != nil {
+		v.release(blocks)
+		return err
+	}
+	return nil
+}
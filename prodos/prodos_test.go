@@ -0,0 +1,328 @@
+package prodos
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ivanizag/izapple2/storage"
+)
+
+func newTestVolume(t *testing.T, blocks int) *Volume {
+	disk, err := storage.NewBlockDiskMemoryWriteable(make([]uint8, blocks*blockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := Format(disk, "test.vol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func testData(size int) []uint8 {
+	data := make([]uint8, size)
+	for i := range data {
+		data[i] = uint8(i*13 + i/blockSize)
+	}
+	return data
+}
+
+func TestFormat(t *testing.T) {
+	v := newTestVolume(t, 280)
+	reopened, err := Open(v.disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Name() != "TEST.VOL" {
+		t.Errorf("unexpected volume name %v", reopened.Name())
+	}
+	free, err := reopened.FreeBlocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if free != 280-7 {
+		t.Errorf("expected %v free blocks, got %v", 280-7, free)
+	}
+}
+
+func TestWriteAndReadFiles(t *testing.T) {
+	v := newTestVolume(t, 1600)
+	initialFree, _ := v.FreeBlocks()
+
+	sizes := map[string]int{
+		"EMPTY":    0,
+		"SEEDLING": 300,
+		"SAPLING":  20000,
+		"TREE":     200000,
+	}
+	for name, size := range sizes {
+		err := v.WriteFile("/"+name, testData(size), FileTypeBIN, 0x2000)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := v.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(sizes) {
+		t.Errorf("expected %v entries, got %v", len(sizes), len(entries))
+	}
+
+	for name, size := range sizes {
+		data, e, err := v.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, testData(size)) {
+			t.Errorf("the data of %v differs", name)
+		}
+		if e.FileType != FileTypeBIN || e.AuxType != 0x2000 {
+			t.Errorf("unexpected type for %v: %v", name, e)
+		}
+	}
+
+	for name := range sizes {
+		err = v.Delete(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	free, _ := v.FreeBlocks()
+	if free != initialFree {
+		t.Errorf("expected %v free blocks after deleting, got %v", initialFree, free)
+	}
+}
+
+func TestSubdirectories(t *testing.T) {
+	v := newTestVolume(t, 280)
+	err := v.Mkdir("DIR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.Mkdir("dir/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// More files than fit on a directory block
+	for i := range 30 {
+		name := "DIR/SUB/F" + string(rune('A'+i/10)) + string(rune('0'+i%10))
+		err = v.WriteFile(name, testData(i), FileTypeTXT, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := v.ReadDir("DIR/SUB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 30 {
+		t.Errorf("expected 30 entries, got %v", len(entries))
+	}
+	sub, err := v.Stat("DIR/SUB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.BlocksUsed != 3 {
+		t.Errorf("expected the subdirectory to use 3 blocks, got %v", sub.BlocksUsed)
+	}
+
+	err = v.Delete("DIR/SUB")
+	if err == nil {
+		t.Error("a directory with files can't be deleted")
+	}
+	err = v.WriteFile("DIR/SUB/FA0", []uint8("replaced"), FileTypeTXT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, err := v.ReadFile("DIR/SUB/FA0")
+	if err != nil || string(data) != "replaced" {
+		t.Errorf("the file was not replaced: %q %v", data, err)
+	}
+}
+
+func TestDosOrderImage(t *testing.T) {
+	data := make([]uint8, 280*blockSize)
+	raw, err := storage.NewBlockDiskMemoryWriteable(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk, err := storage.NewBlockDiskDosOrder(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := Format(disk, "DOSORDER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.WriteFile("HELLO", []uint8("hello"), FileTypeTXT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The volume directory key block 2 is on the DOS sectors 0x0b and 0x0a of track 0
+	if data[0x0b*256+4]>>4 != storageVolumeHeader {
+		t.Error("the volume header is not on DOS sector 0x0b")
+	}
+
+	read, _, err := v.ReadFile("HELLO")
+	if err != nil || string(read) != "hello" {
+		t.Errorf("unexpected content %q %v", read, err)
+	}
+}
+
+func TestNames(t *testing.T) {
+	for _, name := range []string{"", "1ABC", "A B", "ABCDEFGHIJKLMNOP"} {
+		_, err := normalizeName(name)
+		if err == nil {
+			t.Errorf("%q should be invalid", name)
+		}
+	}
+	name, err := normalizeName("hello.s2")
+	if err != nil || name != "HELLO.S2" {
+		t.Errorf("unexpected %v %v", name, err)
+	}
+}
+
+func TestReadProDOSImage(t *testing.T) {
+	disk, err := storage.OpenBlockDiskImage("../resources/ProDOS_2_4_3.po", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := Open(disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := v.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, e := range entries {
+		if e.Name == "PRODOS" {
+			found = true
+			if e.FileType != FileTypeSYS {
+				t.Errorf("PRODOS should be a system file: %v", e.String())
+			}
+			data, _, err := v.ReadFile(e.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) != int(e.EOF) {
+				t.Errorf("expected %v bytes, got %v", e.EOF, len(data))
+			}
+		}
+	}
+	if !found {
+		t.Error("PRODOS not found")
+	}
+}
+
+func TestReplaceOnFullDisk(t *testing.T) {
+	v := newTestVolume(t, 280)
+	original := testData(4 * blockSize) // 4 data blocks and an index
+	err := v.WriteFile("/KEEP", original, FileTypeBIN, 0x2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the disk leaving 2 free blocks
+	fileBlocks := func(n int) int {
+		if n > pointersPerIndex {
+			return n + 1 + (n+pointersPerIndex-1)/pointersPerIndex
+		}
+		return n + 1
+	}
+	free, _ := v.FreeBlocks()
+	n := free
+	for fileBlocks(n) > free-2 {
+		n--
+	}
+	err = v.WriteFile("/FILLER", testData(n*blockSize), FileTypeBIN, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if free, _ = v.FreeBlocks(); free != 2 {
+		t.Fatalf("expected 2 free blocks, got %v", free)
+	}
+
+	// 7 data blocks and an index don't fit on the 2+5 blocks available
+	err = v.WriteFile("/KEEP", testData(7*blockSize), FileTypeBIN, 0x2000)
+	if err == nil {
+		t.Fatal("the write should fail with the disk full")
+	}
+	data, _, err := v.ReadFile("/KEEP")
+	if err != nil {
+		t.Fatalf("the replaced file should be kept: %v", err)
+	}
+	if !bytes.Equal(data, original) {
+		t.Error("the replaced file changed")
+	}
+
+	// 6 data blocks and an index fit using the blocks of the old file
+	err = v.WriteFile("/KEEP", testData(6*blockSize), FileTypeBIN, 0x2000)
+	if err != nil {
+		t.Errorf("the write should use the blocks of the old file: %v", err)
+	}
+}
+
+func TestWriteOnFullDirectory(t *testing.T) {
+	v := newTestVolume(t, 200)
+	err := v.Mkdir("/DIR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range entriesPerBlock - 1 {
+		err = v.WriteFile(fmt.Sprintf("/DIR/F%v", i), []uint8{uint8(i)}, FileTypeBIN, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Fill the disk leaving a free block, the directory needs another
+	free, _ := v.FreeBlocks()
+	err = v.WriteFile("/FILLER", testData((free-2)*blockSize), FileTypeBIN, 0) // With an index block
+	if err != nil {
+		t.Fatal(err)
+	}
+	if free, _ = v.FreeBlocks(); free != 1 {
+		t.Fatalf("expected 1 free block, got %v", free)
+	}
+
+	err = v.WriteFile("/DIR/NEW", []uint8{1}, FileTypeBIN, 0)
+	if err == nil || !strings.Contains(err.Error(), "2 blocks needed") {
+		t.Errorf("the write should fail counting the directory block: %v", err)
+	}
+	if free, _ = v.FreeBlocks(); free != 1 {
+		t.Errorf("the blocks should be released, %v free", free)
+	}
+	if _, err = v.Stat("/DIR/NEW"); err == nil {
+		t.Error("the file should not be created")
+	}
+}
+
+func TestReadFileInvalidEOF(t *testing.T) {
+	v := newTestVolume(t, 280)
+	err := v.WriteFile("/SEED", []uint8{1, 2, 3}, FileTypeBIN, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := v.Stat("/SEED")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.EOF = uint32(2 * blockSize)
+	err = v.writeEntry(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = v.ReadFile("/SEED")
+	if err == nil {
+		t.Error("the read should fail with an EOF beyond the blocks")
+	}
+}
@@ -0,0 +1,99 @@
+package prodos
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Some ProDOS file types
+const (
+	FileTypeNone = uint8(0x00)
+	FileTypeTXT  = uint8(0x04)
+	FileTypeBIN  = uint8(0x06)
+	FileTypeDIR  = uint8(0x0f)
+	FileTypeINT  = uint8(0xfa)
+	FileTypeBAS  = uint8(0xfc)
+	FileTypeVAR  = uint8(0xfd)
+	FileTypeREL  = uint8(0xfe)
+	FileTypeSYS  = uint8(0xff)
+)
+
+var fileTypeNames = map[uint8]string{
+	FileTypeNone: "NON",
+	FileTypeTXT:  "TXT",
+	FileTypeBIN:  "BIN",
+	FileTypeDIR:  "DIR",
+	0xef:         "PAS",
+	0xf0:         "CMD",
+	FileTypeINT:  "INT",
+	0xfb:         "IVR",
+	FileTypeBAS:  "BAS",
+	FileTypeVAR:  "VAR",
+	FileTypeREL:  "REL",
+	FileTypeSYS:  "SYS",
+}
+
+// FileTypeName returns the three letters name of a file type, or $XX if unknown
+func FileTypeName(fileType uint8) string {
+	name, ok := fileTypeNames[fileType]
+	if !ok {
+		return fmt.Sprintf("$%02X", fileType)
+	}
+	return name
+}
+
+// ParseFileType accepts a three letters name of a file type or a number, as $XX, 0xXX or decimal
+func ParseFileType(s string) (uint8, error) {
+	s = strings.ToUpper(s)
+	for t, name := range fileTypeNames {
+		if name == s {
+			return t, nil
+		}
+	}
+	if strings.HasPrefix(s, "$") {
+		s = "0X" + s[1:]
+	}
+	value, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file type '%v'", s)
+	}
+	return uint8(value), nil
+}
+
+/*
+Dates are stored on two words:
+	Date: yyyyyyym mmmddddd
+	Time: 000hhhhh 00mmmmmm
+The years 0 to 39 are 2000 to 2039, as on ProDOS 2.5.
+*/
+
+func getDateTime(data []uint8) time.Time {
+	date := getWord(data)
+	if date == 0 {
+		return time.Time{}
+	}
+	year := int(date >> 9)
+	if year < 40 {
+		year += 2000
+	} else {
+		year += 1900
+	}
+	month := time.Month((date >> 5) & 0x0f)
+	day := int(date & 0x1f)
+	hour := int(data[3] & 0x1f)
+	minute := int(data[2] & 0x3f)
+	return time.Date(year, month, day, hour, minute, 0, 0, time.Local)
+}
+
+func putDateTime(data []uint8, t time.Time) {
+	if t.IsZero() {
+		clear(data[:4])
+		return
+	}
+	year := t.Year() % 100
+	putWord(data, uint16(year)<<9|uint16(t.Month())<<5|uint16(t.Day()))
+	data[2] = uint8(t.Minute())
+	data[3] = uint8(t.Hour())
+}
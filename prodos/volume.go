@@ -0,0 +1,268 @@
+package prodos
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ivanizag/izapple2/storage"
+)
+
+/*
+ProDOS filesystem on a block device, to access the disk images from the
+host.
+
+See:
+	Beneath Apple ProDOS, chapter 4 and appendix B.
+	ProDOS 8 Technical Reference Manual, appendix B. https://prodos8.com/docs/techref/file-organization/
+
+The volume directory starts on block 2 and uses 4 blocks. The bitmap with
+the free blocks follows. Blocks 0 and 1 are for the boot loader, they are
+left empty when formatting.
+*/
+
+const (
+	blockSize             = int(storage.ProDosBlockSize)
+	volumeDirectoryBlock  = 2
+	volumeDirectoryBlocks = 4
+	bitsPerBitmapBlock    = blockSize * 8
+	maxBlocks             = 65535
+)
+
+// Volume is a ProDOS filesystem on a block device
+type Volume struct {
+	disk        storage.BlockDisk
+	name        string
+	totalBlocks uint16
+	bitmapBlock uint16
+}
+
+// Open reads the ProDOS volume on the block device
+func Open(disk storage.BlockDisk) (*Volume, error) {
+	var v Volume
+	v.disk = disk
+
+	block, err := v.readBlock(volumeDirectoryBlock)
+	if err != nil {
+		return nil, err
+	}
+	header := block[directoryHeaderOffset:]
+	if header[0]>>4 != storageVolumeHeader {
+		return nil, errors.New("not a ProDOS volume")
+	}
+	v.name = string(header[1 : 1+header[0]&0x0f])
+	v.bitmapBlock = getWord(header[0x23:])
+	v.totalBlocks = getWord(header[0x25:])
+	if uint32(v.totalBlocks) > disk.GetSizeInBlocks() || v.bitmapBlock >= v.totalBlocks {
+		return nil, errors.New("invalid ProDOS volume header")
+	}
+	return &v, nil
+}
+
+// Format creates an empty ProDOS volume on the block device
+func Format(disk storage.BlockDisk, name string) (*Volume, error) {
+	name, err := normalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+	if disk.IsReadOnly() {
+		return nil, errors.New("the disk is read only")
+	}
+
+	var v Volume
+	v.disk = disk
+	v.name = name
+	v.totalBlocks = uint16(min(disk.GetSizeInBlocks(), maxBlocks))
+	v.bitmapBlock = volumeDirectoryBlock + volumeDirectoryBlocks
+	bitmapBlocks := (int(v.totalBlocks) + bitsPerBitmapBlock - 1) / bitsPerBitmapBlock
+	firstFree := int(v.bitmapBlock) + bitmapBlocks
+	if firstFree >= int(v.totalBlocks) {
+		return nil, errors.New("the disk is too small")
+	}
+
+	empty := make([]uint8, blockSize)
+	for i := range 2 {
+		err = v.writeBlock(uint16(i), empty)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Volume directory
+	for i := range volumeDirectoryBlocks {
+		block := make([]uint8, blockSize)
+		current := volumeDirectoryBlock + i
+		if i > 0 {
+			putWord(block[0:], uint16(current-1))
+		}
+		if i < volumeDirectoryBlocks-1 {
+			putWord(block[2:], uint16(current+1))
+		}
+		if i == 0 {
+			header := block[directoryHeaderOffset:]
+			header[0] = storageVolumeHeader<<4 | uint8(len(name))
+			copy(header[1:], name)
+			putDateTime(header[0x18:], time.Now())
+			header[0x1e] = accessDefault
+			header[0x1f] = entryLength
+			header[0x20] = entriesPerBlock
+			putWord(header[0x23:], v.bitmapBlock)
+			putWord(header[0x25:], v.totalBlocks)
+		}
+		err = v.writeBlock(uint16(current), block)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Bitmap, the blocks used by the boot loader, the directory and the bitmap are not free
+	for i := range bitmapBlocks {
+		block := make([]uint8, blockSize)
+		for bit := range bitsPerBitmapBlock {
+			n := i*bitsPerBitmapBlock + bit
+			if n >= firstFree && n < int(v.totalBlocks) {
+				block[bit/8] |= 0x80 >> (bit % 8)
+			}
+		}
+		err = v.writeBlock(v.bitmapBlock+uint16(i), block)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &v, nil
+}
+
+// Name returns the name of the volume
+func (v *Volume) Name() string {
+	return v.name
+}
+
+// TotalBlocks returns the size of the volume
+func (v *Volume) TotalBlocks() int {
+	return int(v.totalBlocks)
+}
+
+// FreeBlocks returns the number of blocks available
+func (v *Volume) FreeBlocks() (int, error) {
+	free := 0
+	err := v.forEachBitmapBlock(func(first int, block []uint8) (bool, error) {
+		for bit := range bitsPerBitmapBlock {
+			if first+bit < int(v.totalBlocks) && block[bit/8]&(0x80>>(bit%8)) != 0 {
+				free++
+			}
+		}
+		return false, nil
+	})
+	return free, err
+}
+
+func (v *Volume) readBlock(block uint16) ([]uint8, error) {
+	data, err := v.disk.Read(uint32(block))
+	if err != nil {
+		return nil, err
+	}
+	// Copy to avoid modifying the data of memory block disks
+	return append([]uint8(nil), data...), nil
+}
+
+func (v *Volume) writeBlock(block uint16, data []uint8) error {
+	return v.disk.Write(uint32(block), data)
+}
+
+func (v *Volume) forEachBitmapBlock(f func(first int, block []uint8) (bool, error)) error {
+	bitmapBlocks := (int(v.totalBlocks) + bitsPerBitmapBlock - 1) / bitsPerBitmapBlock
+	for i := range bitmapBlocks {
+		block, err := v.readBlock(v.bitmapBlock + uint16(i))
+		if err != nil {
+			return err
+		}
+		modified, err := f(i*bitsPerBitmapBlock, block)
+		if err != nil {
+			return err
+		}
+		if modified {
+			err = v.writeBlock(v.bitmapBlock+uint16(i), block)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// allocate marks as used and returns a number of free blocks
+func (v *Volume) allocate(count int) ([]uint16, error) {
+	if v.disk.IsReadOnly() {
+		return nil, errors.New("the disk is read only")
+	}
+	free, err := v.FreeBlocks()
+	if err != nil {
+		return nil, err
+	}
+	if free < count {
+		return nil, fmt.Errorf("disk full, %v blocks needed and %v available", count, free)
+	}
+
+	blocks := make([]uint16, 0, count)
+	err = v.forEachBitmapBlock(func(first int, block []uint8) (bool, error) {
+		modified := false
+		for bit := 0; bit < bitsPerBitmapBlock && len(blocks) < count; bit++ {
+			mask := uint8(0x80) >> (bit % 8)
+			if first+bit < int(v.totalBlocks) && block[bit/8]&mask != 0 {
+				block[bit/8] &^= mask
+				blocks = append(blocks, uint16(first+bit))
+				modified = true
+			}
+		}
+		return modified, nil
+	})
+	return blocks, err
+}
+
+// release marks the blocks as free
+func (v *Volume) release(blocks []uint16) error {
+	return v.forEachBitmapBlock(func(first int, block []uint8) (bool, error) {
+		modified := false
+		for _, b := range blocks {
+			bit := int(b) - first
+			if bit >= 0 && bit < bitsPerBitmapBlock {
+				block[bit/8] |= 0x80 >> (bit % 8)
+				modified = true
+			}
+		}
+		return modified, nil
+	})
+}
+
+// CheckName returns an error if the name is not a valid ProDOS name
+func CheckName(name string) error {
+	_, err := normalizeName(name)
+	return err
+}
+
+// normalizeName validates a ProDOS name and returns it in uppercase
+func normalizeName(name string) (string, error) {
+	name = strings.ToUpper(name)
+	if len(name) == 0 || len(name) > maxNameLength {
+		return "", fmt.Errorf("invalid name '%v', it must have 1 to 15 characters", name)
+	}
+	for i, c := range name {
+		valid := c >= 'A' && c <= 'Z' ||
+			i > 0 && (c >= '0' && c <= '9' || c == '.')
+		if !valid {
+			return "", fmt.Errorf("invalid name '%v', it must start with a letter followed by letters, digits or periods", name)
+		}
+	}
+	return name, nil
+}
+
+func getWord(data []uint8) uint16 {
+	return uint16(data[0]) | uint16(data[1])<<8
+}
+
+func putWord(data []uint8, value uint16) {
+	data[0] = uint8(value)
+	data[1] = uint8(value >> 8)
+}
@@ -0,0 +1,239 @@
+package izapple2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Log of the register writes to the AY-3-8913 of the Mockingboard and the
+Phasor, to play the music with other tools. The format is selected with
+the extension of the file:
+
+	.vgm: VGM 1.51 with an AY-3-8913, dual chip for the two PSGs. The
+		writes are timed in samples of 1/44100 seconds.
+	.ym: YM6 with the registers of the first PSG dumped on every 1/50
+		seconds frame, uncompressed and interleaved.
+
+See:
+
+	"VGM Specification", vgmrips
+	"YM file format", ST-Sound by Arnaud Carré
+
+VGM has room for two AY chips, the second pair of PSGs of the Phasor is
+not logged. The registers of the chips when the log starts are written
+first. The log is completed when the emulator ends.
+*/
+
+type psgLogger interface {
+	write(cycle uint64, chip int, reg uint8, value uint8)
+	close(cycle uint64) error
+}
+
+func newPsgLogger(filename string, clockMhz float64, startCycle uint64) (psgLogger, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext != ".vgm" && ext != ".ym" {
+		return nil, fmt.Errorf("unknown format for '%v', use a .vgm or .ym file", filename)
+	}
+
+	// Fail early if the file can't be created, it is written on close
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	if ext == ".vgm" {
+		return newPsgLoggerVgm(f, clockMhz, startCycle), nil
+	}
+	return newPsgLoggerYm(f, clockMhz, startCycle), nil
+}
+
+func writePsgLogFile(f *os.File, data []uint8) error {
+	_, err := f.Write(data)
+	errClose := f.Close()
+	if err == nil {
+		err = errClose
+	}
+	return err
+}
+
+const (
+	vgmSampleRate = 44100
+	vgmHeaderSize = 0x100
+
+	vgmCommandAY8910Write = 0xa0
+	vgmCommandWait        = 0x61
+	vgmCommandEnd         = 0x66
+
+	vgmAY8910DualChip = 0x40000000
+	vgmAY8913Type     = 0x02
+	vgmAY8910Legacy   = 0x01 // Default flags, legacy output
+)
+
+type psgLoggerVgm struct {
+	file            *os.File
+	clock           uint32
+	cyclesPerSample float64
+	startCycle      uint64
+	samples         uint64 // Samples waited so far
+	data            []uint8
+}
+
+func newPsgLoggerVgm(f *os.File, clockMhz float64, startCycle uint64) *psgLoggerVgm {
+	var l psgLoggerVgm
+	l.file = f
+	l.clock = uint32(clockMhz * 1_000_000)
+	l.cyclesPerSample = clockMhz * 1_000_000 / vgmSampleRate
+	l.startCycle = startCycle
+	return &l
+}
+
+func (l *psgLoggerVgm) write(cycle uint64, chip int, reg uint8, value uint8) {
+	if chip > 1 {
+		return
+	}
+	l.wait(cycle)
+	// Bit 7 of the register selects the second chip
+	l.data = append(l.data, vgmCommandAY8910Write, reg|uint8(chip)<<7, value)
+}
+
+// wait adds wait commands up to the sample of the CPU cycle
+func (l *psgLoggerVgm) wait(cycle uint64) {
+	target := uint64(float64(cycle-l.startCycle) / l.cyclesPerSample)
+	for l.samples < target {
+		n := min(target-l.samples, 0xffff)
+		l.data = append(l.data, vgmCommandWait)
+		l.data = binary.LittleEndian.AppendUint16(l.data, uint16(n))
+		l.samples += n
+	}
+}
+
+func (l *psgLoggerVgm) close(cycle uint64) error {
+	l.wait(cycle)
+	l.data = append(l.data, vgmCommandEnd)
+
+	header := make([]uint8, vgmHeaderSize)
+	copy(header, "Vgm ")
+	binary.LittleEndian.PutUint32(header[0x04:], uint32(vgmHeaderSize+len(l.data)-0x04)) // EOF offset
+	binary.LittleEndian.PutUint32(header[0x08:], 0x151)                                  // Version
+	binary.LittleEndian.PutUint32(header[0x18:], uint32(l.samples))                      // Total samples
+	binary.LittleEndian.PutUint32(header[0x34:], vgmHeaderSize-0x34)                     // Data offset
+	binary.LittleEndian.PutUint32(header[0x74:], l.clock|vgmAY8910DualChip)
+	header[0x78] = vgmAY8913Type
+	header[0x79] = vgmAY8910Legacy
+
+	return writePsgLogFile(l.file, append(header, l.data...))
+}
+
+const (
+	ymFrameRate       = 50
+	ymAttrInterleaved = 1
+	ymEnvelopeKeep    = 0xff // R13 value for frames without envelope shape writes
+	ymComment         = "Recorded with izapple2"
+)
+
+type psgLoggerYm struct {
+	file           *os.File
+	clock          uint32
+	cyclesPerFrame float64
+	frameEnd       float64 // Cycle of the end of the current frame
+	regs           [16]uint8
+	envelopeWrite  bool // R13 was written on the current frame
+	frames         [][16]uint8
+}
+
+func newPsgLoggerYm(f *os.File, clockMhz float64, startCycle uint64) *psgLoggerYm {
+	var l psgLoggerYm
+	l.file = f
+	l.clock = uint32(clockMhz * 1_000_000)
+	l.cyclesPerFrame = clockMhz * 1_000_000 / ymFrameRate
+	l.frameEnd = float64(startCycle) + l.cyclesPerFrame
+	return &l
+}
+
+func (l *psgLoggerYm) write(cycle uint64, chip int, reg uint8, value uint8) {
+	if chip != 0 || reg > 13 {
+		return
+	}
+	l.advance(cycle)
+	l.regs[reg] = value
+	if reg == 13 {
+		l.envelopeWrite = true
+	}
+}
+
+// advance dumps the registers for the frames completed before the cycle
+func (l *psgLoggerYm) advance(cycle uint64) {
+	for float64(cycle) >= l.frameEnd {
+		frame := l.regs
+		if !l.envelopeWrite {
+			frame[13] = ymEnvelopeKeep
+		}
+		l.frames = append(l.frames, frame)
+		l.envelopeWrite = false
+		l.frameEnd += l.cyclesPerFrame
+	}
+}
+
+func (l *psgLoggerYm) close(cycle uint64) error {
+	l.advance(cycle)
+	if len(l.frames) == 0 {
+		l.file.Close()
+		return errors.New("the YM log needs at least one frame")
+	}
+
+	data := []uint8("YM6!LeOnArD!")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(l.frames)))
+	data = binary.BigEndian.AppendUint32(data, ymAttrInterleaved)
+	data = binary.BigEndian.AppendUint16(data, 0) // Digidrums
+	data = binary.BigEndian.AppendUint32(data, l.clock)
+	data = binary.BigEndian.AppendUint16(data, ymFrameRate)
+	data = binary.BigEndian.AppendUint32(data, 0) // Loop frame
+	data = binary.BigEndian.AppendUint16(data, 0) // Additional data
+	data = append(data, 0)                        // Song name
+	data = append(data, 0)                        // Author
+	data = append(data, ymComment...)
+	data = append(data, 0)
+
+	for reg := range 16 {
+		for _, frame := range l.frames {
+			data = append(data, frame[reg])
+		}
+	}
+	data = append(data, "End!"...)
+
+	return writePsgLogFile(l.file, data)
+}
+
+// StartPsgLog logs the register writes to the sound generators of the
+// first Mockingboard or Phasor card to a .vgm or .ym file. Call it with
+// the emulator paused.
+func (a *Apple2) StartPsgLog(filename string) error {
+	c := a.findMockingboard()
+	if c == nil {
+		return errors.New("no Mockingboard or Phasor card installed")
+	}
+	return c.startPsgLog(filename)
+}
+
+// StopPsgLog completes the file started with StartPsgLog. Call it with the
+// emulator paused.
+func (a *Apple2) StopPsgLog() error {
+	c := a.findMockingboard()
+	if c == nil {
+		return errors.New("no Mockingboard or Phasor card installed")
+	}
+	return c.stopPsgLog()
+}
+
+func (a *Apple2) findMockingboard() *CardMockingboard {
+	for _, card := range a.cards {
+		if c, ok := card.(*CardMockingboard); ok {
+			return c
+		}
+	}
+	return nil
+}
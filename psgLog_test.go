@@ -0,0 +1,133 @@
+package izapple2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makePsgLogTester(t *testing.T, filename string) (*Apple2, *CardMockingboard) {
+	a, card := makeMockingboardTester(t)
+	for _, base := range []uint16{0xc400, 0xc480} {
+		a.mmu.Poke(base+3, 0xff) // DDRA: all output
+		a.mmu.Poke(base+2, 0x07) // DDRB: control lines output
+	}
+	err := a.StartPsgLog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, card
+}
+
+func advanceMockingboard(a *Apple2, card *CardMockingboard, cycles uint64) {
+	a.cycles += cycles
+	card.tick()
+}
+
+func TestPsgLogVgm(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.vgm")
+	a, card := makePsgLogTester(t, filename)
+
+	writePsg(a, 0xc400, 0, 0x55)
+	advanceMockingboard(a, card, 1_022_727/10) // 0.1 seconds
+	writePsg(a, 0xc480, 8, 0x0f)
+	advanceMockingboard(a, card, 1_022_727/10)
+
+	err := a.StopPsgLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data[0:4]) != "Vgm " {
+		t.Fatalf("Not a VGM file")
+	}
+	if eof := binary.LittleEndian.Uint32(data[0x04:]); int(eof) != len(data)-4 {
+		t.Errorf("The EOF offset should be %v, got %v", len(data)-4, eof)
+	}
+	clock := binary.LittleEndian.Uint32(data[0x74:])
+	if clock&vgmAY8910DualChip == 0 {
+		t.Errorf("The VGM should have two AY chips")
+	}
+	if samples := binary.LittleEndian.Uint32(data[0x18:]); samples < 8800 || samples > 8830 {
+		t.Errorf("The VGM should last about 8820 samples, got %v", samples)
+	}
+
+	commands := data[vgmHeaderSize:]
+	first := bytes.Index(commands, []uint8{vgmCommandAY8910Write, 0x00, 0x55})
+	second := bytes.Index(commands, []uint8{vgmCommandAY8910Write, 0x88, 0x0f})
+	if first < 0 || second < 0 {
+		t.Fatalf("The VGM writes are missing")
+	}
+	wait := bytes.IndexByte(commands[first:second], vgmCommandWait) + first
+	if wait < first {
+		t.Fatalf("The VGM writes should be separated by a wait")
+	}
+	if samples := binary.LittleEndian.Uint16(commands[wait+1:]); samples < 4400 || samples > 4420 {
+		t.Errorf("The writes should be 0.1 seconds apart, got %v samples", samples)
+	}
+	if commands[len(commands)-1] != vgmCommandEnd {
+		t.Errorf("The VGM should end with the end command")
+	}
+}
+
+func TestPsgLogYm(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.ym")
+	a, card := makePsgLogTester(t, filename)
+	frameCycles := uint64(a.GetClockMhz() * 1_000_000 / ymFrameRate)
+
+	writePsg(a, 0xc400, 0, 0x55)
+	writePsg(a, 0xc480, 1, 0x0f) // Second PSG, not logged
+	advanceMockingboard(a, card, 3*frameCycles+100)
+	writePsg(a, 0xc400, 13, 0x0e)
+	advanceMockingboard(a, card, 2*frameCycles)
+
+	err := a.StopPsgLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data[0:12]) != "YM6!LeOnArD!" {
+		t.Fatalf("Not a YM6 file")
+	}
+	frames := int(binary.BigEndian.Uint32(data[12:]))
+	if frames != 5 {
+		t.Fatalf("The YM should have 5 frames, got %v", frames)
+	}
+	start := bytes.Index(data, []uint8(ymComment+"\x00")) + len(ymComment) + 1
+	regs := data[start:]
+	if len(regs) != 16*frames+4 || string(regs[16*frames:]) != "End!" {
+		t.Fatalf("The YM frames are not complete")
+	}
+
+	column := func(reg int) []uint8 {
+		return regs[reg*frames : (reg+1)*frames]
+	}
+	if !bytes.Equal(column(0), []uint8{0x55, 0x55, 0x55, 0x55, 0x55}) {
+		t.Errorf("Unexpected R0 %v", column(0))
+	}
+	if !bytes.Equal(column(1), []uint8{0, 0, 0, 0, 0}) {
+		t.Errorf("Unexpected R1 %v", column(1))
+	}
+	// The initial R13 is written on the first frame, then on the fourth
+	if !bytes.Equal(column(13), []uint8{0x00, 0xff, 0xff, 0x0e, 0xff}) {
+		t.Errorf("Unexpected R13 %v", column(13))
+	}
+}
+
+func TestPsgLogUnknownFormat(t *testing.T) {
+	a, _ := makeMockingboardTester(t)
+	err := a.StartPsgLog(filepath.Join(t.TempDir(), "test.mp3"))
+	if err == nil {
+		t.Errorf("The log should fail for unknown formats")
+	}
+}
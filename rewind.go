@@ -0,0 +1,151 @@
+package izapple2
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+/*
+Rewind of the emulation.
+
+While the emulation runs, a compressed save state of the machine is taken
+every few frames and stored on a ring buffer that keeps the last seconds
+of emulation. Each CommandRewind pauses the emulator and restores the most
+recent snapshot, removing it from the buffer. Sending it again goes back
+further in time.
+
+As with the save states, the diskettes content is not part of the
+snapshots. Writes to the disk are not undone.
+*/
+
+const (
+	rewindCyclesPerFrame     = 65 * 262 // NTSC frame
+	rewindFramesPerSnapshot  = 6
+	rewindSnapshotsPerSecond = 60 / rewindFramesPerSnapshot
+)
+
+type rewindBuffer struct {
+	snapshots [][]byte
+	first     int // Index of the oldest snapshot
+	count     int
+	lastCycle uint64 // Cycle of the last snapshot taken
+
+	buf        bytes.Buffer
+	compressor *flate.Writer
+}
+
+func newRewindBuffer(seconds int) *rewindBuffer {
+	var rb rewindBuffer
+	rb.snapshots = make([][]byte, seconds*rewindSnapshotsPerSecond)
+	return &rb
+}
+
+func (rb *rewindBuffer) push(snapshot []byte) {
+	if len(rb.snapshots) == 0 {
+		return
+	}
+	i := (rb.first + rb.count) % len(rb.snapshots)
+	rb.snapshots[i] = snapshot
+	if rb.count < len(rb.snapshots) {
+		rb.count++
+	} else {
+		// The buffer is full, the oldest snapshot has been overwritten
+		rb.first = (rb.first + 1) % len(rb.snapshots)
+	}
+}
+
+func (rb *rewindBuffer) pop() ([]byte, bool) {
+	if rb.count == 0 {
+		return nil, false
+	}
+	rb.count--
+	i := (rb.first + rb.count) % len(rb.snapshots)
+	snapshot := rb.snapshots[i]
+	rb.snapshots[i] = nil
+	return snapshot, true
+}
+
+func (a *Apple2) setRewind(seconds string) error {
+	if seconds == "" || seconds == "none" {
+		a.rewind = nil
+		return nil
+	}
+	value, err := strconv.Atoi(seconds)
+	if err != nil || value < 0 {
+		return fmt.Errorf("invalid rewind seconds: %s", seconds)
+	}
+	if value == 0 {
+		a.rewind = nil
+	} else {
+		a.rewind = newRewindBuffer(value)
+	}
+	return nil
+}
+
+// rewindTick takes a snapshot if enough cycles have passed since the last one.
+// To be called only from the emulation goroutine.
+func (a *Apple2) rewindTick() {
+	rb := a.rewind
+	if rb == nil || a.cycles-rb.lastCycle < rewindCyclesPerFrame*rewindFramesPerSnapshot {
+		return
+	}
+	rb.lastCycle = a.cycles
+
+	err := a.rewindSnapshot()
+	if err != nil {
+		fmt.Printf("Rewind disabled, could not take a snapshot: %v\n", err)
+		a.rewind = nil
+	}
+}
+
+func (a *Apple2) rewindSnapshot() error {
+	rb := a.rewind
+	rb.buf.Reset()
+	if rb.compressor == nil {
+		var err error
+		rb.compressor, err = flate.NewWriter(&rb.buf, flate.BestSpeed)
+		if err != nil {
+			return err
+		}
+	} else {
+		rb.compressor.Reset(&rb.buf)
+	}
+
+	err := a.SaveState(rb.compressor)
+	if err != nil {
+		return err
+	}
+	err = rb.compressor.Close()
+	if err != nil {
+		return err
+	}
+
+	rb.push(bytes.Clone(rb.buf.Bytes()))
+	return nil
+}
+
+// rewindStep restores the most recent snapshot. To be called only from
+// the emulation goroutine.
+func (a *Apple2) rewindStep() error {
+	rb := a.rewind
+	if rb == nil {
+		return errors.New("rewind is not enabled")
+	}
+	snapshot, ok := rb.pop()
+	if !ok {
+		return errors.New("no more snapshots to rewind")
+	}
+
+	decompressor := flate.NewReader(bytes.NewReader(snapshot))
+	defer decompressor.Close()
+	err := a.LoadState(decompressor)
+	if err != nil {
+		return err
+	}
+
+	rb.lastCycle = a.cycles
+	return nil
+}
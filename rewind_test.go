@@ -0,0 +1,93 @@
+package izapple2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRewindBufferRing(t *testing.T) {
+	rb := newRewindBuffer(1)
+	total := rewindSnapshotsPerSecond + 3
+	for i := 0; i < total; i++ {
+		rb.push([]byte{uint8(i)})
+	}
+
+	for i := total - 1; i >= 3; i-- {
+		snapshot, ok := rb.pop()
+		if !ok {
+			t.Fatalf("Snapshot %v should be available", i)
+		}
+		if snapshot[0] != uint8(i) {
+			t.Errorf("Snapshot %v expected, got %v", i, snapshot[0])
+		}
+	}
+	if _, ok := rb.pop(); ok {
+		t.Error("The oldest snapshots should have been discarded")
+	}
+}
+
+func TestRewindStep(t *testing.T) {
+	at, err := makeApple2Tester("2plus", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := at.a
+	err = a.setRewind("10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.mmu.Poke(0x2000, 0x12)
+	a.cycles += rewindCyclesPerFrame * rewindFramesPerSnapshot
+	a.rewindTick()
+	a.mmu.Poke(0x2000, 0x34)
+	a.cycles += 100
+	a.rewindTick() // Too soon for a new snapshot
+
+	err = a.rewindStep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.mmu.Peek(0x2000) != 0x12 {
+		t.Error("The RAM should be restored to the snapshot")
+	}
+	if a.rewindStep() == nil {
+		t.Error("There should not be more snapshots")
+	}
+}
+
+func TestRewindStepWithWoz(t *testing.T) {
+	overrides := newConfiguration()
+	overrides.set(confS6, "diskii,disk1=\"woz_test_images/DOS 3.3 System Master.woz\"")
+	at, err := makeApple2Tester("2enh", overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := at.a
+	err = a.setRewind("10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.mmu.Peek(0xc0e9) // Motor on
+	a.cycles += rewindCyclesPerFrame * rewindFramesPerSnapshot
+	a.rewindTick()
+	a.cycles += 100000
+	a.mmu.Peek(0xc0ec)
+
+	err = a.rewindStep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan bool)
+	go func() {
+		a.cycles += 100
+		a.mmu.Peek(0xc0ec)
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The diskette read after the rewind does not end")
+	}
+}
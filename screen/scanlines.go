@@ -0,0 +1,65 @@
+package screen
+
+import (
+	"image"
+	"image/draw"
+)
+
+/*
+Rendering of frames with several video modes. When the video mode or the
+page changes mid-frame, each line is shown with the mode active when the
+beam scanned it.
+
+Each of the modes used is rendered as a full screen and the lines are
+copied from it. The images are aligned on the left, the widths can be a
+few pixels different when the NTSC filter is applied.
+*/
+
+// scanlineVideoModes returns the mode of each line if the video source
+// provides them and the last frame has mode changes, nil otherwise
+func scanlineVideoModes(vs VideoSource) []uint32 {
+	svs, ok := vs.(ScanlineVideoSource)
+	if !ok {
+		return nil
+	}
+	modes := svs.GetScanlineVideoModes()
+	if len(modes) != hiResHeight {
+		return nil
+	}
+
+	changes := false
+	for _, mode := range modes {
+		base := mode & VideoBaseMask
+		if base == VideoSHR || base == VideoVidex {
+			// Not 192 lines, the modes can't be combined
+			return nil
+		}
+		if mode != modes[0] {
+			changes = true
+		}
+	}
+	if !changes {
+		return nil
+	}
+	return modes
+}
+
+func snapshotByScanlines(vs VideoSource, modes []uint32, screenMode int) *image.RGBA {
+	snaps := make(map[uint32]*image.RGBA)
+	width := 0
+	for _, mode := range modes {
+		if _, ok := snaps[mode]; !ok {
+			snap := snapshotByMode(vs, mode, screenMode)
+			snaps[mode] = snap
+			width = max(width, snap.Bounds().Dx())
+		}
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, width, hiResHeight))
+	draw.Draw(out, out.Bounds(), image.Black, image.Point{}, draw.Src)
+	for y, mode := range modes {
+		line := image.Rect(0, y, width, y+1)
+		draw.Draw(out, line, snaps[mode], image.Pt(0, y), draw.Src)
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package screen
+
+import (
+	"image"
+	"testing"
+)
+
+type scanlineTestSource struct {
+	*TestScenario
+	modes []uint32
+}
+
+func (s *scanlineTestSource) GetScanlineVideoModes() []uint32 {
+	return s.modes
+}
+
+func TestSnapshotScanlines(t *testing.T) {
+	ts, err := loadTestScenario("./test_resources/hgr-mix40_329392851.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modifiers := ts.VideoMode & VideoModifiersMask
+
+	// Text on the top half and HGR on the bottom half
+	modes := make([]uint32, hiResHeight)
+	for y := range modes {
+		if y < hiResHeight/2 {
+			modes[y] = VideoText40 | modifiers
+		} else {
+			modes[y] = VideoHGR | modifiers
+		}
+	}
+
+	snap := Snapshot(&scanlineTestSource{ts, modes}, ScreenModePlain)
+	text := snapshotByMode(ts, VideoText40|modifiers, ScreenModePlain)
+	hgr := snapshotByMode(ts, VideoHGR|modifiers, ScreenModePlain)
+
+	sameLine := func(reference *image.RGBA, y int) bool {
+		for x := range reference.Bounds().Dx() {
+			if snap.RGBAAt(x, y) != reference.RGBAAt(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, y := range []int{0, 50, hiResHeight/2 - 1} {
+		if !sameLine(text, y) {
+			t.Errorf("The line %v should be rendered as text", y)
+		}
+	}
+	for _, y := range []int{hiResHeight / 2, 150, hiResHeight - 1} {
+		if !sameLine(hgr, y) {
+			t.Errorf("The line %v should be rendered as HGR", y)
+		}
+	}
+}
+
+func TestSnapshotScanlinesSingleMode(t *testing.T) {
+	ts, err := loadTestScenario("./test_resources/hgr_489333721.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modes := make([]uint32, hiResHeight)
+	for y := range modes {
+		modes[y] = ts.VideoMode
+	}
+	if scanlineVideoModes(&scanlineTestSource{ts, modes}) != nil {
+		t.Errorf("A frame without mode changes should be rendered with the current mode")
+	}
+}
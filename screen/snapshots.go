@@ -36,8 +36,13 @@ func NextScreenMode(screenMode int) int {
 
 // Snapshot the currently visible screen
 func Snapshot(vs VideoSource, screenMode int) *image.RGBA {
-	videoMode := vs.GetCurrentVideoMode()
-	snap := snapshotByMode(vs, videoMode, screenMode)
+	var snap *image.RGBA
+	if modes := scanlineVideoModes(vs); modes != nil {
+		snap = snapshotByScanlines(vs, modes, screenMode)
+	} else {
+		videoMode := vs.GetCurrentVideoMode()
+		snap = snapshotByMode(vs, videoMode, screenMode)
+	}
 
 	if screenMode != ScreenModePlain && snap.Bounds().Dy() == hiResHeight {
 		// Apply the filter to regular CRT snapshots with 192 lines. Not to SHR
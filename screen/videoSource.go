@@ -57,3 +57,11 @@ type VideoSource interface {
 	// SupportsLowercase returns true if the video source supports lowercase
 	SupportsLowercase() bool
 }
+
+// ScanlineVideoSource is a VideoSource that knows the video mode used on
+// each line of the last frame, to render the mode changes done mid-frame
+type ScanlineVideoSource interface {
+	// GetScanlineVideoModes returns the video mode of each of the 192
+	// visible lines, nil if not known
+	GetScanlineVideoModes() []uint32
+}
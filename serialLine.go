@@ -0,0 +1,199 @@
+package izapple2
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+/*
+Host side of a serial line. The line can be connected to:
+
+	none: nothing connected
+	tcp:host:port: a TCP client connected to host:port
+	listen:host:port: a TCP server waiting for a connection on host:port,
+		the host can be omitted to listen on all the interfaces
+	pty: a pseudo-terminal, the name of the device is printed on start
+	file:path: the bytes sent are appended to a file, nothing is received
+	modem: a Hayes compatible modem dialing TCP addresses
+	modem:port: the modem also receives calls on a TCP port of the local host
+	modem:host:port: the modem receives calls on host:port
+
+The bytes received are read on a goroutine and buffered, the emulation
+polls them without blocking.
+*/
+
+type serialLine interface {
+	read() (uint8, bool) // Non blocking
+	write(data []uint8)
+	isConnected() bool
+	close()
+}
+
+const serialLineBufferSize = 64 * 1024
+
+func newSerialLine(device string, cycles func() uint64) (serialLine, error) {
+	kind, address, _ := strings.Cut(device, ":")
+	switch kind {
+	case "", "none":
+		return &serialLineNone{}, nil
+	case "tcp":
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		s := newSerialStream()
+		s.attach(conn)
+		return s, nil
+	case "listen":
+		return newSerialLineListener(address)
+	case "pty":
+		return newSerialLinePty()
+	case "modem":
+		return newSerialLineModem(address, cycles)
+	case "file":
+		f, err := os.OpenFile(address, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &serialLineFile{file: f}, nil
+	}
+	return nil, fmt.Errorf("unknown serial device '%v', use none, tcp:host:port, listen:host:port, pty, modem[:[host:]port] or file:path", device)
+}
+
+// serialLineNone has nothing connected
+type serialLineNone struct{}
+
+func (s *serialLineNone) read() (uint8, bool) { return 0, false }
+func (s *serialLineNone) write([]uint8)       {}
+func (s *serialLineNone) isConnected() bool   { return false }
+func (s *serialLineNone) close()              {}
+
+// serialLineFile stores the bytes sent
+type serialLineFile struct {
+	file *os.File
+}
+
+func (s *serialLineFile) read() (uint8, bool) { return 0, false }
+func (s *serialLineFile) isConnected() bool   { return true }
+func (s *serialLineFile) close()              { s.file.Close() }
+
+func (s *serialLineFile) write(data []uint8) {
+	s.file.Write(data)
+}
+
+// serialStream exchanges bytes with a connection or a device
+type serialStream struct {
+	mutex    sync.Mutex
+	conn     io.ReadWriteCloser
+	received chan uint8
+}
+
+func newSerialStream() *serialStream {
+	var s serialStream
+	s.received = make(chan uint8, serialLineBufferSize)
+	return &s
+}
+
+// attach replaces the connection and starts reading from it
+func (s *serialStream) attach(conn io.ReadWriteCloser) {
+	s.mutex.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn = conn
+	s.mutex.Unlock()
+
+	go func() {
+		buffer := make([]uint8, 1024)
+		for {
+			n, err := conn.Read(buffer)
+			for _, value := range buffer[:n] {
+				s.received <- value
+			}
+			if err != nil {
+				s.detach(conn)
+				return
+			}
+		}
+	}()
+}
+
+func (s *serialStream) detach(conn io.ReadWriteCloser) {
+	s.mutex.Lock()
+	if s.conn == conn {
+		s.conn.Close()
+		s.conn = nil
+	}
+	s.mutex.Unlock()
+}
+
+func (s *serialStream) read() (uint8, bool) {
+	select {
+	case value := <-s.received:
+		return value, true
+	default:
+		return 0, false
+	}
+}
+
+func (s *serialStream) write(data []uint8) {
+	s.mutex.Lock()
+	conn := s.conn
+	s.mutex.Unlock()
+	if conn != nil {
+		_, err := conn.Write(data)
+		if err != nil {
+			s.detach(conn)
+		}
+	}
+}
+
+func (s *serialStream) isConnected() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.conn != nil
+}
+
+func (s *serialStream) close() {
+	s.mutex.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	s.mutex.Unlock()
+}
+
+// serialLineListener accepts TCP connections, a new connection replaces
+// the previous one
+type serialLineListener struct {
+	*serialStream
+	listener net.Listener
+}
+
+func newSerialLineListener(address string) (*serialLineListener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &serialLineListener{newSerialStream(), listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return // The listener has been closed
+			}
+			s.attach(conn)
+		}
+	}()
+	return s, nil
+}
+
+func (s *serialLineListener) close() {
+	s.listener.Close()
+	s.serialStream.close()
+}
@@ -0,0 +1,581 @@
+package izapple2
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Hayes Smartmodem compatible modem on the serial line. The phone numbers
+are host:port addresses reached with TCP, the port defaults to 23.
+
+Commands supported:
+
+	A: answer an incoming call
+	Dhost:port, DThost:port, DPhost:port: dial
+	En: echo of the commands, E0 or E1
+	Hn: hang up
+	In: information
+	O: return online after the escape
+	Qn: quiet mode, no result codes with Q1
+	Sr=n, Sr?: set or show the S-registers
+	Vn: result codes with words, V1, or numbers, V0
+	Z, &F: reset
+	&Cn: the carrier detect line is always on, &C0, or follows the carrier, &C1
+	Ln, Mn, Xn and other &x: accepted and ignored
+	A/: repeat the last command
+
+S-registers with meaning:
+
+	S0: number of rings to answer automatically, 0 to disable
+	S1: ring count
+	S2: escape character, 43 '+'
+	S3: carriage return character
+	S4: line feed character
+	S5: backspace character
+	S12: escape guard time in 1/50 seconds of emulated time
+
+The incoming calls are accepted with a TCP listener if a port is given
+with "modem:port", only from the local host. Use "modem:host:port" to
+listen on another interface, "modem:0.0.0.0:port" for all of them. While connected, a sequence of three escape characters
+with a pause of the guard time before and after returns to command mode.
+If the remote side talks telnet, the options are refused but echo and
+suppress go ahead, as needed by the BBSes.
+*/
+
+type serialLineModem struct {
+	regs    [256]uint8
+	echo    bool
+	verbose bool
+	quiet   bool
+	dcdMode bool // &C1
+
+	command     []uint8
+	lastCommand string
+	output      []uint8
+
+	stream     *serialStream // Remote connection
+	carrier    bool          // Connected to the remote side
+	online     bool          // Data mode, not command mode
+	dialing    chan modemDialResult
+	dialCancel context.CancelFunc
+
+	listener net.Listener
+	incoming chan net.Conn
+	done     chan struct{} // Closed to stop the accept loop
+	ringing  net.Conn
+	lastRing time.Time
+
+	cycles      func() uint64 // Emulated time for the escape guard time
+	escapeCount int
+	lastSent    uint64 // Cycle of the last byte sent online
+
+	telnet      bool
+	telnetState int
+	telnetVerb  uint8
+}
+
+type modemDialResult struct {
+	conn net.Conn
+	err  error
+}
+
+const (
+	modemResultOK         = 0
+	modemResultConnect    = 1
+	modemResultRing       = 2
+	modemResultNoCarrier  = 3
+	modemResultError      = 4
+	modemResultBusy       = 7
+	modemRingPeriod       = 2 * time.Second
+	modemDialTimeout      = 30 * time.Second
+	modemCommandMaxLength = 64
+	modemDefaultPort      = "23"
+	modemDefaultHost      = "127.0.0.1"
+)
+
+var modemResults = map[int]string{
+	modemResultOK:        "OK",
+	modemResultConnect:   "CONNECT",
+	modemResultRing:      "RING",
+	modemResultNoCarrier: "NO CARRIER",
+	modemResultError:     "ERROR",
+	modemResultBusy:      "BUSY",
+}
+
+func newSerialLineModem(port string, cycles func() uint64) (*serialLineModem, error) {
+	var m serialLineModem
+	m.cycles = cycles
+	m.stream = newSerialStream()
+	m.reset()
+
+	if port != "" {
+		address := port
+		if !strings.Contains(address, ":") {
+			address = net.JoinHostPort(modemDefaultHost, port)
+		}
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		m.listener = listener
+		m.incoming = make(chan net.Conn)
+		m.done = make(chan struct{})
+		go m.acceptCalls(listener, m.incoming, m.done)
+	}
+	return &m, nil
+}
+
+func (m *serialLineModem) acceptCalls(listener net.Listener, incoming chan<- net.Conn, done <-chan struct{}) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return // The listener has been closed
+		}
+		select {
+		case incoming <- conn:
+		case <-done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (m *serialLineModem) reset() {
+	m.hangUp()
+	m.regs = [256]uint8{}
+	m.regs[2] = '+'
+	m.regs[3] = '\r'
+	m.regs[4] = '\n'
+	m.regs[5] = 8
+	m.regs[12] = 50
+	m.echo = true
+	m.verbose = true
+	m.quiet = false
+	m.dcdMode = false
+}
+
+func (m *serialLineModem) hangUp() {
+	m.stream.close()
+	for len(m.stream.received) > 0 {
+		<-m.stream.received
+	}
+	m.carrier = false
+	m.online = false
+	m.abortDial()
+	m.escapeCount = 0
+	m.telnet = false
+	m.telnetState = 0
+	if m.ringing != nil {
+		m.ringing.Close()
+		m.ringing = nil
+	}
+}
+
+func (m *serialLineModem) isConnected() bool {
+	return !m.dcdMode || m.carrier
+}
+
+func (m *serialLineModem) close() {
+	if m.listener != nil {
+		close(m.done)
+		m.listener.Close()
+		m.listener = nil
+	}
+	m.hangUp()
+}
+
+func (m *serialLineModem) write(data []uint8) {
+	if m.online {
+		m.sendOnline(data)
+		return
+	}
+
+	for _, value := range data {
+		if m.dialing != nil {
+			// Any character aborts the dialing
+			m.abortDial()
+			m.result(modemResultNoCarrier)
+			continue
+		}
+		value &= 0x7f
+		if m.echo {
+			m.output = append(m.output, value)
+		}
+
+		switch {
+		case value == m.regs[3]:
+			line := strings.ToUpper(string(m.command))
+			m.command = nil
+			if strings.HasPrefix(line, "AT") {
+				m.lastCommand = line[2:]
+				m.execute(m.lastCommand)
+			}
+		case value == m.regs[5]:
+			if len(m.command) > 0 {
+				m.command = m.command[:len(m.command)-1]
+			}
+		case value < ' ':
+			// Ignore control characters
+		case len(m.command) < modemCommandMaxLength:
+			m.command = append(m.command, value)
+			if strings.ToUpper(string(m.command)) == "A/" {
+				m.command = nil
+				m.execute(m.lastCommand)
+			}
+		}
+	}
+}
+
+func (m *serialLineModem) sendOnline(data []uint8) {
+	now := m.cycles()
+	guard := m.guardCycles()
+	for _, value := range data {
+		if value == m.regs[2] && m.regs[2] < 128 &&
+			(m.escapeCount > 0 || now-m.lastSent >= guard) {
+			m.escapeCount++
+		} else {
+			m.escapeCount = 0
+		}
+		m.lastSent = now
+	}
+
+	if m.telnet {
+		// Escape the IAC bytes
+		escaped := make([]uint8, 0, len(data))
+		for _, value := range data {
+			escaped = append(escaped, value)
+			if value == telnetIAC {
+				escaped = append(escaped, telnetIAC)
+			}
+		}
+		data = escaped
+	}
+	m.stream.write(data)
+}
+
+func (m *serialLineModem) guardCycles() uint64 {
+	return uint64(float64(m.regs[12]) * CPUClockMhz * 1_000_000 / 50)
+}
+
+func (m *serialLineModem) read() (uint8, bool) {
+	m.poll()
+
+	if len(m.output) > 0 {
+		value := m.output[0]
+		m.output = m.output[1:]
+		return value, true
+	}
+
+	if m.online {
+		for {
+			value, ok := m.stream.read()
+			if !ok {
+				return 0, false
+			}
+			value, ok = m.telnetFilter(value)
+			if ok {
+				return value, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// poll processes the events of the connections
+func (m *serialLineModem) poll() {
+	if m.dialing != nil {
+		select {
+		case result := <-m.dialing:
+			m.dialing = nil
+			m.dialCancel()
+			m.dialCancel = nil
+			if result.err != nil {
+				m.result(modemResultNoCarrier)
+			} else {
+				m.connect(result.conn)
+			}
+		default:
+		}
+	}
+
+	if m.incoming != nil {
+		select {
+		case conn := <-m.incoming:
+			if m.ringing != nil || m.dialing != nil || m.carrier {
+				conn.Write([]uint8("BUSY\r\n"))
+				conn.Close()
+			} else {
+				m.ringing = conn
+				m.regs[1] = 0
+				m.lastRing = time.Time{}
+			}
+		default:
+		}
+	}
+
+	if m.ringing != nil && time.Since(m.lastRing) >= modemRingPeriod {
+		m.lastRing = time.Now()
+		m.regs[1]++
+		m.result(modemResultRing)
+		if m.regs[0] != 0 && m.regs[1] >= m.regs[0] {
+			m.answer()
+		}
+	}
+
+	if m.online && m.escapeCount >= 3 && m.cycles()-m.lastSent >= m.guardCycles() {
+		m.online = false
+		m.escapeCount = 0
+		m.result(modemResultOK)
+	}
+
+	if m.carrier && !m.stream.isConnected() && len(m.stream.received) == 0 {
+		// The remote side has hung up
+		m.hangUp()
+		m.result(modemResultNoCarrier)
+	}
+}
+
+func (m *serialLineModem) connect(conn net.Conn) {
+	m.stream.attach(conn)
+	m.carrier = true
+	m.online = true
+	m.escapeCount = 0
+	m.lastSent = m.cycles()
+	m.result(modemResultConnect)
+}
+
+func (m *serialLineModem) answer() bool {
+	if m.ringing == nil {
+		return false
+	}
+	conn := m.ringing
+	m.ringing = nil
+	m.regs[1] = 0
+	m.connect(conn)
+	return true
+}
+
+func (m *serialLineModem) dial(address string) {
+	if strings.HasPrefix(address, "T") || strings.HasPrefix(address, "P") {
+		address = address[1:] // Tone or pulse dialing
+	}
+	if address == "" {
+		m.result(modemResultError)
+		return
+	}
+	if !strings.Contains(address, ":") {
+		address = net.JoinHostPort(address, modemDefaultPort)
+	}
+
+	m.hangUp()
+	ctx, cancel := context.WithTimeout(context.Background(), modemDialTimeout)
+	result := make(chan modemDialResult, 1)
+	m.dialing = result
+	m.dialCancel = cancel
+	go func() {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		result <- modemDialResult{conn, err}
+	}()
+}
+
+// abortDial cancels the dialing in progress, a connection completed anyway
+// is closed
+func (m *serialLineModem) abortDial() {
+	if m.dialing == nil {
+		return
+	}
+	m.dialCancel()
+	go func(result chan modemDialResult) {
+		if late := <-result; late.conn != nil {
+			late.conn.Close()
+		}
+	}(m.dialing)
+	m.dialing = nil
+	m.dialCancel = nil
+}
+
+// execute runs the commands after "AT"
+func (m *serialLineModem) execute(line string) {
+	line = strings.ReplaceAll(line, " ", "")
+	pos := 0
+	number := func() int {
+		start := pos
+		for pos < len(line) && line[pos] >= '0' && line[pos] <= '9' {
+			pos++
+		}
+		n, _ := strconv.Atoi(line[start:pos])
+		return n
+	}
+
+	for pos < len(line) {
+		command := line[pos]
+		pos++
+		switch command {
+		case 'A':
+			if !m.answer() {
+				m.result(modemResultNoCarrier)
+			}
+			return
+		case 'D':
+			m.dial(line[pos:])
+			return
+		case 'E':
+			m.echo = number() != 0
+		case 'H':
+			number()
+			m.hangUp()
+		case 'I':
+			number()
+			m.respond("izapple2 modem")
+		case 'O':
+			number()
+			if !m.carrier {
+				m.result(modemResultNoCarrier)
+				return
+			}
+			m.online = true
+			m.escapeCount = 0
+			m.result(modemResultConnect)
+			return
+		case 'Q':
+			m.quiet = number() != 0
+		case 'V':
+			m.verbose = number() != 0
+		case 'Z':
+			number()
+			m.reset()
+		case 'L', 'M', 'X':
+			number()
+		case 'S':
+			reg := number()
+			if reg > 255 || pos >= len(line) {
+				m.result(modemResultError)
+				return
+			}
+			operation := line[pos]
+			pos++
+			switch operation {
+			case '=':
+				m.regs[reg] = uint8(number())
+			case '?':
+				m.respond(fmt.Sprintf("%03d", m.regs[reg]))
+			default:
+				m.result(modemResultError)
+				return
+			}
+		case '&':
+			if pos >= len(line) {
+				m.result(modemResultError)
+				return
+			}
+			extended := line[pos]
+			pos++
+			value := number()
+			switch extended {
+			case 'C':
+				m.dcdMode = value != 0
+			case 'F':
+				m.reset()
+			}
+		default:
+			m.result(modemResultError)
+			return
+		}
+	}
+	m.result(modemResultOK)
+}
+
+func (m *serialLineModem) result(code int) {
+	if m.quiet {
+		return
+	}
+	if m.verbose {
+		m.respond(modemResults[code])
+	} else {
+		m.output = append(m.output, []uint8(strconv.Itoa(code))...)
+		m.output = append(m.output, m.regs[3])
+	}
+}
+
+func (m *serialLineModem) respond(text string) {
+	if m.verbose {
+		m.output = append(m.output, m.regs[3], m.regs[4])
+	}
+	m.output = append(m.output, []uint8(text)...)
+	m.output = append(m.output, m.regs[3])
+	if m.verbose {
+		m.output = append(m.output, m.regs[4])
+	}
+}
+
+const (
+	telnetIAC  = 255
+	telnetDONT = 254
+	telnetDO   = 253
+	telnetWONT = 252
+	telnetWILL = 251
+	telnetSB   = 250
+	telnetSE   = 240
+
+	telnetOptionEcho = 1
+	telnetOptionSGA  = 3
+
+	telnetStateData   = 0
+	telnetStateIAC    = 1
+	telnetStateOption = 2
+	telnetStateSB     = 3
+	telnetStateSBIAC  = 4
+)
+
+// telnetFilter removes the telnet commands from the data received
+func (m *serialLineModem) telnetFilter(value uint8) (uint8, bool) {
+	switch m.telnetState {
+	case telnetStateData:
+		if value == telnetIAC {
+			m.telnet = true
+			m.telnetState = telnetStateIAC
+			return 0, false
+		}
+		return value, true
+	case telnetStateIAC:
+		m.telnetState = telnetStateData
+		switch value {
+		case telnetIAC:
+			return value, true
+		case telnetDO, telnetDONT, telnetWILL, telnetWONT:
+			m.telnetVerb = value
+			m.telnetState = telnetStateOption
+		case telnetSB:
+			m.telnetState = telnetStateSB
+		}
+	case telnetStateOption:
+		m.telnetState = telnetStateData
+		switch m.telnetVerb {
+		case telnetDO:
+			m.stream.write([]uint8{telnetIAC, telnetWONT, value})
+		case telnetWILL:
+			if value == telnetOptionEcho || value == telnetOptionSGA {
+				m.stream.write([]uint8{telnetIAC, telnetDO, value})
+			} else {
+				m.stream.write([]uint8{telnetIAC, telnetDONT, value})
+			}
+		}
+	case telnetStateSB:
+		if value == telnetIAC {
+			m.telnetState = telnetStateSBIAC
+		}
+	case telnetStateSBIAC:
+		if value == telnetSE {
+			m.telnetState = telnetStateData
+		} else {
+			m.telnetState = telnetStateSB
+		}
+	}
+	return 0, false
+}
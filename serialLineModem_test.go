@@ -0,0 +1,302 @@
+package izapple2
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// modemExpect reads from the modem until the text is received
+func modemExpect(t *testing.T, m *serialLineModem, text string) {
+	t.Helper()
+	var received []uint8
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		value, ok := m.read()
+		if !ok {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		received = append(received, value)
+		if strings.Contains(string(received), text) {
+			return
+		}
+	}
+	t.Fatalf("Expected %q from the modem, got %q", text, received)
+}
+
+func modemTestClock() uint64 {
+	return 0
+}
+
+func startEchoServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestModemCommands(t *testing.T) {
+	m, err := newSerialLineModem("", modemTestClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.close()
+
+	m.write([]uint8("AT\r"))
+	modemExpect(t, m, "AT\r\r\nOK\r\n")
+
+	m.write([]uint8("ATE0 S7=45 S7?\r"))
+	modemExpect(t, m, "\r\n045\r\n\r\nOK\r\n")
+
+	m.write([]uint8("ATV0\r"))
+	modemExpect(t, m, "0\r")
+
+	m.write([]uint8("ATK\r"))
+	modemExpect(t, m, "4\r")
+
+	// Reset restores the echo and the verbose result codes
+	m.write([]uint8("ATZ\r"))
+	modemExpect(t, m, "\r\nOK\r\n")
+	m.write([]uint8("AT\r"))
+	modemExpect(t, m, "AT\r\r\nOK\r\n")
+}
+
+func TestModemDialAndEscape(t *testing.T) {
+	address := startEchoServer(t)
+	m, err := newSerialLineModem("", modemTestClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.close()
+
+	m.write([]uint8("ATE0S12=0&C1\r"))
+	modemExpect(t, m, "OK\r\n")
+	if m.isConnected() {
+		t.Error("The carrier should be off before dialing")
+	}
+
+	m.write([]uint8("ATDT" + address + "\r"))
+	modemExpect(t, m, "CONNECT\r\n")
+	if !m.isConnected() {
+		t.Error("The carrier should be on after connecting")
+	}
+
+	m.write([]uint8("HELLO"))
+	modemExpect(t, m, "HELLO")
+
+	// Escape to command mode, the connection is kept
+	m.write([]uint8("+++"))
+	modemExpect(t, m, "OK\r\n")
+	m.write([]uint8("ATO\r"))
+	modemExpect(t, m, "CONNECT\r\n")
+	m.write([]uint8("AGAIN"))
+	modemExpect(t, m, "AGAIN")
+
+	m.write([]uint8("+++"))
+	modemExpect(t, m, "OK\r\n")
+	m.write([]uint8("ATH\r"))
+	modemExpect(t, m, "OK\r\n")
+	if m.isConnected() {
+		t.Error("The carrier should be off after hanging up")
+	}
+}
+
+func TestModemEscapeGuardTime(t *testing.T) {
+	address := startEchoServer(t)
+	var cycles uint64
+	m, err := newSerialLineModem("", func() uint64 { return cycles })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.close()
+	clock := CPUClockMhz * 1_000_000
+	second := uint64(clock)
+
+	m.write([]uint8("ATE0DT" + address + "\r"))
+	modemExpect(t, m, "CONNECT\r\n")
+
+	// Without the pause of the emulated guard time the escape is data
+	m.write([]uint8("+++"))
+	cycles += 2 * second
+	modemExpect(t, m, "+++")
+	if !m.online {
+		t.Fatal("The escape without the pause before should be sent as data")
+	}
+
+	m.write([]uint8("+++"))
+	m.read()
+	if !m.online {
+		t.Fatal("The escape should wait for the pause after")
+	}
+	cycles += 2 * second
+	modemExpect(t, m, "OK\r\n")
+}
+
+func TestModemDialAborted(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	m, err := newSerialLineModem("", modemTestClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.close()
+	m.write([]uint8("ATE0DT" + listener.Addr().String() + "\r"))
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// A key aborts the dialing, the connection made is closed
+	m.write([]uint8(" "))
+	modemExpect(t, m, "NO CARRIER\r\n")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]uint8, 1))
+	if err != io.EOF {
+		t.Errorf("The connection should be closed, got %v", err)
+	}
+}
+
+func TestModemDialFails(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	m, err := newSerialLineModem("", modemTestClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.close()
+
+	m.write([]uint8("ATDT" + address + "\r"))
+	modemExpect(t, m, "NO CARRIER\r\n")
+}
+
+func TestModemAnswer(t *testing.T) {
+	m, err := newSerialLineModem("0", modemTestClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.close()
+	m.write([]uint8("ATE0\r"))
+	modemExpect(t, m, "OK\r\n")
+
+	conn, err := net.Dial("tcp", m.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	modemExpect(t, m, "RING\r\n")
+
+	m.write([]uint8("ATA\r"))
+	modemExpect(t, m, "CONNECT\r\n")
+
+	conn.Write([]uint8("FROM REMOTE"))
+	modemExpect(t, m, "FROM REMOTE")
+
+	m.write([]uint8("TO REMOTE"))
+	buffer := make([]uint8, 9)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadFull(conn, buffer)
+	if err != nil || string(buffer) != "TO REMOTE" {
+		t.Errorf("The remote side should receive the data, got %q, %v", buffer, err)
+	}
+
+	// The remote side hangs up
+	conn.Close()
+	modemExpect(t, m, "NO CARRIER\r\n")
+}
+
+func TestModemTelnetNegotiation(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	m, err := newSerialLineModem("", modemTestClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.close()
+	m.write([]uint8("ATE0DT" + listener.Addr().String() + "\r"))
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	modemExpect(t, m, "CONNECT\r\n")
+
+	conn.Write([]uint8{telnetIAC, telnetWILL, telnetOptionEcho, telnetIAC, telnetDO, 24, 'O', 'K', telnetIAC, telnetIAC})
+	modemExpect(t, m, "OK\xff")
+
+	reply := make([]uint8, 6)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint8{telnetIAC, telnetDO, telnetOptionEcho, telnetIAC, telnetWONT, 24}
+	if string(reply) != string(expected) {
+		t.Errorf("The telnet options should be answered, got %v", reply)
+	}
+}
+
+func TestModemListensOnLocalHost(t *testing.T) {
+	m, err := newSerialLineModem("0", modemTestClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.close()
+
+	host, _, err := net.SplitHostPort(m.listener.Addr().String())
+	if err != nil || host != modemDefaultHost {
+		t.Errorf("The modem should listen on %v, got %v, %v", modemDefaultHost, host, err)
+	}
+}
+
+func TestModemCloseWithCallPending(t *testing.T) {
+	m, err := newSerialLineModem("0", modemTestClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", m.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The call is never polled, closing the modem drops it
+	m.close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]uint8, 1))
+	if err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("The pending call should be closed, got %v", err)
+	}
+}
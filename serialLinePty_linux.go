@@ -0,0 +1,82 @@
+package izapple2
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// newSerialLinePty creates a pseudo-terminal. The slave side is kept open
+// to have the line connected when no program is using the device.
+func newSerialLinePty() (serialLine, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := int32(0)
+	err = ioctl(master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock)))
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	var number uint32
+	err = ioctl(master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&number)))
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	name := fmt.Sprintf("/dev/pts/%v", number)
+
+	slave, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	err = setRawMode(slave.Fd())
+	if err != nil {
+		master.Close()
+		slave.Close()
+		return nil, err
+	}
+
+	fmt.Printf("Serial line connected to %v\n", name)
+	s := newSerialStream()
+	s.attach(master)
+	return &serialLinePty{s, slave}, nil
+}
+
+type serialLinePty struct {
+	*serialStream
+	slave *os.File
+}
+
+func (s *serialLinePty) close() {
+	s.serialStream.close()
+	s.slave.Close()
+}
+
+func ioctl(fd uintptr, request uintptr, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// setRawMode disables the line discipline as cfmakeraw
+func setRawMode(fd uintptr) error {
+	var t syscall.Termios
+	err := ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&t)))
+	if err != nil {
+		return err
+	}
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8
+	return ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(&t)))
+}
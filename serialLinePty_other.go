@@ -0,0 +1,9 @@
+//go:build !linux
+
+package izapple2
+
+import "errors"
+
+func newSerialLinePty() (serialLine, error) {
+	return nil, errors.New("pseudo-terminals are only supported on Linux")
+}
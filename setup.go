@@ -1,6 +1,7 @@
 package izapple2
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -20,8 +21,10 @@ func configure(configuration *configuration) (*Apple2, error) {
 	a.Name = configuration.get(confName)
 	a.mmu = newMemoryManager(&a)
 	a.video = newVideo(&a)
+	a.scanner = newVideoScanner(&a)
 	a.io = newIoC0Page(&a)
 	a.commandChannel = make(chan command, 100)
+	a.debugger = newDebugger(&a)
 
 	// Configure the board
 	board := configuration.get(confBoard)
@@ -61,8 +64,10 @@ func configure(configuration *configuration) (*Apple2, error) {
 	switch cpu {
 	case "6502":
 		a.cpu = iz6502.NewNMOS6502(a.mmu)
+		a.debugger.disasm = iz6502.NewNMOS6502(&debuggerMemory{a.mmu})
 	case "65c02":
 		a.cpu = iz6502.NewCMOS65c02(a.mmu)
+		a.debugger.disasm = iz6502.NewCMOS65c02(&debuggerMemory{a.mmu})
 	default:
 		return nil, fmt.Errorf("cpu %s not supported, must be '6502' or '65c02'", cpu)
 	}
@@ -80,6 +85,11 @@ func configure(configuration *configuration) (*Apple2, error) {
 		return nil, err
 	}
 
+	err = a.setRewind(configuration.get(confRewind))
+	if err != nil {
+		return nil, err
+	}
+
 	// Add cards on the slots
 	for i := range 8 {
 		cardConfig := configuration.get(fmt.Sprintf("s%v", i))
@@ -123,13 +133,18 @@ func configure(configuration *configuration) (*Apple2, error) {
 		if err != nil {
 			return nil, err
 		}
-		c, err := newCassette(&a, data)
+		c, err := newCassette(&a, data, configuration.getFlag(confTapeTurbo))
 		if err != nil {
 			return nil, fmt.Errorf("could not load the tape %s: %w", tape, err)
 		}
 		a.io.setCassette(c)
 	}
 
+	tapeOut := configuration.get(confTapeOut)
+	if tapeOut != "" && tapeOut != "none" {
+		a.io.setCassetteOutput(newCassetteOutput(&a, tapeOut))
+	}
+
 	nsc := configuration.get(confNsc)
 	if nsc != "none" && nsc != "" {
 		err = setupNoSlotClock(&a, nsc)
@@ -150,6 +165,32 @@ func configure(configuration *configuration) (*Apple2, error) {
 		return nil, err
 	}
 
+	record := configuration.get(confRecord)
+	play := configuration.get(confPlay)
+	if record != "" && record != "none" && play != "" && play != "none" {
+		return nil, errors.New("a movie can't be recorded while playing back another")
+	}
+	if record != "" && record != "none" {
+		err = a.startMovieRecording(record)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if play != "" && play != "none" {
+		err = a.startMoviePlayback(play)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	viceMon := configuration.get(confViceMon)
+	if viceMon != "" && viceMon != "none" {
+		err = a.startViceMonitor(viceMon)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &a, nil
 }
 
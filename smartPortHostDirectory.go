@@ -0,0 +1,694 @@
+package izapple2
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ivanizag/izapple2/prodos"
+	"github.com/ivanizag/izapple2/storage"
+)
+
+/*
+A directory of the host presented as a ProDOS volume.
+
+The ProDOS volume is synthesized with the files of the host directory and its
+subdirectories. The directories, indexes and bitmap are built in memory and
+the data blocks are read from the host files when requested. When the host files change, the volume is
+built again the next time ProDOS reads the volume directory. The files open
+on the Apple II at that moment would be corrupted, close them before
+assembling new versions on the host.
+
+The blocks written by the Apple II are kept in memory. When a block
+of a directory or of the bitmap is written, the changes are copied to the
+host: new files and directories are created, the modified files are written
+and the files deleted on the Apple II are deleted on the host.
+
+The ProDOS file types are stored on a _FileInformation.txt file on each
+directory, with the format used by Cadius:
+	HELLO=Type(06),AuxType(2000),Access(C3)
+The type can also be set on the host file name with a #TTAAAA suffix, as
+HELLO#062000. Without that information the files with the .SYSTEM suffix
+are SYS at $2000, the files with .TXT suffix are TXT and the rest are BIN.
+*/
+
+// SmartPortHostDirectory represents a host directory as a ProDOS volume
+type SmartPortHostDirectory struct {
+	host  *CardSmartPort // For DMA
+	path  string
+	trace bool
+
+	disk     *hostDirectoryDisk
+	files    map[string]string // ProDOS path to host path
+	metadata map[uint16]bool   // Blocks of directories and bitmap
+
+	fingerprint uint64
+	lastCheck   time.Time
+	dirty       bool
+}
+
+const (
+	hostDirectoryBlocks        = 65535
+	hostDirectoryInfoFile      = "_FileInformation.txt"
+	hostDirectoryCheckInterval = 500 * time.Millisecond
+	hostDirectoryMaxFileSize   = 0xffffff
+	hostDirectoryVolumeBlock   = 2
+)
+
+// NewSmartPortHostDirectory creates a ProDOS volume with the files of a host directory
+func NewSmartPortHostDirectory(host *CardSmartPort, path string) (*SmartPortHostDirectory, error) {
+	var d SmartPortHostDirectory
+	d.host = host
+	d.path = path
+	d.disk = newHostDirectoryDisk()
+
+	err := d.build()
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// IsHostDirectory returns true if the path is a directory of the host
+func IsHostDirectory(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func (d *SmartPortHostDirectory) exec(call *smartPortCall) uint8 {
+	var result uint8
+
+	switch call.command {
+	case smartPortCommandStatus:
+		address := call.param16(2)
+		result = d.status(call.statusCode(), address)
+
+	case smartPortCommandReadBlock:
+		address := call.param16(2)
+		block := call.param24(4)
+		result = d.readBlock(block, address)
+
+	case smartPortCommandWriteBlock:
+		address := call.param16(2)
+		block := call.param24(4)
+		result = d.writeBlock(block, address)
+
+	default:
+		// Prodos device command not supported
+		result = smartPortErrorIO
+	}
+
+	if d.trace {
+		fmt.Printf("[SmartPortHostDirectory] Command %v, return %s \n",
+			call, smartPortErrorMessage(result))
+	}
+
+	return result
+}
+
+func (d *SmartPortHostDirectory) readBlock(block uint32, dest uint16) uint8 {
+	if d.trace {
+		fmt.Printf("[SmartPortHostDirectory] Read block %v into $%x.\n", block, dest)
+	}
+
+	if block == hostDirectoryVolumeBlock {
+		d.refresh()
+	}
+
+	data, err := d.disk.Read(block)
+	if err != nil {
+		return smartPortErrorIO
+	}
+
+	// Byte by byte transfer to memory using the full Poke code path
+	for i := uint16(0); i < uint16(len(data)); i++ {
+		d.host.a.mmu.Poke(dest+i, data[i])
+	}
+
+	return smartPortNoError
+}
+
+func (d *SmartPortHostDirectory) writeBlock(block uint32, source uint16) uint8 {
+	if d.trace {
+		fmt.Printf("[SmartPortHostDirectory] Write block %v from $%x.\n", block, source)
+	}
+
+	// Byte by byte transfer from memory using the full Peek code path
+	buf := make([]uint8, storage.ProDosBlockSize)
+	for i := uint16(0); i < uint16(len(buf)); i++ {
+		buf[i] = d.host.a.mmu.Peek(source + i)
+	}
+
+	err := d.disk.Write(block, buf)
+	if err != nil {
+		return smartPortErrorIO
+	}
+	d.dirty = true
+
+	if d.metadata[uint16(block)] {
+		err = d.sync()
+		if err != nil {
+			fmt.Printf("[SmartPortHostDirectory] Error copying the changes to %v: %v\n", d.path, err)
+		}
+	}
+
+	return smartPortNoError
+}
+
+func (d *SmartPortHostDirectory) status(code uint8, dest uint16) uint8 {
+	if d.trace {
+		fmt.Printf("[SmartPortHostDirectory] Status %v into $%x.\n", code, dest)
+	}
+
+	flags := smartPortStatusCodeTypeBlock |
+		smartPortStatusCodeTypeRead |
+		smartPortStatusCodeTypeWrite |
+		smartPortStatusCodeTypeOnline
+	blocks := uint32(hostDirectoryBlocks)
+	status := []uint8{flags, uint8(blocks), uint8(blocks >> 8), uint8(blocks >> 16)}
+
+	switch code {
+	case smartPortStatusCodeDevice:
+		d.host.a.mmu.pokeRange(dest, status)
+
+	case smartPortStatusCodeDeviceInfo:
+		name := "HOST DIRECTORY"
+		dib := append(status, uint8(len(name)))
+		dib = append(dib, []uint8(fmt.Sprintf("%-16s", name))...)
+		dib = append(dib,
+			0x02,       // Type hard disk
+			0x00,       // Subtype
+			0x00, 0x01, // Firmware version
+		)
+		d.host.a.mmu.pokeRange(dest, dib)
+
+	default:
+		return smartPortErrorIO
+	}
+
+	return smartPortNoError
+}
+
+// refresh builds the volume again if the host files have changed
+func (d *SmartPortHostDirectory) refresh() {
+	if d.dirty || time.Since(d.lastCheck) < hostDirectoryCheckInterval {
+		return
+	}
+	d.lastCheck = time.Now()
+	if d.hostFingerprint() == d.fingerprint {
+		return
+	}
+
+	if d.trace {
+		fmt.Printf("[SmartPortHostDirectory] The files on %v have changed, building the volume.\n", d.path)
+	}
+	err := d.build()
+	if err != nil {
+		fmt.Printf("[SmartPortHostDirectory] Error reading %v: %v\n", d.path, err)
+	}
+}
+
+// hostFingerprint is a hash of the names, sizes and modification times of the host files
+func (d *SmartPortHostDirectory) hostFingerprint() uint64 {
+	h := fnv.New64a()
+	filepath.WalkDir(d.path, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != d.path && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err == nil {
+			fmt.Fprintf(h, "%v %v %v\n", path, info.Size(), info.ModTime().UnixNano())
+		}
+		return nil
+	})
+	return h.Sum64()
+}
+
+// build creates the ProDOS volume with the host files
+func (d *SmartPortHostDirectory) build() error {
+	d.disk.reset()
+	name := hostToProDOSName(filepath.Base(d.path), map[string]bool{})
+	volume, err := prodos.Format(d.disk, name)
+	if err != nil {
+		return err
+	}
+
+	d.files = make(map[string]string)
+	err = d.buildDirectory(volume, d.path, "", 0)
+	if err != nil {
+		return err
+	}
+
+	d.fingerprint = d.hostFingerprint()
+	d.dirty = false
+	return d.updateMetadata(volume)
+}
+
+func (d *SmartPortHostDirectory) buildDirectory(volume *prodos.Volume, hostPath string, proDOSPath string, depth int) error {
+	if depth > 16 {
+		return errors.New("too many nested directories")
+	}
+	entries, err := os.ReadDir(hostPath)
+	if err != nil {
+		return err
+	}
+	info := readHostFileInfo(hostPath)
+
+	used := make(map[string]bool)
+	for _, entry := range entries {
+		hostName := entry.Name()
+		if strings.HasPrefix(hostName, ".") || hostName == hostDirectoryInfoFile {
+			continue
+		}
+		fileInfo, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		fileType, auxType, suffix := hostFileType(hostName)
+		name := hostToProDOSName(strings.TrimSuffix(hostName, suffix), used)
+		used[name] = true
+		path := name
+		if proDOSPath != "" {
+			path = proDOSPath + "/" + name
+		}
+		hostFile := filepath.Join(hostPath, hostName)
+
+		if entry.IsDir() {
+			err = volume.Mkdir(path)
+			if err != nil {
+				return err
+			}
+			d.files[path] = hostFile
+			err = d.buildDirectory(volume, hostFile, path, depth+1)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !fileInfo.Mode().IsRegular() || fileInfo.Size() > hostDirectoryMaxFileSize {
+			continue
+		}
+		if i, ok := info[strings.ToUpper(hostName)]; ok {
+			fileType, auxType = i.fileType, i.auxType
+		} else if i, ok := info[name]; ok {
+			fileType, auxType = i.fileType, i.auxType
+		}
+		// The file is created empty, the data is read from the host when needed
+		err = volume.WriteFile(path, make([]uint8, fileInfo.Size()), fileType, auxType)
+		if err != nil {
+			fmt.Printf("[SmartPortHostDirectory] %v not added: %v\n", hostFile, err)
+			continue
+		}
+		blocks, err := volume.DataBlocks(path)
+		if err != nil {
+			return err
+		}
+		d.disk.mapHostFile(blocks, hostFile)
+		d.files[path] = hostFile
+	}
+	return nil
+}
+
+func (d *SmartPortHostDirectory) updateMetadata(volume *prodos.Volume) error {
+	blocks, err := volume.MetadataBlocks()
+	if err != nil {
+		return err
+	}
+	d.metadata = make(map[uint16]bool)
+	for _, b := range blocks {
+		d.metadata[b] = true
+	}
+	return nil
+}
+
+// sync copies the changes on the ProDOS volume to the host
+func (d *SmartPortHostDirectory) sync() error {
+	volume, err := prodos.Open(d.disk)
+	if err != nil {
+		return err
+	}
+
+	present := make(map[string]bool)
+	err = d.syncDirectory(volume, d.path, "", present, 0)
+	if err != nil {
+		return err
+	}
+
+	// Delete the host files removed on the Apple II, the deepest first
+	var removed []string
+	for path := range d.files {
+		if !present[path] {
+			removed = append(removed, path)
+		}
+	}
+	slices.Sort(removed)
+	slices.Reverse(removed)
+	for _, path := range removed {
+		if d.trace {
+			fmt.Printf("[SmartPortHostDirectory] Deleting %v.\n", d.files[path])
+		}
+		err = d.disk.detachHostFile(d.files[path])
+		if err != nil {
+			return err
+		}
+		err = os.Remove(d.files[path])
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		delete(d.files, path)
+	}
+
+	d.fingerprint = d.hostFingerprint()
+	d.dirty = false
+	return d.updateMetadata(volume)
+}
+
+func (d *SmartPortHostDirectory) syncDirectory(volume *prodos.Volume, hostPath string, proDOSPath string, present map[string]bool, depth int) error {
+	if depth > 16 {
+		return errors.New("too many nested directories")
+	}
+	entries, err := volume.ReadDir(proDOSPath)
+	if err != nil {
+		return err
+	}
+	info := readHostFileInfo(hostPath)
+	infoChanged := false
+
+	for _, e := range entries {
+		// The names come from blocks written by the Apple II
+		err = prodos.CheckName(e.Name)
+		if err != nil {
+			fmt.Printf("[SmartPortHostDirectory] %v not copied: %v\n", e.Name, err)
+			continue
+		}
+		path := e.Name
+		if proDOSPath != "" {
+			path = proDOSPath + "/" + e.Name
+		}
+		present[path] = true
+		hostFile, known := d.files[path]
+		if !known {
+			hostFile = filepath.Join(hostPath, e.Name)
+			if !d.isInside(hostFile) {
+				fmt.Printf("[SmartPortHostDirectory] %v not copied, it is outside of %v\n", hostFile, d.path)
+				continue
+			}
+			d.files[path] = hostFile
+		}
+
+		if e.IsDir() {
+			err = os.MkdirAll(hostFile, 0755)
+			if err != nil {
+				return err
+			}
+			err = d.syncDirectory(volume, hostFile, path, present, depth+1)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		data, _, err := volume.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		current, err := os.ReadFile(hostFile)
+		if err != nil || !bytes.Equal(current, data) {
+			if d.trace {
+				fmt.Printf("[SmartPortHostDirectory] Writing %v.\n", hostFile)
+			}
+			err = d.disk.detachHostFile(hostFile)
+			if err != nil {
+				return err
+			}
+			err = os.WriteFile(hostFile, data, 0644)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Keep the file type if it is not the default for the name
+		hostName := strings.ToUpper(filepath.Base(hostFile))
+		fileType, auxType, _ := hostFileType(filepath.Base(hostFile))
+		i, hasInfo := info[hostName]
+		if hasInfo && (i.fileType != e.FileType || i.auxType != e.AuxType) ||
+			!hasInfo && (fileType != e.FileType || auxType != e.AuxType) {
+			info[hostName] = hostFileInfo{e.FileType, e.AuxType, e.Access}
+			infoChanged = true
+		}
+	}
+
+	if infoChanged {
+		return writeHostFileInfo(hostPath, info)
+	}
+	return nil
+}
+
+// isInside returns true if the host path is on the directory of the volume
+func (d *SmartPortHostDirectory) isInside(hostPath string) bool {
+	rel, err := filepath.Rel(d.path, hostPath)
+	return err == nil && rel != "." && rel != ".." &&
+		!strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// hostToProDOSName converts a host file name to a valid ProDOS name not used
+func hostToProDOSName(hostName string, used map[string]bool) string {
+	var name strings.Builder
+	for _, c := range strings.ToUpper(hostName) {
+		if c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' {
+			name.WriteRune(c)
+		} else {
+			name.WriteRune('.')
+		}
+	}
+	s := name.String()
+	if s == "" || s[0] < 'A' || s[0] > 'Z' {
+		s = "A" + s
+	}
+	if len(s) > 15 {
+		s = s[:15]
+	}
+	for i := 1; used[s]; i++ {
+		suffix := strconv.Itoa(i)
+		s = s[:min(len(s), 15-len(suffix))] + suffix
+	}
+	return s
+}
+
+// hostFileType returns the ProDOS type for a host file name and the #TTAAAA suffix if present
+func hostFileType(hostName string) (uint8, uint16, string) {
+	if pos := strings.LastIndex(hostName, "#"); pos != -1 && len(hostName)-pos == 7 {
+		value, err := strconv.ParseUint(hostName[pos+1:], 16, 32)
+		if err == nil {
+			return uint8(value >> 16), uint16(value), hostName[pos:]
+		}
+	}
+
+	upper := strings.ToUpper(hostName)
+	switch {
+	case strings.HasSuffix(upper, ".SYSTEM"):
+		return prodos.FileTypeSYS, 0x2000, ""
+	case strings.HasSuffix(upper, ".TXT"):
+		return prodos.FileTypeTXT, 0, ""
+	}
+	return prodos.FileTypeBIN, 0, ""
+}
+
+type hostFileInfo struct {
+	fileType uint8
+	auxType  uint16
+	access   uint8
+}
+
+// readHostFileInfo parses the _FileInformation.txt file of a directory
+func readHostFileInfo(hostPath string) map[string]hostFileInfo {
+	info := make(map[string]hostFileInfo)
+	file, err := os.Open(filepath.Join(hostPath, hostDirectoryInfoFile))
+	if err != nil {
+		return info
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, fields, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		i := hostFileInfo{prodos.FileTypeBIN, 0, 0xc3}
+		for _, field := range strings.Split(fields, ",") {
+			key, value, _ := strings.Cut(strings.TrimSuffix(field, ")"), "(")
+			n, err := strconv.ParseUint(value, 16, 16)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "Type":
+				i.fileType = uint8(n)
+			case "AuxType":
+				i.auxType = uint16(n)
+			case "Access":
+				i.access = uint8(n)
+			}
+		}
+		info[strings.ToUpper(strings.TrimSpace(name))] = i
+	}
+	return info
+}
+
+func writeHostFileInfo(hostPath string, info map[string]hostFileInfo) error {
+	var b strings.Builder
+	names := slices.Sorted(func(yield func(string) bool) {
+		for name := range info {
+			if !yield(name) {
+				return
+			}
+		}
+	})
+	for _, name := range names {
+		i := info[name]
+		fmt.Fprintf(&b, "%v=Type(%02X),AuxType(%04X),Access(%02X)\n", name, i.fileType, i.auxType, i.access)
+	}
+	return os.WriteFile(filepath.Join(hostPath, hostDirectoryInfoFile), []uint8(b.String()), 0644)
+}
+
+/*
+The block device of the host directory volume. The directories, indexes and
+bitmap built are kept on memory with the blocks written by the Apple II. The
+data blocks of the host files are read from the host when requested. The rest
+of the blocks are empty.
+*/
+type hostDirectoryDisk struct {
+	blocks     map[uint32][]uint8
+	hostBlocks map[uint32]hostBlock
+
+	// The last host file read is kept open
+	openPath string
+	openFile *os.File
+}
+
+type hostBlock struct {
+	path   string
+	offset int64
+}
+
+func newHostDirectoryDisk() *hostDirectoryDisk {
+	var hd hostDirectoryDisk
+	hd.reset()
+	return &hd
+}
+
+func (hd *hostDirectoryDisk) reset() {
+	hd.close()
+	hd.blocks = make(map[uint32][]uint8)
+	hd.hostBlocks = make(map[uint32]hostBlock)
+}
+
+func (hd *hostDirectoryDisk) close() {
+	if hd.openFile != nil {
+		hd.openFile.Close()
+		hd.openFile = nil
+	}
+	hd.openPath = ""
+}
+
+// GetSizeInBlocks returns the number of blocks of the device
+func (hd *hostDirectoryDisk) GetSizeInBlocks() uint32 {
+	return hostDirectoryBlocks
+}
+
+// IsReadOnly returns true if the device is read only
+func (hd *hostDirectoryDisk) IsReadOnly() bool {
+	return false
+}
+
+func (hd *hostDirectoryDisk) Read(block uint32) ([]uint8, error) {
+	if block >= hostDirectoryBlocks {
+		return nil, errors.New("disk block number is too big")
+	}
+
+	buf := make([]uint8, storage.ProDosBlockSize)
+	if data, ok := hd.blocks[block]; ok {
+		copy(buf, data)
+		return buf, nil
+	}
+	if hb, ok := hd.hostBlocks[block]; ok {
+		if hd.openPath != hb.path {
+			hd.close()
+			file, err := os.Open(hb.path)
+			if err != nil {
+				// The host file is gone, the block is no longer used
+				return buf, nil
+			}
+			hd.openPath = hb.path
+			hd.openFile = file
+		}
+		_, err := hd.openFile.ReadAt(buf, hb.offset)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func (hd *hostDirectoryDisk) Write(block uint32, data []uint8) error {
+	if block >= hostDirectoryBlocks {
+		return errors.New("disk block number is too big")
+	}
+
+	delete(hd.hostBlocks, block)
+	if !slices.ContainsFunc(data, func(b uint8) bool { return b != 0 }) {
+		delete(hd.blocks, block)
+		return nil
+	}
+	hd.blocks[block] = slices.Clone(data)
+	return nil
+}
+
+// mapHostFile links the data blocks of a file to the host file
+func (hd *hostDirectoryDisk) mapHostFile(blocks []uint16, path string) {
+	for i, b := range blocks {
+		if b != 0 {
+			hd.hostBlocks[uint32(b)] = hostBlock{path, int64(i) * int64(storage.ProDosBlockSize)}
+		}
+	}
+}
+
+// detachHostFile copies to memory the blocks read from a host file before
+// it is modified or deleted
+func (hd *hostDirectoryDisk) detachHostFile(path string) error {
+	for block, hb := range hd.hostBlocks {
+		if hb.path != path {
+			continue
+		}
+		data, err := hd.Read(block)
+		if err != nil {
+			return err
+		}
+		err = hd.Write(block, data)
+		if err != nil {
+			return err
+		}
+	}
+	if hd.openPath == path {
+		hd.close()
+	}
+	return nil
+}
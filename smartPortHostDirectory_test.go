@@ -0,0 +1,216 @@
+package izapple2
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ivanizag/izapple2/prodos"
+)
+
+func TestHostDirectoryBuild(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "hello world.txt"), []uint8("HELLO"), 0644)
+	os.WriteFile(filepath.Join(dir, "GAME#062000"), []uint8{1, 2, 3}, 0644)
+	os.WriteFile(filepath.Join(dir, "PROG"), []uint8{4, 5}, 0644)
+	os.WriteFile(filepath.Join(dir, ".hidden"), []uint8{6}, 0644)
+	os.WriteFile(filepath.Join(dir, hostDirectoryInfoFile), []uint8("PROG=Type(FC),AuxType(0801),Access(C3)\n"), 0644)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "sub", "A.SYSTEM"), make([]uint8, 1000), 0644)
+
+	d, err := NewSmartPortHostDirectory(nil, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volume, err := prodos.Open(d.disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		path     string
+		fileType uint8
+		auxType  uint16
+	}{
+		{"HELLO.WORLD.TXT", prodos.FileTypeTXT, 0},
+		{"GAME", prodos.FileTypeBIN, 0x2000},
+		{"PROG", prodos.FileTypeBAS, 0x0801},
+		{"SUB", prodos.FileTypeDIR, 0},
+		{"SUB/A.SYSTEM", prodos.FileTypeSYS, 0x2000},
+	}
+	for _, x := range expected {
+		path := x.path
+		e, err := volume.Stat(path)
+		if err != nil {
+			t.Errorf("%v not found: %v", path, err)
+			continue
+		}
+		if e.FileType != x.fileType || !e.IsDir() && e.AuxType != x.auxType {
+			t.Errorf("%v has type $%02x/$%04x, expected $%02x/$%04x", path, e.FileType, e.AuxType, x.fileType, x.auxType)
+		}
+	}
+	entries, err := volume.ReadDir("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("expected 4 entries on the volume, found %v", len(entries))
+	}
+}
+
+func TestHostDirectorySync(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "OLD"), []uint8{1}, 0644)
+	os.WriteFile(filepath.Join(dir, "KEEP"), []uint8{2}, 0644)
+
+	d, err := NewSmartPortHostDirectory(nil, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volume, err := prodos.Open(d.disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes done on the Apple II
+	err = volume.Delete("OLD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = volume.Mkdir("NEW.DIR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = volume.WriteFile("NEW.DIR/BASIC", []uint8{3, 4}, prodos.FileTypeBAS, 0x0801)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "OLD")); !os.IsNotExist(err) {
+		t.Error("OLD should have been deleted on the host")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "NEW.DIR", "BASIC"))
+	if err != nil || len(data) != 2 || data[1] != 4 {
+		t.Errorf("NEW.DIR/BASIC not written on the host: %v %v", data, err)
+	}
+	info := readHostFileInfo(filepath.Join(dir, "NEW.DIR"))
+	if i := info["BASIC"]; i.fileType != prodos.FileTypeBAS || i.auxType != 0x0801 {
+		t.Errorf("type of BASIC not stored on the host, found %+v", i)
+	}
+
+	// Changes done on the host are picked up when the volume directory is read
+	os.WriteFile(filepath.Join(dir, "ADDED"), []uint8{5}, 0644)
+	d.lastCheck = time.Time{}
+	d.refresh()
+	volume, err = prodos.Open(d.disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"ADDED", "KEEP", "NEW.DIR/BASIC"} {
+		if _, err := volume.Stat(path); err != nil {
+			t.Errorf("%v not found after the rebuild: %v", path, err)
+		}
+	}
+}
+
+func TestHostDirectoryDataFromHost(t *testing.T) {
+	dir := t.TempDir()
+	data := testHostData(3000)
+	os.WriteFile(filepath.Join(dir, "OLD"), data, 0644)
+
+	d, err := NewSmartPortHostDirectory(nil, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volume, err := prodos.Open(d.disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := volume.DataBlocks("OLD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range blocks {
+		if _, ok := d.disk.blocks[uint32(b)]; ok {
+			t.Errorf("block %v of OLD is stored in memory", b)
+		}
+	}
+
+	// Renamed on the Apple II, the data is kept after the old file is deleted
+	entries, err := volume.ReadDir("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := d.disk.Read(hostDirectoryVolumeBlock)
+	copy(block[0x2b:], []uint8{entries[0].StorageType<<4 | 3, 'N', 'E', 'W'})
+	d.disk.Write(hostDirectoryVolumeBlock, block)
+	err = d.sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "OLD")); !os.IsNotExist(err) {
+		t.Error("OLD should have been deleted on the host")
+	}
+	read, _, err := volume.ReadFile("NEW")
+	if err != nil || !bytes.Equal(read, data) {
+		t.Errorf("NEW has not the data of OLD: %v", err)
+	}
+	written, err := os.ReadFile(filepath.Join(dir, "NEW"))
+	if err != nil || !bytes.Equal(written, data) {
+		t.Errorf("NEW not written on the host: %v", err)
+	}
+}
+
+func TestHostDirectoryInvalidNames(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "volume")
+	os.Mkdir(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "KEEP"), []uint8{1}, 0644)
+
+	d, err := NewSmartPortHostDirectory(nil, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volume, err := prodos.Open(d.disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = volume.WriteFile("EVIL", []uint8{2}, prodos.FileTypeBIN, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Name changed to ../EVIL on the directory block
+	block, _ := d.disk.Read(hostDirectoryVolumeBlock)
+	for offset := 0x2b; offset+0x27 <= len(block); offset += 0x27 {
+		if string(block[offset+1:offset+5]) == "EVIL" {
+			copy(block[offset:], []uint8{block[offset]&0xf0 | 7, '.', '.', '/', 'E', 'V', 'I', 'L'})
+		}
+	}
+	d.disk.Write(hostDirectoryVolumeBlock, block)
+	err = d.sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "EVIL")); !os.IsNotExist(err) {
+		t.Error("EVIL should not be written outside of the volume directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "KEEP")); err != nil {
+		t.Errorf("KEEP should be kept on the host: %v", err)
+	}
+}
+
+func testHostData(size int) []uint8 {
+	data := make([]uint8, size)
+	for i := range data {
+		data[i] = uint8(i*7 + 1)
+	}
+	return data
+}
@@ -0,0 +1,266 @@
+package izapple2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+/*
+Save states of the full machine.
+
+The state is a sequence of big endian binary values: a header, the CPU
+registers, the memory manager with all the RAM banks, the softswitches
+and the state of every card on the slots. There are no tags, each
+component reads back the same values it wrote, in the same order.
+
+A state can only be restored on a machine with the same configuration,
+the header stores a signature with the board, the memory banks and the
+cards on the slots to verify it.
+
+The diskettes content is not stored, just the name of the image inserted
+and the position of the head. The image is loaded again if it changed.
+*/
+
+const (
+	stateMagic   = "IZA2"
+	stateVersion = uint16(1)
+
+	// DefaultStateFile is the file used by CommandSaveState and CommandLoadState
+	DefaultStateFile = "apple2.state"
+
+	stateMaxBytesLength = 64 * 1024 * 1024
+)
+
+// persistent is implemented by the components with state to be stored on
+// the save states
+type persistent interface {
+	saveState(w io.Writer) error
+	loadState(r io.Reader) error
+}
+
+// SaveState writes the full state of the emulated machine. It is not safe
+// to call it while the emulation is running, use SendSaveState instead.
+func (a *Apple2) SaveState(w io.Writer) error {
+	_, err := w.Write([]byte(stateMagic))
+	if err != nil {
+		return err
+	}
+	version := stateVersion
+	signature := a.stateSignature()
+	err = saveValues(w, &version, &signature)
+	if err != nil {
+		return err
+	}
+
+	err = a.cpu.Save(w)
+	if err != nil {
+		return err
+	}
+
+	cgPage := a.cg.getPage()
+	err = saveValues(w, &a.cycles, &a.irqRequests, &a.dmaActive, &a.dmaSlot, &cgPage)
+	if err != nil {
+		return err
+	}
+
+	err = a.mmu.saveState(w)
+	if err != nil {
+		return err
+	}
+	err = a.io.saveState(w)
+	if err != nil {
+		return err
+	}
+	if v, ok := a.video.(persistent); ok {
+		err = v.saveState(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, c := range a.cards {
+		if c != nil {
+			err = c.saveState(w)
+			if err != nil {
+				return fmt.Errorf("error saving the card in slot %v: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadState restores a state written by SaveState. It is not safe to call
+// it while the emulation is running, use SendLoadState instead. If there
+// is an error the machine can be left on an inconsistent state.
+func (a *Apple2) LoadState(r io.Reader) error {
+	magic := make([]byte, len(stateMagic))
+	_, err := io.ReadFull(r, magic)
+	if err != nil {
+		return err
+	}
+	if string(magic) != stateMagic {
+		return errors.New("not an izapple2 state file")
+	}
+	var version uint16
+	var signature string
+	err = loadValues(r, &version, &signature)
+	if err != nil {
+		return err
+	}
+	if version != stateVersion {
+		return fmt.Errorf("state version %v not supported", version)
+	}
+	if signature != a.stateSignature() {
+		return fmt.Errorf("the state was saved with a different machine configuration: %s", signature)
+	}
+
+	err = a.cpu.Load(r)
+	if err != nil {
+		return err
+	}
+
+	var cgPage int
+	err = loadValues(r, &a.cycles, &a.irqRequests, &a.dmaActive, &a.dmaSlot, &cgPage)
+	if err != nil {
+		return err
+	}
+	a.cg.setPage(cgPage)
+	a.cpu.SetIRQ(a.irqRequests != 0)
+
+	err = a.mmu.loadState(r)
+	if err != nil {
+		return err
+	}
+	err = a.io.loadState(r)
+	if err != nil {
+		return err
+	}
+	if v, ok := a.video.(persistent); ok {
+		err = v.loadState(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, c := range a.cards {
+		if c != nil {
+			err = c.loadState(r)
+			if err != nil {
+				return fmt.Errorf("error loading the card in slot %v: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// stateSignature describes the parts of the configuration that define
+// the layout of the state
+func (a *Apple2) stateSignature() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s,lc:%v,ext:%v", a.board, len(a.mmu.physicalLangRAM), len(a.mmu.physicalExtRAM))
+	if a.io.cassette != nil {
+		sb.WriteString(",tape")
+	}
+	for i, c := range a.cards {
+		if c != nil {
+			fmt.Fprintf(&sb, ",s%v:%s", i, c.GetName())
+		}
+	}
+	return sb.String()
+}
+
+func (a *Apple2) saveStateToFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return a.SaveState(f)
+}
+
+func (a *Apple2) loadStateFromFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return a.LoadState(f)
+}
+
+/*
+saveValues and loadValues serialize a list of pointers to the fields of
+a component. The values with fixed size are written as is. The int fields
+are stored as int64. The strings and the pointers to byte slices are
+stored with its length, the slices, not the pointers, are read in place
+with the existing length.
+*/
+func saveValues(w io.Writer, values ...any) error {
+	for _, value := range values {
+		var err error
+		switch v := value.(type) {
+		case *int:
+			err = binary.Write(w, binary.BigEndian, int64(*v))
+		case *string:
+			err = saveBytes(w, []byte(*v))
+		case *[]uint8:
+			err = saveBytes(w, *v)
+		default:
+			err = binary.Write(w, binary.BigEndian, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadValues(r io.Reader, values ...any) error {
+	for _, value := range values {
+		var err error
+		switch v := value.(type) {
+		case *int:
+			var i int64
+			err = binary.Read(r, binary.BigEndian, &i)
+			*v = int(i)
+		case *string:
+			var data []byte
+			data, err = loadBytes(r)
+			*v = string(data)
+		case *[]uint8:
+			*v, err = loadBytes(r)
+		default:
+			err = binary.Read(r, binary.BigEndian, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func saveBytes(w io.Writer, data []uint8) error {
+	err := binary.Write(w, binary.BigEndian, uint32(len(data)))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func loadBytes(r io.Reader) ([]uint8, error) {
+	var length uint32
+	err := binary.Read(r, binary.BigEndian, &length)
+	if err != nil {
+		return nil, err
+	}
+	if length > stateMaxBytesLength {
+		return nil, errors.New("invalid length on the state data")
+	}
+	data := make([]uint8, length)
+	_, err = io.ReadFull(r, data)
+	return data, err
+}
@@ -0,0 +1,97 @@
+package izapple2
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	a, card := makeMockingboardTester(t)
+
+	a.mmu.Poke(0x2000, 0x12)
+	a.mmu.Poke(0xc404, 0x00) // Start VIA 1 T1 with 0x2000 cycles
+	a.mmu.Poke(0xc405, 0x20)
+	a.cycles += 100
+	card.tick()
+
+	var buf bytes.Buffer
+	err := a.SaveState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.mmu.Poke(0x2000, 0x34)
+	a.mmu.Poke(0xc405, 0x10)
+	a.cycles += 500
+	card.tick()
+
+	err = a.LoadState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.mmu.Peek(0x2000) != 0x12 {
+		t.Error("The RAM should be restored")
+	}
+	counter := uint16(a.mmu.Peek(0xc404)) | uint16(a.mmu.Peek(0xc405))<<8
+	if counter != 0x2000-100 {
+		t.Errorf("The VIA timer should be restored, got 0x%04x", counter)
+	}
+}
+
+func TestStateConfigurationMismatch(t *testing.T) {
+	a, _ := makeMockingboardTester(t)
+	var buf bytes.Buffer
+	err := a.SaveState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at, err := makeApple2Tester("2plus", newConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = at.a.LoadState(&buf)
+	if err == nil {
+		t.Error("The state should not load on a different configuration")
+	}
+}
+
+func TestStateLoadWithWoz(t *testing.T) {
+	overrides := newConfiguration()
+	overrides.set(confS6, "diskii,disk1=\"woz_test_images/DOS 3.3 System Master.woz\"")
+	at, err := makeApple2Tester("2enh", overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := at.a
+
+	a.mmu.Peek(0xc0e9) // Motor on
+	a.cycles += 1000
+	a.mmu.Peek(0xc0ec)
+
+	var buf bytes.Buffer
+	err = a.SaveState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.cycles += 100000
+	a.mmu.Peek(0xc0ec)
+
+	err = a.LoadState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan bool)
+	go func() {
+		a.cycles += 100
+		a.mmu.Peek(0xc0ec)
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The diskette read after the state load does not end")
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 /*
@@ -62,6 +64,30 @@ func NewBlockDiskFile(file *os.File, readOnly bool) (BlockDisk, error) {
 	return &bd, nil
 }
 
+// OpenBlockDiskImage opens a block device on a PO, HDV, 2MG, DSK or DO file.
+// The 140K images with the .dsk or .do extension are in DOS order.
+func OpenBlockDiskImage(filename string, readOnly bool) (BlockDisk, error) {
+	flag := os.O_RDWR
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+	file, err := os.OpenFile(filename, flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	bd, err := NewBlockDiskFile(file, readOnly)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == ".dsk" || ext == ".do" {
+		return NewBlockDiskDosOrder(bd)
+	}
+	return bd, nil
+}
+
 func NewBlockDiskMemory(data []uint8) (BlockDisk, error) {
 	var bd blockDiskMemory
 	bd.data = data
@@ -75,6 +101,17 @@ func NewBlockDiskMemory(data []uint8) (BlockDisk, error) {
 	return &bd, nil
 }
 
+// NewBlockDiskMemoryWriteable creates a block device on memory, the writes
+// modify the data slice
+func NewBlockDiskMemoryWriteable(data []uint8) (BlockDisk, error) {
+	bd, err := NewBlockDiskMemory(data)
+	if err != nil {
+		return nil, err
+	}
+	bd.(*blockDiskMemory).readOnly = false
+	return bd, nil
+}
+
 func getBlockAndOffset(reader io.Reader, size uint32) (uint32, uint32, error) {
 	header, err := parse2mg(reader, size)
 	if err == nil {
@@ -148,5 +185,14 @@ func (bd *blockDiskFile) Write(block uint32, data []uint8) error {
 }
 
 func (bd *blockDiskMemory) Write(block uint32, data []uint8) error {
-	return errors.New("can't write in a readonly disk")
+	if bd.readOnly {
+		return errors.New("can't write in a readonly disk")
+	}
+	if block >= bd.blocks {
+		return errors.New("disk block number is too big")
+	}
+
+	offset := bd.dataOffset + block*ProDosBlockSize
+	copy(bd.data[offset:offset+ProDosBlockSize], data)
+	return nil
 }
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"errors"
+)
+
+/*
+ProDOS blocks on a 140K image with the sectors in DOS 3.3 order, as the
+.dsk and .do files. Every block uses two sectors of the track, they are
+remapped to the position they have on the file.
+*/
+
+type blockDiskDosOrder struct {
+	disk BlockDisk // The file as a raw sequence of 512 bytes blocks
+}
+
+// NewBlockDiskDosOrder exposes the ProDOS blocks of a 140K image in DOS 3.3 order
+func NewBlockDiskDosOrder(disk BlockDisk) (BlockDisk, error) {
+	if disk.GetSizeInBlocks() != dskImageSize/ProDosBlockSize {
+		return nil, errors.New("only 140K images can be in DOS order")
+	}
+	return &blockDiskDosOrder{disk}, nil
+}
+
+// sectorOffset returns the position on the file of the 256 bytes half of a block
+func (bd *blockDiskDosOrder) sectorOffset(block uint32, half int) uint32 {
+	track := block / 8
+	proDosSector := int(block%8)*2 + half
+	for physical, v := range prodosSectorsLogicalOrder {
+		if v == proDosSector {
+			return track*bytesPerTrack + uint32(dos33SectorsLogicalOrder[physical])*bytesPerSector
+		}
+	}
+	return 0 // Not possible
+}
+
+func (bd *blockDiskDosOrder) GetSizeInBlocks() uint32 {
+	return bd.disk.GetSizeInBlocks()
+}
+
+func (bd *blockDiskDosOrder) IsReadOnly() bool {
+	return bd.disk.IsReadOnly()
+}
+
+func (bd *blockDiskDosOrder) Read(block uint32) ([]uint8, error) {
+	if block >= bd.GetSizeInBlocks() {
+		return nil, errors.New("disk block number is too big")
+	}
+
+	data := make([]uint8, 0, ProDosBlockSize)
+	for half := range 2 {
+		offset := bd.sectorOffset(block, half)
+		raw, err := bd.disk.Read(offset / ProDosBlockSize)
+		if err != nil {
+			return nil, err
+		}
+		start := offset % ProDosBlockSize
+		data = append(data, raw[start:start+bytesPerSector]...)
+	}
+	return data, nil
+}
+
+func (bd *blockDiskDosOrder) Write(block uint32, data []uint8) error {
+	if block >= bd.GetSizeInBlocks() {
+		return errors.New("disk block number is too big")
+	}
+
+	for half := range 2 {
+		offset := bd.sectorOffset(block, half)
+		raw, err := bd.disk.Read(offset / ProDosBlockSize)
+		if err != nil {
+			return err
+		}
+		raw = append([]uint8(nil), raw...)
+		start := offset % ProDosBlockSize
+		copy(raw[start:start+bytesPerSector], data[half*bytesPerSector:])
+		err = bd.disk.Write(offset/ProDosBlockSize, raw)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
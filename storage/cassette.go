@@ -87,3 +87,111 @@ func extractTransitions(wav *wavFile, cyclesPerSecond float64) []uint64 {
 
 	return transitions
 }
+
+// Sample rate and amplitude of the tapes saved
+const (
+	tapeSaveSampleRate = 44100
+	tapeSaveAmplitude  = 0x6000
+)
+
+// EncodeTape builds a WAV recording of a cassette tape from the CPU
+// cycles, from the start of the recording, at which the cassette output
+// toggles. The signal is a square wave flipping on each toggle.
+func EncodeTape(transitions []uint64, cyclesPerSecond float64) []uint8 {
+	if len(transitions) == 0 {
+		return encodeWavFile(nil, tapeSaveSampleRate)
+	}
+
+	framesPerCycle := tapeSaveSampleRate / cyclesPerSecond
+	// The level after the last toggle is kept for a millisecond for the
+	// last zero crossing to be detected, then some silence
+	last := float64(transitions[len(transitions)-1]) * framesPerCycle
+	end := int(last) + tapeSaveSampleRate/1000
+	samples := make([]int16, end+tapeSaveSampleRate/10)
+
+	level := int16(-tapeSaveAmplitude)
+	cursor := 0
+	for frame := range end {
+		cycle := uint64(float64(frame) / framesPerCycle)
+		for cursor < len(transitions) && transitions[cursor] <= cycle {
+			level = -level
+			cursor++
+		}
+		samples[frame] = level
+	}
+
+	return encodeWavFile(samples, tapeSaveSampleRate)
+}
+
+/*
+Decoder of the Apple II Monitor ROM tape format, used to load the tapes
+directly to memory. Each recording has a 770 Hz header tone, a sync cycle
+with a short first half, then the bytes MSB first with 2 kHz cycles for "0"
+bits and 1 kHz cycles for "1" bits. The last byte is the checksum, but as
+the length is not stored on the tape, it is known only by the caller.
+*/
+
+// Half-cycle and cycle limits, in microseconds
+const (
+	tapeHeaderMinHalf = 500  // 650 for the 770 Hz tone
+	tapeHeaderMaxHalf = 900  // 650 for the 770 Hz tone
+	tapeHeaderMinRun  = 64   // Half-cycles to detect a header tone
+	tapeOneMinCycle   = 750  // 500 for "0" and 1000 for "1"
+	tapeOneMaxCycle   = 1250 // Longer cycles end the data
+)
+
+// TapeBlock is the data of a recording on a tape
+type TapeBlock struct {
+	Start int     // Index of the first transition of the header tone
+	End   int     // Index of the transition after the data
+	Data  []uint8 // Data bytes followed by the checksum
+}
+
+// DecodeTape finds the recordings on the zero crossings of a tape
+func DecodeTape(transitions []uint64, cyclesPerSecond float64) []TapeBlock {
+	cyclesPerMicro := cyclesPerSecond / 1_000_000
+	half := func(i int) float64 {
+		return float64(transitions[i+1]-transitions[i]) / cyclesPerMicro
+	}
+
+	var blocks []TapeBlock
+	i := 0
+	for i+1 < len(transitions) {
+		// Header tone
+		start := i
+		for i+1 < len(transitions) && half(i) >= tapeHeaderMinHalf && half(i) <= tapeHeaderMaxHalf {
+			i++
+		}
+		if i-start < tapeHeaderMinRun || i+1 >= len(transitions) || half(i) >= tapeHeaderMinHalf {
+			i++
+			continue
+		}
+
+		// Sync cycle, then the bits
+		i += 2
+		block := TapeBlock{Start: start}
+		var value uint8
+		bits := 0
+		for i+2 < len(transitions) {
+			cycle := half(i) + half(i+1)
+			if cycle >= tapeOneMaxCycle {
+				break
+			}
+			value <<= 1
+			if cycle >= tapeOneMinCycle {
+				value |= 1
+			}
+			bits++
+			if bits == 8 {
+				block.Data = append(block.Data, value)
+				bits = 0
+			}
+			i += 2
+		}
+		block.End = i
+		if len(block.Data) > 0 {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
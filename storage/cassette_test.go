@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTapeEncodeRoundTrip(t *testing.T) {
+	const cyclesPerSecond = 1_020_484
+	// A 770 Hz header followed by 2 kHz and 1 kHz cycles
+	var transitions []uint64
+	cycle := uint64(1000)
+	for i := range 2000 {
+		half := uint64(cyclesPerSecond / 770 / 2)
+		if i >= 1000 {
+			half = cyclesPerSecond / 2000 / 2
+			if i%4 >= 2 {
+				half = cyclesPerSecond / 1000 / 2
+			}
+		}
+		cycle += half
+		transitions = append(transitions, cycle)
+	}
+
+	wav := EncodeTape(transitions, cyclesPerSecond)
+	decoded, err := MakeTape(wav, cyclesPerSecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded) != len(transitions) {
+		t.Fatalf("expected %v transitions, got %v", len(transitions), len(decoded))
+	}
+	// The resolution is one sample, about 23 cycles
+	tolerance := uint64(2 * cyclesPerSecond / tapeSaveSampleRate)
+	for i := range transitions {
+		if decoded[i]+tolerance < transitions[i] || decoded[i] > transitions[i]+tolerance {
+			t.Fatalf("transition %v at cycle %v, expected %v", i, decoded[i], transitions[i])
+		}
+	}
+}
+
+type testTape struct {
+	transitions []uint64
+	cycle       float64
+}
+
+func (t *testTape) half(microseconds float64) {
+	t.cycle += microseconds * 1.020484
+	t.transitions = append(t.transitions, uint64(t.cycle))
+}
+
+func (t *testTape) record(data []uint8) {
+	for range 2000 {
+		t.half(650) // Header tone
+	}
+	t.half(200) // Sync
+	t.half(250)
+	for _, value := range data {
+		for i := 7; i >= 0; i-- {
+			duration := 250.0
+			if value&(1<<i) != 0 {
+				duration = 500.0
+			}
+			t.half(duration)
+			t.half(duration)
+		}
+	}
+	for range 100 {
+		t.half(650) // Trailing tone
+	}
+}
+
+func TestDecodeTape(t *testing.T) {
+	var tape testTape
+	tape.half(100_000) // Noise before the recordings
+	first := []uint8{0x12, 0x34, 0xcb}
+	second := []uint8{0x00, 0xff, 0xa5, 0x5a, 0x3a}
+	tape.record(first)
+	tape.cycle += 2_000_000 // Silence
+	tape.record(second)
+
+	blocks := DecodeTape(tape.transitions, 1_020_484)
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 recordings, found %v", len(blocks))
+	}
+	if !bytes.Equal(blocks[0].Data, first) {
+		t.Errorf("first recording is %x, expected %x", blocks[0].Data, first)
+	}
+	if !bytes.Equal(blocks[1].Data, second) {
+		t.Errorf("second recording is %x, expected %x", blocks[1].Data, second)
+	}
+	if blocks[0].End > blocks[1].Start {
+		t.Errorf("the first recording ends at %v, after the start of the second at %v", blocks[0].End, blocks[1].Start)
+	}
+}
@@ -0,0 +1,443 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Conversion between the disk image formats.
+
+The source image is decoded to the lowest level available: the bits of the
+tracks for WOZ and A2R, the nibbles for NIB, the sectors for DSK, DO and
+PO, and the ProDOS blocks for 2MG and the images that are not 140K. Then it
+is encoded on the target format. Going from a lower level to a higher one
+loses information, only the standard sectors are recovered. The warnings
+returned tell what has been lost.
+
+When converting nibbles to bits, the runs of five or more 0xff nibbles are
+considered sync gaps and are written as 10 bits self sync bytes.
+*/
+
+// DiskFormat is the format of a disk image file
+type DiskFormat int
+
+const (
+	// DiskFormatUnknown is a format not supported
+	DiskFormatUnknown DiskFormat = iota
+	// DiskFormatDO is a 140K image with the sectors in DOS 3.3 order, .dsk or .do
+	DiskFormatDO
+	// DiskFormatPO is an image with the ProDOS blocks in order, .po or .hdv
+	DiskFormatPO
+	// DiskFormatNIB is a 5.25 image with 6656 nibbles per track
+	DiskFormatNIB
+	// DiskFormatWOZ is a WOZ 2 image with the bits of the tracks
+	DiskFormatWOZ
+	// DiskFormat2MG is a ProDOS image with the 2MG header
+	DiskFormat2MG
+	// DiskFormatA2R is a flux capture from the Applesauce, only as source
+	DiskFormatA2R
+)
+
+const (
+	wozGap1Syncs       = 16 // Shorter than the NIB gap to fit the track on a WOZ track
+	nibMinSyncRun      = 5
+	file2mgHeaderSize  = 64
+	file2mgCreatorCode = uint32('I') | uint32('Z')<<8 | uint32('A')<<16 | uint32('2')<<24
+)
+
+func (f DiskFormat) String() string {
+	switch f {
+	case DiskFormatDO:
+		return "DO"
+	case DiskFormatPO:
+		return "PO"
+	case DiskFormatNIB:
+		return "NIB"
+	case DiskFormatWOZ:
+		return "WOZ"
+	case DiskFormat2MG:
+		return "2MG"
+	case DiskFormatA2R:
+		return "A2R"
+	}
+	return "unknown"
+}
+
+// ParseDiskFormat returns the format for a name or a file extension
+func ParseDiskFormat(name string) DiskFormat {
+	name = strings.ToLower(name)
+	if ext := filepath.Ext(name); ext != "" {
+		name = ext[1:]
+	}
+
+	switch name {
+	case "dsk", "do":
+		return DiskFormatDO
+	case "po", "hdv":
+		return DiskFormatPO
+	case "nib":
+		return DiskFormatNIB
+	case "woz":
+		return DiskFormatWOZ
+	case "2mg", "2img":
+		return DiskFormat2MG
+	case "a2r":
+		return DiskFormatA2R
+	}
+	return DiskFormatUnknown
+}
+
+// diskImageLevels has the data of an image at the lowest level available
+type diskImageLevels struct {
+	woz     *FileWoz
+	nibbles [][]uint8 // 35 tracks of nibbles
+	sectors []uint8   // 140K in DOS 3.3 order
+	blocks  []uint8   // ProDOS blocks
+}
+
+// ConvertDisk converts a disk image from one format to another. It returns
+// warnings about the information lost on the conversion.
+func ConvertDisk(data []uint8, from DiskFormat, to DiskFormat) ([]uint8, []string, error) {
+	var warnings []string
+	warn := func(format string, a ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, a...))
+	}
+
+	source, err := decodeDiskImage(data, from)
+	if err != nil {
+		return nil, nil, err
+	}
+	if source.woz != nil && source.woz.Info.DiskType == 1 && source.woz.Info.BootSectorFormat == 2 &&
+		to != DiskFormatWOZ && to != DiskFormatNIB {
+		return nil, nil, errors.New("13 sector disks can only be converted to WOZ or NIB")
+	}
+
+	var out []uint8
+	switch to {
+	case DiskFormatWOZ:
+		out, err = source.encodeWoz(warn)
+	case DiskFormatNIB:
+		out, err = source.encodeNib(warn)
+	case DiskFormatDO:
+		out, err = source.encodeSectors(warn)
+	case DiskFormatPO:
+		out, err = source.encodeBlocks(warn)
+	case DiskFormat2MG:
+		out, err = source.encodeBlocks(warn)
+		if err == nil {
+			out = encode2mg(out)
+		}
+	default:
+		err = fmt.Errorf("conversion to %v not supported", to)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, warnings, nil
+}
+
+func decodeDiskImage(data []uint8, from DiskFormat) (*diskImageLevels, error) {
+	var d diskImageLevels
+	switch from {
+	case DiskFormatWOZ, DiskFormatA2R:
+		f, err := MakeFileWoz(data)
+		if err != nil {
+			return nil, err
+		}
+		d.woz = f
+
+	case DiskFormatNIB:
+		if !isFileNib(data) {
+			return nil, errors.New("invalid size for a NIB image")
+		}
+		for i := range numberOfTracks {
+			d.nibbles = append(d.nibbles, data[nibBytesPerTrack*i:nibBytesPerTrack*(i+1)])
+		}
+
+	case DiskFormatDO:
+		if !isFileDsk(data) {
+			return nil, errors.New("invalid size for a DOS ordered image, it must be 140K")
+		}
+		d.sectors = data
+
+	case DiskFormatPO, DiskFormat2MG:
+		bd, err := NewBlockDiskMemory(data)
+		if err != nil {
+			return nil, err
+		}
+		if from == DiskFormat2MG && isFileDsk(data) {
+			return nil, errors.New("the image has no 2MG header")
+		}
+		d.blocks = make([]uint8, 0, bd.GetSizeInBlocks()*ProDosBlockSize)
+		for i := range bd.GetSizeInBlocks() {
+			block, err := bd.Read(i)
+			if err != nil {
+				return nil, err
+			}
+			d.blocks = append(d.blocks, block...)
+		}
+		if isFileDsk(d.blocks) {
+			d.sectors = reorderSectors(d.blocks, &prodosSectorsLogicalOrder, &dos33SectorsLogicalOrder)
+			d.blocks = nil
+		}
+
+	default:
+		return nil, fmt.Errorf("conversion from %v not supported", from)
+	}
+	return &d, nil
+}
+
+// reorderSectors changes the logical order of the sectors of a 140K image
+func reorderSectors(data []uint8, from *[16]int, to *[16]int) []uint8 {
+	out := make([]uint8, len(data))
+	for track := range numberOfTracks {
+		for physical := range numberOfSectors {
+			src := track*bytesPerTrack + from[physical]*bytesPerSector
+			dst := track*bytesPerTrack + to[physical]*bytesPerSector
+			copy(out[dst:dst+bytesPerSector], data[src:src+bytesPerSector])
+		}
+	}
+	return out
+}
+
+func (d *diskImageLevels) is35() bool {
+	return d.woz != nil && d.woz.Info.DiskType == 2
+}
+
+// getNibbles returns the nibbles of the 35 tracks of a 5.25 disk
+func (d *diskImageLevels) getNibbles(warn func(string, ...any)) ([][]uint8, error) {
+	if d.nibbles != nil {
+		return d.nibbles, nil
+	}
+
+	if d.sectors != nil {
+		var nibbles [][]uint8
+		for i := range numberOfTracks {
+			trackData := d.sectors[i*bytesPerTrack : (i+1)*bytesPerTrack]
+			nibbles = append(nibbles, nibEncodeTrack(trackData, defaultVolumeTag, byte(i), &dos33SectorsLogicalOrder))
+		}
+		return nibbles, nil
+	}
+
+	if d.woz != nil && !d.is35() {
+		warn("the bit timing and the sync bits are lost")
+		var nibbles [][]uint8
+		for i := range numberOfTracks {
+			if d.woz.trackMap[i*4] == 0xff {
+				nibbles = append(nibbles, nil)
+				continue
+			}
+			nibbles = append(nibbles, d.woz.DumpTrackAsNib(i*4))
+		}
+		if d.woz.hasQuarterTracks() {
+			warn("the half and quarter tracks are lost")
+		}
+		if d.woz.fluxMap != nil {
+			warn("the flux tracks are lost")
+		}
+		return nibbles, nil
+	}
+
+	return nil, errors.New("the image is not a 5.25 disk")
+}
+
+// getSectors returns the 140K of a 5.25 disk in DOS 3.3 order
+func (d *diskImageLevels) getSectors(warn func(string, ...any)) ([]uint8, error) {
+	if d.sectors != nil {
+		return d.sectors, nil
+	}
+	if d.blocks != nil {
+		return nil, errors.New("only 140K images can be used as 5.25 disks")
+	}
+
+	nibbles, err := d.getNibbles(func(string, ...any) {})
+	if err != nil {
+		return nil, err
+	}
+
+	warn("only the standard sectors are kept, copy protections and non standard formats are lost")
+	data := make([]uint8, 0, dskImageSize)
+	for i, track := range nibbles {
+		sectors, found, _ := nibDecodeTrackSectors(track, &dos33SectorsLogicalOrder)
+		if found != 0xffff {
+			missing := 0
+			for s := range numberOfSectors {
+				if found&(1<<s) == 0 {
+					missing++
+				}
+			}
+			warn("track %v: %v sectors are missing or damaged", i, missing)
+		}
+		data = append(data, sectors...)
+	}
+	return data, nil
+}
+
+// getBlocks returns the ProDOS blocks
+func (d *diskImageLevels) getBlocks(warn func(string, ...any)) ([]uint8, error) {
+	if d.blocks != nil {
+		return d.blocks, nil
+	}
+
+	if d.is35() {
+		warn("only the standard sectors are kept, the tags and copy protections are lost")
+		diskette, err := newDisketteWoz35(d.woz, false)
+		if err != nil {
+			return nil, err
+		}
+		disk := NewBlockDisk35(diskette)
+		blocks := disk.GetSizeInBlocks()
+		data := make([]uint8, 0, blocks*ProDosBlockSize)
+		for i := range blocks {
+			block, err := disk.Read(i)
+			if err != nil {
+				warn("block %v: %v", i, err)
+				block = make([]uint8, ProDosBlockSize)
+			}
+			data = append(data, block...)
+		}
+		return data, nil
+	}
+
+	sectors, err := d.getSectors(warn)
+	if err != nil {
+		return nil, err
+	}
+	return reorderSectors(sectors, &dos33SectorsLogicalOrder, &prodosSectorsLogicalOrder), nil
+}
+
+func (d *diskImageLevels) encodeSectors(warn func(string, ...any)) ([]uint8, error) {
+	return d.getSectors(warn)
+}
+
+func (d *diskImageLevels) encodeBlocks(warn func(string, ...any)) ([]uint8, error) {
+	return d.getBlocks(warn)
+}
+
+func (d *diskImageLevels) encodeNib(warn func(string, ...any)) ([]uint8, error) {
+	nibbles, err := d.getNibbles(warn)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]uint8, 0, nibImageSize)
+	for i, track := range nibbles {
+		if len(track) > nibBytesPerTrack {
+			warn("track %v: %v nibbles are truncated", i, len(track)-nibBytesPerTrack)
+			track = track[:nibBytesPerTrack]
+		}
+		data = append(data, track...)
+		for range nibBytesPerTrack - len(track) {
+			data = append(data, 0xff)
+		}
+	}
+	return data, nil
+}
+
+func (d *diskImageLevels) encodeWoz(warn func(string, ...any)) ([]uint8, error) {
+	if d.woz != nil {
+		info := d.woz.Info
+		if d.woz.version < 2 {
+			// Fields not present on WOZ 1
+			info.DiskSides = 1
+			info.OptimalBitTiming = uint8(d.woz.BitTiming())
+		}
+		return encodeWoz2(info, d.woz.trackMap, d.woz.fluxMap, d.woz.tracks[:], d.woz.meta), nil
+	}
+
+	if d.blocks != nil {
+		f, err := NewFileWozFromBlocks35(d.blocks)
+		if err != nil {
+			return nil, err
+		}
+		return f.raw, nil
+	}
+
+	var nibbles [][]uint8
+	if d.sectors != nil {
+		for i := range numberOfTracks {
+			trackData := d.sectors[i*bytesPerTrack : (i+1)*bytesPerTrack]
+			nibbles = append(nibbles, nibEncodeTrackGap(trackData, defaultVolumeTag, byte(i), &dos33SectorsLogicalOrder, wozGap1Syncs))
+		}
+	} else {
+		nibbles = d.nibbles
+	}
+
+	var info woz2Info
+	info.DiskType = 1
+	info.DiskSides = 1
+	info.BootSectorFormat = 1 // 16 sectors
+	info.OptimalBitTiming = wozDefaultBitTiming
+	copy(info.Creator[:], []uint8("izapple2                        "))
+
+	trackMap := bytes.Repeat([]uint8{0xff}, wozMaxTrack)
+	var tracks []disketteTrackWoz
+	for i, track := range nibbles {
+		// The quarter tracks next to the track are mapped to it
+		for qt := i*4 - 1; qt <= i*4+1; qt++ {
+			if qt >= 0 {
+				trackMap[qt] = uint8(i)
+			}
+		}
+		tracks = append(tracks, nibblesToWozTrack(track))
+	}
+	return encodeWoz2(info, trackMap, nil, tracks, nil), nil
+}
+
+// nibblesToWozTrack converts the nibbles to bits, the 0xff on long runs are
+// sync bytes with two extra zero bits.
+func nibblesToWozTrack(nibbles []uint8) disketteTrackWoz {
+	var t disketteTrackWoz
+	for i := 0; i < len(nibbles); {
+		run := 0
+		for i+run < len(nibbles) && nibbles[i+run] == 0xff {
+			run++
+		}
+		if run >= nibMinSyncRun {
+			t.appendSync(run)
+			i += run
+			continue
+		}
+		t.appendByte(nibbles[i])
+		i++
+	}
+	return t
+}
+
+// hasQuarterTracks returns true if there is data not on the whole tracks
+func (f *FileWoz) hasQuarterTracks() bool {
+	whole := make(map[uint8]bool)
+	for qt := 0; qt < len(f.trackMap); qt += 4 {
+		whole[f.trackMap[qt]] = true
+	}
+	for _, track := range f.trackMap {
+		if track != 0xff && !whole[track] {
+			return true
+		}
+	}
+	return false
+}
+
+// encode2mg adds the 2MG header to a ProDOS ordered image
+func encode2mg(data []uint8) []uint8 {
+	var header file2mgHeader
+	header.Preamble = file2mgPreamble
+	header.Creator = file2mgCreatorCode
+	header.HeaderSize = file2mgHeaderSize
+	header.Version = file2mgVersion
+	header.Format = file2mgFormatProdos
+	header.Blocks = uint32(len(data)) / ProDosBlockSize
+	header.OffsetData = file2mgHeaderSize
+	header.LengthData = uint32(len(data))
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.LittleEndian, &header)
+	out.Write(make([]uint8, file2mgHeaderSize-out.Len()))
+	out.Write(data)
+	return out.Bytes()
+}
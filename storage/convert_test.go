@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func makeTestDsk() []uint8 {
+	data := make([]uint8, dskImageSize)
+	for i := range data {
+		data[i] = uint8(i*7 + i/bytesPerSector)
+	}
+	return data
+}
+
+func TestConvertDskRoundTrips(t *testing.T) {
+	dsk := makeTestDsk()
+	for _, format := range []DiskFormat{DiskFormatWOZ, DiskFormatNIB, DiskFormatPO, DiskFormat2MG} {
+		converted, _, err := ConvertDisk(dsk, DiskFormatDO, format)
+		if err != nil {
+			t.Fatalf("DO to %v: %v", format, err)
+		}
+		back, warnings, err := ConvertDisk(converted, format, DiskFormatDO)
+		if err != nil {
+			t.Fatalf("%v to DO: %v", format, err)
+		}
+		if !bytes.Equal(dsk, back) {
+			t.Errorf("DO to %v and back differs, warnings: %v", format, warnings)
+		}
+	}
+}
+
+func TestConvertDoToPo(t *testing.T) {
+	dsk := makeTestDsk()
+	po, warnings, err := ConvertDisk(dsk, DiskFormatDO, DiskFormatPO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("no warnings expected, got %v", warnings)
+	}
+
+	// Block 1 is on the DOS sectors 0x0d and 0x0c of track 0
+	if !bytes.Equal(po[512:768], dsk[0x0d*256:0x0e*256]) ||
+		!bytes.Equal(po[768:1024], dsk[0x0c*256:0x0d*256]) {
+		t.Error("block 1 doesn't match the DOS sectors")
+	}
+}
+
+func TestConvert35WozToPo(t *testing.T) {
+	po := make([]uint8, gcr35Blocks800K*ProDosBlockSize)
+	for i := range po {
+		po[i] = uint8(i / 3)
+	}
+	woz, _, err := ConvertDisk(po, DiskFormatPO, DiskFormatWOZ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	twomg, _, err := ConvertDisk(woz, DiskFormatWOZ, DiskFormat2MG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(twomg) != file2mgHeaderSize+len(po) {
+		t.Fatalf("unexpected 2MG size %v", len(twomg))
+	}
+	if !bytes.Equal(twomg[file2mgHeaderSize:], po) {
+		t.Error("the blocks differ")
+	}
+
+	_, _, err = ConvertDisk(woz, DiskFormatWOZ, DiskFormatNIB)
+	if err == nil {
+		t.Error("a 3.5 disk can't be converted to NIB")
+	}
+}
+
+func TestConvertWozWarnings(t *testing.T) {
+	data, err := os.ReadFile(testWozFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nib, warnings, err := ConvertDisk(data, DiskFormatWOZ, DiskFormatNIB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nib) != nibImageSize {
+		t.Errorf("unexpected NIB size %v", len(nib))
+	}
+	if len(warnings) == 0 {
+		t.Error("converting WOZ to NIB should warn")
+	}
+
+	_, warnings, err = ConvertDisk(data, DiskFormatWOZ, DiskFormatDO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range warnings {
+		t.Log(w)
+	}
+}
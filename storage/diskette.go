@@ -13,9 +13,19 @@ type Diskette interface {
 	Is13Sectors() bool
 }
 
+// SaveableDiskette is a diskette that can save the changes to a file
+type SaveableDiskette interface {
+	SetSaveFile(filename string)
+}
+
+// TimedDiskette is a diskette that follows the cycles of the emulation
+type TimedDiskette interface {
+	ResetTime(cycle uint64)
+}
+
 // IsDiskette returns true if the files looks like a 5 1/4 diskette
 func IsDiskette(data []byte) bool {
-	return isFileNib(data) || isFileDsk(data) || isFileWoz(data)
+	return isFileNib(data) || isFileDsk(data) || isFileWoz(data) || isFileA2R(data)
 }
 
 // MakeDiskette returns a Diskette by detecting the format
@@ -43,7 +53,16 @@ func MakeDiskette(data []byte, filename string, writeable bool) (Diskette, error
 			return nil, err
 		}
 
-		return newDisquetteWoz(f)
+		return newDisquetteWoz(f, writeable)
+	}
+
+	if isFileA2R(data) {
+		f, err := NewFileWozFromA2R(data)
+		if err != nil {
+			return nil, err
+		}
+
+		return newDisquetteWoz(f, writeable)
 	}
 
 	return nil, errors.New("diskette format not supported")
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+3.5 diskettes emulated at the GCR bitstream level. See gcr35.go for the
+format of the tracks.
+
+The WOZ images for 3.5 disks have the track and side on the TMAP using the
+index (track << 1) + side. The ProDOS images of 400K and 800K are encoded
+to a WOZ image when loaded.
+*/
+
+// Diskette35 represents a 3.5 diskette and its RW mechanism
+type Diskette35 interface {
+	PowerOn(cycle uint64)
+	PowerOff(cycle uint64)
+	Read(track int, side int, cycle uint64) uint8
+	Write(track int, side int, value uint8, cycle uint64)
+	IsDoubleSided() bool
+	IsWriteProtected() bool
+}
+
+type disketteWoz35 struct {
+	disketteWoz
+}
+
+func newDisketteWoz35(f *FileWoz, writeable bool) (*disketteWoz35, error) {
+	if f.Info.DiskType != 2 {
+		return nil, errors.New("only 3.5 disks are supported")
+	}
+
+	var d disketteWoz35
+	d.data = f
+	d.bitTiming = uint64(f.BitTiming())
+	d.writeable = writeable
+	return &d, nil
+}
+
+func (d *disketteWoz35) Read(track int, side int, cycle uint64) uint8 {
+	return d.disketteWoz.Read(track<<1+side, cycle)
+}
+
+func (d *disketteWoz35) Write(track int, side int, value uint8, cycle uint64) {
+	d.disketteWoz.Write(track<<1+side, value, cycle)
+}
+
+func (d *disketteWoz35) IsDoubleSided() bool {
+	return d.data.Info.DiskSides == 2
+}
+
+func (d *disketteWoz35) IsWriteProtected() bool {
+	return d.data.Info.WriteProtected == 1
+}
+
+/*
+BlockDisk35 is a block device over a 3.5 diskette. The ProDOS blocks are
+read and written decoding the GCR bitstream, as the firmware of the
+UniDisk 3.5 does. It has its own clock, it advances as the bits pass under
+the head. It is not an emulation of the drive, there is no IWM to access
+the bitstream from the Apple II.
+*/
+type BlockDisk35 struct {
+	diskette Diskette35
+	cycle    uint64
+	track    int
+	side     int
+	valid    bool // The last value read was a valid nibble
+}
+
+const (
+	gcr35CyclesPerBit     = gcr35BitTiming / wozTicksPerCycle
+	gcr35MaxRevolution    = 2  // Revolutions to find a sector
+	gcr35MaxDataGap       = 64 // Nibbles between the address field and the data field
+	gcr35MaxBitsPerNibble = 64
+	gcr35AddressNibbles   = 5
+	gcr35SyncCycles       = 10 * gcr35CyclesPerBit
+	gcr35NibbleCycles     = 8 * gcr35CyclesPerBit
+)
+
+// NewBlockDisk35 creates a block device for the diskette
+func NewBlockDisk35(diskette Diskette35) *BlockDisk35 {
+	var d BlockDisk35
+	d.diskette = diskette
+	return &d
+}
+
+// Diskette returns the diskette of the block device
+func (d *BlockDisk35) Diskette() Diskette35 {
+	return d.diskette
+}
+
+// GetSizeInBlocks returns the number of blocks of the disk
+func (d *BlockDisk35) GetSizeInBlocks() uint32 {
+	if d.diskette.IsDoubleSided() {
+		return gcr35Blocks800K
+	}
+	return gcr35Blocks400K
+}
+
+// IsReadOnly returns true if the diskette is write protected
+func (d *BlockDisk35) IsReadOnly() bool {
+	return d.diskette.IsWriteProtected()
+}
+
+func (d *BlockDisk35) sides() int {
+	if d.diskette.IsDoubleSided() {
+		return 2
+	}
+	return 1
+}
+
+func (d *BlockDisk35) readNibble() uint8 {
+	// Poll every bit time, a new nibble is available when the latch becomes valid
+	for range gcr35MaxBitsPerNibble {
+		d.cycle += gcr35CyclesPerBit
+		value := d.diskette.Read(d.track, d.side, d.cycle)
+		valid := value >= 0x80
+		if valid && !d.valid {
+			d.valid = true
+			return value
+		}
+		d.valid = valid
+	}
+	return 0 // No data
+}
+
+func (d *BlockDisk35) readField(prolog3 uint8, size int, maxNibbles int) ([]uint8, bool) {
+	// Finds a prolog and returns the following nibbles, checking the epilog
+	matched := 0
+	for range maxNibbles {
+		value := d.readNibble()
+		switch {
+		case matched == 0 && value == diskPrologByte1:
+			matched = 1
+		case matched == 1 && value == diskPrologByte2:
+			matched = 2
+		case matched == 2 && value == prolog3:
+			field := make([]uint8, size)
+			for i := range field {
+				field[i] = d.readNibble()
+			}
+			return field, d.readNibble() == gcr35EpilogByte1 && d.readNibble() == gcr35EpilogByte2
+		case value == diskPrologByte1:
+			matched = 1
+		default:
+			matched = 0
+		}
+	}
+	return nil, false
+}
+
+func (d *BlockDisk35) findSector(track int, side int, sector int) error {
+	d.track = track
+	d.side = side
+	maxNibbles := gcr35MaxRevolution * int(gcr35TrackBits(track)) / 8
+	for maxNibbles > 0 {
+		start := d.cycle
+		field, ok := d.readField(diskPrologByte3Address, gcr35AddressNibbles, maxNibbles)
+		maxNibbles -= int((d.cycle - start) / gcr35NibbleCycles)
+		if !ok {
+			continue
+		}
+
+		var values [gcr35AddressNibbles]uint8
+		for i, v := range field {
+			w := sixAndTwoUntranslateTable[v]
+			if w == -1 {
+				ok = false
+				break
+			}
+			values[i] = uint8(w)
+		}
+		if ok && values[0]^values[1]^values[2]^values[3] == values[4] &&
+			int(values[0])|int(values[2]&1)<<6 == track &&
+			int(values[1]) == sector &&
+			int(values[2]>>5)&1 == side {
+			return nil
+		}
+	}
+	return fmt.Errorf("sector %v not found on track %v side %v", sector, track, side)
+}
+
+// Read returns a ProDOS block
+func (d *BlockDisk35) Read(block uint32) ([]uint8, error) {
+	track, side, sector, ok := gcr35BlockLocation(block, d.sides())
+	if !ok {
+		return nil, fmt.Errorf("block %v out of range", block)
+	}
+
+	d.diskette.PowerOn(d.cycle)
+	defer func() { d.diskette.PowerOff(d.cycle) }()
+	err := d.findSector(track, side, sector)
+	if err != nil {
+		return nil, err
+	}
+
+	field, ok := d.readField(diskPrologByte3Data, 1+gcr35DataNibbles+gcr35ChecksumNibbles, gcr35MaxDataGap)
+	if !ok {
+		return nil, fmt.Errorf("data field not found for block %v", block)
+	}
+	if int(sixAndTwoUntranslateTable[field[0]]) != sector {
+		return nil, fmt.Errorf("data field of the wrong sector for block %v", block)
+	}
+	data, err := gcr35DecodeData(field[1:])
+	if err != nil {
+		return nil, fmt.Errorf("%w for block %v", err, block)
+	}
+	return data[gcr35TagSize:], nil
+}
+
+// Write writes a ProDOS block, replacing the data field of the sector
+func (d *BlockDisk35) Write(block uint32, data []uint8) error {
+	if d.IsReadOnly() {
+		return errors.New("the diskette is write protected")
+	}
+	track, side, sector, ok := gcr35BlockLocation(block, d.sides())
+	if !ok {
+		return fmt.Errorf("block %v out of range", block)
+	}
+
+	d.diskette.PowerOn(d.cycle)
+	defer func() { d.diskette.PowerOff(d.cycle) }()
+	err := d.findSector(track, side, sector)
+	if err != nil {
+		return err
+	}
+
+	// Write just after the address field
+	sectorData := make([]uint8, gcr35SectorSize)
+	copy(sectorData[gcr35TagSize:], data)
+	d.diskette.Write(track, side, gcr35PadByte, d.cycle)
+	d.cycle += gcr35NibbleCycles
+	for range gcr35DataSyncs {
+		d.diskette.Write(track, side, 0xff, d.cycle)
+		d.cycle += gcr35SyncCycles
+	}
+	for _, v := range gcr35DataField(sector, sectorData) {
+		d.diskette.Write(track, side, v, d.cycle)
+		d.cycle += gcr35NibbleCycles
+	}
+	d.diskette.Write(track, side, gcr35PadByte, d.cycle)
+	d.cycle += gcr35NibbleCycles
+	d.diskette.Read(track, side, d.cycle) // Back to read mode
+	d.valid = false
+	return nil
+}
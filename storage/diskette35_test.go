@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+func makeTest800KImage() []uint8 {
+	data := make([]uint8, gcr35Blocks800K*ProDosBlockSize)
+	for i := range data {
+		data[i] = uint8(i*7 + i/512)
+	}
+	return data
+}
+
+func TestGcr35DataFieldBackAndForth(t *testing.T) {
+	data := make([]uint8, gcr35SectorSize)
+	for i := range data {
+		data[i] = uint8(i * 13)
+	}
+	field := gcr35DataField(3, data)
+	if len(field) != 4+gcr35DataNibbles+gcr35ChecksumNibbles+2 {
+		t.Fatalf("unexpected data field size %v", len(field))
+	}
+	decoded, err := gcr35DecodeData(field[4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decoded) {
+		t.Error("decoded data differs")
+	}
+
+	field[100] = sixAndTwoTranslateTable[(sixAndTwoUntranslateTable[field[100]]+1)&0x3f]
+	_, err = gcr35DecodeData(field[4:])
+	if err == nil {
+		t.Error("the checksum error was not detected")
+	}
+}
+
+func TestGcr35Interleave(t *testing.T) {
+	order := gcr35Interleave(12)
+	expected := []int{0, 6, 1, 7, 2, 8, 3, 9, 4, 10, 5, 11}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, order)
+		}
+	}
+}
+
+func TestBlockDisk35ReadAndWrite(t *testing.T) {
+	image := makeTest800KImage()
+	f, err := NewFileWozFromBlocks35(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for track := range gcr35Tracks {
+		bits := f.tracks[f.trackMap[track*2+1]].bitCount
+		if bits != gcr35TrackBits(track) {
+			t.Errorf("track %v has %v bits, expected %v", track, bits, gcr35TrackBits(track))
+		}
+	}
+
+	diskette, err := newDisketteWoz35(f, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk := NewBlockDisk35(diskette)
+	if disk.GetSizeInBlocks() != gcr35Blocks800K {
+		t.Errorf("expected 800K, got %v blocks", disk.GetSizeInBlocks())
+	}
+
+	for _, block := range []uint32{0, 1, 11, 12, 24, 23, 500, 1599, 1000} {
+		data, err := disk.Read(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := image[block*ProDosBlockSize : (block+1)*ProDosBlockSize]
+		if !bytes.Equal(data, expected) {
+			t.Errorf("block %v differs", block)
+		}
+	}
+
+	written := bytes.Repeat([]uint8{0xa5}, int(ProDosBlockSize))
+	for _, block := range []uint32{7, 1400} {
+		err = disk.Write(block, written)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, block := range []uint32{6, 7, 8, 1400, 1401} {
+		data, err := disk.Read(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := image[block*ProDosBlockSize : (block+1)*ProDosBlockSize]
+		if block == 7 || block == 1400 {
+			expected = written
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("block %v differs after the write", block)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"errors"
+	"fmt"
 	"math/rand"
 )
 
@@ -10,6 +11,8 @@ See:
 	https://applesaucefdc.com/woz/
 */
 
+const wozTicksPerCycle = 8 // Approximating the CPU cycle to 1 microsecond
+
 type disketteWoz struct {
 	data    *FileWoz
 	cycleOn uint64 // Cycle when the disk was last turned on
@@ -18,15 +21,25 @@ type disketteWoz struct {
 	latch       uint8
 	position    uint32
 	positionMax uint32 // As tracks may have different lengths position is related of positionMax of the las track
-	cycle       uint64
+	tick        uint64 // Time of the current position in units of 125 nanoseconds
+	bitTiming   uint64 // Time per bit in units of 125 nanoseconds
+	fluxZeros   uint32 // Bits left up to the next flux transition
 
 	mc3470Buffer uint8 // Four bit buffer to detect weak bits and to add latency
 
 	visibleLatch          uint8
 	visibleLatchCountDown int8 // The visible latch stores a valid latch reading for 2 bit timings
+
+	writing           bool
+	writeValue        uint8 // Shift register with the bits pending to be written
+	writeQuarterTrack int
+
+	// Needed to write back
+	writeable bool
+	saveFile  string
 }
 
-func newDisquetteWoz(f *FileWoz) (*disketteWoz, error) {
+func newDisquetteWoz(f *FileWoz, writeable bool) (*disketteWoz, error) {
 	// Discard not supported features
 	if f.Info.DiskType != 1 {
 		return nil, errors.New("only 5.25 disks are supported")
@@ -34,6 +47,8 @@ func newDisquetteWoz(f *FileWoz) (*disketteWoz, error) {
 
 	var d disketteWoz
 	d.data = f
+	d.bitTiming = uint64(f.BitTiming())
+	d.writeable = writeable
 	return &d, nil
 }
 
@@ -42,21 +57,52 @@ func (d *disketteWoz) PowerOn(cycle uint64) {
 	d.cycleOn = cycle
 }
 
-func (d *disketteWoz) PowerOff(_ uint64) {
+func (d *disketteWoz) PowerOff(cycle uint64) {
+	if d.writing {
+		d.flushWrite(cycle)
+		d.writing = false
+	}
 	d.turning = false
+	d.commit()
+}
+
+// SetSaveFile sets the file where the changes are saved when the drive
+// is turned off. Only images loaded from local uncompressed files are saved.
+func (d *disketteWoz) SetSaveFile(filename string) {
+	d.saveFile = filename
+}
+
+func (d *disketteWoz) commit() {
+	if d.saveFile == "" || !d.writeable || !d.data.IsModified() {
+		return
+	}
+	err := d.data.Save(d.saveFile)
+	if err != nil {
+		fmt.Printf("Data can't be written to %v: %v\n", d.saveFile, err)
+		d.saveFile = ""
+	}
 }
 
 func (d *disketteWoz) Read(quarterTrack int, cycle uint64) uint8 {
+	if d.writing {
+		// Back to read mode
+		d.flushWrite(cycle)
+		d.writing = false
+	}
+
 	// Count cycles to know how many bits have been read
-	cycles := cycle - d.cycle
-	deltaBits := cycles / cyclesPerBit // TODO: Use Woz optimal bit timing
+	deltaBits := d.elapsedBits(cycle)
 
 	// Process bits from woz
 	// TODO: avoid processing too many bits if delta is big
 	for range deltaBits {
 		// Get next bit taking into account the MC3470 latency and weak bits
 		var fluxBit bool
-		fluxBit, d.position, d.positionMax = d.data.GetNextBitAndPosition(d.position, d.positionMax, quarterTrack)
+		if d.data.HasFlux(quarterTrack) {
+			fluxBit = d.nextFluxBit(quarterTrack)
+		} else {
+			fluxBit, d.position, d.positionMax = d.data.GetNextBitAndPosition(d.position, d.positionMax, quarterTrack)
+		}
 		d.mc3470Buffer = (d.mc3470Buffer << 1) & 0x0f
 		if fluxBit {
 			d.mc3470Buffer++
@@ -84,16 +130,65 @@ func (d *disketteWoz) Read(quarterTrack int, cycle uint64) uint8 {
 		}
 	}
 
-	// fmt.Printf("Visible: 0x%.2x, latch: 0x%.2x, bits: %v, cycles: %v\n", d.visibleLatch, d.latch, deltaBits, cycle-d.cycle)
-
-	// Update the internal last cycle without losing the remainder not processed
-	d.cycle += deltaBits * cyclesPerBit
+	// fmt.Printf("Visible: 0x%.2x, latch: 0x%.2x, bits: %v, cycles: %v\n", d.visibleLatch, d.latch, deltaBits, d.tick)
 
 	return d.visibleLatch
 }
 
-func (d *disketteWoz) Write(quarterTrack int, value uint8, _ uint64) {
-	panic("Write not implemented on woz disk implementation")
+// ResetTime moves the time of the head position to the cycle without reading
+// any bit. To be used when the cycles count goes back, as on a state load.
+func (d *disketteWoz) ResetTime(cycle uint64) {
+	d.tick = cycle * wozTicksPerCycle
+}
+
+// elapsedBits returns the bits passed under the head up to the cycle. The
+// remainder not processed is kept for the next call.
+func (d *disketteWoz) elapsedBits(cycle uint64) uint64 {
+	ticks := cycle * wozTicksPerCycle
+	deltaBits := (ticks - d.tick) / d.bitTiming
+	d.tick += deltaBits * d.bitTiming
+	return deltaBits
+}
+
+// nextFluxBit converts the flux transition timings to bits
+func (d *disketteWoz) nextFluxBit(quarterTrack int) bool {
+	if d.fluxZeros == 0 {
+		var ticks uint32
+		ticks, d.position, d.positionMax = d.data.GetNextFluxAndPosition(d.position, d.positionMax, quarterTrack)
+		d.fluxZeros = uint32((uint64(ticks) + d.bitTiming/2) / d.bitTiming)
+		if d.fluxZeros == 0 {
+			d.fluxZeros = 1
+		}
+	}
+	d.fluxZeros--
+	return d.fluxZeros == 0
+}
+
+func (d *disketteWoz) Write(quarterTrack int, value uint8, cycle uint64) {
+	if d.writing {
+		d.flushWrite(cycle)
+	} else {
+		// Move to the current position
+		d.Read(quarterTrack, cycle)
+	}
+
+	// The value is shifted out a bit at a time starting now
+	d.writing = true
+	d.writeValue = value
+	d.writeQuarterTrack = quarterTrack
+}
+
+// flushWrite writes the bits shifted out since the last write. After the
+// eight bits of the value, the shift register writes zeros until a new
+// value is loaded or the write mode ends.
+func (d *disketteWoz) flushWrite(cycle uint64) {
+	deltaBits := d.elapsedBits(cycle)
+	for range deltaBits {
+		bit := d.writeValue >= 0x80
+		d.writeValue <<= 1
+		_, d.position, d.positionMax = d.data.GetNextBitAndPosition(d.position, d.positionMax, d.writeQuarterTrack)
+		d.data.SetBit(bit, d.position, d.positionMax, d.writeQuarterTrack)
+	}
 }
 
 func (d *disketteWoz) Is13Sectors() bool {
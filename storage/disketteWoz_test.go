@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testWozFile = "../woz_test_images/DOS 3.3 System Master.woz"
+
+func loadTestWoz(t *testing.T) *FileWoz {
+	data, err := os.ReadFile(testWozFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFileWoz(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestWozCRC(t *testing.T) {
+	data, err := os.ReadFile(testWozFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crc := binary.LittleEndian.Uint32(data[wozCRCPos:])
+
+	f, err := NewFileWoz(bytes.Clone(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	computed := binary.LittleEndian.Uint32(f.Bytes()[wozCRCPos:])
+	if crc != computed {
+		t.Errorf("CRC mismatch, expected 0x%08x, got 0x%08x", crc, computed)
+	}
+}
+
+func TestWozWriteAndReadBack(t *testing.T) {
+	f := loadTestWoz(t)
+	d, err := newDisquetteWoz(f, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.PowerOn(0)
+	d.Read(0, 1000)
+	start := d.position
+	startMax := d.positionMax
+
+	// Write a byte every 32 cycles
+	values := []uint8{0xd5, 0xaa, 0x96}
+	cycle := uint64(1000)
+	for _, v := range values {
+		d.Write(0, v, cycle)
+		cycle += 8 * cyclesPerBit
+	}
+	d.Read(0, cycle) // Ends the write mode
+
+	if !f.IsModified() {
+		t.Error("the image should be modified")
+	}
+
+	position := start
+	positionMax := startMax
+	for _, v := range values {
+		var read uint8
+		for range 8 {
+			var bit bool
+			bit, position, positionMax = f.GetNextBitAndPosition(position, positionMax, 0)
+			read <<= 1
+			if bit {
+				read++
+			}
+		}
+		if read != v {
+			t.Errorf("expected 0x%02x, got 0x%02x", v, read)
+		}
+	}
+}
+
+func TestWozSave(t *testing.T) {
+	f := loadTestWoz(t)
+	d, err := newDisquetteWoz(f, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "test.woz")
+	d.SetSaveFile(filename)
+
+	d.PowerOn(0)
+	d.Write(4, 0x00, 1000) // Write zeros on track 1
+	d.Write(4, 0x00, 2000)
+	d.PowerOff(3000)
+
+	if f.IsModified() {
+		t.Error("the image should have been saved")
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, f.Bytes()) {
+		t.Error("the saved image differs")
+	}
+	_, err = NewFileWoz(data)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func makeTestFluxWoz(bits string, bitTiming uint8) *FileWoz {
+	// Encode the bits as flux transition timings
+	var flux []uint8
+	ticks := 0
+	for _, b := range bits {
+		ticks += int(bitTiming)
+		if b == '1' {
+			for ticks >= wozFluxContinue {
+				flux = append(flux, wozFluxContinue)
+				ticks -= wozFluxContinue
+			}
+			flux = append(flux, uint8(ticks))
+			ticks = 0
+		}
+	}
+
+	var f FileWoz
+	f.version = 2
+	f.Info.DiskType = 1
+	f.Info.OptimalBitTiming = bitTiming
+	f.trackMap = bytes.Repeat([]uint8{0xff}, wozMaxTrack)
+	f.fluxMap = bytes.Repeat([]uint8{0xff}, wozMaxTrack)
+	f.fluxMap[0] = 0
+	f.tracks[0].bitCount = uint32(len(flux))
+	f.tracks[0].data = flux
+	return &f
+}
+
+func TestWozFluxToBits(t *testing.T) {
+	bits := "1101010110101010100101101000000000001"
+	f := makeTestFluxWoz(bits, 28)
+	d, err := newDisquetteWoz(f, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.bitTiming != 28 {
+		t.Errorf("expected bit timing of 28, got %v", d.bitTiming)
+	}
+
+	read := ""
+	for range bits {
+		if d.nextFluxBit(0) {
+			read += "1"
+		} else {
+			read += "0"
+		}
+	}
+	if read != bits {
+		t.Errorf("expected %v, got %v", bits, read)
+	}
+}
+
+func TestWozFluxBlock(t *testing.T) {
+	f := makeTestFluxWoz("1101010110101010100101101000000000001", 28)
+	data := encodeWoz2(f.Info, f.trackMap, f.fluxMap, f.tracks[:], nil)
+	f2, err := NewFileWoz(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pos := int(f2.Info.FluxBlock) * woz2TrackBlockSize
+	if f2.Info.FluxBlock == 0 || pos >= len(data) || string(data[pos:pos+4]) != "FLUX" {
+		t.Fatalf("the FLUX chunk should be on the block %v", f2.Info.FluxBlock)
+	}
+	if size := binary.LittleEndian.Uint32(data[pos+4:]); size != woz2TrackBlockSize-wozChunkHeaderLen {
+		t.Errorf("the FLUX chunk should take a full block, got %v bytes", size)
+	}
+	if !bytes.Equal(f2.fluxMap, f.fluxMap) {
+		t.Error("the flux map differs")
+	}
+}
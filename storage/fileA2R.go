@@ -0,0 +1,445 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+)
+
+/*
+See:
+	https://applesaucefdc.com/a2r2-reference/
+	https://applesaucefdc.com/a2r/
+
+A2R files store the raw flux transitions captured from the disk, usually
+several revolutions per track. For each track the revolution with the
+duration closest to the median of all the revolutions captured is chosen,
+discarding the ones with glitches or speed variations. The revolution is
+converted to a WOZ 2.1 image:
+	- The TMAP tracks have the bitstream decoded using 4 microseconds cells.
+	- The FLUX tracks keep the flux transition timings as captured.
+As WOZ images can hold 160 tracks at most, when there is no room for both
+on all the quarter tracks captured, the tracks are added in order: the
+bitstreams of the whole tracks, the flux of the whole, half and quarter
+tracks and the bitstreams of the rest. The quarter tracks without their
+own track read the closest one, as done on WOZ images.
+*/
+
+var headerA2R2 = []uint8{0x41, 0x32, 0x52, 0x32, 0xFF, 0x0A, 0x0D, 0x0A}
+var headerA2R3 = []uint8{0x41, 0x32, 0x52, 0x33, 0xFF, 0x0A, 0x0D, 0x0A}
+
+const (
+	a2rFirstChunkPos    = 8
+	a2rCaptureTiming    = 1
+	a2rCaptureXTiming   = 3
+	a2rDriveType525     = 1
+	a2rStreamEnd        = 0xff
+	a2rCaptureMark      = 'C'
+	a2rCapturesEnd      = 'X'
+	a2rResolutionPicos  = 125000 // The 125 nanoseconds used by the WOZ flux timings
+	a2rStrmHeaderSize   = 10
+	a2rRwcpHeaderSize   = 16
+	a2rRwcpCaptureSize  = 4 // Up to the index signals
+	a2rFluxBitsRounding = wozDefaultBitTiming / 2
+)
+
+type a2rInfo struct {
+	Version        uint8
+	Creator        [32]byte
+	DriveType      uint8
+	WriteProtected uint8
+	Synchronized   uint8
+}
+
+type a2rCapture struct {
+	location    int      // Quarter track
+	transitions []uint64 // Time of each flux transition from the start of the capture
+	duration    uint64
+	indexes     []uint64 // Start of each revolution
+}
+
+type a2rRevolution struct {
+	capture *a2rCapture
+	start   uint64
+	end     uint64
+}
+
+func isFileA2R(data []uint8) bool {
+	if len(data) < len(headerA2R2) {
+		return false
+	}
+	header := data[:len(headerA2R2)]
+	return bytes.Equal(headerA2R2, header) || bytes.Equal(headerA2R3, header)
+}
+
+// MakeFileWoz returns a FileWoz by detecting the format, WOZ or A2R
+func MakeFileWoz(data []uint8) (*FileWoz, error) {
+	if isFileA2R(data) {
+		return NewFileWozFromA2R(data)
+	}
+	return NewFileWoz(data)
+}
+
+// NewFileWozFromA2R converts an A2R flux image to a WOZ image
+func NewFileWozFromA2R(data []uint8) (*FileWoz, error) {
+	if !isFileA2R(data) {
+		return nil, errors.New("invalid A2R header")
+	}
+
+	// Extract the chunks
+	i := a2rFirstChunkPos
+	var chunkHeader wozChunkHeader
+	chunks := make(map[string][]uint8)
+	for i+wozChunkHeaderLen < len(data) {
+		binary.Read(bytes.NewReader(data[i:]), binary.LittleEndian, &chunkHeader)
+
+		i += wozChunkHeaderLen
+		iNext := i + int(chunkHeader.Size)
+		if iNext > len(data) {
+			return nil, errors.New("invalid chunk in A2R file")
+		}
+
+		id := string(chunkHeader.ID[:])
+		chunks[id] = data[i:iNext]
+		i = iNext
+	}
+
+	infoData, ok := chunks["INFO"]
+	if !ok {
+		return nil, errors.New("chunk INFO missing from A2R file")
+	}
+	var info a2rInfo
+	binary.Read(bytes.NewReader(infoData), binary.LittleEndian, &info)
+	if info.DriveType != a2rDriveType525 {
+		return nil, errors.New("only 5.25 disks are supported")
+	}
+
+	var captures []*a2rCapture
+	var err error
+	if strm, ok := chunks["STRM"]; ok {
+		captures, err = a2rParseStrm(strm)
+	} else if rwcp, ok := chunks["RWCP"]; ok {
+		captures, err = a2rParseRwcp(rwcp)
+	} else {
+		err = errors.New("no flux captures on the A2R file")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Choose a revolution for each track
+	revolutions := make(map[int][]a2rRevolution)
+	for _, c := range captures {
+		if c.location < wozMaxTrack {
+			revolutions[c.location] = append(revolutions[c.location], c.revolutions()...)
+		}
+	}
+	fluxes := make(map[int][]uint8)
+	for location, r := range revolutions {
+		// The flux is empty on the unformatted tracks
+		if flux := a2rBestRevolution(r).flux(); len(flux) != 0 {
+			fluxes[location] = flux
+		}
+	}
+
+	var wozInfo woz2Info
+	wozInfo.DiskType = 1
+	wozInfo.WriteProtected = info.WriteProtected
+	wozInfo.Synchronized = info.Synchronized
+	wozInfo.DiskSides = 1
+	wozInfo.OptimalBitTiming = wozDefaultBitTiming
+	copy(wozInfo.Creator[:], bytes.Repeat([]byte(" "), len(wozInfo.Creator)))
+	copy(wozInfo.Creator[:], "izapple2 from A2R")
+
+	trackMap := bytes.Repeat([]uint8{0xff}, wozMaxTrack)
+	fluxMap := bytes.Repeat([]uint8{0xff}, wozMaxTrack)
+	var tracks []disketteTrackWoz
+	for _, slot := range a2rTrackSlots(slices.Sorted(maps.Keys(fluxes))) {
+		if len(tracks) == wozMaxTrack {
+			break
+		}
+		flux := fluxes[slot.location]
+		if slot.flux {
+			fluxMap[slot.location] = uint8(len(tracks))
+			tracks = append(tracks, disketteTrackWoz{uint32(len(flux)), flux})
+		} else {
+			trackMap[slot.location] = uint8(len(tracks))
+			tracks = append(tracks, fluxToBits(flux))
+		}
+	}
+
+	// The quarter tracks not captured read the adjacent ones. The ones
+	// captured without room for their track read the closest of the track.
+	reach := func(location int) int {
+		if _, captured := revolutions[location]; !captured {
+			return 1
+		}
+		if _, formatted := fluxes[location]; formatted {
+			return 2
+		}
+		return 0
+	}
+	a2rFillTrackMap(trackMap, reach)
+	a2rFillTrackMap(fluxMap, reach)
+	if !slices.ContainsFunc(fluxMap, func(i uint8) bool { return i != 0xff }) {
+		fluxMap = nil
+	}
+
+	var meta map[string]string
+	if metaData, ok := chunks["META"]; ok {
+		meta = make(map[string]string)
+		for entry := range strings.SplitSeq(string(metaData), "\n") {
+			parts := strings.Split(entry, "\t")
+			if len(parts) >= 2 {
+				meta[parts[0]] = parts[1]
+			}
+		}
+	}
+
+	return NewFileWoz(encodeWoz2(wozInfo, trackMap, fluxMap, tracks, meta))
+}
+
+func a2rParseStrm(data []uint8) ([]*a2rCapture, error) {
+	var captures []*a2rCapture
+	i := 0
+	for i < len(data) && data[i] != a2rStreamEnd {
+		if i+a2rStrmHeaderSize > len(data) {
+			return nil, errors.New("invalid STRM chunk in A2R file")
+		}
+		location := int(data[i])
+		kind := data[i+1]
+		size := int(binary.LittleEndian.Uint32(data[i+2:]))
+		loopPoint := uint64(binary.LittleEndian.Uint32(data[i+6:]))
+		i += a2rStrmHeaderSize
+		if i+size > len(data) {
+			return nil, errors.New("invalid STRM chunk in A2R file")
+		}
+
+		if kind == a2rCaptureTiming || kind == a2rCaptureXTiming {
+			c := newA2rCapture(location, data[i:i+size], a2rResolutionPicos)
+			if loopPoint != 0 {
+				// The revolutions repeat every loop point. The timing
+				// captures have a revolution and a quarter, the rest after
+				// the last full revolution is discarded.
+				for start := uint64(0); start <= c.duration; start += loopPoint {
+					c.indexes = append(c.indexes, start)
+				}
+			}
+			captures = append(captures, c)
+		}
+		i += size
+	}
+	return captures, nil
+}
+
+func a2rParseRwcp(data []uint8) ([]*a2rCapture, error) {
+	if len(data) < a2rRwcpHeaderSize {
+		return nil, errors.New("invalid RWCP chunk in A2R file")
+	}
+	resolution := uint64(binary.LittleEndian.Uint32(data[1:]))
+	if resolution == 0 {
+		return nil, errors.New("invalid resolution on the A2R file")
+	}
+
+	var captures []*a2rCapture
+	i := a2rRwcpHeaderSize
+	for i < len(data) && data[i] == a2rCaptureMark {
+		i++
+		if i+a2rRwcpCaptureSize > len(data) {
+			return nil, errors.New("invalid RWCP chunk in A2R file")
+		}
+		kind := data[i]
+		location := int(binary.LittleEndian.Uint16(data[i+1:]))
+		indexCount := int(data[i+3])
+		i += a2rRwcpCaptureSize
+		if i+4*indexCount+4 > len(data) {
+			return nil, errors.New("invalid RWCP chunk in A2R file")
+		}
+		indexes := make([]uint64, indexCount)
+		for j := range indexes {
+			indexes[j] = uint64(binary.LittleEndian.Uint32(data[i:])) * resolution / a2rResolutionPicos
+			i += 4
+		}
+		size := int(binary.LittleEndian.Uint32(data[i:]))
+		i += 4
+		if i+size > len(data) {
+			return nil, errors.New("invalid RWCP chunk in A2R file")
+		}
+
+		if kind == a2rCaptureTiming || kind == a2rCaptureXTiming {
+			c := newA2rCapture(location, data[i:i+size], resolution)
+			if len(indexes) >= 2 {
+				c.indexes = indexes
+			}
+			captures = append(captures, c)
+		}
+		i += size
+	}
+	if i >= len(data) || data[i] != a2rCapturesEnd {
+		return nil, errors.New("invalid RWCP chunk in A2R file")
+	}
+	return captures, nil
+}
+
+func newA2rCapture(location int, data []uint8, resolution uint64) *a2rCapture {
+	var c a2rCapture
+	c.location = location
+	ticks := uint64(0)
+	for _, value := range data {
+		ticks += uint64(value)
+		if value != wozFluxContinue {
+			c.transitions = append(c.transitions, ticks*resolution/a2rResolutionPicos)
+		}
+	}
+	c.duration = ticks * resolution / a2rResolutionPicos
+	return &c
+}
+
+func (c *a2rCapture) revolutions() []a2rRevolution {
+	if len(c.indexes) < 2 {
+		// The capture is a single revolution
+		return []a2rRevolution{{c, 0, c.duration}}
+	}
+	revolutions := make([]a2rRevolution, 0, len(c.indexes)-1)
+	for i := range len(c.indexes) - 1 {
+		revolutions = append(revolutions, a2rRevolution{c, c.indexes[i], c.indexes[i+1]})
+	}
+	return revolutions
+}
+
+// flux returns the flux timings of the revolution. The time after the last
+// transition is added to the first one to loop seamlessly.
+func (r a2rRevolution) flux() []uint8 {
+	first, _ := slices.BinarySearch(r.capture.transitions, r.start+1)
+	var intervals []uint64
+	last := r.start
+	for _, t := range r.capture.transitions[first:] {
+		if t > r.end {
+			break
+		}
+		intervals = append(intervals, t-last)
+		last = t
+	}
+	if len(intervals) == 0 {
+		return nil
+	}
+	intervals[0] += r.end - last
+
+	var flux []uint8
+	for _, interval := range intervals {
+		for interval >= wozFluxContinue {
+			flux = append(flux, wozFluxContinue)
+			interval -= wozFluxContinue
+		}
+		flux = append(flux, uint8(interval))
+	}
+	return flux
+}
+
+type a2rTrackSlot struct {
+	location int
+	flux     bool
+}
+
+// a2rTrackSlots returns the tracks to add to the WOZ image in order of
+// preference
+func a2rTrackSlots(locations []int) []a2rTrackSlot {
+	kind := func(location int) int {
+		switch {
+		case location%4 == 0:
+			return 0 // Whole track
+		case location%2 == 0:
+			return 1 // Half track
+		}
+		return 2 // Quarter track
+	}
+	order := []struct {
+		flux  bool
+		kinds []int
+	}{
+		{false, []int{0}},
+		{true, []int{0, 1, 2}},
+		{false, []int{1, 2}},
+	}
+
+	var slots []a2rTrackSlot
+	for _, o := range order {
+		for _, k := range o.kinds {
+			for _, location := range locations {
+				if kind(location) == k {
+					slots = append(slots, a2rTrackSlot{location, o.flux})
+				}
+			}
+		}
+	}
+	return slots
+}
+
+// a2rFillTrackMap points the quarter tracks without a track to the closest
+// one up to the reach of each quarter track
+func a2rFillTrackMap(trackMap []uint8, reach func(location int) int) {
+	own := slices.Clone(trackMap)
+	for location := range trackMap {
+		for distance := 1; distance <= reach(location) && trackMap[location] == 0xff; distance++ {
+			for _, adjacent := range []int{location - distance, location + distance} {
+				if adjacent >= 0 && adjacent < len(own) && own[adjacent] != 0xff {
+					trackMap[location] = own[adjacent]
+					break
+				}
+			}
+		}
+	}
+}
+
+func a2rBestRevolution(revolutions []a2rRevolution) a2rRevolution {
+	durations := make([]uint64, len(revolutions))
+	for i, r := range revolutions {
+		durations[i] = r.end - r.start
+	}
+	slices.Sort(durations)
+	median := durations[len(durations)/2]
+
+	best := revolutions[0]
+	bestDistance := ^uint64(0)
+	for _, r := range revolutions {
+		duration := r.end - r.start
+		distance := max(duration, median) - min(duration, median)
+		if distance < bestDistance {
+			best = r
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+// fluxToBits decodes the flux timings using 4 microseconds cells
+func fluxToBits(flux []uint8) disketteTrackWoz {
+	var track disketteTrackWoz
+	ticks := uint32(0)
+	for _, value := range flux {
+		ticks += uint32(value)
+		if value == wozFluxContinue {
+			continue
+		}
+		cells := max((ticks+a2rFluxBitsRounding)/wozDefaultBitTiming, 1)
+		for range cells - 1 {
+			track.appendBit(false)
+		}
+		track.appendBit(true)
+		ticks = 0
+	}
+	return track
+}
+
+func (t *disketteTrackWoz) appendBit(value bool) {
+	if t.bitCount%8 == 0 {
+		t.data = append(t.data, 0)
+	}
+	if value {
+		t.data[t.bitCount/8] |= 1 << (7 - t.bitCount%8)
+	}
+	t.bitCount++
+}
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func trackBits(track disketteTrackWoz) string {
+	var s strings.Builder
+	for i := range track.bitCount {
+		if track.data[i/8]>>(7-i%8)&1 == 1 {
+			s.WriteByte('1')
+		} else {
+			s.WriteByte('0')
+		}
+	}
+	return s.String()
+}
+
+// bitsToFlux encodes the bits as flux timings, adding a delay before the first transition
+func bitsToFlux(bits string, delay int) []uint8 {
+	var flux []uint8
+	ticks := delay
+	for _, b := range bits {
+		ticks += wozDefaultBitTiming
+		if b == '1' {
+			for ticks >= wozFluxContinue {
+				flux = append(flux, wozFluxContinue)
+				ticks -= wozFluxContinue
+			}
+			flux = append(flux, uint8(ticks))
+			ticks = 0
+		}
+	}
+	return flux
+}
+
+func makeTestA2R3(location int, flux []uint8, durations []uint32) []uint8 {
+	var capture bytes.Buffer
+	capture.WriteByte(a2rCaptureMark)
+	capture.WriteByte(a2rCaptureXTiming)
+	binary.Write(&capture, binary.LittleEndian, uint16(location))
+	capture.WriteByte(uint8(len(durations) + 1))
+	index := uint32(0)
+	binary.Write(&capture, binary.LittleEndian, index)
+	for _, d := range durations {
+		index += d
+		binary.Write(&capture, binary.LittleEndian, index)
+	}
+	binary.Write(&capture, binary.LittleEndian, uint32(len(flux)))
+	capture.Write(flux)
+	capture.WriteByte(a2rCapturesEnd)
+
+	var rwcp bytes.Buffer
+	rwcp.WriteByte(1)
+	binary.Write(&rwcp, binary.LittleEndian, uint32(a2rResolutionPicos))
+	rwcp.Write(make([]uint8, 11))
+	rwcp.Write(capture.Bytes())
+
+	var info bytes.Buffer
+	binary.Write(&info, binary.LittleEndian, a2rInfo{Version: 3, DriveType: a2rDriveType525})
+	info.WriteByte(0) // Hard sector count
+
+	return makeTestA2R(headerA2R3, info.Bytes(), "RWCP", rwcp.Bytes())
+}
+
+type a2rTestStream struct {
+	location  int
+	kind      uint8
+	flux      []uint8
+	loopPoint uint32
+}
+
+func makeTestA2R2(streams []a2rTestStream) []uint8 {
+	var strm bytes.Buffer
+	for _, s := range streams {
+		strm.WriteByte(uint8(s.location))
+		strm.WriteByte(s.kind)
+		binary.Write(&strm, binary.LittleEndian, uint32(len(s.flux)))
+		binary.Write(&strm, binary.LittleEndian, s.loopPoint)
+		strm.Write(s.flux)
+	}
+	strm.WriteByte(a2rStreamEnd)
+
+	var info bytes.Buffer
+	binary.Write(&info, binary.LittleEndian, a2rInfo{Version: 1, DriveType: a2rDriveType525})
+
+	return makeTestA2R(headerA2R2, info.Bytes(), "STRM", strm.Bytes())
+}
+
+func makeTestA2R(header []uint8, info []uint8, id string, captures []uint8) []uint8 {
+	var out bytes.Buffer
+	out.Write(header)
+	for _, chunk := range []struct {
+		id   string
+		data []uint8
+	}{{"INFO", info}, {id, captures}, {"META", []uint8("title\tTest\n")}} {
+		binary.Write(&out, binary.LittleEndian, wozChunkHeader{[4]byte([]byte(chunk.id)), uint32(len(chunk.data))})
+		out.Write(chunk.data)
+	}
+	return out.Bytes()
+}
+
+func TestA2RBestRevolution(t *testing.T) {
+	original := trackBits(loadTestWoz(t).tracks[0])
+	trailing := len(original) - len(strings.TrimRight(original, "0"))
+	expected := original[len(original)-trailing:] + original[:len(original)-trailing]
+
+	duration := uint32(len(original) * wozDefaultBitTiming)
+	glitch := 500
+	// Three revolutions, the first with a glitch
+	data := makeTestA2R3(0,
+		bitsToFlux(strings.Repeat(original, 3), glitch),
+		[]uint32{duration + uint32(glitch), duration, duration})
+	if !IsDiskette(data) {
+		t.Fatal("the A2R image is not detected")
+	}
+
+	f, err := NewFileWozFromA2R(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Info.Version != 3 || !f.HasFlux(0) || !f.HasFlux(1) || f.HasFlux(2) {
+		t.Error("the flux tracks are not available")
+	}
+	if f.meta["title"] != "Test" {
+		t.Error("the metadata is lost")
+	}
+
+	decoded := trackBits(f.tracks[f.trackMap[0]])
+	if decoded != expected {
+		t.Errorf("the decoded track differs, %v bits instead of %v", len(decoded), len(expected))
+	}
+	if f.trackMap[1] != f.trackMap[0] {
+		t.Error("the adjacent quarter track should read the same track")
+	}
+
+	_, err = MakeDiskette(data, "test.a2r", false)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestA2R2TimingCapture(t *testing.T) {
+	original := trackBits(loadTestWoz(t).tracks[0])
+	trailing := len(original) - len(strings.TrimRight(original, "0"))
+	expected := original[len(original)-trailing:] + original[:len(original)-trailing]
+
+	// A revolution and a quarter, the loop point marks the revolution
+	loopPoint := uint32(len(original) * wozDefaultBitTiming)
+	data := makeTestA2R2([]a2rTestStream{{0, a2rCaptureTiming,
+		bitsToFlux(original+original[:len(original)/4], 0), loopPoint}})
+
+	f, err := NewFileWozFromA2R(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := trackBits(f.tracks[f.trackMap[0]])
+	if decoded != expected {
+		t.Errorf("the decoded track differs, %v bits instead of %v", len(decoded), len(expected))
+	}
+	if f.meta["title"] != "Test" {
+		t.Error("the metadata is lost")
+	}
+}
+
+func TestA2RQuarterTrackCapture(t *testing.T) {
+	// 35 tracks captured on every quarter track
+	var streams []a2rTestStream
+	for location := 0; location <= 34*4; location++ {
+		bits := strings.Repeat("1", location%8+1) + strings.Repeat("10110100", 600)
+		streams = append(streams, a2rTestStream{location, a2rCaptureTiming, bitsToFlux(bits, 0), 0})
+	}
+	f, err := NewFileWozFromA2R(makeTestA2R2(streams))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for location := 0; location <= 34*4; location++ {
+		if !f.HasFlux(location) || f.trackMap[location] == 0xff {
+			t.Fatalf("quarter track %v has no tracks", location)
+		}
+		if location%2 == 0 && f.tracks[f.fluxMap[location]].bitCount != uint32(len(streams[location].flux)) {
+			t.Errorf("quarter track %v should have its own flux track", location)
+		}
+		if location%4 == 0 && f.tracks[f.trackMap[location]].bitCount != fluxToBits(streams[location].flux).bitCount {
+			t.Errorf("track %v should have its own bit track", location/4)
+		}
+	}
+	if f.HasFlux(34*4 + 3) {
+		t.Error("the quarter tracks beyond the capture should be empty")
+	}
+}
@@ -201,9 +201,13 @@ const (
 )
 
 func nibEncodeTrack(data []byte, volume byte, track byte, logicalOrder *[16]int) []byte {
+	return nibEncodeTrackGap(data, volume, track, logicalOrder, gap1Len)
+}
+
+func nibEncodeTrackGap(data []byte, volume byte, track byte, logicalOrder *[16]int, gap1Size int) []byte {
 	b := make([]byte, 0, nibBytesPerTrack) // Buffer slice with enough capacity
 	// Initialize gaps to be copied for each sector
-	gap1 := make([]byte, gap1Len)
+	gap1 := make([]byte, gap1Size)
 	for i := range gap1 {
 		gap1[i] = 0xff
 	}
@@ -276,33 +280,57 @@ func findProlog(diskPrologByte3 uint8, data []byte, position int) int {
 }
 
 func nibDecodeTrack(data []byte, logicalOrder *[16]int) ([]byte, error) {
+	b, _, err := nibDecodeTrackSectors(data, logicalOrder)
+	return b, err
+}
+
+// nibDecodeTrackSectors decodes the sectors found on a track of nibbles. It
+// returns a bit set with the sectors decoded with a valid checksum. The error
+// is returned if invalid nibbles are found, the rest of the sectors are
+// still decoded.
+func nibDecodeTrackSectors(data []byte, logicalOrder *[16]int) ([]byte, uint16, error) {
 	b := make([]byte, bytesPerTrack) // Buffer slice with enough capacity
+	found := uint16(0)
+	var err error
 
 	i := int(0)
 	l := len(data)
+	sectorData := make([]byte, bytesPerSector)
 
 	for {
 		// Find address field prolog
+		start := i
 		i = findProlog(diskPrologByte3Address, data, i)
-		if i == -1 {
+		if i == -1 || i < start {
+			// No more sectors or we are back at the start of the track
 			break
 		}
 
 		// We just want the sector from the address field, we ignore the rest, no error detection
 		sector := oddEvenDecodeByte(data[(i+4)%l], data[(i+5)%l])
+		if sector >= numberOfSectors {
+			continue
+		}
 		logicalSector := logicalOrder[sector]
 		dst := int(logicalSector) * bytesPerSector
 
 		// Find data prolog
 		i = (i + 8 + 3) % l // We skip the four two byte fields and the epilog
 		i = findProlog(diskPrologByte3Data, data, i)
+		if i == -1 {
+			break
+		}
+
+		clear(sectorData)
+		valid := true
 
 		// Read secondary buffer
 		prevV := byte(0)
 		for j := range secondaryBufferSize {
 			w := sixAndTwoUntranslateTable[data[i%l]]
 			if w == -1 {
-				return nil, errors.New("invalid byte from nib data")
+				valid = false
+				break
 			}
 			v := byte(w) ^ prevV
 			prevV = v
@@ -310,7 +338,7 @@ func nibDecodeTrack(data []byte, logicalOrder *[16]int) ([]byte, error) {
 				// The elements of the secondary buffer add two bits to three bytes
 				offset := j + k*secondaryBufferSize
 				if offset < bytesPerSector {
-					b[dst+offset] |= ((v & 0x02) >> 1) | ((v & 0x01) << 1)
+					sectorData[offset] |= ((v & 0x02) >> 1) | ((v & 0x01) << 1)
 				}
 				v >>= 2
 			}
@@ -318,17 +346,28 @@ func nibDecodeTrack(data []byte, logicalOrder *[16]int) ([]byte, error) {
 		}
 
 		// Read primary buffer
-		for j := range primaryBufferSize {
+		for j := 0; valid && j < primaryBufferSize; j++ {
 			w := sixAndTwoUntranslateTable[data[i%l]]
 			if w == -1 {
-				return nil, errors.New("invalid byte from nib data")
+				valid = false
+				break
 			}
 			v := byte(w) ^ prevV
-			b[dst+j] |= v << 2 // The elements of the secondary buffer are the 6 MSB bits
+			sectorData[j] |= v << 2 // The elements of the secondary buffer are the 6 MSB bits
 			prevV = v
 			i++
 		}
+
+		if !valid {
+			err = errors.New("invalid byte from nib data")
+			continue
+		}
+
+		copy(b[dst:], sectorData)
+		if sixAndTwoUntranslateTable[data[i%l]] == int16(prevV) {
+			found |= 1 << sector
+		}
 	}
 
-	return b, nil
+	return b, found, err
 }
@@ -5,6 +5,10 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"maps"
+	"os"
+	"slices"
 	"strings"
 )
 
@@ -17,12 +21,16 @@ type FileWoz struct {
 	version  int
 	Info     woz2Info
 	trackMap []uint8
+	fluxMap  []uint8 // Optional, WOZ 2.1
 	tracks   [wozMaxTrack]disketteTrackWoz
 	meta     map[string]string
+
+	raw      []uint8 // The full image, the tracks data points inside it
+	modified bool
 }
 
 type disketteTrackWoz struct {
-	bitCount uint32
+	bitCount uint32 // For flux tracks, the number of bytes
 	data     []uint8
 }
 
@@ -49,6 +57,8 @@ type woz2Info struct {
 	CompatibleHardware uint16
 	RequiredRAM        uint16
 	LargestTrack       uint16
+	FluxBlock          uint16 // WOZ 2.1
+	LargestFluxTrack   uint16 // WOZ 2.1
 }
 
 type woz1TrackFooter struct {
@@ -67,14 +77,18 @@ type woz2TrackHeader struct {
 }
 
 const (
+	wozCRCPos             = 8
 	wozFirstChunkPos      = 12
 	wozChunkHeaderLen     = 8
+	wozInfoSize           = 60
 	wozMaxTrack           = 160
 	woz1TrackDataSize     = 6656
 	woz1TrackFooterOffset = 6646
 	woz2TrackBlockSize    = 512
 	woz2FirstTrackBlock   = 3 // The bits on the TRKS block start on 3*512
 	woz2TrackBitsOffset   = 1280
+	wozDefaultBitTiming   = 32  // 4 microseconds in units of 125 nanoseconds
+	wozFluxContinue       = 255 // The flux transition timing continues on the next byte
 )
 
 var headerWoz1 = []uint8{0x57, 0x4f, 0x5A, 0x31, 0xFF, 0x0A, 0x0D, 0x0A}
@@ -107,9 +121,70 @@ func (f *FileWoz) GetNextBitAndPosition(position uint32, positionMax uint32, qua
 	return value, position, positionMax
 }
 
+// BitTiming returns the time per bit in units of 125 nanoseconds
+func (f *FileWoz) BitTiming() uint32 {
+	if f.version < 2 || f.Info.OptimalBitTiming == 0 {
+		if f.Info.DiskType == 2 {
+			return gcr35BitTiming
+		}
+		return wozDefaultBitTiming
+	}
+	return uint32(f.Info.OptimalBitTiming)
+}
+
+// HasFlux returns true if the quarter track has flux transition timings
+func (f *FileWoz) HasFlux(quarterTrack int) bool {
+	return f.fluxMap != nil && f.fluxMap[quarterTrack] != 0xff
+}
+
+// GetNextFluxAndPosition returns the time to the next flux transition in
+// units of 125 nanoseconds. The position is the byte on the flux data.
+func (f *FileWoz) GetNextFluxAndPosition(position uint32, positionMax uint32, quarterTrack int) (uint32, uint32, uint32) {
+	if positionMax == 0 {
+		// First unitialised use
+		positionMax = ^uint32(0) // MaxUint32
+	}
+
+	trackWoz := f.tracks[f.fluxMap[quarterTrack]]
+	if trackWoz.bitCount == 0 {
+		// No data, no transitions for a whole bit
+		return wozDefaultBitTiming, position, positionMax
+	}
+
+	position++
+	position %= positionMax
+	if trackWoz.bitCount != positionMax {
+		// Adjust position as tracks have different length
+		position = position * trackWoz.bitCount / positionMax
+		positionMax = trackWoz.bitCount
+	}
+
+	ticks := uint32(0)
+	for range positionMax {
+		value := trackWoz.data[position]
+		ticks += uint32(value)
+		if value != wozFluxContinue {
+			break
+		}
+		position = (position + 1) % positionMax
+	}
+	return ticks, position, positionMax
+}
+
 func (f *FileWoz) SetBit(value bool, position uint32, positionMax uint32, quarterTrack int) {
 	// The position is not moved, GetNextBitAndPosition() would have been called previously.
 
+	if f.HasFlux(quarterTrack) {
+		// Writing replaces the flux track, the bit track will be used from now on.
+		fluxIndex := f.fluxMap[quarterTrack]
+		for i := range f.fluxMap {
+			if f.fluxMap[i] == fluxIndex {
+				f.fluxMap[i] = 0xff
+			}
+		}
+		f.modified = true
+	}
+
 	trackIndex := f.trackMap[quarterTrack]
 	if trackIndex == 0xff {
 		// No track defined. Nothing is saved
@@ -117,14 +192,40 @@ func (f *FileWoz) SetBit(value bool, position uint32, positionMax uint32, quarte
 	}
 	trackWoz := f.tracks[trackIndex]
 
+	if trackWoz.bitCount != positionMax {
+		// Adjust position as tracks have different length
+		position = position * trackWoz.bitCount / positionMax
+	}
+
 	mask := uint8(1) << (7 - position%8)
 	if value {
 		trackWoz.data[position/8] |= mask
 	} else {
 		trackWoz.data[position/8] &= ^mask
 	}
+	f.modified = true
+}
+
+// IsModified returns true if the image has been written since loaded or saved
+func (f *FileWoz) IsModified() bool {
+	return f.modified
+}
 
-	fmt.Printf("Saving %v at %v\n", value, position)
+// Bytes returns the WOZ image with the changes and the CRC updated
+func (f *FileWoz) Bytes() []uint8 {
+	crc := crc32.ChecksumIEEE(f.raw[wozFirstChunkPos:])
+	binary.LittleEndian.PutUint32(f.raw[wozCRCPos:], crc)
+	return f.raw
+}
+
+// Save writes the WOZ image to a file
+func (f *FileWoz) Save(filename string) error {
+	err := os.WriteFile(filename, f.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+	f.modified = false
+	return nil
 }
 
 func isFileWoz(data []uint8) bool {
@@ -150,6 +251,7 @@ func NewFileWoz(data []uint8) (*FileWoz, error) {
 	} else {
 		return nil, errors.New("invalid WOZ header")
 	}
+	f.raw = data
 
 	// Extract the chunks
 	i := wozFirstChunkPos
@@ -205,6 +307,12 @@ func NewFileWoz(data []uint8) (*FileWoz, error) {
 	}
 	f.trackMap = trackMap
 
+	// Read the optional FLUX chunk, it uses the tracks on the TRKS chunk
+	fluxMap, ok := chunks["FLUX"]
+	if ok && f.version == 2 && len(fluxMap) >= wozMaxTrack {
+		f.fluxMap = fluxMap[:wozMaxTrack] // The chunk is padded to a full block
+	}
+
 	// Read the TRKS chunk
 	tracksData, ok := chunks["TRKS"]
 	if !ok {
@@ -242,6 +350,76 @@ func NewFileWoz(data []uint8) (*FileWoz, error) {
 	return &f, nil
 }
 
+// encodeWoz2 builds a WOZ 2.1 image. The tracks are referenced by index from
+// the track map and the optional flux map.
+func encodeWoz2(info woz2Info, trackMap []uint8, fluxMap []uint8, tracks []disketteTrackWoz, meta map[string]string) []uint8 {
+	var trks bytes.Buffer
+	var trksData bytes.Buffer
+	block := woz2FirstTrackBlock
+	for i := range wozMaxTrack {
+		var header woz2TrackHeader
+		if i < len(tracks) && len(tracks[i].data) != 0 {
+			blocks := (len(tracks[i].data) + woz2TrackBlockSize - 1) / woz2TrackBlockSize
+			header.StartingBlock = uint16(block)
+			header.BlockCount = uint16(blocks)
+			header.BitCount = tracks[i].bitCount
+			block += blocks
+
+			trksData.Write(tracks[i].data)
+			trksData.Write(make([]uint8, blocks*woz2TrackBlockSize-len(tracks[i].data)))
+
+			if fluxMap != nil && slices.Contains(fluxMap, uint8(i)) {
+				info.LargestFluxTrack = max(info.LargestFluxTrack, uint16(blocks))
+			} else {
+				info.LargestTrack = max(info.LargestTrack, uint16(blocks))
+			}
+		}
+		binary.Write(&trks, binary.LittleEndian, &header)
+	}
+	trks.Write(trksData.Bytes())
+
+	// The INFO and TMAP chunks have a fixed size and the tracks are padded
+	// to full blocks, the TRKS chunk ends on a block boundary. As per WOZ
+	// 2.1 the FLUX chunk follows it taking the next full block.
+	info.Version = 2
+	info.FluxBlock = 0
+	if fluxMap != nil {
+		info.Version = 3
+		info.FluxBlock = uint16(block)
+	}
+
+	var out bytes.Buffer
+	out.Write(headerWoz2)
+	out.Write(make([]uint8, 4)) // CRC
+	writeChunk := func(id string, data []uint8) {
+		binary.Write(&out, binary.LittleEndian, wozChunkHeader{[4]byte([]byte(id)), uint32(len(data))})
+		out.Write(data)
+	}
+
+	var infoData bytes.Buffer
+	binary.Write(&infoData, binary.LittleEndian, &info)
+	infoData.Write(make([]uint8, wozInfoSize-infoData.Len()))
+	writeChunk("INFO", infoData.Bytes())
+	writeChunk("TMAP", trackMap)
+	writeChunk("TRKS", trks.Bytes())
+	if fluxMap != nil {
+		fluxData := make([]uint8, woz2TrackBlockSize-wozChunkHeaderLen)
+		copy(fluxData, fluxMap[:wozMaxTrack])
+		writeChunk("FLUX", fluxData)
+	}
+	if len(meta) != 0 {
+		var metaData strings.Builder
+		for _, k := range slices.Sorted(maps.Keys(meta)) {
+			fmt.Fprintf(&metaData, "%v\t%v\n", k, meta[k])
+		}
+		writeChunk("META", []uint8(metaData.String()))
+	}
+
+	data := out.Bytes()
+	binary.LittleEndian.PutUint32(data[wozCRCPos:], crc32.ChecksumIEEE(data[wozFirstChunkPos:]))
+	return data
+}
+
 func (f *FileWoz) DumpTrackAsWoz(quarterTrack int) []uint8 {
 	trackWoz := f.tracks[f.trackMap[quarterTrack]]
 	return trackWoz.data
@@ -279,6 +457,10 @@ func (f *FileWoz) Dump() {
 		fmt.Printf("  Required RAM: %vKB\n", f.Info.RequiredRAM)
 		fmt.Printf("  Largest track: %v blocks\n", f.Info.LargestTrack)
 	}
+	if f.Info.Version >= 3 {
+		fmt.Printf("  Flux block: %v\n", f.Info.FluxBlock)
+		fmt.Printf("  Largest flux track: %v blocks\n", f.Info.LargestFluxTrack)
+	}
 	if f.meta != nil {
 		fmt.Printf("  Metadata:\n")
 		for k, v := range f.meta {
@@ -292,6 +474,15 @@ func (f *FileWoz) Dump() {
 				0.25*float32(i), track, f.tracks[track].bitCount, len(f.tracks[track].data))
 		}
 	}
+	if f.fluxMap != nil {
+		fmt.Printf("   Flux tracks:\n")
+		for i, track := range f.fluxMap {
+			if track != 255 {
+				fmt.Printf("    Track %.2f: %v (%v bytes)\n",
+					0.25*float32(i), track, f.tracks[track].bitCount)
+			}
+		}
+	}
 
 	// nibs := f.dumpTrackAsNib(0)
 	// fmt.Printf("  Zero track: {%v} %x\n", len(nibs), nibs)
@@ -0,0 +1,329 @@
+package storage
+
+import (
+	"errors"
+)
+
+/*
+GCR encoding of the 3.5 disks used by the Apple 3.5 Drive, the UniDisk 3.5
+and the Macintosh.
+
+See:
+	Inside Macintosh, volume II, The Disk Driver
+	https://github.com/TomHarte/CLK/wiki/Apple-GCR-disk-encoding
+	MAME, src/lib/formats/ap_dsk35.cpp
+
+There are 80 tracks per side grouped in 5 speed zones of 16 tracks. The
+bit cells are always 2 microseconds long, the drive rotates slower on the
+outer zones to fit more sectors:
+	Tracks  0-15: 12 sectors, 394 rpm
+	Tracks 16-31: 11 sectors, 429 rpm
+	Tracks 32-47: 10 sectors, 472 rpm
+	Tracks 48-63:  9 sectors, 525 rpm
+	Tracks 64-79:  8 sectors, 590 rpm
+
+Every sector has 12 tag bytes and 512 data bytes. The sectors are stored
+with a 2:1 interleave.
+
+Address field:
+	D5 AA 96 track sector side format checksum DE AA
+	The side field has the side on bit 5 and the bit 6 of the track on bit 0.
+Data field:
+	D5 AA AD sector <699 nibbles with 524 bytes> <4 nibbles checksum> DE AA
+*/
+
+const (
+	gcr35Tracks            = 80
+	gcr35TracksPerZone     = 16
+	gcr35TagSize           = 12
+	gcr35SectorSize        = gcr35TagSize + int(ProDosBlockSize)
+	gcr35DataNibbles       = 699
+	gcr35ChecksumNibbles   = 4
+	gcr35BitTiming         = 16 // 2 microseconds in units of 125 nanoseconds
+	gcr35FormatDoubleSided = 0x22
+	gcr35FormatSingleSided = 0x02
+	gcr35Blocks400K        = 800
+	gcr35Blocks800K        = 1600
+	gcr35GapSyncs          = 6 // Syncs before the address field
+	gcr35DataSyncs         = 5 // Syncs between the address field and the data field
+	gcr35EpilogByte1       = uint8(0xde)
+	gcr35EpilogByte2       = uint8(0xaa)
+	gcr35PadByte           = uint8(0xff)
+)
+
+var gcr35Zones = [gcr35Tracks / gcr35TracksPerZone]struct {
+	sectors int
+	rpm     int
+}{{12, 394}, {11, 429}, {10, 472}, {9, 525}, {8, 590}}
+
+func gcr35SectorsPerTrack(track int) int {
+	return gcr35Zones[track/gcr35TracksPerZone].sectors
+}
+
+// gcr35TrackBits returns the bits that fit on one revolution
+func gcr35TrackBits(track int) uint32 {
+	// 60 seconds per minute, 2 microseconds per bit
+	return uint32(30_000_000 / gcr35Zones[track/gcr35TracksPerZone].rpm)
+}
+
+// gcr35BlockLocation returns the track, side and sector of a block
+func gcr35BlockLocation(block uint32, sides int) (int, int, int, bool) {
+	first := uint32(0)
+	for track := range gcr35Tracks {
+		sectors := uint32(gcr35SectorsPerTrack(track))
+		if block < first+sectors*uint32(sides) {
+			offset := block - first
+			return track, int(offset / sectors), int(offset % sectors), true
+		}
+		first += sectors * uint32(sides)
+	}
+	return 0, 0, 0, false
+}
+
+// gcr35Interleave returns the sectors in physical order
+func gcr35Interleave(sectors int) []int {
+	order := make([]int, sectors)
+	used := make([]bool, sectors)
+	position := 0
+	for sector := range sectors {
+		for used[position] {
+			position = (position + 1) % sectors
+		}
+		order[position] = sector
+		used[position] = true
+		position = (position + 2) % sectors
+	}
+	return order
+}
+
+func gcr35AddressField(track int, side int, sector int, format uint8) []uint8 {
+	sideField := uint8(side<<5) | uint8(track>>6)
+	fields := []uint8{uint8(track & 0x3f), uint8(sector), sideField, format}
+	checksum := fields[0] ^ fields[1] ^ fields[2] ^ fields[3]
+	fields = append(fields, checksum&0x3f)
+
+	b := []uint8{diskPrologByte1, diskPrologByte2, diskPrologByte3Address}
+	for _, v := range fields {
+		b = append(b, sixAndTwoTranslateTable[v&0x3f])
+	}
+	return append(b, gcr35EpilogByte1, gcr35EpilogByte2)
+}
+
+// gcr35DataField encodes the 12 tag bytes and the 512 data bytes of a sector
+func gcr35DataField(sector int, data []uint8) []uint8 {
+	var b1, b2, b3 [175]uint8
+	c1, c2, c3 := 0, 0, 0
+	for i, j := 0, 0; ; j++ {
+		c1 = (c1 & 0xff) << 1
+		if c1&0x100 != 0 {
+			c1++
+		}
+
+		v := int(data[i])
+		i++
+		c3 += v
+		if c1&0x100 != 0 {
+			c3++
+			c1 &= 0xff
+		}
+		b1[j] = uint8(v ^ c1)
+
+		v = int(data[i])
+		i++
+		c2 += v
+		if c3 > 0xff {
+			c2++
+			c3 &= 0xff
+		}
+		b2[j] = uint8(v ^ c3)
+
+		if i == gcr35SectorSize {
+			break
+		}
+
+		v = int(data[i])
+		i++
+		c1 += v
+		if c2 > 0xff {
+			c1++
+			c2 &= 0xff
+		}
+		b3[j] = uint8(v ^ c2)
+	}
+	c4 := ((c1 & 0xc0) >> 6) | ((c2 & 0xc0) >> 4) | ((c3 & 0xc0) >> 2)
+
+	nibbles := make([]uint8, 0, gcr35DataNibbles+gcr35ChecksumNibbles)
+	for j := range b1 {
+		high := ((b1[j] & 0xc0) >> 2) | ((b2[j] & 0xc0) >> 4) | ((b3[j] & 0xc0) >> 6)
+		nibbles = append(nibbles, high, b1[j]&0x3f, b2[j]&0x3f)
+		if j != len(b1)-1 {
+			nibbles = append(nibbles, b3[j]&0x3f)
+		}
+	}
+	nibbles = append(nibbles, uint8(c4), uint8(c3&0x3f), uint8(c2&0x3f), uint8(c1&0x3f))
+
+	b := []uint8{diskPrologByte1, diskPrologByte2, diskPrologByte3Data, sixAndTwoTranslateTable[sector]}
+	for _, v := range nibbles {
+		b = append(b, sixAndTwoTranslateTable[v])
+	}
+	return append(b, gcr35EpilogByte1, gcr35EpilogByte2)
+}
+
+// gcr35DecodeData decodes the nibbles after the sector number of the data field
+func gcr35DecodeData(encoded []uint8) ([]uint8, error) {
+	if len(encoded) < gcr35DataNibbles+gcr35ChecksumNibbles {
+		return nil, errors.New("data field too short")
+	}
+	nibbles := make([]uint8, gcr35DataNibbles+gcr35ChecksumNibbles)
+	for i := range nibbles {
+		w := sixAndTwoUntranslateTable[encoded[i]]
+		if w == -1 {
+			return nil, errors.New("invalid nibble on the data field")
+		}
+		nibbles[i] = uint8(w)
+	}
+
+	var b1, b2, b3 [175]uint8
+	for i, j := 0, 0; i < len(b1); i++ {
+		high := nibbles[j]
+		b1[i] = nibbles[j+1] | (high<<2)&0xc0
+		b2[i] = nibbles[j+2] | (high<<4)&0xc0
+		j += 3
+		if i != len(b1)-1 {
+			b3[i] = nibbles[j] | (high<<6)&0xc0
+			j++
+		}
+	}
+
+	data := make([]uint8, gcr35SectorSize)
+	c1, c2, c3 := 0, 0, 0
+	for i, j := 0, 0; ; j++ {
+		c1 = (c1 & 0xff) << 1
+		if c1&0x100 != 0 {
+			c1++
+		}
+
+		v := int(b1[j]) ^ (c1 & 0xff)
+		c3 += v
+		if c1&0x100 != 0 {
+			c3++
+			c1 &= 0xff
+		}
+		data[i] = uint8(v)
+		i++
+
+		v = int(b2[j]) ^ (c3 & 0xff)
+		c2 += v
+		if c3 > 0xff {
+			c2++
+			c3 &= 0xff
+		}
+		data[i] = uint8(v)
+		i++
+
+		if i == gcr35SectorSize {
+			break
+		}
+
+		v = int(b3[j]) ^ (c2 & 0xff)
+		c1 += v
+		if c2 > 0xff {
+			c1++
+			c2 &= 0xff
+		}
+		data[i] = uint8(v)
+		i++
+	}
+	c4 := ((c1 & 0xc0) >> 6) | ((c2 & 0xc0) >> 4) | ((c3 & 0xc0) >> 2)
+
+	checksum := nibbles[gcr35DataNibbles:]
+	if checksum[0] != uint8(c4) || checksum[1] != uint8(c3&0x3f) ||
+		checksum[2] != uint8(c2&0x3f) || checksum[3] != uint8(c1&0x3f) {
+		return nil, errors.New("checksum error on the data field")
+	}
+	return data, nil
+}
+
+func (t *disketteTrackWoz) appendByte(value uint8) {
+	for i := range 8 {
+		t.appendBit((value>>(7-i))&1 == 1)
+	}
+}
+
+func (t *disketteTrackWoz) appendSync(count int) {
+	// Self sync bytes, 0xff followed by two zero bits
+	for range count {
+		t.appendByte(0xff)
+		t.appendBit(false)
+		t.appendBit(false)
+	}
+}
+
+// gcr35EncodeTrack builds the bitstream for a track. The data has the 512
+// bytes blocks of the track and side in logical order.
+func gcr35EncodeTrack(track int, side int, format uint8, data []uint8) disketteTrackWoz {
+	var t disketteTrackWoz
+	sectorData := make([]uint8, gcr35SectorSize) // The tags are zero
+	for _, sector := range gcr35Interleave(gcr35SectorsPerTrack(track)) {
+		copy(sectorData[gcr35TagSize:], data[sector*int(ProDosBlockSize):])
+
+		t.appendSync(gcr35GapSyncs)
+		for _, v := range gcr35AddressField(track, side, sector, format) {
+			t.appendByte(v)
+		}
+		t.appendByte(gcr35PadByte)
+		t.appendSync(gcr35DataSyncs)
+		for _, v := range gcr35DataField(sector, sectorData) {
+			t.appendByte(v)
+		}
+		t.appendByte(gcr35PadByte)
+	}
+
+	// Fill up to the size of the track
+	size := gcr35TrackBits(track)
+	for t.bitCount+10 <= size {
+		t.appendSync(1)
+	}
+	for t.bitCount < size {
+		t.appendBit(true)
+	}
+	return t
+}
+
+// NewFileWozFromBlocks35 encodes a 400K or 800K ProDOS image as a 3.5 WOZ image
+func NewFileWozFromBlocks35(data []uint8) (*FileWoz, error) {
+	blocks := len(data) / int(ProDosBlockSize)
+	sides := 2
+	format := uint8(gcr35FormatDoubleSided)
+	switch blocks {
+	case gcr35Blocks800K:
+	case gcr35Blocks400K:
+		sides = 1
+		format = gcr35FormatSingleSided
+	default:
+		return nil, errors.New("only 400K and 800K images can be used as 3.5 disks")
+	}
+
+	var info woz2Info
+	info.DiskType = 2
+	info.DiskSides = uint8(sides)
+	info.OptimalBitTiming = gcr35BitTiming
+	copy(info.Creator[:], []uint8("izapple2                        "))
+
+	trackMap := make([]uint8, wozMaxTrack)
+	for i := range trackMap {
+		trackMap[i] = 0xff
+	}
+	var tracks []disketteTrackWoz
+	offset := 0
+	for track := range gcr35Tracks {
+		size := gcr35SectorsPerTrack(track) * int(ProDosBlockSize)
+		for side := range sides {
+			trackMap[track*2+side] = uint8(len(tracks))
+			tracks = append(tracks, gcr35EncodeTrack(track, side, format, data[offset:offset+size]))
+			offset += size
+		}
+	}
+
+	return NewFileWoz(encodeWoz2(info, trackMap, nil, tracks, nil))
+}
@@ -7,11 +7,12 @@ import (
 )
 
 /*
-Minimal WAV file decoder to load cassette tape recordings.
+Minimal WAV file decoder to load cassette tape recordings, and encoder
+to save the cassette output.
 
 Supports PCM integer samples of 8, 16, 24 and 32 bits and 32 bit
 IEEE float samples. For multichannel files, the channel with the
-most energy is used.
+most energy is used. The files are saved as mono 16 bit PCM.
 
 See: http://soundfile.sapp.org/doc/WaveFormat/
 */
@@ -144,3 +145,28 @@ func (w *wavFile) bestChannel() int {
 	}
 	return best
 }
+
+// encodeWavFile builds a mono 16 bit PCM WAV file
+func encodeWavFile(samples []int16, sampleRate int) []uint8 {
+	dataSize := len(samples) * 2
+	data := make([]uint8, 44+dataSize)
+	copy(data[0:], "RIFF")
+	binary.LittleEndian.PutUint32(data[4:], uint32(36+dataSize))
+	copy(data[8:], "WAVE")
+
+	copy(data[12:], "fmt ")
+	binary.LittleEndian.PutUint32(data[16:], 16)
+	binary.LittleEndian.PutUint16(data[20:], wavFormatPCM)
+	binary.LittleEndian.PutUint16(data[22:], 1) // Channels
+	binary.LittleEndian.PutUint32(data[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(data[28:], uint32(sampleRate*2)) // Bytes per second
+	binary.LittleEndian.PutUint16(data[32:], 2)                    // Block align
+	binary.LittleEndian.PutUint16(data[34:], 16)                   // Bits per sample
+
+	copy(data[36:], "data")
+	binary.LittleEndian.PutUint32(data[40:], uint32(dataSize))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(data[44+2*i:], uint16(s))
+	}
+	return data
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ivanizag/izapple2"
+	"github.com/ivanizag/izapple2/dos33"
+)
+
+// openDos returns the DOS volume if the image has a DOS filesystem
+func openDos(filename string) *dos33.Volume {
+	data, _, err := izapple2.LoadResource(filename)
+	if err != nil {
+		return nil
+	}
+	v, err := dos33.Open(data)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+func saveDos(filename string, v *dos33.Volume) error {
+	_, writeable, err := izapple2.LoadResource(filename)
+	if err != nil {
+		return err
+	}
+	if !writeable {
+		return errors.New("the image can't be modified")
+	}
+	return os.WriteFile(filename, v.Bytes(), 0644)
+}
+
+func listDos(v *dos33.Volume) error {
+	entries, err := v.Catalog()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("DISK VOLUME %v\n\n", v.VolumeNumber())
+	for _, e := range entries {
+		fmt.Printf("%v\n", e.String())
+	}
+	fmt.Printf("\nSectors free: %v\n", v.FreeSectors())
+	return nil
+}
+
+func getDosFile(v *dos33.Volume, name string, destination string, text bool) error {
+	f, err := v.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	data := f.Data
+	if text {
+		switch f.Entry.Type {
+		case dos33.FileTypeApplesoft:
+			data = []uint8(dos33.DetokenizeApplesoft(data))
+		case dos33.FileTypeText:
+			data = []uint8(dos33.TextToHost(data))
+		}
+	}
+	if destination == "" {
+		destination = f.Entry.Name
+	}
+	err = os.WriteFile(destination, data, 0644)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Extracted %v, type %v, address $%04x, %v bytes\n",
+		f.Entry.Name, f.Entry.Type, f.Address, len(data))
+	return nil
+}
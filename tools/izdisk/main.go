@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ivanizag/izapple2"
+	"github.com/ivanizag/izapple2/storage"
+)
+
+const usage = `Usage: izdisk <command> [options]
+
+Commands:
+  convert [-from format] [-to format] [-force] <source> <destination>
+      Converts a disk image. The formats are taken from the file extensions
+      if not provided: dsk, do, po, hdv, nib, woz, 2mg and a2r (source only).
+      The source can be compressed with gzip or zip.
+
+  ls <image> [path]
+      Lists a directory of a ProDOS image or the catalog of a DOS image.
+  get [-text] <image> <path> [destination]
+      Extracts a file of a ProDOS or DOS image. With -text the Applesoft
+      programs are converted to listings and the text files to host text.
+  put [-type type] [-aux auxtype] <image> <source> [path]
+      Copies a file to a ProDOS or DOS image, replacing the file if it
+      exists. The type can be a name as BIN or SYS, or a number as $06. For
+      DOS images, the type is A, I, B or T and the aux type is the address
+      of binary files.
+  mkdir <image> <path>
+      Creates a directory on a ProDOS image.
+  rm <image> <path>
+      Deletes a file of a DOS image or a file or an empty directory of a
+      ProDOS image.
+  format [-blocks count] <image> <volume name>
+      Creates an empty ProDOS image, 280 blocks by default.
+
+  The ProDOS images can be in PO, HDV, 2MG, DSK and DO format. The DOS 3.3
+  images in DSK or DO format and the DOS 3.2 images in D13 format.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Print(usage)
+		os.Exit(1)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "convert":
+		err = convert(os.Args[2:])
+	case "ls":
+		err = listDirectory(os.Args[2:])
+	case "get":
+		err = getFile(os.Args[2:])
+	case "put":
+		err = putFile(os.Args[2:])
+	case "mkdir":
+		err = makeDirectory(os.Args[2:])
+	case "rm":
+		err = deleteFile(os.Args[2:])
+	case "format":
+		err = formatImage(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Print(usage)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func convert(args []string) error {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	from := flags.String("from", "", "format of the source image")
+	to := flags.String("to", "", "format of the destination image")
+	force := flags.Bool("force", false, "overwrite the destination file")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		fmt.Print(usage)
+		os.Exit(1)
+	}
+	source := flags.Arg(0)
+	destination := flags.Arg(1)
+
+	fromFormat, err := diskFormat(*from, source)
+	if err != nil {
+		return err
+	}
+	toFormat, err := diskFormat(*to, destination)
+	if err != nil {
+		return err
+	}
+
+	if !*force {
+		if _, err := os.Stat(destination); err == nil {
+			return fmt.Errorf("%v already exists, use -force to overwrite it", destination)
+		}
+	}
+
+	data, _, err := izapple2.LoadResource(source)
+	if err != nil {
+		return err
+	}
+
+	out, warnings, err := storage.ConvertDisk(data, fromFormat, toFormat)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		fmt.Printf("Warning: %v\n", w)
+	}
+
+	err = os.WriteFile(destination, out, 0644)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Converted %v from %v to %v\n", source, fromFormat, toFormat)
+	return nil
+}
+
+func diskFormat(name string, filename string) (storage.DiskFormat, error) {
+	if name == "" {
+		name = filename
+	}
+	format := storage.ParseDiskFormat(name)
+	if format == storage.DiskFormatUnknown {
+		return format, fmt.Errorf("unknown disk image format for %v", name)
+	}
+	return format, nil
+}
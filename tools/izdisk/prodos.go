@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ivanizag/izapple2/dos33"
+	"github.com/ivanizag/izapple2/prodos"
+	"github.com/ivanizag/izapple2/storage"
+)
+
+func openVolume(filename string, readOnly bool) (*prodos.Volume, error) {
+	disk, err := storage.OpenBlockDiskImage(filename, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return prodos.Open(disk)
+}
+
+func checkArgs(args []string, minArgs int, maxArgs int) {
+	if len(args) < minArgs || len(args) > maxArgs {
+		fmt.Print(usage)
+		os.Exit(1)
+	}
+}
+
+func listDirectory(args []string) error {
+	checkArgs(args, 1, 2)
+	if dv := openDos(args[0]); dv != nil {
+		return listDos(dv)
+	}
+	v, err := openVolume(args[0], true)
+	if err != nil {
+		return err
+	}
+	path := ""
+	if len(args) > 1 {
+		path = args[1]
+	}
+	entries, err := v.ReadDir(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("/%v/%v\n\n", v.Name(), strings.ToUpper(strings.Trim(path, "/")))
+	fmt.Printf(" NAME            TYPE AUX      EOF  BLKS MODIFIED\n")
+	for _, e := range entries {
+		modified := "<NO DATE>"
+		if !e.Modified.IsZero() {
+			modified = e.Modified.Format("02-Jan-06 15:04")
+		}
+		fmt.Printf(" %v %v\n", e.String(), modified)
+	}
+	free, err := v.FreeBlocks()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nBlocks free: %v, used: %v, total: %v\n", free, v.TotalBlocks()-free, v.TotalBlocks())
+	return nil
+}
+
+func getFile(args []string) error {
+	flags := flag.NewFlagSet("get", flag.ExitOnError)
+	text := flags.Bool("text", false, "convert Applesoft programs to listings and text files to host text")
+	flags.Parse(args)
+	args = flags.Args()
+	checkArgs(args, 2, 3)
+	destination := ""
+	if len(args) > 2 {
+		destination = args[2]
+	}
+	if dv := openDos(args[0]); dv != nil {
+		return getDosFile(dv, args[1], destination, *text)
+	}
+
+	v, err := openVolume(args[0], true)
+	if err != nil {
+		return err
+	}
+	data, e, err := v.ReadFile(args[1])
+	if err != nil {
+		return err
+	}
+	if destination == "" {
+		destination = e.Name
+	}
+	if *text {
+		switch e.FileType {
+		case prodos.FileTypeBAS:
+			data = []uint8(dos33.DetokenizeApplesoft(data))
+		case prodos.FileTypeTXT:
+			data = []uint8(dos33.TextToHost(data))
+		}
+	}
+	err = os.WriteFile(destination, data, 0644)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Extracted %v, type %v, aux type $%04x, %v bytes\n",
+		e.Name, prodos.FileTypeName(e.FileType), e.AuxType, len(data))
+	return nil
+}
+
+func putFile(args []string) error {
+	flags := flag.NewFlagSet("put", flag.ExitOnError)
+	typeName := flags.String("type", "BIN", "ProDOS file type")
+	auxName := flags.String("aux", "0", "ProDOS aux type, the load address for BIN files")
+	flags.Parse(args)
+	args = flags.Args()
+	checkArgs(args, 2, 3)
+
+	aux := strings.Replace(*auxName, "$", "0x", 1)
+	auxType, err := strconv.ParseUint(aux, 0, 16)
+	if err != nil {
+		return fmt.Errorf("invalid aux type '%v'", *auxName)
+	}
+	data, err := os.ReadFile(args[1])
+	if err != nil {
+		return err
+	}
+	path := strings.TrimSuffix(filepath.Base(args[1]), filepath.Ext(args[1]))
+	if len(args) > 2 {
+		path = args[2]
+	}
+
+	if dv := openDos(args[0]); dv != nil {
+		fileType, err := dos33.ParseFileType(*typeName)
+		if err != nil {
+			return err
+		}
+		err = dv.WriteFile(path, fileType, data, uint16(auxType))
+		if err != nil {
+			return err
+		}
+		return saveDos(args[0], dv)
+	}
+
+	fileType, err := prodos.ParseFileType(*typeName)
+	if err != nil {
+		return err
+	}
+	v, err := openVolume(args[0], false)
+	if err != nil {
+		return err
+	}
+	return v.WriteFile(path, data, fileType, uint16(auxType))
+}
+
+func makeDirectory(args []string) error {
+	checkArgs(args, 2, 2)
+	v, err := openVolume(args[0], false)
+	if err != nil {
+		return err
+	}
+	return v.Mkdir(args[1])
+}
+
+func deleteFile(args []string) error {
+	checkArgs(args, 2, 2)
+	if dv := openDos(args[0]); dv != nil {
+		err := dv.Delete(args[1])
+		if err != nil {
+			return err
+		}
+		return saveDos(args[0], dv)
+	}
+	v, err := openVolume(args[0], false)
+	if err != nil {
+		return err
+	}
+	return v.Delete(args[1])
+}
+
+func formatImage(args []string) error {
+	flags := flag.NewFlagSet("format", flag.ExitOnError)
+	blocks := flags.Int("blocks", 280, "size of the image in blocks")
+	flags.Parse(args)
+	args = flags.Args()
+	checkArgs(args, 2, 2)
+
+	if *blocks < 8 || *blocks > 65535 {
+		return fmt.Errorf("invalid number of blocks %v", *blocks)
+	}
+	if _, err := os.Stat(args[0]); err == nil {
+		return fmt.Errorf("%v already exists", args[0])
+	}
+	data := make([]uint8, *blocks*int(storage.ProDosBlockSize))
+	format := storage.ParseDiskFormat(args[0])
+	if format == storage.DiskFormat2MG {
+		data, _, _ = storage.ConvertDisk(data, storage.DiskFormatPO, storage.DiskFormat2MG)
+	}
+	err := os.WriteFile(args[0], data, 0644)
+	if err != nil {
+		return err
+	}
+
+	disk, err := storage.OpenBlockDiskImage(args[0], false)
+	if err != nil {
+		return err
+	}
+	_, err = prodos.Format(disk, args[1])
+	return err
+}
@@ -97,9 +97,26 @@ func getTracerFactory() map[string]*traceBuilder {
 		description:     "Trace monitor ROM calls",
 		executionTracer: newTraceMonitor(),
 	}
+	tracerFactory["vgm"] = &traceBuilder{
+		name:        "vgm",
+		description: "Log the Mockingboard sound registers to mockingboard.vgm",
+		connectFunc: func(a *Apple2) { startPsgLogTracer(a, "mockingboard.vgm") },
+	}
+	tracerFactory["ym"] = &traceBuilder{
+		name:        "ym",
+		description: "Log the Mockingboard sound registers to mockingboard.ym",
+		connectFunc: func(a *Apple2) { startPsgLogTracer(a, "mockingboard.ym") },
+	}
 	return tracerFactory
 }
 
+func startPsgLogTracer(a *Apple2, filename string) {
+	err := a.StartPsgLog(filename)
+	if err != nil {
+		fmt.Printf("Could not log the PSG registers to %v: %v\n", filename, err)
+	}
+}
+
 func availableTracers() []string {
 	names := maps.Keys(getTracerFactory())
 	slices.Sort(names)
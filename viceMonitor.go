@@ -0,0 +1,706 @@
+package izapple2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Server for the VICE binary remote monitor protocol. External debuggers
+that support it can connect to read and write memory and registers, set
+checkpoints and step.
+
+See:
+	https://vice-emu.sourceforge.io/vice_13.html
+
+As in VICE, any command received stops the emulation until the "exit"
+command is sent. Only the main memory space and the 6502 registers are
+available. The memory reads without side effects return zero for the
+$C000-$CFFF area.
+
+The checkpoints are implemented with the breakpoints and watchpoints of
+the debugger.
+*/
+
+const (
+	viceStx        = uint8(0x02)
+	viceAPIVersion = uint8(0x02)
+	viceEventID    = uint32(0xffffffff)
+
+	viceHeaderLength = 11
+	viceMaxBody      = 0x10000 + 16
+)
+
+// Commands
+const (
+	viceCmdMemoryGet          = uint8(0x01)
+	viceCmdMemorySet          = uint8(0x02)
+	viceCmdCheckpointGet      = uint8(0x11)
+	viceCmdCheckpointSet      = uint8(0x12)
+	viceCmdCheckpointDelete   = uint8(0x13)
+	viceCmdCheckpointList     = uint8(0x14)
+	viceCmdCheckpointToggle   = uint8(0x15)
+	viceCmdConditionSet       = uint8(0x22)
+	viceCmdRegistersGet       = uint8(0x31)
+	viceCmdRegistersSet       = uint8(0x32)
+	viceCmdAdvanceInstruction = uint8(0x71)
+	viceCmdExecuteUntilReturn = uint8(0x73)
+	viceCmdPing               = uint8(0x81)
+	viceCmdBanksAvailable     = uint8(0x82)
+	viceCmdRegistersAvailable = uint8(0x83)
+	viceCmdViceInfo           = uint8(0x85)
+	viceCmdExit               = uint8(0xaa)
+	viceCmdQuit               = uint8(0xbb)
+	viceCmdReset              = uint8(0xcc)
+)
+
+// Events
+const (
+	viceEventStopped = uint8(0x62)
+	viceEventResumed = uint8(0x63)
+)
+
+// Error codes
+const (
+	viceErrorOk               = uint8(0x00)
+	viceErrorNotFound         = uint8(0x01)
+	viceErrorInvalidMemspace  = uint8(0x02)
+	viceErrorCommandLength    = uint8(0x80)
+	viceErrorInvalidParameter = uint8(0x81)
+	viceErrorAPIVersion       = uint8(0x82)
+	viceErrorInvalidCommand   = uint8(0x83)
+	viceErrorGeneral          = uint8(0x8f)
+)
+
+// Checkpoint operations
+const (
+	viceOperationLoad  = uint8(0x01)
+	viceOperationStore = uint8(0x02)
+	viceOperationExec  = uint8(0x04)
+)
+
+// Register ids, as used by VICE for the 6502
+const (
+	viceRegA  = uint8(0x00)
+	viceRegX  = uint8(0x01)
+	viceRegY  = uint8(0x02)
+	viceRegPC = uint8(0x03)
+	viceRegSP = uint8(0x04)
+	viceRegFL = uint8(0x05)
+)
+
+var viceRegisterNames = []struct {
+	id   uint8
+	bits uint8
+	name string
+}{
+	{viceRegA, 8, "A"},
+	{viceRegX, 8, "X"},
+	{viceRegY, 8, "Y"},
+	{viceRegPC, 16, "PC"},
+	{viceRegSP, 8, "SP"},
+	{viceRegFL, 8, "FL"},
+}
+
+type viceCheckpoint struct {
+	id          uint32
+	start       uint16
+	end         uint16
+	stopWhenHit bool
+	enabled     bool
+	operation   uint8
+	temporary   bool
+	hitCount    uint32
+	ignoreCount uint32
+	condition   string
+	debuggerIDs []int
+}
+
+type viceMonitor struct {
+	a        *Apple2
+	listener net.Listener
+
+	mutex          sync.Mutex // Protects the connection writes and the checkpoints
+	conn           net.Conn
+	checkpoints    map[uint32]*viceCheckpoint
+	lastCheckpoint uint32
+	advancing      atomic.Bool // Stepping several instructions, no events are sent
+	stops          chan int
+}
+
+func (a *Apple2) startViceMonitor(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("could not start the VICE monitor server: %w", err)
+	}
+
+	m := newViceMonitor(a, listener)
+	go m.acceptLoop()
+	go m.eventLoop()
+	return nil
+}
+
+func newViceMonitor(a *Apple2, listener net.Listener) *viceMonitor {
+	var m viceMonitor
+	m.a = a
+	m.listener = listener
+	m.checkpoints = make(map[uint32]*viceCheckpoint)
+	m.stops = make(chan int, 16)
+	a.debugger.SetStopHandler(func(id int, _ string) {
+		select {
+		case m.stops <- id:
+		default:
+			// Not blocking the emulation
+		}
+	})
+	return &m
+}
+
+func (m *viceMonitor) acceptLoop() {
+	for {
+		conn, err := m.listener.Accept()
+		if err != nil {
+			return
+		}
+		m.mutex.Lock()
+		m.conn = conn
+		m.mutex.Unlock()
+
+		m.serve(conn)
+
+		m.mutex.Lock()
+		m.conn = nil
+		m.mutex.Unlock()
+		conn.Close()
+	}
+}
+
+func (m *viceMonitor) serve(conn net.Conn) {
+	header := make([]uint8, viceHeaderLength)
+	for {
+		_, err := io.ReadFull(conn, header)
+		if err != nil {
+			return
+		}
+		if header[0] != viceStx {
+			return // Lost sync with the client
+		}
+		length := binary.LittleEndian.Uint32(header[2:])
+		requestID := binary.LittleEndian.Uint32(header[6:])
+		command := header[10]
+		if length > viceMaxBody {
+			return
+		}
+		body := make([]uint8, length)
+		_, err = io.ReadFull(conn, body)
+		if err != nil {
+			return
+		}
+
+		if header[1] != 0x01 && header[1] != viceAPIVersion {
+			m.respond(command, viceErrorAPIVersion, requestID, nil)
+			continue
+		}
+
+		m.enterMonitor()
+		m.processCommand(command, requestID, body)
+	}
+}
+
+// enterMonitor pauses the emulation, as VICE does when a command is received
+func (m *viceMonitor) enterMonitor() {
+	if m.a.IsPaused() {
+		return
+	}
+	m.a.SendCommand(CommandPause)
+	spinWait(m.a.IsPaused)
+	m.sendStopped()
+}
+
+func (m *viceMonitor) processCommand(command uint8, requestID uint32, body []uint8) {
+	var response []uint8
+	errorCode := viceErrorOk
+	responseType := command
+
+	switch command {
+	case viceCmdPing:
+		// Nothing to do
+	case viceCmdViceInfo:
+		response = []uint8{4, 3, 7, 0, 0, 4, 0, 0, 0, 0}
+	case viceCmdMemoryGet:
+		response, errorCode = m.memoryGet(body)
+	case viceCmdMemorySet:
+		errorCode = m.memorySet(body)
+	case viceCmdRegistersGet:
+		if len(body) < 1 {
+			errorCode = viceErrorCommandLength
+		} else if body[0] != 0 {
+			errorCode = viceErrorInvalidMemspace
+		} else {
+			response = m.registers()
+		}
+	case viceCmdRegistersSet:
+		errorCode = m.registersSet(body)
+		if errorCode == viceErrorOk {
+			response = m.registers()
+		}
+		responseType = viceCmdRegistersGet
+	case viceCmdRegistersAvailable:
+		response = binary.LittleEndian.AppendUint16(nil, uint16(len(viceRegisterNames)))
+		for _, r := range viceRegisterNames {
+			response = append(response, uint8(3+len(r.name)), r.id, r.bits, uint8(len(r.name)))
+			response = append(response, r.name...)
+		}
+	case viceCmdBanksAvailable:
+		name := "cpu"
+		response = binary.LittleEndian.AppendUint16(nil, 1)
+		response = append(response, uint8(3+len(name)), 0, 0, uint8(len(name)))
+		response = append(response, name...)
+	case viceCmdCheckpointSet:
+		response, errorCode = m.checkpointSet(body)
+		responseType = viceCmdCheckpointGet
+	case viceCmdCheckpointGet:
+		var cp *viceCheckpoint
+		cp, errorCode = m.getCheckpoint(body)
+		if cp != nil {
+			response = m.checkpointInfo(cp, false)
+		}
+	case viceCmdCheckpointDelete:
+		var cp *viceCheckpoint
+		cp, errorCode = m.getCheckpoint(body)
+		if cp != nil {
+			m.mutex.Lock()
+			m.disableCheckpoint(cp)
+			delete(m.checkpoints, cp.id)
+			m.mutex.Unlock()
+		}
+	case viceCmdCheckpointToggle:
+		errorCode = m.checkpointToggle(body)
+	case viceCmdCheckpointList:
+		m.mutex.Lock()
+		for id := uint32(1); id <= m.lastCheckpoint; id++ {
+			if cp, ok := m.checkpoints[id]; ok {
+				m.write(viceCmdCheckpointGet, viceErrorOk, requestID, m.checkpointInfo(cp, false))
+			}
+		}
+		response = binary.LittleEndian.AppendUint32(nil, uint32(len(m.checkpoints)))
+		m.mutex.Unlock()
+	case viceCmdConditionSet:
+		errorCode = m.conditionSet(body)
+	case viceCmdAdvanceInstruction:
+		if len(body) < 3 {
+			errorCode = viceErrorCommandLength
+		} else {
+			m.respond(command, viceErrorOk, requestID, nil)
+			m.advance(body[0] != 0, binary.LittleEndian.Uint16(body[1:]))
+			return
+		}
+	case viceCmdExecuteUntilReturn:
+		m.respond(command, viceErrorOk, requestID, nil)
+		m.advancing.Store(true)
+		err := m.a.debugger.StepOut()
+		if err == nil {
+			spinWait(m.a.IsPaused)
+		}
+		m.advancing.Store(false)
+		m.sendStopped()
+		return
+	case viceCmdExit:
+		m.respond(command, viceErrorOk, requestID, nil)
+		pc, _ := m.a.cpu.GetPCAndSP()
+		err := m.a.debugger.Continue()
+		if err == nil {
+			m.respond(viceEventResumed, viceErrorOk, viceEventID, binary.LittleEndian.AppendUint16(nil, pc))
+		}
+		return
+	case viceCmdQuit:
+		m.respond(command, viceErrorOk, requestID, nil)
+		m.a.SendCommand(CommandKill)
+		return
+	case viceCmdReset:
+		m.a.SendCommand(CommandReset)
+	default:
+		errorCode = viceErrorInvalidCommand
+	}
+
+	m.respond(responseType, errorCode, requestID, response)
+}
+
+func (m *viceMonitor) respond(responseType uint8, errorCode uint8, requestID uint32, body []uint8) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.write(responseType, errorCode, requestID, body)
+}
+
+// write is called with the mutex locked
+func (m *viceMonitor) write(responseType uint8, errorCode uint8, requestID uint32, body []uint8) {
+	if m.conn == nil {
+		return
+	}
+	message := make([]uint8, 0, 12+len(body))
+	message = append(message, viceStx, viceAPIVersion)
+	message = binary.LittleEndian.AppendUint32(message, uint32(len(body)))
+	message = append(message, responseType, errorCode)
+	message = binary.LittleEndian.AppendUint32(message, requestID)
+	message = append(message, body...)
+	m.conn.Write(message)
+}
+
+func (m *viceMonitor) sendStopped() {
+	pc, _ := m.a.cpu.GetPCAndSP()
+	m.respond(viceCmdRegistersGet, viceErrorOk, viceEventID, m.registers())
+	m.respond(viceEventStopped, viceErrorOk, viceEventID, binary.LittleEndian.AppendUint16(nil, pc))
+}
+
+func (m *viceMonitor) advance(stepOver bool, count uint16) {
+	m.advancing.Store(true)
+	for range count {
+		var err error
+		if stepOver {
+			err = m.a.debugger.StepOver()
+		} else {
+			err = m.a.debugger.Step()
+		}
+		if err != nil {
+			break
+		}
+		spinWait(m.a.IsPaused)
+	}
+	m.advancing.Store(false)
+	m.sendStopped()
+}
+
+// eventLoop notifies the checkpoints hit
+func (m *viceMonitor) eventLoop() {
+	for id := range m.stops {
+		if m.advancing.Load() {
+			continue
+		}
+		spinWait(m.a.IsPaused)
+
+		m.mutex.Lock()
+		cp := m.findCheckpoint(id)
+		resume := false
+		if cp != nil {
+			cp.hitCount++
+			if cp.ignoreCount > 0 {
+				cp.ignoreCount--
+				resume = true
+			} else {
+				m.write(viceCmdCheckpointGet, viceErrorOk, viceEventID, m.checkpointInfo(cp, true))
+				resume = !cp.stopWhenHit
+				if cp.temporary {
+					m.disableCheckpoint(cp)
+					delete(m.checkpoints, cp.id)
+				}
+			}
+		}
+		m.mutex.Unlock()
+
+		if resume {
+			m.a.debugger.Continue()
+		} else {
+			m.sendStopped()
+		}
+	}
+}
+
+// findCheckpoint is called with the mutex locked
+func (m *viceMonitor) findCheckpoint(debuggerID int) *viceCheckpoint {
+	if debuggerID == 0 {
+		return nil
+	}
+	for _, cp := range m.checkpoints {
+		for _, id := range cp.debuggerIDs {
+			if id == debuggerID {
+				return cp
+			}
+		}
+	}
+	return nil
+}
+
+func (m *viceMonitor) peek(address uint16, sideEffects bool) uint8 {
+	if !sideEffects && address >= 0xc000 && address <= 0xcfff {
+		return 0
+	}
+	return m.a.mmu.peekUnwatched(address)
+}
+
+func (m *viceMonitor) memoryGet(body []uint8) ([]uint8, uint8) {
+	if len(body) < 8 {
+		return nil, viceErrorCommandLength
+	}
+	sideEffects := body[0] != 0
+	start := binary.LittleEndian.Uint16(body[1:])
+	end := binary.LittleEndian.Uint16(body[3:])
+	if body[5] != 0 {
+		return nil, viceErrorInvalidMemspace
+	}
+	if end < start {
+		return nil, viceErrorInvalidParameter
+	}
+
+	length := int(end) - int(start) + 1
+	response := binary.LittleEndian.AppendUint16(nil, uint16(length))
+	for i := 0; i < length; i++ {
+		response = append(response, m.peek(start+uint16(i), sideEffects))
+	}
+	return response, viceErrorOk
+}
+
+func (m *viceMonitor) memorySet(body []uint8) uint8 {
+	if len(body) < 8 {
+		return viceErrorCommandLength
+	}
+	sideEffects := body[0] != 0
+	start := binary.LittleEndian.Uint16(body[1:])
+	end := binary.LittleEndian.Uint16(body[3:])
+	if body[5] != 0 {
+		return viceErrorInvalidMemspace
+	}
+	if end < start {
+		return viceErrorInvalidParameter
+	}
+	data := body[8:]
+	if len(data) != int(end)-int(start)+1 {
+		return viceErrorCommandLength
+	}
+
+	for i, value := range data {
+		address := start + uint16(i)
+		if sideEffects || address < 0xc000 || address > 0xcfff {
+			m.a.mmu.pokeUnwatched(address, value)
+		}
+	}
+	return viceErrorOk
+}
+
+func (m *viceMonitor) registers() []uint8 {
+	pc, sp := m.a.cpu.GetPCAndSP()
+	regA, regX, regY, regP := m.a.cpu.GetAXYP()
+	values := []struct {
+		id    uint8
+		value uint16
+	}{
+		{viceRegA, uint16(regA)},
+		{viceRegX, uint16(regX)},
+		{viceRegY, uint16(regY)},
+		{viceRegPC, pc},
+		{viceRegSP, uint16(sp)},
+		{viceRegFL, uint16(regP)},
+	}
+
+	response := binary.LittleEndian.AppendUint16(nil, uint16(len(values)))
+	for _, v := range values {
+		response = append(response, 3, v.id)
+		response = binary.LittleEndian.AppendUint16(response, v.value)
+	}
+	return response
+}
+
+func (m *viceMonitor) registersSet(body []uint8) uint8 {
+	if len(body) < 3 {
+		return viceErrorCommandLength
+	}
+	if body[0] != 0 {
+		return viceErrorInvalidMemspace
+	}
+	count := int(binary.LittleEndian.Uint16(body[1:]))
+	regA, regX, regY, regP := m.a.cpu.GetAXYP()
+	pc, _ := m.a.cpu.GetPCAndSP()
+
+	items := body[3:]
+	for range count {
+		if len(items) < 1 || len(items) < int(items[0])+1 || items[0] < 3 {
+			return viceErrorCommandLength
+		}
+		id := items[1]
+		value := binary.LittleEndian.Uint16(items[2:])
+		switch id {
+		case viceRegA:
+			regA = uint8(value)
+		case viceRegX:
+			regX = uint8(value)
+		case viceRegY:
+			regY = uint8(value)
+		case viceRegPC:
+			pc = value
+		case viceRegFL:
+			regP = uint8(value)
+		default:
+			return viceErrorInvalidParameter
+		}
+		items = items[items[0]+1:]
+	}
+
+	m.a.cpu.SetAXYP(regA, regX, regY, regP)
+	m.a.cpu.SetPC(pc)
+	return viceErrorOk
+}
+
+func (m *viceMonitor) getCheckpoint(body []uint8) (*viceCheckpoint, uint8) {
+	if len(body) < 4 {
+		return nil, viceErrorCommandLength
+	}
+	id := binary.LittleEndian.Uint32(body)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	cp, ok := m.checkpoints[id]
+	if !ok {
+		return nil, viceErrorNotFound
+	}
+	return cp, viceErrorOk
+}
+
+func (m *viceMonitor) checkpointSet(body []uint8) ([]uint8, uint8) {
+	if len(body) < 8 {
+		return nil, viceErrorCommandLength
+	}
+	var cp viceCheckpoint
+	cp.start = binary.LittleEndian.Uint16(body)
+	cp.end = binary.LittleEndian.Uint16(body[2:])
+	cp.stopWhenHit = body[4] != 0
+	cp.enabled = body[5] != 0
+	cp.operation = body[6]
+	cp.temporary = body[7] != 0
+	if len(body) >= 9 && body[8] != 0 {
+		return nil, viceErrorInvalidMemspace
+	}
+	if cp.end < cp.start || cp.operation == 0 ||
+		cp.operation&^(viceOperationLoad|viceOperationStore|viceOperationExec) != 0 {
+		return nil, viceErrorInvalidParameter
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if cp.enabled {
+		err := m.enableCheckpoint(&cp)
+		if err != nil {
+			return nil, viceErrorInvalidParameter
+		}
+	}
+	m.lastCheckpoint++
+	cp.id = m.lastCheckpoint
+	m.checkpoints[cp.id] = &cp
+	return m.checkpointInfo(&cp, false), viceErrorOk
+}
+
+func (m *viceMonitor) checkpointToggle(body []uint8) uint8 {
+	if len(body) < 5 {
+		return viceErrorCommandLength
+	}
+	cp, errorCode := m.getCheckpoint(body)
+	if cp == nil {
+		return errorCode
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	enabled := body[4] != 0
+	if enabled && !cp.enabled {
+		err := m.enableCheckpoint(cp)
+		if err != nil {
+			return viceErrorGeneral
+		}
+	} else if !enabled && cp.enabled {
+		m.disableCheckpoint(cp)
+	}
+	cp.enabled = enabled
+	return viceErrorOk
+}
+
+func (m *viceMonitor) conditionSet(body []uint8) uint8 {
+	if len(body) < 5 || len(body) < 5+int(body[4]) {
+		return viceErrorCommandLength
+	}
+	cp, errorCode := m.getCheckpoint(body)
+	if cp == nil {
+		return errorCode
+	}
+	condition := string(body[5 : 5+int(body[4])])
+	if _, err := parseBreakpointConditions(condition); err != nil {
+		return viceErrorInvalidParameter
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	cp.condition = condition
+	if cp.enabled {
+		m.disableCheckpoint(cp)
+		err := m.enableCheckpoint(cp)
+		if err != nil {
+			return viceErrorGeneral
+		}
+	}
+	return viceErrorOk
+}
+
+// enableCheckpoint adds the breakpoints and watchpoints to the debugger. It
+// is called with the mutex locked.
+func (m *viceMonitor) enableCheckpoint(cp *viceCheckpoint) error {
+	d := m.a.debugger
+	if cp.operation&viceOperationExec != 0 {
+		id, err := d.AddBreakpointRange(cp.start, cp.end, cp.condition)
+		if err != nil {
+			return err
+		}
+		cp.debuggerIDs = append(cp.debuggerIDs, id)
+	}
+	read := cp.operation&viceOperationLoad != 0
+	write := cp.operation&viceOperationStore != 0
+	if read || write {
+		if cp.condition != "" {
+			m.disableCheckpoint(cp)
+			return errors.New("conditions are only supported on exec checkpoints")
+		}
+		id, err := d.AddWatchpoint(cp.start, cp.end, read, write)
+		if err != nil {
+			m.disableCheckpoint(cp)
+			return err
+		}
+		cp.debuggerIDs = append(cp.debuggerIDs, id)
+	}
+	return nil
+}
+
+// disableCheckpoint removes the breakpoints and watchpoints from the
+// debugger. It is called with the mutex locked.
+func (m *viceMonitor) disableCheckpoint(cp *viceCheckpoint) {
+	for _, id := range cp.debuggerIDs {
+		m.a.debugger.Remove(id)
+	}
+	cp.debuggerIDs = nil
+}
+
+func (m *viceMonitor) checkpointInfo(cp *viceCheckpoint, hit bool) []uint8 {
+	info := binary.LittleEndian.AppendUint32(nil, cp.id)
+	info = append(info, boolToUint8(hit))
+	info = binary.LittleEndian.AppendUint16(info, cp.start)
+	info = binary.LittleEndian.AppendUint16(info, cp.end)
+	info = append(info, boolToUint8(cp.stopWhenHit), boolToUint8(cp.enabled),
+		cp.operation, boolToUint8(cp.temporary))
+	info = binary.LittleEndian.AppendUint32(info, cp.hitCount)
+	info = binary.LittleEndian.AppendUint32(info, cp.ignoreCount)
+	info = append(info, boolToUint8(cp.condition != ""), 0)
+	return info
+}
+
+func boolToUint8(value bool) uint8 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func spinWait(f func() bool) {
+	for !f() {
+		time.Sleep(time.Millisecond)
+	}
+}
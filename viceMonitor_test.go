@@ -0,0 +1,163 @@
+package izapple2
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+type viceTestClient struct {
+	t         *testing.T
+	conn      net.Conn
+	requestID uint32
+}
+
+func makeViceMonitorTester(t *testing.T) (*Apple2, *viceTestClient) {
+	at, err := makeApple2Tester("2plus", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := at.a
+	a.paused.Store(true)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newViceMonitor(a, listener)
+	go m.acceptLoop()
+	t.Cleanup(func() { listener.Close() })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return a, &viceTestClient{t: t, conn: conn}
+}
+
+func (c *viceTestClient) request(command uint8, body []uint8) (uint8, uint8, []uint8) {
+	c.requestID++
+	message := []uint8{viceStx, viceAPIVersion}
+	message = binary.LittleEndian.AppendUint32(message, uint32(len(body)))
+	message = binary.LittleEndian.AppendUint32(message, c.requestID)
+	message = append(message, command)
+	message = append(message, body...)
+	_, err := c.conn.Write(message)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	header := make([]uint8, 12)
+	_, err = io.ReadFull(c.conn, header)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if header[0] != viceStx || header[1] != viceAPIVersion {
+		c.t.Fatalf("Invalid response header %v", header)
+	}
+	if binary.LittleEndian.Uint32(header[8:]) != c.requestID {
+		c.t.Fatalf("Unexpected request id on %v", header)
+	}
+	response := make([]uint8, binary.LittleEndian.Uint32(header[2:]))
+	_, err = io.ReadFull(c.conn, response)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return header[6], header[7], response
+}
+
+func TestViceMonitorPing(t *testing.T) {
+	_, c := makeViceMonitorTester(t)
+	responseType, errorCode, _ := c.request(viceCmdPing, nil)
+	if responseType != viceCmdPing || errorCode != viceErrorOk {
+		t.Errorf("Unexpected ping response %02x, error %02x", responseType, errorCode)
+	}
+
+	_, errorCode, _ = c.request(0x7f, nil)
+	if errorCode != viceErrorInvalidCommand {
+		t.Errorf("An unknown command should fail, got error %02x", errorCode)
+	}
+}
+
+func TestViceMonitorMemory(t *testing.T) {
+	a, c := makeViceMonitorTester(t)
+
+	set := []uint8{0, 0x00, 0x20, 0x02, 0x20, 0, 0, 0, 0x11, 0x22, 0x33}
+	_, errorCode, _ := c.request(viceCmdMemorySet, set)
+	if errorCode != viceErrorOk {
+		t.Fatalf("Memory set failed with error %02x", errorCode)
+	}
+	if a.mmu.Peek(0x2001) != 0x22 {
+		t.Error("The memory should be written")
+	}
+
+	get := []uint8{0, 0x00, 0x20, 0x02, 0x20, 0, 0, 0}
+	_, errorCode, response := c.request(viceCmdMemoryGet, get)
+	if errorCode != viceErrorOk {
+		t.Fatalf("Memory get failed with error %02x", errorCode)
+	}
+	if len(response) != 5 || response[0] != 3 || response[2] != 0x11 || response[4] != 0x33 {
+		t.Errorf("Unexpected memory get response %v", response)
+	}
+}
+
+func TestViceMonitorRegisters(t *testing.T) {
+	a, c := makeViceMonitorTester(t)
+
+	set := []uint8{0, 2, 0,
+		3, viceRegA, 0x42, 0x00,
+		3, viceRegPC, 0x00, 0x03,
+	}
+	responseType, errorCode, _ := c.request(viceCmdRegistersSet, set)
+	if responseType != viceCmdRegistersGet || errorCode != viceErrorOk {
+		t.Fatalf("Registers set failed, type %02x, error %02x", responseType, errorCode)
+	}
+
+	regA, _, _, _ := a.cpu.GetAXYP()
+	pc, _ := a.cpu.GetPCAndSP()
+	if regA != 0x42 || pc != 0x0300 {
+		t.Errorf("The registers should be updated, got A=%02x, PC=%04x", regA, pc)
+	}
+
+	_, _, response := c.request(viceCmdRegistersGet, []uint8{0})
+	if binary.LittleEndian.Uint16(response) != uint16(len(viceRegisterNames)) {
+		t.Errorf("Unexpected registers count on %v", response)
+	}
+}
+
+func TestViceMonitorCheckpoints(t *testing.T) {
+	a, c := makeViceMonitorTester(t)
+
+	set := []uint8{0x00, 0x03, 0x00, 0x03, 1, 1, viceOperationExec, 0}
+	_, errorCode, response := c.request(viceCmdCheckpointSet, set)
+	if errorCode != viceErrorOk {
+		t.Fatalf("Checkpoint set failed with error %02x", errorCode)
+	}
+	id := binary.LittleEndian.Uint32(response)
+	if len(a.debugger.GetBreakpoints()) != 1 {
+		t.Error("The checkpoint should add a breakpoint")
+	}
+
+	_, errorCode, _ = c.request(viceCmdConditionSet, append(binary.LittleEndian.AppendUint32(nil, id), 4, 'A', '=', '=', '1'))
+	if errorCode != viceErrorOk {
+		t.Errorf("Condition set failed with error %02x", errorCode)
+	}
+	if a.debugger.GetBreakpoints()[0].Condition != "A==1" {
+		t.Error("The breakpoint should have the condition")
+	}
+
+	_, errorCode, _ = c.request(viceCmdCheckpointDelete, binary.LittleEndian.AppendUint32(nil, id))
+	if errorCode != viceErrorOk {
+		t.Errorf("Checkpoint delete failed with error %02x", errorCode)
+	}
+	if len(a.debugger.GetBreakpoints()) != 0 {
+		t.Error("The breakpoint should be removed")
+	}
+
+	_, errorCode, _ = c.request(viceCmdCheckpointDelete, binary.LittleEndian.AppendUint32(nil, id))
+	if errorCode != viceErrorNotFound {
+		t.Errorf("Deleting twice should fail, got error %02x", errorCode)
+	}
+}
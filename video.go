@@ -23,6 +23,7 @@ type video struct {
 }
 
 var _ screen.VideoSource = (*video)(nil)
+var _ screen.ScanlineVideoSource = (*video)(nil)
 
 func newVideo(a *Apple2) *video {
 	return &video{a}
@@ -178,3 +179,9 @@ func DumpTextModeAnsi(a *Apple2) string {
 	supportsLowercase := a.hasLowerCase
 	return screen.RenderTextModeAnsi(a.video, is80Columns, isSecondPage, isAltText, supportsLowercase, false)
 }
+
+// GetScanlineVideoModes returns the video mode of each of the visible lines
+// of the last complete frame
+func (v *video) GetScanlineVideoModes() []uint32 {
+	return v.a.scanner.getScanlineVideoModes()
+}
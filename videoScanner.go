@@ -0,0 +1,117 @@
+package izapple2
+
+import (
+	"sync/atomic"
+)
+
+/*
+Video scanner, follows the position of the beam from the CPU cycles.
+
+See:
+
+	"Understanding the Apple IIe", Jim Sather, chapter 5
+	"Inside Apple IIe", page 268
+
+Each scanline takes 65 cycles, 25 of horizontal blanking and 40 showing a
+byte each. A NTSC frame has 262 lines, the first 192 are visible and the
+other 70 are the vertical blanking. The frame starts with the line 0 on
+the cycle 0 and takes 17030 cycles.
+
+The video mode is sampled at the start of the visible part of every line.
+Changing the mode or the page mid-frame, as in split screens and raster
+effects, only affects the lines not yet scanned. The modes of the lines
+of the last complete frame are used to render the screen. The video
+memory is not recorded, all the lines are rendered with its current
+contents.
+*/
+type videoScanner struct {
+	a          *Apple2
+	frame      uint64 // Frame being scanned
+	line       int    // Next line to sample
+	lines      [scannerVisibleLines]uint32
+	lastFrame  atomic.Pointer[[scannerVisibleLines]uint32]
+	nextSample uint64 // Cycle of the start of the visible part of the next line
+}
+
+const (
+	scannerCyclesPerLine  = 65
+	scannerHBlankCycles   = 25
+	scannerVisibleLines   = 192
+	scannerLinesPerFrame  = 262
+	scannerCyclesPerFrame = scannerCyclesPerLine * scannerLinesPerFrame
+	scannerVisibleCycles  = scannerCyclesPerLine * scannerVisibleLines
+)
+
+func newVideoScanner(a *Apple2) *videoScanner {
+	var s videoScanner
+	s.a = a
+	s.sync()
+	return &s
+}
+
+// sync discards the frame being scanned and waits for the next line
+func (s *videoScanner) sync() {
+	cycles := s.a.cycles
+	s.frame = cycles / scannerCyclesPerFrame
+	s.line = int(cycles%scannerCyclesPerFrame) / scannerCyclesPerLine
+	if s.line >= scannerVisibleLines {
+		s.frame++
+		s.line = 0
+	}
+	s.updateNextSample()
+	if s.nextSample <= cycles {
+		s.line++ // The visible part of the current line has started
+		s.updateNextSample()
+	}
+}
+
+func (s *videoScanner) updateNextSample() {
+	s.nextSample = s.frame*scannerCyclesPerFrame +
+		uint64(s.line)*scannerCyclesPerLine + scannerHBlankCycles
+}
+
+// tick is called on every instruction to sample the video mode of the
+// lines reached by the beam
+func (s *videoScanner) tick() {
+	cycles := s.a.cycles
+	if cycles < s.nextSample {
+		if s.nextSample-cycles > scannerCyclesPerFrame {
+			// The cycles went back, like when a state is loaded
+			s.sync()
+		}
+		return
+	}
+	if cycles-s.nextSample >= scannerCyclesPerFrame {
+		// The cycles jumped ahead
+		s.sync()
+		return
+	}
+
+	mode := s.a.video.GetCurrentVideoMode()
+	for s.nextSample <= cycles {
+		s.lines[s.line] = mode
+		s.line++
+		if s.line == scannerVisibleLines {
+			frame := s.lines
+			s.lastFrame.Store(&frame)
+			s.frame++
+			s.line = 0
+		}
+		s.updateNextSample()
+	}
+}
+
+// getScanlineVideoModes returns the video mode of each visible line of the
+// last complete frame, nil if there is none yet
+func (s *videoScanner) getScanlineVideoModes() []uint32 {
+	frame := s.lastFrame.Load()
+	if frame == nil {
+		return nil
+	}
+	return frame[:]
+}
+
+// isVerticalBlank returns true when the beam is on the vertical blanking
+func (s *videoScanner) isVerticalBlank() bool {
+	return s.a.GetCycles()%scannerCyclesPerFrame >= scannerVisibleCycles
+}
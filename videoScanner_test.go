@@ -0,0 +1,57 @@
+package izapple2
+
+import (
+	"testing"
+
+	"github.com/ivanizag/izapple2/screen"
+)
+
+func makeVideoScannerTester(t *testing.T) *Apple2 {
+	at, err := makeApple2Tester("2enh", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return at.a
+}
+
+func TestVideoScannerMidFrameModeChange(t *testing.T) {
+	a := makeVideoScannerTester(t)
+	a.cycles = 0
+	a.scanner.sync()
+
+	a.mmu.Peek(0xc050) // Graphics
+	a.mmu.Peek(0xc057) // Hi-res
+	a.cycles = 100*scannerCyclesPerLine + scannerHBlankCycles
+	a.scanner.tick()
+	a.mmu.Peek(0xc051) // Text
+	a.cycles = scannerVisibleCycles
+	a.scanner.tick()
+
+	modes := a.scanner.getScanlineVideoModes()
+	if modes == nil {
+		t.Fatal("The frame should be complete")
+	}
+	if base := modes[100] & screen.VideoBaseMask; base != screen.VideoHGR {
+		t.Errorf("The line 100 should be HGR, got 0x%x", base)
+	}
+	if base := modes[101] & screen.VideoBaseMask; base != screen.VideoText40 {
+		t.Errorf("The line 101 should be text, got 0x%x", base)
+	}
+}
+
+func TestVideoScannerVerticalBlank(t *testing.T) {
+	a := makeVideoScannerTester(t)
+
+	a.cycles = 5 * scannerCyclesPerFrame
+	if a.mmu.Peek(0xc019)&0x80 == 0 {
+		t.Errorf("RDVBLBAR should be set while drawing the lines")
+	}
+	a.cycles += scannerVisibleCycles
+	if a.mmu.Peek(0xc019)&0x80 != 0 {
+		t.Errorf("RDVBLBAR should be clear on the vertical blanking")
+	}
+	a.cycles += scannerCyclesPerFrame - scannerVisibleCycles
+	if a.mmu.Peek(0xc019)&0x80 == 0 {
+		t.Errorf("RDVBLBAR should be set on the next frame")
+	}
+}